@@ -7,5 +7,5 @@ var ph=Object.defineProperty;var xh=(s,t,e)=>t in s?ph(s,t,{enumerable:!0,config
 `,""),s.push(t,""),s}class rf{constructor(t,e,i,n,r){this.overlaps=i,this.pixelRatio=e,this.resolution=t,this.alignAndScaleFill_,this.instructions=n.instructions,this.coordinates=n.coordinates,this.coordinateCache_={},this.renderedTransform_=te(),this.hitDetectionInstructions=n.hitDetectionInstructions,this.pixelCoordinates_=null,this.viewRotation_=0,this.fillStates=n.fillStates||{},this.strokeStates=n.strokeStates||{},this.textStates=n.textStates||{},this.widths_={},this.labels_={},this.zIndexContext_=r?new $l:null}getZIndexContext(){return this.zIndexContext_}createLabel(t,e,i,n){const r=t+e+i+n;if(this.labels_[r])return this.labels_[r];const o=n?this.strokeStates[n]:null,a=i?this.fillStates[i]:null,l=this.textStates[e],h=this.pixelRatio,c=[l.scale[0]*h,l.scale[1]*h],u=Array.isArray(t),d=l.justify?ws[l.justify]:fr(Array.isArray(t)?t[0]:t,l.textAlign||Tn),f=n&&o.lineWidth?o.lineWidth:0,g=u?t:t.split(`
 `).reduce(sf,[]),{width:_,height:m,widths:y,heights:p,lineWidths:x}=hu(l,g),E=_+f,C=[],R=(E+2)*c[0],I=(m+f)*c[1],T={width:R<0?Math.floor(R):Math.ceil(R),height:I<0?Math.floor(I):Math.ceil(I),contextInstructions:C};(c[0]!=1||c[1]!=1)&&C.push("scale",c),n&&(C.push("strokeStyle",o.strokeStyle),C.push("lineWidth",f),C.push("lineCap",o.lineCap),C.push("lineJoin",o.lineJoin),C.push("miterLimit",o.miterLimit),C.push("setLineDash",[o.lineDash]),C.push("lineDashOffset",o.lineDashOffset)),i&&C.push("fillStyle",a.fillStyle),C.push("textBaseline","middle"),C.push("textAlign","center");const S=.5-d;let z=d*E+S*f;const O=[],N=[];let U=0,V=0,Y=0,L=0,D;for(let X=0,nt=g.length;X<nt;X+=2){const Z=g[X];if(Z===`
 `){V+=U,U=0,z=d*E+S*f,++L;continue}const Q=g[X+1]||l.font;Q!==D&&(n&&O.push("font",Q),i&&N.push("font",Q),D=Q),U=Math.max(U,p[Y]);const $=[Z,z+S*y[Y]+d*(y[Y]-x[L]),.5*(f+U)+V];z+=y[Y],n&&O.push("strokeText",$),i&&N.push("fillText",$),++Y}return Array.prototype.push.apply(C,O),Array.prototype.push.apply(C,N),this.labels_[r]=T,T}replayTextBackground_(t,e,i,n,r,o,a){t.beginPath(),t.moveTo.apply(t,e),t.lineTo.apply(t,i),t.lineTo.apply(t,n),t.lineTo.apply(t,r),t.lineTo.apply(t,e),o&&(this.alignAndScaleFill_=o[2],this.fill_(t)),a&&(this.setStrokeStyle_(t,a),t.stroke())}calculateImageOrLabelDimensions_(t,e,i,n,r,o,a,l,h,c,u,d,f,g,_,m){a*=d[0],l*=d[1];let y=i-a,p=n-l;const x=r+h>t?t-h:r,E=o+c>e?e-c:o,C=g[3]+x*d[0]+g[1],R=g[0]+E*d[1]+g[2],I=y-g[3],T=p-g[0];(_||u!==0)&&(De[0]=I,Oe[0]=I,De[1]=T,ye[1]=T,ye[0]=I+C,pe[0]=ye[0],pe[1]=T+R,Oe[1]=pe[1]);let S;return u!==0?(S=ue(te(),i,n,1,1,u,-i,-n),gt(S,De),gt(S,ye),gt(S,pe),gt(S,Oe),Le(Math.min(De[0],ye[0],pe[0],Oe[0]),Math.min(De[1],ye[1],pe[1],Oe[1]),Math.max(De[0],ye[0],pe[0],Oe[0]),Math.max(De[1],ye[1],pe[1],Oe[1]),pi)):Le(Math.min(I,I+C),Math.min(T,T+R),Math.max(I,I+C),Math.max(T,T+R),pi),f&&(y=Math.round(y),p=Math.round(p)),{drawImageX:y,drawImageY:p,drawImageW:x,drawImageH:E,originX:h,originY:c,declutterBox:{minX:pi[0],minY:pi[1],maxX:pi[2],maxY:pi[3],value:m},canvasTransform:S,scale:d}}replayImageOrLabel_(t,e,i,n,r,o,a){const l=!!(o||a),h=n.declutterBox,c=a?a[2]*n.scale[0]/2:0;return h.minX-c<=e[0]&&h.maxX+c>=0&&h.minY-c<=e[1]&&h.maxY+c>=0&&(l&&this.replayTextBackground_(t,De,ye,pe,Oe,o,a),cu(t,n.canvasTransform,r,i,n.originX,n.originY,n.drawImageW,n.drawImageH,n.drawImageX,n.drawImageY,n.scale)),!0}fill_(t){const e=this.alignAndScaleFill_;if(e){const i=gt(this.renderedTransform_,[0,0]),n=512*this.pixelRatio;t.save(),t.translate(i[0]%n,i[1]%n),e!==1&&t.scale(e,e),t.rotate(this.viewRotation_)}t.fill(),e&&t.restore()}setStrokeStyle_(t,e){t.strokeStyle=e[1],t.lineWidth=e[2],t.lineCap=e[3],t.lineJoin=e[4],t.miterLimit=e[5],t.lineDashOffset=e[7],t.setLineDash(e[6])}drawLabelWithPointPlacement_(t,e,i,n){const r=this.textStates[e],o=this.createLabel(t,e,n,i),a=this.strokeStates[i],l=this.pixelRatio,h=fr(Array.isArray(t)?t[0]:t,r.textAlign||Tn),c=ws[r.textBaseline||gs],u=a&&a.lineWidth?a.lineWidth:0,d=o.width/l-2*r.scale[0],f=h*d+2*(.5-h)*u,g=c*o.height/l+2*(.5-c)*u;return{label:o,anchorX:f,anchorY:g}}execute_(t,e,i,n,r,o,a,l){const h=this.zIndexContext_;let c;this.pixelCoordinates_&&Me(i,this.renderedTransform_)?c=this.pixelCoordinates_:(this.pixelCoordinates_||(this.pixelCoordinates_=[]),c=Be(this.coordinates,0,this.coordinates.length,2,i,this.pixelCoordinates_),cc(this.renderedTransform_,i));let u=0;const d=n.length;let f=0,g,_,m,y,p,x,E,C,R,I,T,S,z,O=0,N=0,U=null,V=null;const Y=this.coordinateCache_,L=this.viewRotation_,D=Math.round(Math.atan2(-i[1],i[0])*1e12)/1e12,X={context:t,pixelRatio:this.pixelRatio,resolution:this.resolution,rotation:L},nt=this.instructions!=n||this.overlaps?0:200;let Z,Q,$,ht;for(;u<d;){const v=n[u];switch(v[0]){case M.BEGIN_GEOMETRY:Z=v[1],ht=v[3],Z.getGeometry()?a!==void 0&&!It(a,ht.getExtent())?u=v[2]+1:++u:u=v[2],h&&(h.zIndex=v[4]);break;case M.BEGIN_PATH:O>nt&&(this.fill_(t),O=0),N>nt&&(t.stroke(),N=0),!O&&!N&&(t.beginPath(),p=NaN,x=NaN),++u;break;case M.CIRCLE:f=v[1];const bt=c[f],dt=c[f+1],Lt=c[f+2],Kt=c[f+3],Pt=Lt-bt,Hi=Kt-dt,qe=Math.sqrt(Pt*Pt+Hi*Hi);t.moveTo(bt+qe,dt),t.arc(bt,dt,qe,0,2*Math.PI,!0),++u;break;case M.CLOSE_PATH:t.closePath(),++u;break;case M.CUSTOM:f=v[1],g=v[2];const Ks=v[3],Nn=v[4],zn=v[5];X.geometry=Ks,X.feature=Z,u in Y||(Y[u]=[]);const Yt=Y[u];zn?zn(c,f,g,2,Yt):(Yt[0]=c[f],Yt[1]=c[f+1],Yt.length=2),h&&(h.zIndex=v[6]),Nn(Yt,X),++u;break;case M.DRAW_IMAGE:f=v[1],g=v[2],R=v[3],_=v[4],m=v[5];let fi=v[6];const Xn=v[7],qs=v[8],Wn=v[9],Yn=v[10];let Dt=v[11];const qt=v[12];let ne=v[13];y=v[14]||"declutter";const Ht=v[15];if(!R&&v.length>=20){I=v[19],T=v[20],S=v[21],z=v[22];const jt=this.drawLabelWithPointPlacement_(I,T,S,z);R=jt.label,v[3]=R;const He=v[23];_=(jt.anchorX-He)*this.pixelRatio,v[4]=_;const Bt=v[24];m=(jt.anchorY-Bt)*this.pixelRatio,v[5]=m,fi=R.height,v[6]=fi,ne=R.width,v[13]=ne}let gi;v.length>25&&(gi=v[25]);let _i,Ae,fe;v.length>17?(_i=v[16],Ae=v[17],fe=v[18]):(_i=ii,Ae=!1,fe=!1),Yn&&D?Dt+=L:!Yn&&!D&&(Dt-=L);let Hs=0;for(;f<g;f+=2){if(gi&&gi[Hs++]<ne/this.pixelRatio)continue;const jt=this.calculateImageOrLabelDimensions_(R.width,R.height,c[f],c[f+1],ne,fi,_,m,qs,Wn,Dt,qt,r,_i,Ae||fe,Z),He=[t,e,R,jt,Xn,Ae?U:null,fe?V:null];if(l){let Bt,se,Vt;if(Ht){const ot=g-f;if(!Ht[ot]){Ht[ot]={args:He,declutterMode:y};continue}const Rt=Ht[ot];Bt=Rt.args,se=Rt.declutterMode,delete Ht[ot],Vt=Fa(Bt)}let ge,_e;if(Bt&&(se!=="declutter"||!l.collides(Vt))&&(ge=!0),(y!=="declutter"||!l.collides(jt.declutterBox))&&(_e=!0),se==="declutter"&&y==="declutter"){const ot=ge&&_e;ge=ot,_e=ot}ge&&(se!=="none"&&l.insert(Vt),this.replayImageOrLabel_.apply(this,Bt)),_e&&(y!=="none"&&l.insert(jt.declutterBox),this.replayImageOrLabel_.apply(this,He))}else this.replayImageOrLabel_.apply(this,He)}++u;break;case M.DRAW_CHARS:const vt=v[1],jo=v[2],$s=v[3],_h=v[4];z=v[5];const mh=v[6],Bo=v[7],Vo=v[8];S=v[9];const Js=v[10];I=v[11],T=v[12];const Uo=[v[13],v[13]];y=v[14]||"declutter";const Qs=this.textStates[T],$i=Qs.font,Ji=[Qs.scale[0]*Bo,Qs.scale[1]*Bo];let Qi;$i in this.widths_?Qi=this.widths_[$i]:(Qi={},this.widths_[$i]=Qi);const Zo=Kl(c,vt,jo,2),Ko=Math.abs(Ji[0])*xa($i,I,Qi);if(_h||Ko<=Zo){const jt=this.textStates[T].textAlign,He=(Zo-Ko)*fr(I,jt),Bt=nf(c,vt,jo,2,I,He,mh,Math.abs(Ji[0]),xa,$i,Qi,D?0:this.viewRotation_);t:if(Bt){const se=[];let Vt,ge,_e,ot,Rt;if(S)for(Vt=0,ge=Bt.length;Vt<ge;++Vt){Rt=Bt[Vt],_e=Rt[4],ot=this.createLabel(_e,T,"",S),_=Rt[2]+(Ji[0]<0?-Js:Js),m=$s*ot.height+(.5-$s)*2*Js*Ji[1]/Ji[0]-Vo;const me=this.calculateImageOrLabelDimensions_(ot.width,ot.height,Rt[0],Rt[1],ot.width,ot.height,_,m,0,0,Rt[3],Uo,!1,ii,!1,Z);if(l&&y==="declutter"&&l.collides(me.declutterBox))break t;se.push([t,e,ot,me,1,null,null])}if(z)for(Vt=0,ge=Bt.length;Vt<ge;++Vt){Rt=Bt[Vt],_e=Rt[4],ot=this.createLabel(_e,T,z,""),_=Rt[2],m=$s*ot.height-Vo;const me=this.calculateImageOrLabelDimensions_(ot.width,ot.height,Rt[0],Rt[1],ot.width,ot.height,_,m,0,0,Rt[3],Uo,!1,ii,!1,Z);if(l&&y==="declutter"&&l.collides(me.declutterBox))break t;se.push([t,e,ot,me,1,null,null])}l&&y!=="none"&&l.load(se.map(Fa));for(let me=0,yh=se.length;me<yh;++me)this.replayImageOrLabel_.apply(this,se[me])}}++u;break;case M.END_GEOMETRY:if(o!==void 0){Z=v[1];const jt=o(Z,ht);if(jt)return jt}++u;break;case M.FILL:nt?O++:this.fill_(t),++u;break;case M.MOVE_TO_LINE_TO:for(f=v[1],g=v[2],Q=c[f],$=c[f+1],E=Q+.5|0,C=$+.5|0,(E!==p||C!==x)&&(t.moveTo(Q,$),p=E,x=C),f+=2;f<g;f+=2)Q=c[f],$=c[f+1],E=Q+.5|0,C=$+.5|0,(f==g-2||E!==p||C!==x)&&(t.lineTo(Q,$),p=E,x=C);++u;break;case M.SET_FILL_STYLE:U=v,this.alignAndScaleFill_=v[2],O&&(this.fill_(t),O=0,N&&(t.stroke(),N=0)),t.fillStyle=v[1],++u;break;case M.SET_STROKE_STYLE:V=v,N&&(t.stroke(),N=0),this.setStrokeStyle_(t,v),++u;break;case M.STROKE:nt?N++:t.stroke(),++u;break;default:++u;break}}O&&this.fill_(t),N&&t.stroke()}execute(t,e,i,n,r,o){this.viewRotation_=n,this.execute_(t,e,i,this.instructions,r,void 0,void 0,o)}executeHitDetection(t,e,i,n,r){return this.viewRotation_=i,this.execute_(t,[t.canvas.width,t.canvas.height],e,this.hitDetectionInstructions,!0,n,r)}}const un=["Polygon","Circle","LineString","Image","Text","Default"],Ql=["Image","Text"],of=un.filter(s=>!Ql.includes(s));class af{constructor(t,e,i,n,r,o,a){this.maxExtent_=t,this.overlaps_=n,this.pixelRatio_=i,this.resolution_=e,this.renderBuffer_=o,this.executorsByZIndex_={},this.hitDetectionContext_=null,this.hitDetectionTransform_=te(),this.renderedContext_=null,this.deferredZIndexContexts_={},this.createExecutors_(r,a)}clip(t,e){const i=this.getClipCoords(e);t.beginPath(),t.moveTo(i[0],i[1]),t.lineTo(i[2],i[3]),t.lineTo(i[4],i[5]),t.lineTo(i[6],i[7]),t.clip()}createExecutors_(t,e){for(const i in t){let n=this.executorsByZIndex_[i];n===void 0&&(n={},this.executorsByZIndex_[i]=n);const r=t[i];for(const o in r){const a=r[o];n[o]=new rf(this.resolution_,this.pixelRatio_,this.overlaps_,a,e)}}}hasExecutors(t){for(const e in this.executorsByZIndex_){const i=this.executorsByZIndex_[e];for(let n=0,r=t.length;n<r;++n)if(t[n]in i)return!0}return!1}forEachFeatureAtCoordinate(t,e,i,n,r,o){n=Math.round(n);const a=n*2+1,l=ue(this.hitDetectionTransform_,n+.5,n+.5,1/e,-1/e,-i,-t[0],-t[1]),h=!this.hitDetectionContext_;h&&(this.hitDetectionContext_=yt(a,a,void 0,{willReadFrequently:!0}));const c=this.hitDetectionContext_;c.canvas.width!==a||c.canvas.height!==a?(c.canvas.width=a,c.canvas.height=a):h||c.clearRect(0,0,a,a);let u;this.renderBuffer_!==void 0&&(u=Xt(),hn(u,t),Mn(u,e*(this.renderBuffer_+n),u));const d=lf(n);let f;function g(C,R){const I=c.getImageData(0,0,a,a).data;for(let T=0,S=d.length;T<S;T++)if(I[d[T]]>0){if(!o||f!=="Image"&&f!=="Text"||o.includes(C)){const z=(d[T]-3)/4,O=n-z%a,N=n-(z/a|0),U=r(C,R,O*O+N*N);if(U)return U}c.clearRect(0,0,a,a);break}}const _=Object.keys(this.executorsByZIndex_).map(Number);_.sort(we);let m,y,p,x,E;for(m=_.length-1;m>=0;--m){const C=_[m].toString();for(p=this.executorsByZIndex_[C],y=un.length-1;y>=0;--y)if(f=un[y],x=p[f],x!==void 0&&(E=x.executeHitDetection(c,l,i,g,u),E))return E}}getClipCoords(t){const e=this.maxExtent_;if(!e)return null;const i=e[0],n=e[1],r=e[2],o=e[3],a=[i,n,i,o,r,o,r,n];return Be(a,0,8,2,t,a),a}isEmpty(){return oi(this.executorsByZIndex_)}execute(t,e,i,n,r,o,a){const l=Object.keys(this.executorsByZIndex_).map(Number);l.sort(we),o=o||un;let h,c,u,d,f,g;for(a&&l.reverse(),h=0,c=l.length;h<c;++h){const _=l[h].toString();for(f=this.executorsByZIndex_[_],u=0,d=o.length;u<d;++u){const m=o[u];if(g=f[m],g!==void 0){const y=a===null?void 0:g.getZIndexContext(),p=y?y.getContext():t,x=this.maxExtent_&&m!=="Image"&&m!=="Text";if(x&&(p.save(),this.clip(p,i)),g.execute(p,e,i,n,r,a),x&&p.restore(),y){y.offset();const E=l[h];this.deferredZIndexContexts_[E]||(this.deferredZIndexContexts_[E]=[]),this.deferredZIndexContexts_[E].push(y)}}}}this.renderedContext_=t}getDeferredZIndexContexts(){return this.deferredZIndexContexts_}getRenderedContext(){return this.renderedContext_}renderDeferred(){const t=this.deferredZIndexContexts_,e=Object.keys(t).map(Number).sort(we);for(let i=0,n=e.length;i<n;++i)t[e[i]].forEach(r=>{r.draw(this.renderedContext_),r.clear()})}}const gr={};function lf(s){if(gr[s]!==void 0)return gr[s];const t=s*2+1,e=s*s,i=new Array(e+1);for(let r=0;r<=s;++r)for(let o=0;o<=s;++o){const a=r*r+o*o;if(a>e)break;let l=i[a];l||(l=[],i[a]=l),l.push(((s+r)*t+(s+o))*4+3),r>0&&l.push(((s-r)*t+(s+o))*4+3),o>0&&(l.push(((s+r)*t+(s-o))*4+3),r>0&&l.push(((s-r)*t+(s-o))*4+3))}const n=[];for(let r=0,o=i.length;r<o;++r)i[r]&&n.push(...i[r]);return gr[s]=n,n}class hf extends Hl{constructor(t,e,i,n,r,o,a){super(),this.context_=t,this.pixelRatio_=e,this.extent_=i,this.transform_=n,this.transformRotation_=n?Rs(Math.atan2(n[1],n[0]),10):0,this.viewRotation_=r,this.squaredTolerance_=o,this.userTransform_=a,this.contextFillState_=null,this.contextStrokeState_=null,this.contextTextState_=null,this.fillState_=null,this.strokeState_=null,this.image_=null,this.imageAnchorX_=0,this.imageAnchorY_=0,this.imageHeight_=0,this.imageOpacity_=0,this.imageOriginX_=0,this.imageOriginY_=0,this.imageRotateWithView_=!1,this.imageRotation_=0,this.imageScale_=[0,0],this.imageWidth_=0,this.text_="",this.textOffsetX_=0,this.textOffsetY_=0,this.textRotateWithView_=!1,this.textRotation_=0,this.textScale_=[0,0],this.textFillState_=null,this.textStrokeState_=null,this.textState_=null,this.pixelCoordinates_=[],this.tmpLocalTransform_=te()}drawImages_(t,e,i,n){if(!this.image_)return;const r=Be(t,e,i,n,this.transform_,this.pixelCoordinates_),o=this.context_,a=this.tmpLocalTransform_,l=o.globalAlpha;this.imageOpacity_!=1&&(o.globalAlpha=l*this.imageOpacity_);let h=this.imageRotation_;this.transformRotation_===0&&(h-=this.viewRotation_),this.imageRotateWithView_&&(h+=this.viewRotation_);for(let c=0,u=r.length;c<u;c+=2){const d=r[c]-this.imageAnchorX_,f=r[c+1]-this.imageAnchorY_;if(h!==0||this.imageScale_[0]!=1||this.imageScale_[1]!=1){const g=d+this.imageAnchorX_,_=f+this.imageAnchorY_;ue(a,g,_,1,1,h,-g,-_),o.save(),o.transform.apply(o,a),o.translate(g,_),o.scale(this.imageScale_[0],this.imageScale_[1]),o.drawImage(this.image_,this.imageOriginX_,this.imageOriginY_,this.imageWidth_,this.imageHeight_,-this.imageAnchorX_,-this.imageAnchorY_,this.imageWidth_,this.imageHeight_),o.restore()}else o.drawImage(this.image_,this.imageOriginX_,this.imageOriginY_,this.imageWidth_,this.imageHeight_,d,f,this.imageWidth_,this.imageHeight_)}this.imageOpacity_!=1&&(o.globalAlpha=l)}drawText_(t,e,i,n){if(!this.textState_||this.text_==="")return;this.textFillState_&&this.setContextFillState_(this.textFillState_),this.textStrokeState_&&this.setContextStrokeState_(this.textStrokeState_),this.setContextTextState_(this.textState_);const r=Be(t,e,i,n,this.transform_,this.pixelCoordinates_),o=this.context_;let a=this.textRotation_;for(this.transformRotation_===0&&(a-=this.viewRotation_),this.textRotateWithView_&&(a+=this.viewRotation_);e<i;e+=n){const l=r[e]+this.textOffsetX_,h=r[e+1]+this.textOffsetY_;a!==0||this.textScale_[0]!=1||this.textScale_[1]!=1?(o.save(),o.translate(l-this.textOffsetX_,h-this.textOffsetY_),o.rotate(a),o.translate(this.textOffsetX_,this.textOffsetY_),o.scale(this.textScale_[0],this.textScale_[1]),this.textStrokeState_&&o.strokeText(this.text_,0,0),this.textFillState_&&o.fillText(this.text_,0,0),o.restore()):(this.textStrokeState_&&o.strokeText(this.text_,l,h),this.textFillState_&&o.fillText(this.text_,l,h))}}moveToLineTo_(t,e,i,n,r){const o=this.context_,a=Be(t,e,i,n,this.transform_,this.pixelCoordinates_);o.moveTo(a[0],a[1]);let l=a.length;r&&(l-=2);for(let h=2;h<l;h+=2)o.lineTo(a[h],a[h+1]);return r&&o.closePath(),i}drawRings_(t,e,i,n){for(let r=0,o=i.length;r<o;++r)e=this.moveToLineTo_(t,e,i[r],n,!0);return e}drawCircle(t){if(this.squaredTolerance_&&(t=t.simplifyTransformed(this.squaredTolerance_,this.userTransform_)),!!It(this.extent_,t.getExtent())){if(this.fillState_||this.strokeState_){this.fillState_&&this.setContextFillState_(this.fillState_),this.strokeState_&&this.setContextStrokeState_(this.strokeState_);const e=gc(t,this.transform_,this.pixelCoordinates_),i=e[2]-e[0],n=e[3]-e[1],r=Math.sqrt(i*i+n*n),o=this.context_;o.beginPath(),o.arc(e[0],e[1],r,0,2*Math.PI),this.fillState_&&o.fill(),this.strokeState_&&o.stroke()}this.text_!==""&&this.drawText_(t.getCenter(),0,2,2)}}setStyle(t){this.setFillStrokeStyle(t.getFill(),t.getStroke()),this.setImageStyle(t.getImage()),this.setTextStyle(t.getText())}setTransform(t){this.transform_=t}drawGeometry(t){switch(t.getType()){case"Point":this.drawPoint(t);break;case"LineString":this.drawLineString(t);break;case"Polygon":this.drawPolygon(t);break;case"MultiPoint":this.drawMultiPoint(t);break;case"MultiLineString":this.drawMultiLineString(t);break;case"MultiPolygon":this.drawMultiPolygon(t);break;case"GeometryCollection":this.drawGeometryCollection(t);break;case"Circle":this.drawCircle(t);break}}drawFeature(t,e){const i=e.getGeometryFunction()(t);i&&(this.setStyle(e),this.drawGeometry(i))}drawGeometryCollection(t){const e=t.getGeometriesArray();for(let i=0,n=e.length;i<n;++i)this.drawGeometry(e[i])}drawPoint(t){this.squaredTolerance_&&(t=t.simplifyTransformed(this.squaredTolerance_,this.userTransform_));const e=t.getFlatCoordinates(),i=t.getStride();this.image_&&this.drawImages_(e,0,e.length,i),this.text_!==""&&this.drawText_(e,0,e.length,i)}drawMultiPoint(t){this.squaredTolerance_&&(t=t.simplifyTransformed(this.squaredTolerance_,this.userTransform_));const e=t.getFlatCoordinates(),i=t.getStride();this.image_&&this.drawImages_(e,0,e.length,i),this.text_!==""&&this.drawText_(e,0,e.length,i)}drawLineString(t){if(this.squaredTolerance_&&(t=t.simplifyTransformed(this.squaredTolerance_,this.userTransform_)),!!It(this.extent_,t.getExtent())){if(this.strokeState_){this.setContextStrokeState_(this.strokeState_);const e=this.context_,i=t.getFlatCoordinates();e.beginPath(),this.moveToLineTo_(i,0,i.length,t.getStride(),!1),e.stroke()}if(this.text_!==""){const e=t.getFlatMidpoint();this.drawText_(e,0,2,2)}}}drawMultiLineString(t){this.squaredTolerance_&&(t=t.simplifyTransformed(this.squaredTolerance_,this.userTransform_));const e=t.getExtent();if(It(this.extent_,e)){if(this.strokeState_){this.setContextStrokeState_(this.strokeState_);const i=this.context_,n=t.getFlatCoordinates();let r=0;const o=t.getEnds(),a=t.getStride();i.beginPath();for(let l=0,h=o.length;l<h;++l)r=this.moveToLineTo_(n,r,o[l],a,!1);i.stroke()}if(this.text_!==""){const i=t.getFlatMidpoints();this.drawText_(i,0,i.length,2)}}}drawPolygon(t){if(this.squaredTolerance_&&(t=t.simplifyTransformed(this.squaredTolerance_,this.userTransform_)),!!It(this.extent_,t.getExtent())){if(this.strokeState_||this.fillState_){this.fillState_&&this.setContextFillState_(this.fillState_),this.strokeState_&&this.setContextStrokeState_(this.strokeState_);const e=this.context_;e.beginPath(),this.drawRings_(t.getOrientedFlatCoordinates(),0,t.getEnds(),t.getStride()),this.fillState_&&e.fill(),this.strokeState_&&e.stroke()}if(this.text_!==""){const e=t.getFlatInteriorPoint();this.drawText_(e,0,2,2)}}}drawMultiPolygon(t){if(this.squaredTolerance_&&(t=t.simplifyTransformed(this.squaredTolerance_,this.userTransform_)),!!It(this.extent_,t.getExtent())){if(this.strokeState_||this.fillState_){this.fillState_&&this.setContextFillState_(this.fillState_),this.strokeState_&&this.setContextStrokeState_(this.strokeState_);const e=this.context_,i=t.getOrientedFlatCoordinates();let n=0;const r=t.getEndss(),o=t.getStride();e.beginPath();for(let a=0,l=r.length;a<l;++a){const h=r[a];n=this.drawRings_(i,n,h,o)}this.fillState_&&e.fill(),this.strokeState_&&e.stroke()}if(this.text_!==""){const e=t.getFlatInteriorPoints();this.drawText_(e,0,e.length,2)}}}setContextFillState_(t){const e=this.context_,i=this.contextFillState_;i?i.fillStyle!=t.fillStyle&&(i.fillStyle=t.fillStyle,e.fillStyle=t.fillStyle):(e.fillStyle=t.fillStyle,this.contextFillState_={fillStyle:t.fillStyle})}setContextStrokeState_(t){const e=this.context_,i=this.contextStrokeState_;i?(i.lineCap!=t.lineCap&&(i.lineCap=t.lineCap,e.lineCap=t.lineCap),Me(i.lineDash,t.lineDash)||e.setLineDash(i.lineDash=t.lineDash),i.lineDashOffset!=t.lineDashOffset&&(i.lineDashOffset=t.lineDashOffset,e.lineDashOffset=t.lineDashOffset),i.lineJoin!=t.lineJoin&&(i.lineJoin=t.lineJoin,e.lineJoin=t.lineJoin),i.lineWidth!=t.lineWidth&&(i.lineWidth=t.lineWidth,e.lineWidth=t.lineWidth),i.miterLimit!=t.miterLimit&&(i.miterLimit=t.miterLimit,e.miterLimit=t.miterLimit),i.strokeStyle!=t.strokeStyle&&(i.strokeStyle=t.strokeStyle,e.strokeStyle=t.strokeStyle)):(e.lineCap=t.lineCap,e.setLineDash(t.lineDash),e.lineDashOffset=t.lineDashOffset,e.lineJoin=t.lineJoin,e.lineWidth=t.lineWidth,e.miterLimit=t.miterLimit,e.strokeStyle=t.strokeStyle,this.contextStrokeState_={lineCap:t.lineCap,lineDash:t.lineDash,lineDashOffset:t.lineDashOffset,lineJoin:t.lineJoin,lineWidth:t.lineWidth,miterLimit:t.miterLimit,strokeStyle:t.strokeStyle})}setContextTextState_(t){const e=this.context_,i=this.contextTextState_,n=t.textAlign?t.textAlign:Tn;i?(i.font!=t.font&&(i.font=t.font,e.font=t.font),i.textAlign!=n&&(i.textAlign=n,e.textAlign=n),i.textBaseline!=t.textBaseline&&(i.textBaseline=t.textBaseline,e.textBaseline=t.textBaseline)):(e.font=t.font,e.textAlign=n,e.textBaseline=t.textBaseline,this.contextTextState_={font:t.font,textAlign:n,textBaseline:t.textBaseline})}setFillStrokeStyle(t,e){if(!t)this.fillState_=null;else{const i=t.getColor();this.fillState_={fillStyle:le(i||Ft)}}if(!e)this.strokeState_=null;else{const i=e.getColor(),n=e.getLineCap(),r=e.getLineDash(),o=e.getLineDashOffset(),a=e.getLineJoin(),l=e.getWidth(),h=e.getMiterLimit(),c=r||Re;this.strokeState_={lineCap:n!==void 0?n:Xi,lineDash:this.pixelRatio_===1?c:c.map(u=>u*this.pixelRatio_),lineDashOffset:(o||Se)*this.pixelRatio_,lineJoin:a!==void 0?a:Wi,lineWidth:(l!==void 0?l:vn)*this.pixelRatio_,miterLimit:h!==void 0?h:Cn,strokeStyle:le(i||wn)}}}setImageStyle(t){let e;if(!t||!(e=t.getSize())){this.image_=null;return}const i=t.getPixelRatio(this.pixelRatio_),n=t.getAnchor(),r=t.getOrigin();this.image_=t.getImage(this.pixelRatio_),this.imageAnchorX_=n[0]*i,this.imageAnchorY_=n[1]*i,this.imageHeight_=e[1]*i,this.imageOpacity_=t.getOpacity(),this.imageOriginX_=r[0],this.imageOriginY_=r[1],this.imageRotateWithView_=t.getRotateWithView(),this.imageRotation_=t.getRotation();const o=t.getScaleArray();this.imageScale_=[o[0]*this.pixelRatio_/i,o[1]*this.pixelRatio_/i],this.imageWidth_=e[0]*i}setTextStyle(t){if(!t)this.text_="";else{const e=t.getFill();if(!e)this.textFillState_=null;else{const f=e.getColor();this.textFillState_={fillStyle:le(f||Ft)}}const i=t.getStroke();if(!i)this.textStrokeState_=null;else{const f=i.getColor(),g=i.getLineCap(),_=i.getLineDash(),m=i.getLineDashOffset(),y=i.getLineJoin(),p=i.getWidth(),x=i.getMiterLimit();this.textStrokeState_={lineCap:g!==void 0?g:Xi,lineDash:_||Re,lineDashOffset:m||Se,lineJoin:y!==void 0?y:Wi,lineWidth:p!==void 0?p:vn,miterLimit:x!==void 0?x:Cn,strokeStyle:le(f||wn)}}const n=t.getFont(),r=t.getOffsetX(),o=t.getOffsetY(),a=t.getRotateWithView(),l=t.getRotation(),h=t.getScaleArray(),c=t.getText(),u=t.getTextAlign(),d=t.getTextBaseline();this.textState_={font:n!==void 0?n:Ll,textAlign:u!==void 0?u:Tn,textBaseline:d!==void 0?d:gs},this.text_=c!==void 0?Array.isArray(c)?c.reduce((f,g,_)=>f+=_%2?" ":g,""):c:"",this.textOffsetX_=r!==void 0?this.pixelRatio_*r:0,this.textOffsetY_=o!==void 0?this.pixelRatio_*o:0,this.textRotateWithView_=a!==void 0?a:!1,this.textRotation_=l!==void 0?l:0,this.textScale_=[this.pixelRatio_*h[0],this.pixelRatio_*h[1]]}}}const cf=hf,oe=.5;function uf(s,t,e,i,n,r,o,a,l){const h=l?An(n):n,c=s[0]*oe,u=s[1]*oe,d=yt(c,u);d.imageSmoothingEnabled=!1;const f=d.canvas,g=new cf(d,oe,n,null,o,a,l?Ms(ec(),l):null),_=e.length,m=Math.floor((256*256*256-1)/_),y={};for(let x=1;x<=_;++x){const E=e[x-1],C=E.getStyleFunction()||i;if(!C)continue;let R=C(E,r);if(!R)continue;Array.isArray(R)||(R=[R]);const T=(x*m).toString(16).padStart(7,"#00000");for(let S=0,z=R.length;S<z;++S){const O=R[S],N=O.getGeometryFunction()(E);if(!N||!It(h,N.getExtent()))continue;const U=O.clone(),V=U.getFill();V&&V.setColor(T);const Y=U.getStroke();Y&&(Y.setColor(T),Y.setLineDash(null)),U.setText(void 0);const L=O.getImage();if(L){const Z=L.getImageSize();if(!Z)continue;const Q=yt(Z[0],Z[1],void 0,{alpha:!1}),$=Q.canvas;Q.fillStyle=T,Q.fillRect(0,0,$.width,$.height),U.setImage(new zs({img:$,anchor:L.getAnchor(),anchorXUnits:"pixels",anchorYUnits:"pixels",offset:L.getOrigin(),opacity:1,size:L.getSize(),scale:L.getScale(),rotation:L.getRotation(),rotateWithView:L.getRotateWithView()}))}const D=U.getZIndex()||0;let X=y[D];X||(X={},y[D]=X,X.Polygon=[],X.Circle=[],X.LineString=[],X.Point=[]);const nt=N.getType();if(nt==="GeometryCollection"){const Z=N.getGeometriesArrayRecursive();for(let Q=0,$=Z.length;Q<$;++Q){const ht=Z[Q];X[ht.getType().replace("Multi","")].push(ht,U)}}else X[nt.replace("Multi","")].push(N,U)}}const p=Object.keys(y).map(Number).sort(we);for(let x=0,E=p.length;x<E;++x){const C=y[p[x]];for(const R in C){const I=C[R];for(let T=0,S=I.length;T<S;T+=2){g.setStyle(I[T+1]);for(let z=0,O=t.length;z<O;++z)g.setTransform(t[z]),g.drawGeometry(I[T])}}}return d.getImageData(0,0,f.width,f.height)}function df(s,t,e){const i=[];if(e){const n=Math.floor(Math.round(s[0])*oe),r=Math.floor(Math.round(s[1])*oe),o=(ct(n,0,e.width-1)+ct(r,0,e.height-1)*e.width)*4,a=e.data[o],l=e.data[o+1],c=e.data[o+2]+256*(l+256*a),u=Math.floor((256*256*256-1)/t.length);c&&c%u===0&&i.push(t[c/u-1])}return i}const ff=.5,th={Point:Cf,LineString:pf,Polygon:Tf,MultiPoint:wf,MultiLineString:xf,MultiPolygon:Ef,GeometryCollection:yf,Circle:_f};function gf(s,t){return parseInt(G(s),10)-parseInt(G(t),10)}function ba(s,t){const e=eh(s,t);return e*e}function eh(s,t){return ff*s/t}function _f(s,t,e,i,n){const r=e.getFill(),o=e.getStroke();if(r||o){const l=s.getBuilder(e.getZIndex(),"Circle");l.setFillStrokeStyle(r,o),l.drawCircle(t,i,n)}const a=e.getText();if(a&&a.getText()){const l=s.getBuilder(e.getZIndex(),"Text");l.setTextStyle(a),l.drawText(t,i)}}function Da(s,t,e,i,n,r,o,a){const l=[],h=e.getImage();if(h){let d=!0;const f=h.getImageState();f==j.LOADED||f==j.ERROR?d=!1:f==j.IDLE&&h.load(),d&&l.push(h.ready())}const c=e.getFill();c&&c.loading()&&l.push(c.ready());const u=l.length>0;return u&&Promise.all(l).then(()=>n(null)),mf(s,t,e,i,r,o,a),u}function mf(s,t,e,i,n,r,o){const a=e.getGeometryFunction()(t);if(!a)return;const l=a.simplifyTransformed(i,n);if(e.getRenderer())ih(s,l,e,t,o);else{const c=th[l.getType()];c(s,l,e,t,o,r)}}function ih(s,t,e,i,n){if(t.getType()=="GeometryCollection"){const o=t.getGeometries();for(let a=0,l=o.length;a<l;++a)ih(s,o[a],e,i,n);return}s.getBuilder(e.getZIndex(),"Default").drawCustom(t,i,e.getRenderer(),e.getHitDetectionRenderer(),n)}function yf(s,t,e,i,n,r){const o=t.getGeometriesArray();let a,l;for(a=0,l=o.length;a<l;++a){const h=th[o[a].getType()];h(s,o[a],e,i,n,r)}}function pf(s,t,e,i,n){const r=e.getStroke();if(r){const a=s.getBuilder(e.getZIndex(),"LineString");a.setFillStrokeStyle(null,r),a.drawLineString(t,i,n)}const o=e.getText();if(o&&o.getText()){const a=s.getBuilder(e.getZIndex(),"Text");a.setTextStyle(o),a.drawText(t,i,n)}}function xf(s,t,e,i,n){const r=e.getStroke();if(r){const a=s.getBuilder(e.getZIndex(),"LineString");a.setFillStrokeStyle(null,r),a.drawMultiLineString(t,i,n)}const o=e.getText();if(o&&o.getText()){const a=s.getBuilder(e.getZIndex(),"Text");a.setTextStyle(o),a.drawText(t,i,n)}}function Ef(s,t,e,i,n){const r=e.getFill(),o=e.getStroke();if(o||r){const l=s.getBuilder(e.getZIndex(),"Polygon");l.setFillStrokeStyle(r,o),l.drawMultiPolygon(t,i,n)}const a=e.getText();if(a&&a.getText()){const l=s.getBuilder(e.getZIndex(),"Text");l.setTextStyle(a),l.drawText(t,i,n)}}function Cf(s,t,e,i,n,r){const o=e.getImage(),a=e.getText(),l=a&&a.getText(),h=r&&o&&l?{}:void 0;if(o){if(o.getImageState()!=j.LOADED)return;const c=s.getBuilder(e.getZIndex(),"Image");c.setImageStyle(o,h),c.drawPoint(t,i,n)}if(l){const c=s.getBuilder(e.getZIndex(),"Text");c.setTextStyle(a,h),c.drawText(t,i,n)}}function wf(s,t,e,i,n,r){const o=e.getImage(),a=o&&o.getOpacity()!==0,l=e.getText(),h=l&&l.getText(),c=r&&a&&h?{}:void 0;if(a){if(o.getImageState()!=j.LOADED)return;const u=s.getBuilder(e.getZIndex(),"Image");u.setImageStyle(o,c),u.drawMultiPoint(t,i,n)}if(h){const u=s.getBuilder(e.getZIndex(),"Text");u.setTextStyle(l,c),u.drawText(t,i,n)}}function Tf(s,t,e,i,n){const r=e.getFill(),o=e.getStroke();if(r||o){const l=s.getBuilder(e.getZIndex(),"Polygon");l.setFillStrokeStyle(r,o),l.drawPolygon(t,i,n)}const a=e.getText();if(a&&a.getText()){const l=s.getBuilder(e.getZIndex(),"Text");l.setTextStyle(a),l.drawText(t,i,n)}}class vf extends Jl{constructor(t){super(t),this.boundHandleStyleImageChange_=this.handleStyleImageChange_.bind(this),this.animatingOrInteracting_,this.hitDetectionImageData_=null,this.renderedFeatures_=null,this.renderedRevision_=-1,this.renderedResolution_=NaN,this.renderedExtent_=Xt(),this.wrappedRenderedExtent_=Xt(),this.renderedRotation_,this.renderedCenter_=null,this.renderedProjection_=null,this.renderedPixelRatio_=1,this.renderedRenderOrder_=null,this.replayGroup_=null,this.replayGroupChanged=!0,this.clipping=!0,this.targetContext_=null,this.opacity_=1}renderWorlds(t,e,i){const n=e.extent,r=e.viewState,o=r.center,a=r.resolution,l=r.projection,h=r.rotation,c=l.getExtent(),u=this.getLayer().getSource(),d=this.getLayer().getDeclutter(),f=e.pixelRatio,g=e.viewHints,_=!(g[Ct.ANIMATING]||g[Ct.INTERACTING]),m=this.context,y=Math.round(et(n)/a*f),p=Math.round(wt(n)/a*f),x=u.getWrapX()&&l.canWrapX(),E=x?et(c):null,C=x?Math.ceil((n[2]-c[2])/E)+1:1;let R=x?Math.floor((n[0]-c[0])/E):0;do{const I=this.getRenderTransform(o,a,h,f,y,p,R*E);t.execute(m,[m.canvas.width,m.canvas.height],I,h,_,i===void 0?un:i?Ql:of,i?d&&e.declutter[d]:void 0)}while(++R<C)}setDrawContext_(){this.opacity_!==1&&(this.targetContext_=this.context,this.context=yt(this.context.canvas.width,this.context.canvas.height,Ma))}resetDrawContext_(){if(this.opacity_!==1){const t=this.targetContext_.globalAlpha;this.targetContext_.globalAlpha=this.opacity_,this.targetContext_.drawImage(this.context.canvas,0,0),this.targetContext_.globalAlpha=t,ks(this.context),Ma.push(this.context.canvas),this.context=this.targetContext_,this.targetContext_=null}}renderDeclutter(t){!this.replayGroup_||!this.getLayer().getDeclutter()||this.renderWorlds(this.replayGroup_,t,!0)}renderDeferredInternal(t){this.replayGroup_&&(this.replayGroup_.renderDeferred(),this.resetDrawContext_())}renderFrame(t,e){const i=t.pixelRatio,n=t.layerStatesArray[t.layerIndex];this.opacity_=n.opacity;const r=t.extent,o=t.viewState.resolution,a=Math.round(et(r)/o*i),l=Math.round(wt(r)/o*i);ue(this.pixelTransform,t.size[0]/2,t.size[1]/2,1/i,1/i,0,-a/2,-l/2),oo(this.inversePixelTransform,this.pixelTransform);const h=ol(this.pixelTransform);this.useContainer(e,h,this.getBackground(t));const c=this.context,u=c.canvas,d=this.replayGroup_;let f=d&&!d.isEmpty();if(!f&&!(this.getLayer().hasListener(Ut.PRERENDER)||this.getLayer().hasListener(Ut.POSTRENDER)))return null;u.width!=a||u.height!=l?(u.width=a,u.height=l,u.style.transform!==h&&(u.style.transform=h)):this.containerReused||c.clearRect(0,0,a,l),this.setDrawContext_(),this.preRender(c,t);const g=t.viewState;g.projection;let _=!1;if(f&&n.extent&&this.clipping){const m=Xe(n.extent);f=It(m,t.extent),_=f&&!Si(m,t.extent),_&&this.clipUnrotated(c,t,m)}return f&&this.renderWorlds(d,t,this.getLayer().getDeclutter()?!1:void 0),_&&c.restore(),this.postRender(c,t),this.renderedRotation_!==g.rotation&&(this.renderedRotation_=g.rotation,this.hitDetectionImageData_=null),t.declutter||this.resetDrawContext_(),this.container}getFeatures(t){return new Promise(e=>{if(!this.hitDetectionImageData_&&!this.animatingOrInteracting_){const i=[this.context.canvas.width,this.context.canvas.height];gt(this.pixelTransform,i);const n=this.renderedCenter_,r=this.renderedResolution_,o=this.renderedRotation_,a=this.renderedProjection_,l=this.wrappedRenderedExtent_,h=this.getLayer(),c=[],u=i[0]*oe,d=i[1]*oe;c.push(this.getRenderTransform(n,r,o,oe,u,d,0).slice());const f=h.getSource(),g=a.getExtent();if(f.getWrapX()&&a.canWrapX()&&!Si(g,l)){let _=l[0];const m=et(g);let y=0,p;for(;_<g[0];)--y,p=m*y,c.push(this.getRenderTransform(n,r,o,oe,u,d,p).slice()),_+=m;for(y=0,_=l[2];_>g[2];)++y,p=m*y,c.push(this.getRenderTransform(n,r,o,oe,u,d,p).slice()),_-=m}this.hitDetectionImageData_=uf(i,c,this.renderedFeatures_,h.getStyleFunction(),l,r,o,ba(r,this.renderedPixelRatio_),null)}e(df(t,this.renderedFeatures_,this.hitDetectionImageData_))})}forEachFeatureAtCoordinate(t,e,i,n,r){if(!this.replayGroup_)return;const o=e.viewState.resolution,a=e.viewState.rotation,l=this.getLayer(),h={},c=function(g,_,m){const y=G(g),p=h[y];if(p){if(p!==!0&&m<p.distanceSq){if(m===0)return h[y]=!0,r.splice(r.lastIndexOf(p),1),n(g,l,_);p.geometry=_,p.distanceSq=m}}else{if(m===0)return h[y]=!0,n(g,l,_);r.push(h[y]={feature:g,layer:l,geometry:_,distanceSq:m,callback:n})}};let u;const d=[this.replayGroup_],f=this.getLayer().getDeclutter();return d.some(g=>u=g.forEachFeatureAtCoordinate(t,o,a,i,c,f&&e.declutter[f]?e.declutter[f].all().map(_=>_.value):null)),u}handleFontsChanged(){const t=this.getLayer();t.getVisible()&&this.replayGroup_&&t.changed()}handleStyleImageChange_(t){this.renderIfReadyAndVisible()}prepareFrame(t){const e=this.getLayer(),i=e.getSource();if(!i)return!1;const n=t.viewHints[Ct.ANIMATING],r=t.viewHints[Ct.INTERACTING],o=e.getUpdateWhileAnimating(),a=e.getUpdateWhileInteracting();if(this.ready&&!o&&n||!a&&r)return this.animatingOrInteracting_=!0,!0;this.animatingOrInteracting_=!1;const l=t.extent,h=t.viewState,c=h.projection,u=h.resolution,d=t.pixelRatio,f=e.getRevision(),g=e.getRenderBuffer();let _=e.getRenderOrder();_===void 0&&(_=gf);const m=h.center.slice(),y=Mn(l,g*u),p=y.slice(),x=[y.slice()],E=c.getExtent();if(i.getWrapX()&&c.canWrapX()&&!Si(E,t.extent)){const V=et(E),Y=Math.max(et(y)/2,V);y[0]=E[0]-Y,y[2]=E[2]+Y,il(m,c);const L=el(x[0],c);L[0]<E[0]&&L[2]<E[2]?x.push([L[0]+V,L[1],L[2]+V,L[3]]):L[0]>E[0]&&L[2]>E[2]&&x.push([L[0]-V,L[1],L[2]-V,L[3]])}if(this.ready&&this.renderedResolution_==u&&this.renderedRevision_==f&&this.renderedRenderOrder_==_&&Si(this.wrappedRenderedExtent_,y))return Me(this.renderedExtent_,p)||(this.hitDetectionImageData_=null,this.renderedExtent_=p),this.renderedCenter_=m,this.replayGroupChanged=!1,!0;this.replayGroup_=null;const C=new Qd(eh(u,d),y,u,d);let R;for(let V=0,Y=x.length;V<Y;++V)i.loadFeatures(x[V],u,c);const I=ba(u,d);let T=!0;const S=(V,Y)=>{let L;const D=V.getStyleFunction()||e.getStyleFunction();if(D&&(L=D(V,u)),L){const X=this.renderFeature(V,I,L,C,R,this.getLayer().getDeclutter(),Y);T=T&&!X}},z=An(y),O=i.getFeaturesInExtent(z);_&&O.sort(_);for(let V=0,Y=O.length;V<Y;++V)S(O[V],V);this.renderedFeatures_=O,this.ready=T;const N=C.finish(),U=new af(y,u,d,i.getOverlaps(),N,e.getRenderBuffer(),!!t.declutter);return this.renderedResolution_=u,this.renderedRevision_=f,this.renderedRenderOrder_=_,this.renderedExtent_=p,this.wrappedRenderedExtent_=y,this.renderedCenter_=m,this.renderedProjection_=c,this.renderedPixelRatio_=d,this.replayGroup_=U,this.hitDetectionImageData_=null,this.replayGroupChanged=!0,!0}renderFeature(t,e,i,n,r,o,a){if(!i)return!1;let l=!1;if(Array.isArray(i))for(let h=0,c=i.length;h<c;++h)l=Da(n,t,i[h],e,this.boundHandleStyleImageChange_,r,o,a)||l;else l=Da(n,t,i,e,this.boundHandleStyleImageChange_,r,o,a);return l}}class Bs extends Nl{constructor(t){super(t)}createRenderer(){return new vf(this)}}class Ts{constructor(t){this.rbush_=new xl(t),this.items_={}}insert(t,e){const i={minX:t[0],minY:t[1],maxX:t[2],maxY:t[3],value:e};this.rbush_.insert(i),this.items_[G(e)]=i}load(t,e){const i=new Array(e.length);for(let n=0,r=e.length;n<r;n++){const o=t[n],a=e[n],l={minX:o[0],minY:o[1],maxX:o[2],maxY:o[3],value:a};i[n]=l,this.items_[G(a)]=l}this.rbush_.load(i)}remove(t){const e=G(t),i=this.items_[e];return delete this.items_[e],this.rbush_.remove(i)!==null}update(t,e){const i=this.items_[G(e)],n=[i.minX,i.minY,i.maxX,i.maxY];_n(n,t)||(this.remove(e),this.insert(t,e))}getAll(){return this.rbush_.all().map(function(e){return e.value})}getInExtent(t){const e={minX:t[0],minY:t[1],maxX:t[2],maxY:t[3]};return this.rbush_.search(e).map(function(n){return n.value})}forEach(t){return this.forEach_(this.getAll(),t)}forEachInExtent(t,e){return this.forEach_(this.getInExtent(t),e)}forEach_(t,e){let i;for(let n=0,r=t.length;n<r;n++)if(i=e(t[n]),i)return i;return i}isEmpty(){return oi(this.items_)}clear(){this.rbush_.clear(),this.items_={}}getExtent(t){const e=this.rbush_.toJSON();return Le(e.minX,e.minY,e.maxX,e.maxY,t)}concat(t){this.rbush_.load(t.rbush_.all());for(const e in t.items_)this.items_[e]=t.items_[e]}}const Oa=te();class Mt{constructor(t,e,i,n,r,o){this.styleFunction,this.extent_,this.id_=o,this.type_=t,this.flatCoordinates_=e,this.flatInteriorPoints_=null,this.flatMidpoints_=null,this.ends_=i||null,this.properties_=r,this.squaredTolerance_,this.stride_=n,this.simplifiedGeometry_}get(t){return this.properties_[t]}getExtent(){return this.extent_||(this.extent_=this.type_==="Point"?ln(this.flatCoordinates_):$r(this.flatCoordinates_,0,this.flatCoordinates_.length,2)),this.extent_}getFlatInteriorPoint(){if(!this.flatInteriorPoints_){const t=Ve(this.getExtent());this.flatInteriorPoints_=_o(this.flatCoordinates_,0,this.ends_,2,t,0)}return this.flatInteriorPoints_}getFlatInteriorPoints(){if(!this.flatInteriorPoints_){const t=Rc(this.flatCoordinates_,this.ends_),e=ql(this.flatCoordinates_,0,t,2);this.flatInteriorPoints_=fl(this.flatCoordinates_,0,t,2,e)}return this.flatInteriorPoints_}getFlatMidpoint(){return this.flatMidpoints_||(this.flatMidpoints_=Cs(this.flatCoordinates_,0,this.flatCoordinates_.length,2,.5)),this.flatMidpoints_}getFlatMidpoints(){if(!this.flatMidpoints_){this.flatMidpoints_=[];const t=this.flatCoordinates_;let e=0;const i=this.ends_;for(let n=0,r=i.length;n<r;++n){const o=i[n],a=Cs(t,e,o,2,.5);Zt(this.flatMidpoints_,a),e=o}}return this.flatMidpoints_}getId(){return this.id_}getOrientedFlatCoordinates(){return this.flatCoordinates_}getGeometry(){return this}getSimplifiedGeometry(t){return this}simplifyTransformed(t,e){return this}getProperties(){return this.properties_}getPropertiesInternal(){return this.properties_}getStride(){return this.stride_}getStyleFunction(){return this.styleFunction}getType(){return this.type_}transform(t){t=ut(t);const e=t.getExtent(),i=t.getWorldExtent();if(e&&i){const n=wt(i)/wt(e);ue(Oa,i[0],i[3],n,-n,0,0,0),Be(this.flatCoordinates_,0,this.flatCoordinates_.length,2,Oa,this.flatCoordinates_)}}applyTransform(t){t(this.flatCoordinates_,this.flatCoordinates_,this.stride_)}clone(){var t;return new Mt(this.type_,this.flatCoordinates_.slice(),(t=this.ends_)==null?void 0:t.slice(),this.stride_,Object.assign({},this.properties_),this.id_)}getEnds(){return this.ends_}enableSimplifyTransformed(){return this.simplifyTransformed=qa((t,e)=>{if(t===this.squaredTolerance_)return this.simplifiedGeometry_;this.simplifiedGeometry_=this.clone(),e&&this.simplifiedGeometry_.applyTransform(e);const i=this.simplifiedGeometry_.getFlatCoordinates();let n;switch(this.type_){case"LineString":i.length=As(i,0,this.simplifiedGeometry_.flatCoordinates_.length,this.simplifiedGeometry_.stride_,t,i,0),n=[i.length];break;case"MultiLineString":n=[],i.length=cl(i,0,this.simplifiedGeometry_.ends_,this.simplifiedGeometry_.stride_,t,i,0,n);break;case"Polygon":n=[],i.length=fo(i,0,this.simplifiedGeometry_.ends_,this.simplifiedGeometry_.stride_,Math.sqrt(t),i,0,n);break}return n&&(this.simplifiedGeometry_=new Mt(this.type_,i,n,2,this.properties_,this.id_)),this.squaredTolerance_=t,this.simplifiedGeometry_}),this}}Mt.prototype.getFlatCoordinates=Mt.prototype.getOrientedFlatCoordinates;class nh extends de{constructor(t){super(),this.projection=ut(t.projection),this.attributions_=ka(t.attributions),this.attributionsCollapsible_=t.attributionsCollapsible!==void 0?t.attributionsCollapsible:!0,this.loading=!1,this.state_=t.state!==void 0?t.state:"ready",this.wrapX_=t.wrapX!==void 0?t.wrapX:!1,this.interpolate_=!!t.interpolate,this.viewResolver=null,this.viewRejector=null;const e=this;this.viewPromise_=new Promise(function(i,n){e.viewResolver=i,e.viewRejector=n})}getAttributions(){return this.attributions_}getAttributionsCollapsible(){return this.attributionsCollapsible_}getProjection(){return this.projection}getResolutions(t){return null}getView(){return this.viewPromise_}getState(){return this.state_}getWrapX(){return this.wrapX_}getInterpolate(){return this.interpolate_}refresh(){this.changed()}setAttributions(t){this.attributions_=ka(t),this.changed()}setState(t){this.state_=t,this.changed()}}function ka(s){return s?Array.isArray(s)?function(t){return s}:typeof s=="function"?s:function(t){return[s]}:null}const Et={ADDFEATURE:"addfeature",CHANGEFEATURE:"changefeature",CLEAR:"clear",REMOVEFEATURE:"removefeature",FEATURESLOADSTART:"featuresloadstart",FEATURESLOADEND:"featuresloadend",FEATURESLOADERROR:"featuresloaderror"};function Rf(s,t){return[[-1/0,-1/0,1/0,1/0]]}function Sf(s,t){return[s]}let If=!1;function Lf(s,t,e,i,n,r,o){const a=new XMLHttpRequest;a.open("GET",typeof s=="function"?s(e,i,n):s,!0),t.getType()=="arraybuffer"&&(a.responseType="arraybuffer"),a.withCredentials=If,a.onload=function(l){if(!a.status||a.status>=200&&a.status<300){const h=t.getType();let c;h=="json"?c=JSON.parse(a.responseText):h=="text"?c=a.responseText:h=="xml"?(c=a.responseXML,c||(c=new DOMParser().parseFromString(a.responseText,"application/xml"))):h=="arraybuffer"&&(c=a.response),c?r(t.readFeatures(c,{extent:e,featureProjection:n}),t.readProjection(c)):o()}else o()},a.onerror=o,a.send()}function Ga(s,t){return function(e,i,n,r,o){const a=this;Lf(s,t,e,i,n,function(l,h){a.addFeatures(l),r!==void 0&&r(l)},o||ki)}}class ke extends Wt{constructor(t,e,i){super(t),this.feature=e,this.features=i}}class Do extends nh{constructor(t){t=t||{},super({attributions:t.attributions,interpolate:!0,projection:void 0,state:"ready",wrapX:t.wrapX!==void 0?t.wrapX:!0}),this.on,this.once,this.un,this.loader_=ki,this.format_=t.format,this.overlaps_=t.overlaps===void 0?!0:t.overlaps,this.url_=t.url,t.loader!==void 0?this.loader_=t.loader:this.url_!==void 0&&(H(this.format_,"`format` must be set when `url` is set"),this.loader_=Ga(this.url_,this.format_)),this.strategy_=t.strategy!==void 0?t.strategy:Rf;const e=t.useSpatialIndex!==void 0?t.useSpatialIndex:!0;this.featuresRtree_=e?new Ts:null,this.loadedExtentsRtree_=new Ts,this.loadingExtentsCount_=0,this.nullGeometryFeatures_={},this.idIndex_={},this.uidIndex_={},this.featureChangeKeys_={},this.featuresCollection_=null;let i,n;Array.isArray(t.features)?n=t.features:t.features&&(i=t.features,n=i.getArray()),!e&&i===void 0&&(i=new Nt(n)),n!==void 0&&this.addFeaturesInternal(n),i!==void 0&&this.bindFeaturesCollection_(i)}addFeature(t){this.addFeatureInternal(t),this.changed()}addFeatureInternal(t){const e=G(t);if(!this.addToIndex_(e,t)){this.featuresCollection_&&this.featuresCollection_.remove(t);return}this.setupChangeEvents_(e,t);const i=t.getGeometry();if(i){const n=i.getExtent();this.featuresRtree_&&this.featuresRtree_.insert(n,t)}else this.nullGeometryFeatures_[e]=t;this.dispatchEvent(new ke(Et.ADDFEATURE,t))}setupChangeEvents_(t,e){e instanceof Mt||(this.featureChangeKeys_[t]=[B(e,A.CHANGE,this.handleFeatureChange_,this),B(e,Oi.PROPERTYCHANGE,this.handleFeatureChange_,this)])}addToIndex_(t,e){let i=!0;if(e.getId()!==void 0){const n=String(e.getId());if(!(n in this.idIndex_))this.idIndex_[n]=e;else if(e instanceof Mt){const r=this.idIndex_[n];r instanceof Mt?Array.isArray(r)?r.push(e):this.idIndex_[n]=[r,e]:i=!1}else i=!1}return i&&(H(!(t in this.uidIndex_),"The passed `feature` was already added to the source"),this.uidIndex_[t]=e),i}addFeatures(t){this.addFeaturesInternal(t),this.changed()}addFeaturesInternal(t){const e=[],i=[],n=[];for(let r=0,o=t.length;r<o;r++){const a=t[r],l=G(a);this.addToIndex_(l,a)&&i.push(a)}for(let r=0,o=i.length;r<o;r++){const a=i[r],l=G(a);this.setupChangeEvents_(l,a);const h=a.getGeometry();if(h){const c=h.getExtent();e.push(c),n.push(a)}else this.nullGeometryFeatures_[l]=a}if(this.featuresRtree_&&this.featuresRtree_.load(e,n),this.hasListener(Et.ADDFEATURE))for(let r=0,o=i.length;r<o;r++)this.dispatchEvent(new ke(Et.ADDFEATURE,i[r]))}bindFeaturesCollection_(t){let e=!1;this.addEventListener(Et.ADDFEATURE,function(i){e||(e=!0,t.push(i.feature),e=!1)}),this.addEventListener(Et.REMOVEFEATURE,function(i){e||(e=!0,t.remove(i.feature),e=!1)}),t.addEventListener(lt.ADD,i=>{e||(e=!0,this.addFeature(i.element),e=!1)}),t.addEventListener(lt.REMOVE,i=>{e||(e=!0,this.removeFeature(i.element),e=!1)}),this.featuresCollection_=t}clear(t){if(t){for(const i in this.featureChangeKeys_)this.featureChangeKeys_[i].forEach(it);this.featuresCollection_||(this.featureChangeKeys_={},this.idIndex_={},this.uidIndex_={})}else if(this.featuresRtree_){const i=n=>{this.removeFeatureInternal(n)};this.featuresRtree_.forEach(i);for(const n in this.nullGeometryFeatures_)this.removeFeatureInternal(this.nullGeometryFeatures_[n])}this.featuresCollection_&&this.featuresCollection_.clear(),this.featuresRtree_&&this.featuresRtree_.clear(),this.nullGeometryFeatures_={};const e=new ke(Et.CLEAR);this.dispatchEvent(e),this.changed()}forEachFeature(t){if(this.featuresRtree_)return this.featuresRtree_.forEach(t);this.featuresCollection_&&this.featuresCollection_.forEach(t)}forEachFeatureAtCoordinateDirect(t,e){const i=[t[0],t[1],t[0],t[1]];return this.forEachFeatureInExtent(i,function(n){const r=n.getGeometry();if(r instanceof Mt||r.intersectsCoordinate(t))return e(n)})}forEachFeatureInExtent(t,e){if(this.featuresRtree_)return this.featuresRtree_.forEachInExtent(t,e);this.featuresCollection_&&this.featuresCollection_.forEach(e)}forEachFeatureIntersectingExtent(t,e){return this.forEachFeatureInExtent(t,function(i){const n=i.getGeometry();if(n instanceof Mt||n.intersectsExtent(t)){const r=e(i);if(r)return r}})}getFeaturesCollection(){return this.featuresCollection_}getFeatures(){let t;return this.featuresCollection_?t=this.featuresCollection_.getArray().slice(0):this.featuresRtree_&&(t=this.featuresRtree_.getAll(),oi(this.nullGeometryFeatures_)||Zt(t,Object.values(this.nullGeometryFeatures_))),t}getFeaturesAtCoordinate(t){const e=[];return this.forEachFeatureAtCoordinateDirect(t,function(i){e.push(i)}),e}getFeaturesInExtent(t,e){if(this.featuresRtree_){if(!(e&&e.canWrapX()&&this.getWrapX()))return this.featuresRtree_.getInExtent(t);const n=Yh(t,e);return[].concat(...n.map(r=>this.featuresRtree_.getInExtent(r)))}return this.featuresCollection_?this.featuresCollection_.getArray().slice(0):[]}getClosestFeatureToCoordinate(t,e){const i=t[0],n=t[1];let r=null;const o=[NaN,NaN];let a=1/0;const l=[-1/0,-1/0,1/0,1/0];return e=e||Ie,this.featuresRtree_.forEachInExtent(l,function(h){if(e(h)){const c=h.getGeometry(),u=a;if(a=c instanceof Mt?0:c.closestPointXY(i,n,o,a),a<u){r=h;const d=Math.sqrt(a);l[0]=i-d,l[1]=n-d,l[2]=i+d,l[3]=n+d}}}),r}getExtent(t){return this.featuresRtree_.getExtent(t)}getFeatureById(t){const e=this.idIndex_[t.toString()];return e!==void 0?e:null}getFeatureByUid(t){const e=this.uidIndex_[t];return e!==void 0?e:null}getFormat(){return this.format_}getOverlaps(){return this.overlaps_}getUrl(){return this.url_}handleFeatureChange_(t){const e=t.target,i=G(e),n=e.getGeometry();if(!n)i in this.nullGeometryFeatures_||(this.featuresRtree_&&this.featuresRtree_.remove(e),this.nullGeometryFeatures_[i]=e);else{const o=n.getExtent();i in this.nullGeometryFeatures_?(delete this.nullGeometryFeatures_[i],this.featuresRtree_&&this.featuresRtree_.insert(o,e)):this.featuresRtree_&&this.featuresRtree_.update(o,e)}const r=e.getId();if(r!==void 0){const o=r.toString();this.idIndex_[o]!==e&&(this.removeFromIdIndex_(e),this.idIndex_[o]=e)}else this.removeFromIdIndex_(e),this.uidIndex_[i]=e;this.changed(),this.dispatchEvent(new ke(Et.CHANGEFEATURE,e))}hasFeature(t){const e=t.getId();return e!==void 0?e in this.idIndex_:G(t)in this.uidIndex_}isEmpty(){return this.featuresRtree_?this.featuresRtree_.isEmpty()&&oi(this.nullGeometryFeatures_):this.featuresCollection_?this.featuresCollection_.getLength()===0:!0}loadFeatures(t,e,i){const n=this.loadedExtentsRtree_,r=this.strategy_(t,e,i);for(let o=0,a=r.length;o<a;++o){const l=r[o];n.forEachInExtent(l,function(c){return Si(c.extent,l)})||(++this.loadingExtentsCount_,this.dispatchEvent(new ke(Et.FEATURESLOADSTART)),this.loader_.call(this,l,e,i,c=>{--this.loadingExtentsCount_,this.dispatchEvent(new ke(Et.FEATURESLOADEND,void 0,c))},()=>{--this.loadingExtentsCount_,this.dispatchEvent(new ke(Et.FEATURESLOADERROR))}),n.insert(l,{extent:l.slice()}))}this.loading=this.loader_.length<4?!1:this.loadingExtentsCount_>0}refresh(){this.clear(!0),this.loadedExtentsRtree_.clear(),super.refresh()}removeLoadedExtent(t){const e=this.loadedExtentsRtree_;let i;e.forEachInExtent(t,function(n){if(_n(n.extent,t))return i=n,!0}),i&&e.remove(i)}removeFeatures(t){const e=[];for(let i=0,n=t.length;i<n;++i){const r=t[i],o=this.removeFeatureInternal(r);o&&e.push(o)}e.length>0&&this.changed()}removeFeature(t){if(!t)return;this.removeFeatureInternal(t)&&this.changed()}removeFeatureInternal(t){const e=G(t);e in this.nullGeometryFeatures_?delete this.nullGeometryFeatures_[e]:this.featuresRtree_&&this.featuresRtree_.remove(t);const i=this.featureChangeKeys_[e];if(!i)return;i.forEach(it),delete this.featureChangeKeys_[e];const n=t.getId();return n!==void 0&&delete this.idIndex_[n.toString()],delete this.uidIndex_[e],this.hasListener(Et.REMOVEFEATURE)&&this.dispatchEvent(new ke(Et.REMOVEFEATURE,t)),t}removeFromIdIndex_(t){let e=!1;for(const i in this.idIndex_){const n=this.idIndex_[i];if(t instanceof Mt&&Array.isArray(n)&&n.includes(t))n.splice(n.indexOf(t),1);else if(this.idIndex_[i]===t){delete this.idIndex_[i],e=!0;break}}return e}setLoader(t){this.loader_=t}setUrl(t){H(this.format_,"`format` must be set when `url` is set"),this.url_=t,this.setLoader(Ga(t,this.format_))}}const Qn={DRAWSTART:"drawstart",DRAWEND:"drawend",DRAWABORT:"drawabort"};class ts extends Wt{constructor(t,e){super(t),this.feature=e}}function Pf(s,t){const e=[];for(let i=0;i<t.length;++i){const r=t[i].getGeometry();sh(s,r,e)}return e}function es(s,t){return Te(s[0],s[1],t[0],t[1])}function Ii(s,t){const e=s.length;return t<0?s[t+e]:t>=e?s[t-e]:s[t]}function is(s,t,e){let i,n;t<e?(i=t,n=e):(i=e,n=t);const r=Math.ceil(i),o=Math.floor(n);if(r>o){const l=Li(s,i),h=Li(s,n);return es(l,h)}let a=0;if(i<r){const l=Li(s,i),h=Ii(s,r);a+=es(l,h)}if(o<n){const l=Ii(s,o),h=Li(s,n);a+=es(l,h)}for(let l=r;l<o-1;++l){const h=Ii(s,l),c=Ii(s,l+1);a+=es(h,c)}return a}function sh(s,t,e){if(t instanceof ce){ns(s,t.getCoordinates(),!1,e);return}if(t instanceof Yi){const i=t.getCoordinates();for(let n=0,r=i.length;n<r;++n)ns(s,i[n],!1,e);return}if(t instanceof zi){const i=t.getCoordinates();for(let n=0,r=i.length;n<r;++n)ns(s,i[n],!0,e);return}if(t instanceof ji){const i=t.getCoordinates();for(let n=0,r=i.length;n<r;++n){const o=i[n];for(let a=0,l=o.length;a<l;++a)ns(s,o[a],!0,e)}return}if(t instanceof Zl){const i=t.getGeometries();for(let n=0;n<i.length;++n)sh(s,i[n],e);return}}const _r={index:-1,endIndex:NaN};function Mf(s,t,e,i){const n=s[0],r=s[1];let o=1/0,a=-1,l=NaN;for(let u=0;u<t.targets.length;++u){const d=t.targets[u],f=d.coordinates;let g=1/0,_;for(let m=0;m<f.length-1;++m){const y=f[m],p=f[m+1],x=rh(n,r,y,p);x.squaredDistance<g&&(g=x.squaredDistance,_=m+x.along)}g<o&&(o=g,d.ring&&t.targetIndex===u&&(d.endIndex>d.startIndex?_<d.startIndex&&(_+=f.length):d.endIndex<d.startIndex&&_>d.startIndex&&(_-=f.length)),l=_,a=u)}const h=t.targets[a];let c=h.ring;if(t.targetIndex===a&&c){const u=Li(h.coordinates,l),d=e.getPixelFromCoordinate(u);us(d,t.startPx)>i&&(c=!1)}if(c){const u=h.coordinates,d=u.length,f=h.startIndex,g=l;if(f<g){const _=is(u,f,g);is(u,f,g-d)<_&&(l-=d)}else{const _=is(u,f,g);is(u,f,g+d)<_&&(l+=d)}}return _r.index=a,_r.endIndex=l,_r}function ns(s,t,e,i){const n=s[0],r=s[1];for(let o=0,a=t.length-1;o<a;++o){const l=t[o],h=t[o+1],c=rh(n,r,l,h);if(c.squaredDistance===0){const u=o+c.along;i.push({coordinates:t,ring:e,startIndex:u,endIndex:u});return}}}const mr={along:0,squaredDistance:0};function rh(s,t,e,i){const n=e[0],r=e[1],o=i[0],a=i[1],l=o-n,h=a-r;let c=0,u=n,d=r;return(l!==0||h!==0)&&(c=ct(((s-n)*l+(t-r)*h)/(l*l+h*h),0,1),u+=l*c,d+=h*c),mr.along=c,mr.squaredDistance=Rs(Te(s,t,u,d),10),mr}function Li(s,t){const e=s.length;let i=Math.floor(t);const n=t-i;i>=e?i-=e:i<0&&(i+=e);let r=i+1;r>=e&&(r-=e);const o=s[i],a=o[0],l=o[1],h=s[r],c=h[0]-a,u=h[1]-l;return[a+c*n,l+u*n]}class Ff extends Ke{constructor(t){const e=t;e.stopDown||(e.stopDown=hi),super(e),this.on,this.once,this.un,this.shouldHandle_=!1,this.downPx_=null,this.downTimeout_,this.lastDragTime_,this.pointerType_,this.freehand_=!1,this.source_=t.source?t.source:null,this.features_=t.features?t.features:null,this.snapTolerance_=t.snapTolerance?t.snapTolerance:12,this.type_=t.type,this.mode_=bf(this.type_),this.stopClick_=!!t.stopClick,this.minPoints_=t.minPoints?t.minPoints:this.mode_==="Polygon"?3:2,this.maxPoints_=this.mode_==="Circle"?2:t.maxPoints?t.maxPoints:1/0,this.finishCondition_=t.finishCondition?t.finishCondition:Ie,this.geometryLayout_=t.geometryLayout?t.geometryLayout:"XY";let i=t.geometryFunction;if(!i){const n=this.mode_;if(n==="Circle")i=function(r,o,a){const l=o||new js([NaN,NaN]),h=st(r[0]),c=ve(h,st(r[r.length-1]));return l.setCenterAndRadius(h,Math.sqrt(c),this.geometryLayout_),l};else{let r;n==="Point"?r=ee:n==="LineString"?r=ce:n==="Polygon"&&(r=zi),i=function(o,a,l){return a?n==="Polygon"?o[0].length?a.setCoordinates([o[0].concat([o[0][0]])],this.geometryLayout_):a.setCoordinates([],this.geometryLayout_):a.setCoordinates(o,this.geometryLayout_):a=new r(o,this.geometryLayout_),a}}}this.geometryFunction_=i,this.dragVertexDelay_=t.dragVertexDelay!==void 0?t.dragVertexDelay:500,this.finishCoordinate_=null,this.sketchFeature_=null,this.sketchPoint_=null,this.sketchCoords_=null,this.sketchLine_=null,this.sketchLineCoords_=null,this.squaredClickTolerance_=t.clickTolerance?t.clickTolerance*t.clickTolerance:36,this.overlay_=new Bs({source:new Do({useSpatialIndex:!1,wrapX:t.wrapX?t.wrapX:!1}),style:t.style?t.style:Af(),updateWhileInteracting:!0}),this.geometryName_=t.geometryName,this.condition_=t.condition?t.condition:Ao,this.freehandCondition_,t.freehand?this.freehandCondition_=xs:this.freehandCondition_=t.freehandCondition?t.freehandCondition:bo,this.traceCondition_,this.setTrace(t.trace||!1),this.traceState_={active:!1},this.traceSource_=t.traceSource||t.source||null,this.addChangeListener(Xr.ACTIVE,this.updateState_)}setTrace(t){let e;t?t===!0?e=xs:e=t:e=Yr,this.traceCondition_=e}setMap(t){super.setMap(t),this.updateState_()}getOverlay(){return this.overlay_}handleEvent(t){t.originalEvent.type===A.CONTEXTMENU&&t.originalEvent.preventDefault(),this.freehand_=this.mode_!=="Point"&&this.freehandCondition_(t);let e=t.type===K.POINTERMOVE,i=!0;return!this.freehand_&&this.lastDragTime_&&t.type===K.POINTERDRAG&&(Date.now()-this.lastDragTime_>=this.dragVertexDelay_?(this.downPx_=t.pixel,this.shouldHandle_=!this.freehand_,e=!0):this.lastDragTime_=void 0,this.shouldHandle_&&this.downTimeout_!==void 0&&(clearTimeout(this.downTimeout_),this.downTimeout_=void 0)),this.freehand_&&t.type===K.POINTERDRAG&&this.sketchFeature_!==null?(this.addToDrawing_(t.coordinate),i=!1):this.freehand_&&t.type===K.POINTERDOWN?i=!1:e&&this.getPointerCount()<2?(i=t.type===K.POINTERMOVE,i&&this.freehand_?(this.handlePointerMove_(t),this.shouldHandle_&&t.originalEvent.preventDefault()):(t.originalEvent.pointerType==="mouse"||t.type===K.POINTERDRAG&&this.downTimeout_===void 0)&&this.handlePointerMove_(t)):t.type===K.DBLCLICK&&(i=!1),super.handleEvent(t)&&i}handleDownEvent(t){return this.shouldHandle_=!this.freehand_,this.freehand_?(this.downPx_=t.pixel,this.finishCoordinate_||this.startDrawing_(t.coordinate),!0):this.condition_(t)?(this.lastDragTime_=Date.now(),this.downTimeout_=setTimeout(()=>{this.handlePointerMove_(new Ee(K.POINTERMOVE,t.map,t.originalEvent,!1,t.frameState))},this.dragVertexDelay_),this.downPx_=t.pixel,!0):(this.lastDragTime_=void 0,!1)}deactivateTrace_(){this.traceState_={active:!1}}toggleTraceState_(t){if(!this.traceSource_||!this.traceCondition_(t))return;if(this.traceState_.active){this.deactivateTrace_();return}const e=this.getMap(),i=e.getCoordinateFromPixel([t.pixel[0]-this.snapTolerance_,t.pixel[1]+this.snapTolerance_]),n=e.getCoordinateFromPixel([t.pixel[0]+this.snapTolerance_,t.pixel[1]-this.snapTolerance_]),r=St([i,n]),o=this.traceSource_.getFeaturesInExtent(r);if(o.length===0)return;const a=Pf(t.coordinate,o);a.length&&(this.traceState_={active:!0,startPx:t.pixel.slice(),targets:a,targetIndex:-1})}addOrRemoveTracedCoordinates_(t,e){const i=t.startIndex<=t.endIndex,n=t.startIndex<=e;i===n?i&&e>t.endIndex||!i&&e<t.endIndex?this.addTracedCoordinates_(t,t.endIndex,e):(i&&e<t.endIndex||!i&&e>t.endIndex)&&this.removeTracedCoordinates_(e,t.endIndex):(this.removeTracedCoordinates_(t.startIndex,t.endIndex),this.addTracedCoordinates_(t,t.startIndex,e))}removeTracedCoordinates_(t,e){if(t===e)return;let i=0;if(t<e){const n=Math.ceil(t);let r=Math.floor(e);r===e&&(r-=1),i=r-n+1}else{const n=Math.floor(t);let r=Math.ceil(e);r===e&&(r+=1),i=n-r+1}i>0&&this.removeLastPoints_(i)}addTracedCoordinates_(t,e,i){if(e===i)return;const n=[];if(e<i){const r=Math.ceil(e);let o=Math.floor(i);o===i&&(o-=1);for(let a=r;a<=o;++a)n.push(Ii(t.coordinates,a))}else{const r=Math.floor(e);let o=Math.ceil(i);o===i&&(o+=1);for(let a=r;a>=o;--a)n.push(Ii(t.coordinates,a))}n.length&&this.appendCoordinates(n)}updateTrace_(t){const e=this.traceState_;if(!e.active||e.targetIndex===-1&&us(e.startPx,t.pixel)<this.snapTolerance_)return;const i=Mf(t.coordinate,e,this.getMap(),this.snapTolerance_);if(e.targetIndex!==i.index){if(e.targetIndex!==-1){const l=e.targets[e.targetIndex];this.removeTracedCoordinates_(l.startIndex,l.endIndex)}const a=e.targets[i.index];this.addTracedCoordinates_(a,a.startIndex,i.endIndex)}else{const a=e.targets[e.targetIndex];this.addOrRemoveTracedCoordinates_(a,i.endIndex)}e.targetIndex=i.index;const n=e.targets[e.targetIndex];n.endIndex=i.endIndex;const r=Li(n.coordinates,n.endIndex),o=this.getMap().getPixelFromCoordinate(r);t.coordinate=r,t.pixel=[Math.round(o[0]),Math.round(o[1])]}handleUpEvent(t){let e=!0;if(this.getPointerCount()===0){this.downTimeout_&&(clearTimeout(this.downTimeout_),this.downTimeout_=void 0),this.handlePointerMove_(t);const i=this.traceState_.active;if(this.toggleTraceState_(t),this.shouldHandle_){const n=!this.finishCoordinate_;n&&this.startDrawing_(t.coordinate),!n&&this.freehand_?this.finishDrawing():!this.freehand_&&(!n||this.mode_==="Point")&&(this.atFinish_(t.pixel,i)?this.finishCondition_(t)&&this.finishDrawing():this.addToDrawing_(t.coordinate)),e=!1}else this.freehand_&&this.abortDrawing()}return!e&&this.stopClick_&&t.preventDefault(),e}handlePointerMove_(t){if(this.pointerType_=t.originalEvent.pointerType,this.downPx_&&(!this.freehand_&&this.shouldHandle_||this.freehand_&&!this.shouldHandle_)){const e=this.downPx_,i=t.pixel,n=e[0]-i[0],r=e[1]-i[1],o=n*n+r*r;if(this.shouldHandle_=this.freehand_?o>this.squaredClickTolerance_:o<=this.squaredClickTolerance_,!this.shouldHandle_)return}if(!this.finishCoordinate_){this.createOrUpdateSketchPoint_(t.coordinate.slice());return}this.updateTrace_(t),this.modifyDrawing_(t.coordinate)}atFinish_(t,e){let i=!1;if(this.sketchFeature_){let n=!1,r=[this.finishCoordinate_];const o=this.mode_;if(o==="Point")i=!0;else if(o==="Circle")i=this.sketchCoords_.length===2;else if(o==="LineString")n=!e&&this.sketchCoords_.length>this.minPoints_;else if(o==="Polygon"){const a=this.sketchCoords_;n=a[0].length>this.minPoints_,r=[a[0][0],a[0][a[0].length-2]],e?r=[a[0][0]]:r=[a[0][0],a[0][a[0].length-2]]}if(n){const a=this.getMap();for(let l=0,h=r.length;l<h;l++){const c=r[l],u=a.getPixelFromCoordinate(c),d=t[0]-u[0],f=t[1]-u[1],g=this.freehand_?1:this.snapTolerance_;if(i=Math.sqrt(d*d+f*f)<=g,i){this.finishCoordinate_=c;break}}}}return i}createOrUpdateSketchPoint_(t){this.sketchPoint_?this.sketchPoint_.getGeometry().setCoordinates(t):(this.sketchPoint_=new Gt(new ee(t)),this.updateSketchFeatures_())}createOrUpdateCustomSketchLine_(t){this.sketchLine_||(this.sketchLine_=new Gt);const e=t.getLinearRing(0);let i=this.sketchLine_.getGeometry();i?(i.setFlatCoordinates(e.getLayout(),e.getFlatCoordinates()),i.changed()):(i=new ce(e.getFlatCoordinates(),e.getLayout()),this.sketchLine_.setGeometry(i))}startDrawing_(t){const e=this.getMap().getView().getProjection(),i=ds(this.geometryLayout_);for(;t.length<i;)t.push(0);this.finishCoordinate_=t,this.mode_==="Point"?this.sketchCoords_=t.slice():this.mode_==="Polygon"?(this.sketchCoords_=[[t.slice(),t.slice()]],this.sketchLineCoords_=this.sketchCoords_[0]):this.sketchCoords_=[t.slice(),t.slice()],this.sketchLineCoords_&&(this.sketchLine_=new Gt(new ce(this.sketchLineCoords_)));const n=this.geometryFunction_(this.sketchCoords_,void 0,e);this.sketchFeature_=new Gt,this.geometryName_&&this.sketchFeature_.setGeometryName(this.geometryName_),this.sketchFeature_.setGeometry(n),this.updateSketchFeatures_(),this.dispatchEvent(new ts(Qn.DRAWSTART,this.sketchFeature_))}modifyDrawing_(t){const e=this.getMap(),i=this.sketchFeature_.getGeometry(),n=e.getView().getProjection(),r=ds(this.geometryLayout_);let o,a;for(;t.length<r;)t.push(0);this.mode_==="Point"?a=this.sketchCoords_:this.mode_==="Polygon"?(o=this.sketchCoords_[0],a=o[o.length-1],this.atFinish_(e.getPixelFromCoordinate(t))&&(t=this.finishCoordinate_.slice())):(o=this.sketchCoords_,a=o[o.length-1]),a[0]=t[0],a[1]=t[1],this.geometryFunction_(this.sketchCoords_,i,n),this.sketchPoint_&&this.sketchPoint_.getGeometry().setCoordinates(t),i.getType()==="Polygon"&&this.mode_!=="Polygon"?this.createOrUpdateCustomSketchLine_(i):this.sketchLineCoords_&&this.sketchLine_.getGeometry().setCoordinates(this.sketchLineCoords_),this.updateSketchFeatures_()}addToDrawing_(t){const e=this.sketchFeature_.getGeometry(),i=this.getMap().getView().getProjection();let n,r;const o=this.mode_;return o==="LineString"||o==="Circle"?(this.finishCoordinate_=t.slice(),r=this.sketchCoords_,r.length>=this.maxPoints_&&(this.freehand_?r.pop():n=!0),r.push(t.slice()),this.geometryFunction_(r,e,i)):o==="Polygon"&&(r=this.sketchCoords_[0],r.length>=this.maxPoints_&&(this.freehand_?r.pop():n=!0),r.push(t.slice()),n&&(this.finishCoordinate_=r[0]),this.geometryFunction_(this.sketchCoords_,e,i)),this.createOrUpdateSketchPoint_(t.slice()),this.updateSketchFeatures_(),n?this.finishDrawing():this.sketchFeature_}removeLastPoints_(t){if(!this.sketchFeature_)return;const e=this.sketchFeature_.getGeometry(),i=this.getMap().getView().getProjection(),n=this.mode_;for(let r=0;r<t;++r){let o;if(n==="LineString"||n==="Circle"){if(o=this.sketchCoords_,o.splice(-2,1),o.length>=2){this.finishCoordinate_=o[o.length-2].slice();const a=this.finishCoordinate_.slice();o[o.length-1]=a,this.createOrUpdateSketchPoint_(a)}this.geometryFunction_(o,e,i),e.getType()==="Polygon"&&this.sketchLine_&&this.createOrUpdateCustomSketchLine_(e)}else if(n==="Polygon"){o=this.sketchCoords_[0],o.splice(-2,1);const a=this.sketchLine_.getGeometry();if(o.length>=2){const l=o[o.length-2].slice();o[o.length-1]=l,this.createOrUpdateSketchPoint_(l)}a.setCoordinates(o),this.geometryFunction_(this.sketchCoords_,e,i)}if(o.length===1){this.abortDrawing();break}}this.updateSketchFeatures_()}removeLastPoint(){this.removeLastPoints_(1)}finishDrawing(){const t=this.abortDrawing_();if(!t)return null;let e=this.sketchCoords_;const i=t.getGeometry(),n=this.getMap().getView().getProjection();return this.mode_==="LineString"?(e.pop(),this.geometryFunction_(e,i,n)):this.mode_==="Polygon"&&(e[0].pop(),this.geometryFunction_(e,i,n),e=i.getCoordinates()),this.type_==="MultiPoint"?t.setGeometry(new On([e])):this.type_==="MultiLineString"?t.setGeometry(new Yi([e])):this.type_==="MultiPolygon"&&t.setGeometry(new ji([e])),this.dispatchEvent(new ts(Qn.DRAWEND,t)),this.features_&&this.features_.push(t),this.source_&&this.source_.addFeature(t),t}abortDrawing_(){this.finishCoordinate_=null;const t=this.sketchFeature_;return this.sketchFeature_=null,this.sketchPoint_=null,this.sketchLine_=null,this.overlay_.getSource().clear(!0),this.deactivateTrace_(),t}abortDrawing(){const t=this.abortDrawing_();t&&this.dispatchEvent(new ts(Qn.DRAWABORT,t))}appendCoordinates(t){const e=this.mode_,i=!this.sketchFeature_;i&&this.startDrawing_(t[0]);let n;if(e==="LineString"||e==="Circle")n=this.sketchCoords_;else if(e==="Polygon")n=this.sketchCoords_&&this.sketchCoords_.length?this.sketchCoords_[0]:[];else return;i&&n.shift(),n.pop();for(let o=0;o<t.length;o++)this.addToDrawing_(t[o]);const r=t[t.length-1];this.sketchFeature_=this.addToDrawing_(r),this.modifyDrawing_(r)}extend(t){const i=t.getGeometry();this.sketchFeature_=t,this.sketchCoords_=i.getCoordinates();const n=this.sketchCoords_[this.sketchCoords_.length-1];this.finishCoordinate_=n.slice(),this.sketchCoords_.push(n.slice()),this.sketchPoint_=new Gt(new ee(n)),this.updateSketchFeatures_(),this.dispatchEvent(new ts(Qn.DRAWSTART,this.sketchFeature_))}updateSketchFeatures_(){const t=[];this.sketchFeature_&&t.push(this.sketchFeature_),this.sketchLine_&&t.push(this.sketchLine_),this.sketchPoint_&&t.push(this.sketchPoint_);const e=this.overlay_.getSource();e.clear(!0),e.addFeatures(t)}updateState_(){const t=this.getMap(),e=this.getActive();(!t||!e)&&this.abortDrawing(),this.overlay_.setMap(e?t:null)}}function Af(){const s=So();return function(t,e){return s[t.getGeometry().getType()]}}function bf(s){switch(s){case"Point":case"MultiPoint":return"Point";case"LineString":case"MultiLineString":return"LineString";case"Polygon":case"MultiPolygon":return"Polygon";case"Circle":return"Circle";default:throw new Error("Invalid type: "+s)}}const yr=Ff,Na=0,dn=1,za=[0,0,0,0],Mi=[],pr={MODIFYSTART:"modifystart",MODIFYEND:"modifyend"};class xr extends Wt{constructor(t,e,i){super(t),this.features=e,this.mapBrowserEvent=i}}class Df extends Ke{constructor(t){super(t),this.on,this.once,this.un,this.boundHandleFeatureChange_=this.handleFeatureChange_.bind(this),this.condition_=t.condition?t.condition:Bl,this.defaultDeleteCondition_=function(i){return xd(i)&&Yl(i)},this.deleteCondition_=t.deleteCondition?t.deleteCondition:this.defaultDeleteCondition_,this.insertVertexCondition_=t.insertVertexCondition?t.insertVertexCondition:xs,this.vertexFeature_=null,this.vertexSegments_=null,this.lastPixel_=[0,0],this.ignoreNextSingleClick_=!1,this.featuresBeingModified_=null,this.rBush_=new Ts,this.pixelTolerance_=t.pixelTolerance!==void 0?t.pixelTolerance:10,this.snappedToVertex_=!1,this.changingFeature_=!1,this.dragSegments_=[],this.overlay_=new Bs({source:new Do({useSpatialIndex:!1,wrapX:!!t.wrapX}),style:t.style?t.style:kf(),updateWhileAnimating:!0,updateWhileInteracting:!0}),this.SEGMENT_WRITERS_={Point:this.writePointGeometry_.bind(this),LineString:this.writeLineStringGeometry_.bind(this),LinearRing:this.writeLineStringGeometry_.bind(this),Polygon:this.writePolygonGeometry_.bind(this),MultiPoint:this.writeMultiPointGeometry_.bind(this),MultiLineString:this.writeMultiLineStringGeometry_.bind(this),MultiPolygon:this.writeMultiPolygonGeometry_.bind(this),Circle:this.writeCircleGeometry_.bind(this),GeometryCollection:this.writeGeometryCollectionGeometry_.bind(this)},this.source_=null,this.hitDetection_=null;let e;if(t.features?e=t.features:t.source&&(this.source_=t.source,e=new Nt(this.source_.getFeatures()),this.source_.addEventListener(Et.ADDFEATURE,this.handleSourceAdd_.bind(this)),this.source_.addEventListener(Et.REMOVEFEATURE,this.handleSourceRemove_.bind(this))),!e)throw new Error("The modify interaction requires features, a source or a layer");t.hitDetection&&(this.hitDetection_=t.hitDetection),this.features_=e,this.features_.forEach(this.addFeature_.bind(this)),this.features_.addEventListener(lt.ADD,this.handleFeatureAdd_.bind(this)),this.features_.addEventListener(lt.REMOVE,this.handleFeatureRemove_.bind(this)),this.lastPointerEvent_=null,this.delta_=[0,0],this.snapToPointer_=t.snapToPointer===void 0?!this.hitDetection_:t.snapToPointer}addFeature_(t){const e=t.getGeometry();if(e){const n=this.SEGMENT_WRITERS_[e.getType()];n&&n(t,e)}const i=this.getMap();i&&i.isRendered()&&this.getActive()&&this.handlePointerAtPixel_(this.lastPixel_,i),t.addEventListener(A.CHANGE,this.boundHandleFeatureChange_)}willModifyFeatures_(t,e){if(!this.featuresBeingModified_){this.featuresBeingModified_=new Nt;const i=this.featuresBeingModified_.getArray();for(let n=0,r=e.length;n<r;++n){const o=e[n];for(let a=0,l=o.length;a<l;++a){const h=o[a].feature;h&&!i.includes(h)&&this.featuresBeingModified_.push(h)}}this.featuresBeingModified_.getLength()===0?this.featuresBeingModified_=null:this.dispatchEvent(new xr(pr.MODIFYSTART,this.featuresBeingModified_,t))}}removeFeature_(t){this.removeFeatureSegmentData_(t),this.vertexFeature_&&this.features_.getLength()===0&&(this.overlay_.getSource().removeFeature(this.vertexFeature_),this.vertexFeature_=null),t.removeEventListener(A.CHANGE,this.boundHandleFeatureChange_)}removeFeatureSegmentData_(t){const e=this.rBush_,i=[];e.forEach(function(n){t===n.feature&&i.push(n)});for(let n=i.length-1;n>=0;--n){const r=i[n];for(let o=this.dragSegments_.length-1;o>=0;--o)this.dragSegments_[o][0]===r&&this.dragSegments_.splice(o,1);e.remove(r)}}setActive(t){this.vertexFeature_&&!t&&(this.overlay_.getSource().removeFeature(this.vertexFeature_),this.vertexFeature_=null),super.setActive(t)}setMap(t){this.overlay_.setMap(t),super.setMap(t)}getOverlay(){return this.overlay_}handleSourceAdd_(t){t.feature&&this.features_.push(t.feature)}handleSourceRemove_(t){t.feature&&this.features_.remove(t.feature)}handleFeatureAdd_(t){this.addFeature_(t.element)}handleFeatureChange_(t){if(!this.changingFeature_){const e=t.target;this.removeFeature_(e),this.addFeature_(e)}}handleFeatureRemove_(t){this.removeFeature_(t.element)}writePointGeometry_(t,e){const i=e.getCoordinates(),n={feature:t,geometry:e,segment:[i,i]};this.rBush_.insert(e.getExtent(),n)}writeMultiPointGeometry_(t,e){const i=e.getCoordinates();for(let n=0,r=i.length;n<r;++n){const o=i[n],a={feature:t,geometry:e,depth:[n],index:n,segment:[o,o]};this.rBush_.insert(e.getExtent(),a)}}writeLineStringGeometry_(t,e){const i=e.getCoordinates();for(let n=0,r=i.length-1;n<r;++n){const o=i.slice(n,n+2),a={feature:t,geometry:e,index:n,segment:o};this.rBush_.insert(St(o),a)}}writeMultiLineStringGeometry_(t,e){const i=e.getCoordinates();for(let n=0,r=i.length;n<r;++n){const o=i[n];for(let a=0,l=o.length-1;a<l;++a){const h=o.slice(a,a+2),c={feature:t,geometry:e,depth:[n],index:a,segment:h};this.rBush_.insert(St(h),c)}}}writePolygonGeometry_(t,e){const i=e.getCoordinates();for(let n=0,r=i.length;n<r;++n){const o=i[n];for(let a=0,l=o.length-1;a<l;++a){const h=o.slice(a,a+2),c={feature:t,geometry:e,depth:[n],index:a,segment:h};this.rBush_.insert(St(h),c)}}}writeMultiPolygonGeometry_(t,e){const i=e.getCoordinates();for(let n=0,r=i.length;n<r;++n){const o=i[n];for(let a=0,l=o.length;a<l;++a){const h=o[a];for(let c=0,u=h.length-1;c<u;++c){const d=h.slice(c,c+2),f={feature:t,geometry:e,depth:[a,n],index:c,segment:d};this.rBush_.insert(St(d),f)}}}}writeCircleGeometry_(t,e){const i=e.getCenter(),n={feature:t,geometry:e,index:Na,segment:[i,i]},r={feature:t,geometry:e,index:dn,segment:[i,i]},o=[n,r];n.featureSegments=o,r.featureSegments=o,this.rBush_.insert(ln(i),n);let a=e;this.rBush_.insert(a.getExtent(),r)}writeGeometryCollectionGeometry_(t,e){const i=e.getGeometriesArray();for(let n=0;n<i.length;++n){const r=i[n],o=this.SEGMENT_WRITERS_[r.getType()];o(t,r)}}createOrUpdateVertexFeature_(t,e,i){let n=this.vertexFeature_;return n?n.getGeometry().setCoordinates(t):(n=new Gt(new ee(t)),this.vertexFeature_=n,this.overlay_.getSource().addFeature(n)),n.set("features",e),n.set("geometries",i),n}handleEvent(t){if(!t.originalEvent)return!0;this.lastPointerEvent_=t;let e;return!t.map.getView().getInteracting()&&t.type==K.POINTERMOVE&&!this.handlingDownUpSequence&&this.handlePointerMove_(t),this.vertexFeature_&&this.deleteCondition_(t)&&(t.type!=K.SINGLECLICK||!this.ignoreNextSingleClick_?e=this.removePoint():e=!0),t.type==K.SINGLECLICK&&(this.ignoreNextSingleClick_=!1),super.handleEvent(t)&&!e}handleDragEvent(t){this.ignoreNextSingleClick_=!1,this.willModifyFeatures_(t,this.dragSegments_);const e=[t.coordinate[0]+this.delta_[0],t.coordinate[1]+this.delta_[1]],i=[],n=[];for(let r=0,o=this.dragSegments_.length;r<o;++r){const a=this.dragSegments_[r],l=a[0],h=l.feature;i.includes(h)||i.push(h);const c=l.geometry;n.includes(c)||n.push(c);const u=l.depth;let d;const f=l.segment,g=a[1];for(;e.length<c.getStride();)e.push(f[g][e.length]);switch(c.getType()){case"Point":d=e,f[0]=e,f[1]=e;break;case"MultiPoint":d=c.getCoordinates(),d[l.index]=e,f[0]=e,f[1]=e;break;case"LineString":d=c.getCoordinates(),d[l.index+g]=e,f[g]=e;break;case"MultiLineString":d=c.getCoordinates(),d[u[0]][l.index+g]=e,f[g]=e;break;case"Polygon":d=c.getCoordinates(),d[u[0]][l.index+g]=e,f[g]=e;break;case"MultiPolygon":d=c.getCoordinates(),d[u[1]][u[0]][l.index+g]=e,f[g]=e;break;case"Circle":if(f[0]=e,f[1]=e,l.index===Na)this.changingFeature_=!0,c.setCenter(e),this.changingFeature_=!1;else{this.changingFeature_=!0,t.map.getView().getProjection();let _=us(st(c.getCenter()),st(e));c.setRadius(_),this.changingFeature_=!1}break}d&&this.setGeometryCoordinates_(c,d)}this.createOrUpdateVertexFeature_(e,i,n)}handleDownEvent(t){if(!this.condition_(t))return!1;const e=t.coordinate;this.handlePointerAtPixel_(t.pixel,t.map,e),this.dragSegments_.length=0,this.featuresBeingModified_=null;const i=this.vertexFeature_;if(i){t.map.getView().getProjection();const n=[],r=i.getGeometry().getCoordinates(),o=St([r]),a=this.rBush_.getInExtent(o),l={};a.sort(Of);for(let h=0,c=a.length;h<c;++h){const u=a[h],d=u.segment;let f=G(u.geometry);const g=u.depth;if(g&&(f+="-"+g.join("-")),l[f]||(l[f]=new Array(2)),u.geometry.getType()==="Circle"&&u.index===dn){const _=Wa(e,u);Jt(_,r)&&!l[f][0]&&(this.dragSegments_.push([u,0]),l[f][0]=u);continue}if(Jt(d[0],r)&&!l[f][0]){this.dragSegments_.push([u,0]),l[f][0]=u;continue}if(Jt(d[1],r)&&!l[f][1]){if(l[f][0]&&l[f][0].index===0){let _=u.geometry.getCoordinates();switch(u.geometry.getType()){case"LineString":case"MultiLineString":continue;case"MultiPolygon":_=_[g[1]];case"Polygon":if(u.index!==_[g[0]].length-2)continue;break}}this.dragSegments_.push([u,1]),l[f][1]=u;continue}G(d)in this.vertexSegments_&&!l[f][0]&&!l[f][1]&&this.insertVertexCondition_(t)&&n.push(u)}n.length&&this.willModifyFeatures_(t,[n]);for(let h=n.length-1;h>=0;--h)this.insertVertex_(n[h],r)}return!!this.vertexFeature_}handleUpEvent(t){for(let e=this.dragSegments_.length-1;e>=0;--e){const i=this.dragSegments_[e][0],n=i.geometry;if(n.getType()==="Circle"){const r=n.getCenter(),o=i.featureSegments[0],a=i.featureSegments[1];o.segment[0]=r,o.segment[1]=r,a.segment[0]=r,a.segment[1]=r,this.rBush_.update(ln(r),o);let l=n;this.rBush_.update(l.getExtent(),a)}else this.rBush_.update(St(i.segment),i)}return this.featuresBeingModified_&&(this.dispatchEvent(new xr(pr.MODIFYEND,this.featuresBeingModified_,t)),this.featuresBeingModified_=null),!1}handlePointerMove_(t){this.lastPixel_=t.pixel,this.handlePointerAtPixel_(t.pixel,t.map,t.coordinate)}handlePointerAtPixel_(t,e,i){const n=i||e.getCoordinateFromPixel(t);e.getView().getProjection();const r=function(l,h){return Xa(n,l)-Xa(n,h)};let o,a;if(this.hitDetection_){const l=typeof this.hitDetection_=="object"?h=>h===this.hitDetection_:void 0;e.forEachFeatureAtPixel(t,(h,c,u)=>{u&&u.getType()==="Point"&&(u=new ee(ai(u.getCoordinates())));const d=u||h.getGeometry();if(h instanceof Gt&&this.features_.getArray().includes(h)){a=d;const f=h.getGeometry().getFlatCoordinates().slice(0,2);o=[{feature:h,geometry:a,segment:[f,f]}]}return!0},{layerFilter:l})}if(!o){const l=Xe(ln(n,za)),h=e.getView().getResolution()*this.pixelTolerance_,c=An(Mn(l,h,za));o=this.rBush_.getInExtent(c)}if(o&&o.length>0){const l=o.sort(r)[0],h=l.segment;let c=Wa(n,l);const u=e.getPixelFromCoordinate(c);let d=us(t,u);if(a||d<=this.pixelTolerance_){const f={};if(f[G(h)]=!0,this.snapToPointer_||(this.delta_[0]=c[0]-n[0],this.delta_[1]=c[1]-n[1]),l.geometry.getType()==="Circle"&&l.index===dn)this.snappedToVertex_=!0,this.createOrUpdateVertexFeature_(c,[l.feature],[l.geometry]);else{const g=e.getPixelFromCoordinate(h[0]),_=e.getPixelFromCoordinate(h[1]),m=ve(u,g),y=ve(u,_);d=Math.sqrt(Math.min(m,y)),this.snappedToVertex_=d<=this.pixelTolerance_,this.snappedToVertex_&&(c=m>y?h[1]:h[0]),this.createOrUpdateVertexFeature_(c,[l.feature],[l.geometry]);const p={};p[G(l.geometry)]=!0;for(let x=1,E=o.length;x<E;++x){const C=o[x].segment;if(Jt(h[0],C[0])&&Jt(h[1],C[1])||Jt(h[0],C[1])&&Jt(h[1],C[0])){const R=G(o[x].geometry);R in p||(p[R]=!0,f[G(C)]=!0)}else break}}this.vertexSegments_=f;return}}this.vertexFeature_&&(this.overlay_.getSource().removeFeature(this.vertexFeature_),this.vertexFeature_=null)}insertVertex_(t,e){const i=t.segment,n=t.feature,r=t.geometry,o=t.depth,a=t.index;let l;for(;e.length<r.getStride();)e.push(0);switch(r.getType()){case"MultiLineString":l=r.getCoordinates(),l[o[0]].splice(a+1,0,e);break;case"Polygon":l=r.getCoordinates(),l[o[0]].splice(a+1,0,e);break;case"MultiPolygon":l=r.getCoordinates(),l[o[1]][o[0]].splice(a+1,0,e);break;case"LineString":l=r.getCoordinates(),l.splice(a+1,0,e);break;default:return}this.setGeometryCoordinates_(r,l);const h=this.rBush_;h.remove(t),this.updateSegmentIndices_(r,a,o,1);const c={segment:[i[0],e],feature:n,geometry:r,depth:o,index:a};h.insert(St(c.segment),c),this.dragSegments_.push([c,1]);const u={segment:[e,i[1]],feature:n,geometry:r,depth:o,index:a+1};h.insert(St(u.segment),u),this.dragSegments_.push([u,0]),this.ignoreNextSingleClick_=!0}removePoint(){if(this.lastPointerEvent_&&this.lastPointerEvent_.type!=K.POINTERDRAG){const t=this.lastPointerEvent_;this.willModifyFeatures_(t,this.dragSegments_);const e=this.removeVertex_();return this.featuresBeingModified_&&this.dispatchEvent(new xr(pr.MODIFYEND,this.featuresBeingModified_,t)),this.featuresBeingModified_=null,e}return!1}removeVertex_(){const t=this.dragSegments_,e={};let i=!1,n,r,o,a,l,h,c,u,d,f,g;for(l=t.length-1;l>=0;--l)o=t[l],f=o[0],g=G(f.feature),f.depth&&(g+="-"+f.depth.join("-")),g in e||(e[g]={}),o[1]===0?(e[g].right=f,e[g].index=f.index):o[1]==1&&(e[g].left=f,e[g].index=f.index+1);for(g in e){switch(d=e[g].right,c=e[g].left,h=e[g].index,u=h-1,c!==void 0?f=c:f=d,u<0&&(u=0),a=f.geometry,r=a.getCoordinates(),n=r,i=!1,a.getType()){case"MultiLineString":r[f.depth[0]].length>2&&(r[f.depth[0]].splice(h,1),i=!0);break;case"LineString":r.length>2&&(r.splice(h,1),i=!0);break;case"MultiPolygon":n=n[f.depth[1]];case"Polygon":n=n[f.depth[0]],n.length>4&&(h==n.length-1&&(h=0),n.splice(h,1),i=!0,h===0&&(n.pop(),n.push(n[0]),u=n.length-1));break}if(i){this.setGeometryCoordinates_(a,r);const _=[];if(c!==void 0&&(this.rBush_.remove(c),_.push(c.segment[0])),d!==void 0&&(this.rBush_.remove(d),_.push(d.segment[1])),c!==void 0&&d!==void 0){const m={depth:f.depth,feature:f.feature,geometry:f.geometry,index:u,segment:_};this.rBush_.insert(St(m.segment),m)}this.updateSegmentIndices_(a,h,f.depth,-1),this.vertexFeature_&&(this.overlay_.getSource().removeFeature(this.vertexFeature_),this.vertexFeature_=null),t.length=0}}return i}setGeometryCoordinates_(t,e){this.changingFeature_=!0,t.setCoordinates(e),this.changingFeature_=!1}updateSegmentIndices_(t,e,i,n){this.rBush_.forEachInExtent(t.getExtent(),function(r){r.geometry===t&&(i===void 0||r.depth===void 0||Me(r.depth,i))&&r.index>e&&(r.index+=n)})}}function Of(s,t){return s.index-t.index}function Xa(s,t,e){const i=t.geometry;if(i.getType()==="Circle"){let r=i;if(t.index===dn){const o=ve(r.getCenter(),st(s)),a=Math.sqrt(o)-r.getRadius();return a*a}}const n=st(s);return Mi[0]=st(t.segment[0]),Mi[1]=st(t.segment[1]),Uh(n,Mi)}function Wa(s,t,e){const i=t.geometry;if(i.getType()==="Circle"&&t.index===dn)return ai(i.getClosestPoint(st(s)));const n=st(s);return Mi[0]=st(t.segment[0]),Mi[1]=st(t.segment[1]),ai(Qr(n,Mi))}function kf(){const s=So();return function(t,e){return s.Point}}const Gf=Df,Nf={SELECT:"select"};class zf extends Wt{constructor(t,e,i,n){super(t),this.selected=e,this.deselected=i,this.mapBrowserEvent=n}}const ss={};class Oo extends qi{constructor(t){super(),this.on,this.once,this.un,t=t||{},this.boundAddFeature_=this.addFeature_.bind(this),this.boundRemoveFeature_=this.removeFeature_.bind(this),this.condition_=t.condition?t.condition:Yl,this.addCondition_=t.addCondition?t.addCondition:Yr,this.removeCondition_=t.removeCondition?t.removeCondition:Yr,this.toggleCondition_=t.toggleCondition?t.toggleCondition:bo,this.multi_=t.multi?t.multi:!1,this.filter_=t.filter?t.filter:Ie,this.hitTolerance_=t.hitTolerance?t.hitTolerance:0,this.style_=t.style!==void 0?t.style:Xf(),this.features_=t.features||new Nt;let e;if(t.layers)if(typeof t.layers=="function")e=t.layers;else{const i=t.layers;e=function(n){return i.includes(n)}}else e=Ie;this.layerFilter_=e,this.featureLayerAssociation_={}}addFeatureLayerAssociation_(t,e){this.featureLayerAssociation_[G(t)]=e}getFeatures(){return this.features_}getHitTolerance(){return this.hitTolerance_}getLayer(t){return this.featureLayerAssociation_[G(t)]}setHitTolerance(t){this.hitTolerance_=t}setMap(t){this.getMap()&&this.style_&&this.features_.forEach(this.restorePreviousStyle_.bind(this)),super.setMap(t),t?(this.features_.addEventListener(lt.ADD,this.boundAddFeature_),this.features_.addEventListener(lt.REMOVE,this.boundRemoveFeature_),this.style_&&this.features_.forEach(this.applySelectedStyle_.bind(this))):(this.features_.removeEventListener(lt.ADD,this.boundAddFeature_),this.features_.removeEventListener(lt.REMOVE,this.boundRemoveFeature_))}addFeature_(t){const e=t.element;if(this.style_&&this.applySelectedStyle_(e),!this.getLayer(e)){const i=this.getMap().getAllLayers().find(function(n){if(n instanceof Bs&&n.getSource()&&n.getSource().hasFeature(e))return n});i&&this.addFeatureLayerAssociation_(e,i)}}removeFeature_(t){this.style_&&this.restorePreviousStyle_(t.element)}getStyle(){return this.style_}applySelectedStyle_(t){const e=G(t);e in ss||(ss[e]=t.getStyle()),t.setStyle(this.style_)}restorePreviousStyle_(t){const e=this.getMap().getInteractions().getArray();for(let n=e.length-1;n>=0;--n){const r=e[n];if(r!==this&&r instanceof Oo&&r.getStyle()&&r.getFeatures().getArray().lastIndexOf(t)!==-1){t.setStyle(r.getStyle());return}}const i=G(t);t.setStyle(ss[i]),delete ss[i]}removeFeatureLayerAssociation_(t){delete this.featureLayerAssociation_[G(t)]}handleEvent(t){if(!this.condition_(t))return!0;const e=this.addCondition_(t),i=this.removeCondition_(t),n=this.toggleCondition_(t),r=!e&&!i&&!n,o=t.map,a=this.getFeatures(),l=[],h=[];if(r){Bi(this.featureLayerAssociation_),o.forEachFeatureAtPixel(t.pixel,(c,u)=>{if(!(!(c instanceof Gt)||!this.filter_(c,u)))return this.addFeatureLayerAssociation_(c,u),h.push(c),!this.multi_},{layerFilter:this.layerFilter_,hitTolerance:this.hitTolerance_});for(let c=a.getLength()-1;c>=0;--c){const u=a.item(c),d=h.indexOf(u);d>-1?h.splice(d,1):(a.remove(u),l.push(u))}h.length!==0&&a.extend(h)}else{o.forEachFeatureAtPixel(t.pixel,(c,u)=>{if(!(!(c instanceof Gt)||!this.filter_(c,u)))return(e||n)&&!a.getArray().includes(c)?(this.addFeatureLayerAssociation_(c,u),h.push(c)):(i||n)&&a.getArray().includes(c)&&(l.push(c),this.removeFeatureLayerAssociation_(c)),!this.multi_},{layerFilter:this.layerFilter_,hitTolerance:this.hitTolerance_});for(let c=l.length-1;c>=0;--c)a.remove(l[c]);a.extend(h)}return(h.length>0||l.length>0)&&this.dispatchEvent(new zf(Nf.SELECT,h,l,t)),!0}}function Xf(){const s=So();return Zt(s.Polygon,s.LineString),Zt(s.GeometryCollection,s.LineString),function(t){return t.getGeometry()?s[t.getGeometry().getType()]:null}}const Wf={SNAP:"snap"};class Yf extends Wt{constructor(t,e){super(t),this.vertex=e.vertex,this.vertexPixel=e.vertexPixel,this.feature=e.feature,this.segment=e.segment}}function Ya(s){return s.feature?s.feature:s.element?s.element:null}const Er=[];class jf extends Ke{constructor(t){t=t||{};const e=t;e.handleDownEvent||(e.handleDownEvent=Ie),e.stopDown||(e.stopDown=hi),super(e),this.on,this.once,this.un,this.source_=t.source?t.source:null,this.vertex_=t.vertex!==void 0?t.vertex:!0,this.edge_=t.edge!==void 0?t.edge:!0,this.features_=t.features?t.features:null,this.featuresListenerKeys_=[],this.featureChangeListenerKeys_={},this.indexedFeaturesExtents_={},this.pendingFeatures_={},this.pixelTolerance_=t.pixelTolerance!==void 0?t.pixelTolerance:10,this.rBush_=new Ts,this.GEOMETRY_SEGMENTERS_={Point:this.segmentPointGeometry_.bind(this),LineString:this.segmentLineStringGeometry_.bind(this),LinearRing:this.segmentLineStringGeometry_.bind(this),Polygon:this.segmentPolygonGeometry_.bind(this),MultiPoint:this.segmentMultiPointGeometry_.bind(this),MultiLineString:this.segmentMultiLineStringGeometry_.bind(this),MultiPolygon:this.segmentMultiPolygonGeometry_.bind(this),GeometryCollection:this.segmentGeometryCollectionGeometry_.bind(this),Circle:this.segmentCircleGeometry_.bind(this)}}addFeature(t,e){e=e!==void 0?e:!0;const i=G(t),n=t.getGeometry();if(n){const r=this.GEOMETRY_SEGMENTERS_[n.getType()];if(r){this.indexedFeaturesExtents_[i]=n.getExtent(Xt());const o=[];if(r(o,n),o.length===1)this.rBush_.insert(St(o[0]),{feature:t,segment:o[0]});else if(o.length>1){const a=o.map(h=>St(h)),l=o.map(h=>({feature:t,segment:h}));this.rBush_.load(a,l)}}}e&&(this.featureChangeListenerKeys_[i]=B(t,A.CHANGE,this.handleFeatureChange_,this))}getFeatures_(){let t;return this.features_?t=this.features_:this.source_&&(t=this.source_.getFeatures()),t}handleEvent(t){const e=this.snapTo(t.pixel,t.coordinate,t.map);return e&&(t.coordinate=e.vertex.slice(0,2),t.pixel=e.vertexPixel,this.dispatchEvent(new Yf(Wf.SNAP,{vertex:t.coordinate,vertexPixel:t.pixel,feature:e.feature,segment:e.segment}))),super.handleEvent(t)}handleFeatureAdd_(t){const e=Ya(t);e&&this.addFeature(e)}handleFeatureRemove_(t){const e=Ya(t);e&&this.removeFeature(e)}handleFeatureChange_(t){const e=t.target;if(this.handlingDownUpSequence){const i=G(e);i in this.pendingFeatures_||(this.pendingFeatures_[i]=e)}else this.updateFeature_(e)}handleUpEvent(t){const e=Object.values(this.pendingFeatures_);return e.length&&(e.forEach(this.updateFeature_.bind(this)),this.pendingFeatures_={}),!1}removeFeature(t,e){const i=e!==void 0?e:!0,n=G(t),r=this.indexedFeaturesExtents_[n];if(r){const o=this.rBush_,a=[];o.forEachInExtent(r,function(l){t===l.feature&&a.push(l)});for(let l=a.length-1;l>=0;--l)o.remove(a[l])}i&&(it(this.featureChangeListenerKeys_[n]),delete this.featureChangeListenerKeys_[n])}setMap(t){const e=this.getMap(),i=this.featuresListenerKeys_,n=this.getFeatures_();e&&(i.forEach(it),i.length=0,this.rBush_.clear(),Object.values(this.featureChangeListenerKeys_).forEach(it),this.featureChangeListenerKeys_={}),super.setMap(t),t&&(this.features_?i.push(B(this.features_,lt.ADD,this.handleFeatureAdd_,this),B(this.features_,lt.REMOVE,this.handleFeatureRemove_,this)):this.source_&&i.push(B(this.source_,Et.ADDFEATURE,this.handleFeatureAdd_,this),B(this.source_,Et.REMOVEFEATURE,this.handleFeatureRemove_,this)),n.forEach(r=>this.addFeature(r)))}snapTo(t,e,i){i.getView().getProjection();const n=st(e),r=An(Mn(St([n]),i.getView().getResolution()*this.pixelTolerance_)),o=this.rBush_.getInExtent(r),a=o.length;if(a===0)return null;let l,h=1/0,c,u=null;const d=this.pixelTolerance_*this.pixelTolerance_,f=()=>{if(l){const g=i.getPixelFromCoordinate(l);if(ve(t,g)<=d)return{vertex:l,vertexPixel:[Math.round(g[0]),Math.round(g[1])],feature:c,segment:u}}return null};if(this.vertex_){for(let _=0;_<a;++_){const m=o[_];m.feature.getGeometry().getType()!=="Circle"&&m.segment.forEach(y=>{const p=st(y),x=ve(n,p);x<h&&(l=y,h=x,c=m.feature)})}const g=f();if(g)return g}if(this.edge_){for(let _=0;_<a;++_){let m=null;const y=o[_];if(y.feature.getGeometry().getType()==="Circle"){let p=y.feature.getGeometry();m=Bh(n,p)}else{const[p,x]=y.segment;x&&(Er[0]=st(p),Er[1]=st(x),m=Qr(n,Er))}if(m){const p=ve(n,m);p<h&&(l=ai(m),u=y.feature.getGeometry().getType()==="Circle"?null:y.segment,h=p)}}const g=f();if(g)return g}return null}updateFeature_(t){this.removeFeature(t,!1),this.addFeature(t,!1)}segmentCircleGeometry_(t,e){this.getMap().getView().getProjection();const r=Sc(e).getCoordinates()[0];for(let o=0,a=r.length-1;o<a;++o)t.push(r.slice(o,o+2))}segmentGeometryCollectionGeometry_(t,e){const i=e.getGeometriesArray();for(let n=0;n<i.length;++n){const r=this.GEOMETRY_SEGMENTERS_[i[n].getType()];r&&r(t,i[n])}}segmentLineStringGeometry_(t,e){const i=e.getCoordinates();for(let n=0,r=i.length-1;n<r;++n)t.push(i.slice(n,n+2))}segmentMultiLineStringGeometry_(t,e){const i=e.getCoordinates();for(let n=0,r=i.length;n<r;++n){const o=i[n];for(let a=0,l=o.length-1;a<l;++a)t.push(o.slice(a,a+2))}}segmentMultiPointGeometry_(t,e){e.getCoordinates().forEach(i=>{t.push([i])})}segmentMultiPolygonGeometry_(t,e){const i=e.getCoordinates();for(let n=0,r=i.length;n<r;++n){const o=i[n];for(let a=0,l=o.length;a<l;++a){const h=o[a];for(let c=0,u=h.length-1;c<u;++c)t.push(h.slice(c,c+2))}}}segmentPointGeometry_(t,e){t.push([e.getCoordinates()])}segmentPolygonGeometry_(t,e){const i=e.getCoordinates();for(let n=0,r=i.length;n<r;++n){const o=i[n];for(let a=0,l=o.length-1;a<l;++a)t.push(o.slice(a,a+2))}}}const Bf=jf;class Vf{constructor(t){this.highWaterMark=t!==void 0?t:2048,this.count_=0,this.entries_={},this.oldest_=null,this.newest_=null}canExpireCache(){return this.highWaterMark>0&&this.getCount()>this.highWaterMark}expireCache(t){for(;this.canExpireCache();)this.pop()}clear(){this.count_=0,this.entries_={},this.oldest_=null,this.newest_=null}containsKey(t){return this.entries_.hasOwnProperty(t)}forEach(t){let e=this.oldest_;for(;e;)t(e.value_,e.key_,this),e=e.newer}get(t,e){const i=this.entries_[t];return H(i!==void 0,"Tried to get a value for a key that does not exist in the cache"),i===this.newest_||(i===this.oldest_?(this.oldest_=this.oldest_.newer,this.oldest_.older=null):(i.newer.older=i.older,i.older.newer=i.newer),i.newer=null,i.older=this.newest_,this.newest_.newer=i,this.newest_=i),i.value_}remove(t){const e=this.entries_[t];return H(e!==void 0,"Tried to get a value for a key that does not exist in the cache"),e===this.newest_?(this.newest_=e.older,this.newest_&&(this.newest_.newer=null)):e===this.oldest_?(this.oldest_=e.newer,this.oldest_&&(this.oldest_.older=null)):(e.newer.older=e.older,e.older.newer=e.newer),delete this.entries_[t],--this.count_,e.value_}getCount(){return this.count_}getKeys(){const t=new Array(this.count_);let e=0,i;for(i=this.newest_;i;i=i.older)t[e++]=i.key_;return t}getValues(){const t=new Array(this.count_);let e=0,i;for(i=this.newest_;i;i=i.older)t[e++]=i.value_;return t}peekLast(){return this.oldest_.value_}peekLastKey(){return this.oldest_.key_}peekFirstKey(){return this.newest_.key_}peek(t){var e;return(e=this.entries_[t])==null?void 0:e.value_}pop(){const t=this.oldest_;return delete this.entries_[t.key_],t.newer&&(t.newer.older=null),this.oldest_=t.newer,this.oldest_||(this.newest_=null),--this.count_,t.value_}replace(t,e){this.get(t),this.entries_[t].value_=e}set(t,e){H(!(t in this.entries_),"Tried to set a value for a key that is used already");const i={key_:t,newer:null,older:this.newest_,value_:e};this.newest_?this.newest_.newer=i:this.oldest_=i,this.newest_=i,this.entries_[t]=i,++this.count_}setSize(t){this.highWaterMark=t}}class oh extends vs{constructor(t,e,i){super(),i=i||{},this.tileCoord=t,this.state=e,this.interimTile=null,this.key="",this.transition_=i.transition===void 0?250:i.transition,this.transitionStarts_={},this.interpolate=!!i.interpolate}changed(){this.dispatchEvent(A.CHANGE)}release(){this.state===F.ERROR&&this.setState(F.EMPTY)}getKey(){return this.key+"/"+this.tileCoord}getInterimTile(){let t=this.interimTile;if(!t)return this;do{if(t.getState()==F.LOADED)return this.transition_=0,t;t=t.interimTile}while(t);return this}refreshInterimChain(){let t=this.interimTile;if(!t)return;let e=this;do{if(t.getState()==F.LOADED){t.interimTile=null;break}t.getState()==F.LOADING?e=t:t.getState()==F.IDLE?e.interimTile=t.interimTile:e=t,t=e.interimTile}while(t)}getTileCoord(){return this.tileCoord}getState(){return this.state}setState(t){if(this.state!==F.ERROR&&this.state>t)throw new Error("Tile load sequence violation");this.state=t,this.changed()}load(){b()}getAlpha(t,e){if(!this.transition_)return 1;let i=this.transitionStarts_[t];if(!i)i=e,this.transitionStarts_[t]=i;else if(i===-1)return 1;const n=e-i+1e3/60;return n>=this.transition_?1:rl(n/this.transition_)}inTransition(t){return this.transition_?this.transitionStarts_[t]!==-1:!1}endTransition(t){this.transition_&&(this.transitionStarts_[t]=-1)}}class ah extends oh{constructor(t,e,i,n,r,o){super(t,e,o),this.crossOrigin_=n,this.src_=i,this.key=i,this.image_=new Image,n!==null&&(this.image_.crossOrigin=n),this.unlisten_=null,this.tileLoadFunction_=r}getImage(){return this.image_}setImage(t){this.image_=t,this.state=F.LOADED,this.unlistenImage_(),this.changed()}handleImageError_(){this.state=F.ERROR,this.unlistenImage_(),this.image_=Uf(),this.changed()}handleImageLoad_(){const t=this.image_;t.naturalWidth&&t.naturalHeight?this.state=F.LOADED:this.state=F.EMPTY,this.unlistenImage_(),this.changed()}load(){this.state==F.ERROR&&(this.state=F.IDLE,this.image_=new Image,this.crossOrigin_!==null&&(this.image_.crossOrigin=this.crossOrigin_)),this.state==F.IDLE&&(this.state=F.LOADING,this.changed(),this.tileLoadFunction_(this,this.src_),this.unlisten_=tu(this.image_,this.handleImageLoad_.bind(this),this.handleImageError_.bind(this)))}unlistenImage_(){this.unlisten_&&(this.unlisten_(),this.unlisten_=null)}}function Uf(){const s=yt(1,1);return s.fillStyle="rgba(0,0,0,0)",s.fillRect(0,0,1,1),s.canvas}const Zf=.5,Kf=10,ja=.25;class qf{constructor(t,e,i,n,r,o){this.sourceProj_=t,this.targetProj_=e;let a={};const l=mn(this.targetProj_,this.sourceProj_);this.transformInv_=function(p){const x=p[0]+"/"+p[1];return a[x]||(a[x]=l(p)),a[x]},this.maxSourceExtent_=n,this.errorThresholdSquared_=r*r,this.triangles_=[],this.wrapsXInSource_=!1,this.canWrapXInSource_=this.sourceProj_.canWrapX()&&!!n&&!!this.sourceProj_.getExtent()&&et(n)>=et(this.sourceProj_.getExtent()),this.sourceWorldWidth_=this.sourceProj_.getExtent()?et(this.sourceProj_.getExtent()):null,this.targetWorldWidth_=this.targetProj_.getExtent()?et(this.targetProj_.getExtent()):null;const h=ui(i),c=Ls(i),u=Is(i),d=Ss(i),f=this.transformInv_(h),g=this.transformInv_(c),_=this.transformInv_(u),m=this.transformInv_(d),y=Kf+(o?Math.max(0,Math.ceil(Math.log2(Ir(i)/(o*o*256*256)))):0);if(this.addQuad_(h,c,u,d,f,g,_,m,y),this.wrapsXInSource_){let p=1/0;this.triangles_.forEach(function(x,E,C){p=Math.min(p,x.source[0][0],x.source[1][0],x.source[2][0])}),this.triangles_.forEach(x=>{if(Math.max(x.source[0][0],x.source[1][0],x.source[2][0])-p>this.sourceWorldWidth_/2){const E=[[x.source[0][0],x.source[0][1]],[x.source[1][0],x.source[1][1]],[x.source[2][0],x.source[2][1]]];E[0][0]-p>this.sourceWorldWidth_/2&&(E[0][0]-=this.sourceWorldWidth_),E[1][0]-p>this.sourceWorldWidth_/2&&(E[1][0]-=this.sourceWorldWidth_),E[2][0]-p>this.sourceWorldWidth_/2&&(E[2][0]-=this.sourceWorldWidth_);const C=Math.min(E[0][0],E[1][0],E[2][0]);Math.max(E[0][0],E[1][0],E[2][0])-C<this.sourceWorldWidth_/2&&(x.source=E)}})}a={}}addTriangle_(t,e,i,n,r,o){this.triangles_.push({source:[n,r,o],target:[t,e,i]})}addQuad_(t,e,i,n,r,o,a,l,h){const c=St([r,o,a,l]),u=this.sourceWorldWidth_?et(c)/this.sourceWorldWidth_:null,d=this.sourceWorldWidth_,f=this.sourceProj_.canWrapX()&&u>.5&&u<1;let g=!1;if(h>0){if(this.targetProj_.isGlobal()&&this.targetWorldWidth_){const m=St([t,e,i,n]);g=et(m)/this.targetWorldWidth_>ja||g}!f&&this.sourceProj_.isGlobal()&&u&&(g=u>ja||g)}if(!g&&this.maxSourceExtent_&&isFinite(c[0])&&isFinite(c[1])&&isFinite(c[2])&&isFinite(c[3])&&!It(c,this.maxSourceExtent_))return;let _=0;if(!g&&(!isFinite(r[0])||!isFinite(r[1])||!isFinite(o[0])||!isFinite(o[1])||!isFinite(a[0])||!isFinite(a[1])||!isFinite(l[0])||!isFinite(l[1]))){if(h>0)g=!0;else if(_=(!isFinite(r[0])||!isFinite(r[1])?8:0)+(!isFinite(o[0])||!isFinite(o[1])?4:0)+(!isFinite(a[0])||!isFinite(a[1])?2:0)+(!isFinite(l[0])||!isFinite(l[1])?1:0),_!=1&&_!=2&&_!=4&&_!=8)return}if(h>0){if(!g){const m=[(t[0]+i[0])/2,(t[1]+i[1])/2],y=this.transformInv_(m);let p;f?p=(si(r[0],d)+si(a[0],d))/2-si(y[0],d):p=(r[0]+a[0])/2-y[0];const x=(r[1]+a[1])/2-y[1];g=p*p+x*x>this.errorThresholdSquared_}if(g){if(Math.abs(t[0]-i[0])<=Math.abs(t[1]-i[1])){const m=[(e[0]+i[0])/2,(e[1]+i[1])/2],y=this.transformInv_(m),p=[(n[0]+t[0])/2,(n[1]+t[1])/2],x=this.transformInv_(p);this.addQuad_(t,e,m,p,r,o,y,x,h-1),this.addQuad_(p,m,i,n,x,y,a,l,h-1)}else{const m=[(t[0]+e[0])/2,(t[1]+e[1])/2],y=this.transformInv_(m),p=[(i[0]+n[0])/2,(i[1]+n[1])/2],x=this.transformInv_(p);this.addQuad_(t,m,p,n,r,y,x,l,h-1),this.addQuad_(m,e,i,p,y,o,a,x,h-1)}return}}if(f){if(!this.canWrapXInSource_)return;this.wrapsXInSource_=!0}_&11||this.addTriangle_(t,i,n,r,a,l),_&14||this.addTriangle_(t,i,e,r,a,o),_&&(_&13||this.addTriangle_(e,n,t,o,l,r),_&7||this.addTriangle_(e,n,i,o,l,a))}calculateSourceExtent(){const t=Xt();return this.triangles_.forEach(function(e,i,n){const r=e.source;hn(t,r[0]),hn(t,r[1]),hn(t,r[2])}),t}getTriangles(){return this.triangles_}}let Cr;const Fi=[];function Ba(s,t,e,i,n){s.beginPath(),s.moveTo(0,0),s.lineTo(t,e),s.lineTo(i,n),s.closePath(),s.save(),s.clip(),s.fillRect(0,0,Math.max(t,i)+1,Math.max(e,n)),s.restore()}function wr(s,t){return Math.abs(s[t*4]-210)>2||Math.abs(s[t*4+3]-.75*255)>2}function Hf(){if(Cr===void 0){const s=yt(6,6,Fi);s.globalCompositeOperation="lighter",s.fillStyle="rgba(210, 0, 0, 0.75)",Ba(s,4,5,4,0),Ba(s,4,5,0,5);const t=s.getImageData(0,0,3,3).data;Cr=wr(t,0)||wr(t,4)||wr(t,8),ks(s),Fi.push(s.canvas)}return Cr}function Va(s,t,e,i){const n=Qh(e,t,s);let r=ia(t,i,e);const o=t.getMetersPerUnit();o!==void 0&&(r*=o);const a=s.getMetersPerUnit();a!==void 0&&(r/=a);const l=s.getExtent();if(!l||Gi(l,n)){const h=ia(s,r,n)/r;isFinite(h)&&h>0&&(r/=h)}return r}function $f(s,t,e,i){const n=Ve(e);let r=Va(s,t,n,i);return(!isFinite(r)||r<=0)&&Jr(e,function(o){return r=Va(s,t,o,i),isFinite(r)&&r>0}),r}function Jf(s,t,e,i,n,r,o,a,l,h,c,u,d,f){const g=yt(Math.round(e*s),Math.round(e*t),Fi);if(u||(g.imageSmoothingEnabled=!1),l.length===0)return g.canvas;g.scale(e,e);function _(C){return Math.round(C*e)/e}g.globalCompositeOperation="lighter";const m=Xt();l.forEach(function(C,R,I){Qa(m,C.extent)});let y;const p=e/i,x=(u?1:1+Math.pow(2,-24))/p;if(!d||l.length!==1||h!==0){if(y=yt(Math.round(et(m)*p),Math.round(wt(m)*p),Fi),u||(y.imageSmoothingEnabled=!1),n&&f){const C=(n[0]-m[0])*p,R=-(n[3]-m[3])*p,I=et(n)*p,T=wt(n)*p;y.rect(C,R,I,T),y.clip()}l.forEach(function(C,R,I){const T=(C.extent[0]-m[0])*p,S=-(C.extent[3]-m[3])*p,z=et(C.extent)*p,O=wt(C.extent)*p;C.image.width>0&&C.image.height>0&&y.drawImage(C.image,h,h,C.image.width-2*h,C.image.height-2*h,u?T:Math.round(T),u?S:Math.round(S),u?z:Math.round(T+z)-Math.round(T),u?O:Math.round(S+O)-Math.round(S))})}const E=ui(o);return a.getTriangles().forEach(function(C,R,I){const T=C.source,S=C.target;let z=T[0][0],O=T[0][1],N=T[1][0],U=T[1][1],V=T[2][0],Y=T[2][1];const L=_((S[0][0]-E[0])/r),D=_(-(S[0][1]-E[1])/r),X=_((S[1][0]-E[0])/r),nt=_(-(S[1][1]-E[1])/r),Z=_((S[2][0]-E[0])/r),Q=_(-(S[2][1]-E[1])/r),$=z,ht=O;z=0,O=0,N-=$,U-=ht,V-=$,Y-=ht;const v=[[N,U,0,0,X-L],[V,Y,0,0,Z-L],[0,0,N,U,nt-D],[0,0,V,Y,Q-D]],rt=Ih(v);if(!rt)return;if(g.save(),g.beginPath(),Hf()||!u){g.moveTo(X,nt);const dt=4,Lt=L-X,Kt=D-nt;for(let Pt=0;Pt<dt;Pt++)g.lineTo(X+_((Pt+1)*Lt/dt),nt+_(Pt*Kt/(dt-1))),Pt!=dt-1&&g.lineTo(X+_((Pt+1)*Lt/dt),nt+_((Pt+1)*Kt/(dt-1)));g.lineTo(Z,Q)}else g.moveTo(X,nt),g.lineTo(L,D),g.lineTo(Z,Q);g.clip(),g.transform(rt[0],rt[2],rt[1],rt[3],L,D),g.translate(m[0]-$,m[3]-ht);let bt;if(y)bt=y.canvas,g.scale(x,-x);else{const dt=l[0],Lt=dt.extent;bt=dt.image,g.scale(et(Lt)/bt.width,-wt(Lt)/bt.height)}g.drawImage(bt,0,0),g.restore()}),y&&(ks(y),Fi.push(y.canvas)),c&&(g.save(),g.globalCompositeOperation="source-over",g.strokeStyle="black",g.lineWidth=1,a.getTriangles().forEach(function(C,R,I){const T=C.target,S=(T[0][0]-E[0])/r,z=-(T[0][1]-E[1])/r,O=(T[1][0]-E[0])/r,N=-(T[1][1]-E[1])/r,U=(T[2][0]-E[0])/r,V=-(T[2][1]-E[1])/r;g.beginPath(),g.moveTo(O,N),g.lineTo(S,z),g.lineTo(U,V),g.closePath(),g.stroke()}),g.restore()),g.canvas}class Br extends oh{constructor(t,e,i,n,r,o,a,l,h,c,u,d){super(r,F.IDLE,d),this.renderEdges_=u!==void 0?u:!1,this.pixelRatio_=a,this.gutter_=l,this.canvas_=null,this.sourceTileGrid_=e,this.targetTileGrid_=n,this.wrappedTileCoord_=o||r,this.sourceTiles_=[],this.sourcesListenerKeys_=null,this.sourceZ_=0;const f=n.getTileCoordExtent(this.wrappedTileCoord_),g=this.targetTileGrid_.getExtent();let _=this.sourceTileGrid_.getExtent();const m=g?cn(f,g):f;if(Ir(m)===0){this.state=F.EMPTY;return}const y=t.getExtent();y&&(_?_=cn(_,y):_=y);const p=n.getResolution(this.wrappedTileCoord_[0]),x=$f(t,i,m,p);if(!isFinite(x)||x<=0){this.state=F.EMPTY;return}const E=c!==void 0?c:Zf;if(this.triangulation_=new qf(t,i,m,_,x*E,p),this.triangulation_.getTriangles().length===0){this.state=F.EMPTY;return}this.sourceZ_=e.getZForResolution(x);let C=this.triangulation_.calculateSourceExtent();if(_&&(t.canWrapX()?(C[1]=ct(C[1],_[1],_[3]),C[3]=ct(C[3],_[1],_[3])):C=cn(C,_)),!Ir(C))this.state=F.EMPTY;else{const R=e.getTileRangeForExtentAndZ(C,this.sourceZ_);for(let I=R.minX;I<=R.maxX;I++)for(let T=R.minY;T<=R.maxY;T++){const S=h(this.sourceZ_,I,T,a);S&&this.sourceTiles_.push(S)}this.sourceTiles_.length===0&&(this.state=F.EMPTY)}}getImage(){return this.canvas_}reproject_(){const t=[];if(this.sourceTiles_.forEach(e=>{e&&e.getState()==F.LOADED&&t.push({extent:this.sourceTileGrid_.getTileCoordExtent(e.tileCoord),image:e.getImage()})}),this.sourceTiles_.length=0,t.length===0)this.state=F.ERROR;else{const e=this.wrappedTileCoord_[0],i=this.targetTileGrid_.getTileSize(e),n=typeof i=="number"?i:i[0],r=typeof i=="number"?i:i[1],o=this.targetTileGrid_.getResolution(e),a=this.sourceTileGrid_.getResolution(this.sourceZ_),l=this.targetTileGrid_.getTileCoordExtent(this.wrappedTileCoord_);this.canvas_=Jf(n,r,this.pixelRatio_,a,this.sourceTileGrid_.getExtent(),o,l,this.triangulation_,t,this.gutter_,this.renderEdges_,this.interpolate),this.state=F.LOADED}this.changed()}load(){if(this.state==F.IDLE){this.state=F.LOADING,this.changed();let t=0;this.sourcesListenerKeys_=[],this.sourceTiles_.forEach(e=>{const i=e.getState();if(i==F.IDLE||i==F.LOADING){t++;const n=B(e,A.CHANGE,function(r){const o=e.getState();(o==F.LOADED||o==F.ERROR||o==F.EMPTY)&&(it(n),t--,t===0&&(this.unlistenSources_(),this.reproject_()))},this);this.sourcesListenerKeys_.push(n)}}),t===0?setTimeout(this.reproject_.bind(this),0):this.sourceTiles_.forEach(function(e,i,n){e.getState()==F.IDLE&&e.load()})}}unlistenSources_(){this.sourcesListenerKeys_.forEach(it),this.sourcesListenerKeys_=null}release(){this.canvas_&&(ks(this.canvas_.getContext("2d")),Fi.push(this.canvas_),this.canvas_=null),super.release()}}function Ua(s,t,e,i){return i!==void 0?(i[0]=s,i[1]=t,i[2]=e,i):[s,t,e]}function Vs(s,t,e){return s+"/"+t+"/"+e}function lh(s){return Vs(s[0],s[1],s[2])}function Qf(s){return s.split("/").map(Number)}function tg(s){return(s[1]<<s[0])+s[2]}function eg(s,t){const e=s[0],i=s[1],n=s[2];if(t.getMinZoom()>e||e>t.getMaxZoom())return!1;const r=t.getFullTileRange(e);return r?r.containsXY(i,n):!0}class hh extends Vf{clear(){for(;this.getCount()>0;)this.pop().release();super.clear()}expireCache(t){for(;this.canExpireCache()&&!(this.peekLast().getKey()in t);)this.pop().release()}pruneExceptNewestZ(){if(this.getCount()===0)return;const t=this.peekFirstKey(),i=Qf(t)[0];this.forEach(n=>{n.tileCoord[0]!==i&&(this.remove(lh(n.tileCoord)),n.release())})}}const Tr={TILELOADSTART:"tileloadstart",TILELOADEND:"tileloadend",TILELOADERROR:"tileloaderror"};class ko{constructor(t,e,i,n){this.minX=t,this.maxX=e,this.minY=i,this.maxY=n}contains(t){return this.containsXY(t[1],t[2])}containsTileRange(t){return this.minX<=t.minX&&t.maxX<=this.maxX&&this.minY<=t.minY&&t.maxY<=this.maxY}containsXY(t,e){return this.minX<=t&&t<=this.maxX&&this.minY<=e&&e<=this.maxY}equals(t){return this.minX==t.minX&&this.minY==t.minY&&this.maxX==t.maxX&&this.maxY==t.maxY}extend(t){t.minX<this.minX&&(this.minX=t.minX),t.maxX>this.maxX&&(this.maxX=t.maxX),t.minY<this.minY&&(this.minY=t.minY),t.maxY>this.maxY&&(this.maxY=t.maxY)}getHeight(){return this.maxY-this.minY+1}getSize(){return[this.getWidth(),this.getHeight()]}getWidth(){return this.maxX-this.minX+1}intersects(t){return this.minX<=t.maxX&&this.maxX>=t.minX&&this.minY<=t.maxY&&this.maxY>=t.minY}}function xi(s,t,e,i,n){return n!==void 0?(n.minX=s,n.maxX=t,n.minY=e,n.maxY=i,n):new ko(s,t,e,i)}const Ei=[0,0,0],Ge=5;class ig{constructor(t){this.minZoom=t.minZoom!==void 0?t.minZoom:0,this.resolutions_=t.resolutions,H(wh(this.resolutions_,(n,r)=>r-n,!0),"`resolutions` must be sorted in descending order");let e;if(!t.origins){for(let n=0,r=this.resolutions_.length-1;n<r;++n)if(!e)e=this.resolutions_[n]/this.resolutions_[n+1];else if(this.resolutions_[n]/this.resolutions_[n+1]!==e){e=void 0;break}}this.zoomFactor_=e,this.maxZoom=this.resolutions_.length-1,this.origin_=t.origin!==void 0?t.origin:null,this.origins_=null,t.origins!==void 0&&(this.origins_=t.origins,H(this.origins_.length==this.resolutions_.length,"Number of `origins` and `resolutions` must be equal"));const i=t.extent;i!==void 0&&!this.origin_&&!this.origins_&&(this.origin_=ui(i)),H(!this.origin_&&this.origins_||this.origin_&&!this.origins_,"Either `origin` or `origins` must be configured, never both"),this.tileSizes_=null,t.tileSizes!==void 0&&(this.tileSizes_=t.tileSizes,H(this.tileSizes_.length==this.resolutions_.length,"Number of `tileSizes` and `resolutions` must be equal")),this.tileSize_=t.tileSize!==void 0?t.tileSize:this.tileSizes_?null:qr,H(!this.tileSize_&&this.tileSizes_||this.tileSize_&&!this.tileSizes_,"Either `tileSize` or `tileSizes` must be configured, never both"),this.extent_=i!==void 0?i:null,this.fullTileRanges_=null,this.tmpSize_=[0,0],this.tmpExtent_=[0,0,0,0],t.sizes!==void 0?this.fullTileRanges_=t.sizes.map((n,r)=>{const o=new ko(Math.min(0,n[0]),Math.max(n[0]-1,-1),Math.min(0,n[1]),Math.max(n[1]-1,-1));if(i){const a=this.getTileRangeForExtentAndZ(i,r);o.minX=Math.max(a.minX,o.minX),o.maxX=Math.min(a.maxX,o.maxX),o.minY=Math.max(a.minY,o.minY),o.maxY=Math.min(a.maxY,o.maxY)}return o}):i&&this.calculateTileRanges_(i)}forEachTileCoord(t,e,i){const n=this.getTileRangeForExtentAndZ(t,e);for(let r=n.minX,o=n.maxX;r<=o;++r)for(let a=n.minY,l=n.maxY;a<=l;++a)i([e,r,a])}forEachTileCoordParentTileRange(t,e,i,n){let r,o,a,l=null,h=t[0]-1;for(this.zoomFactor_===2?(o=t[1],a=t[2]):l=this.getTileCoordExtent(t,n);h>=this.minZoom;){if(o!==void 0&&a!==void 0?(o=Math.floor(o/2),a=Math.floor(a/2),r=xi(o,o,a,a,i)):r=this.getTileRangeForExtentAndZ(l,h,i),e(h,r))return!0;--h}return!1}getExtent(){return this.extent_}getMaxZoom(){return this.maxZoom}getMinZoom(){return this.minZoom}getOrigin(t){return this.origin_?this.origin_:this.origins_[t]}getResolution(t){return this.resolutions_[t]}getResolutions(){return this.resolutions_}getTileCoordChildTileRange(t,e,i){if(t[0]<this.maxZoom){if(this.zoomFactor_===2){const r=t[1]*2,o=t[2]*2;return xi(r,r+1,o,o+1,e)}const n=this.getTileCoordExtent(t,i||this.tmpExtent_);return this.getTileRangeForExtentAndZ(n,t[0]+1,e)}return null}getTileRangeForTileCoordAndZ(t,e,i){if(e>this.maxZoom||e<this.minZoom)return null;const n=t[0],r=t[1],o=t[2];if(e===n)return xi(r,o,r,o,i);if(this.zoomFactor_){const l=Math.pow(this.zoomFactor_,e-n),h=Math.floor(r*l),c=Math.floor(o*l);if(e<n)return xi(h,h,c,c,i);const u=Math.floor(l*(r+1))-1,d=Math.floor(l*(o+1))-1;return xi(h,u,c,d,i)}const a=this.getTileCoordExtent(t,this.tmpExtent_);return this.getTileRangeForExtentAndZ(a,e,i)}getTileRangeForExtentAndZ(t,e,i){this.getTileCoordForXYAndZ_(t[0],t[3],e,!1,Ei);const n=Ei[1],r=Ei[2];this.getTileCoordForXYAndZ_(t[2],t[1],e,!0,Ei);const o=Ei[1],a=Ei[2];return xi(n,o,r,a,i)}getTileCoordCenter(t){const e=this.getOrigin(t[0]),i=this.getResolution(t[0]),n=zt(this.getTileSize(t[0]),this.tmpSize_);return[e[0]+(t[1]+.5)*n[0]*i,e[1]-(t[2]+.5)*n[1]*i]}getTileCoordExtent(t,e){const i=this.getOrigin(t[0]),n=this.getResolution(t[0]),r=zt(this.getTileSize(t[0]),this.tmpSize_),o=i[0]+t[1]*r[0]*n,a=i[1]-(t[2]+1)*r[1]*n,l=o+r[0]*n,h=a+r[1]*n;return Le(o,a,l,h,e)}getTileCoordForCoordAndResolution(t,e,i){return this.getTileCoordForXYAndResolution_(t[0],t[1],e,!1,i)}getTileCoordForXYAndResolution_(t,e,i,n,r){const o=this.getZForResolution(i),a=i/this.getResolution(o),l=this.getOrigin(o),h=zt(this.getTileSize(o),this.tmpSize_);let c=a*(t-l[0])/i/h[0],u=a*(l[1]-e)/i/h[1];return n?(c=Vn(c,Ge)-1,u=Vn(u,Ge)-1):(c=Bn(c,Ge),u=Bn(u,Ge)),Ua(o,c,u,r)}getTileCoordForXYAndZ_(t,e,i,n,r){const o=this.getOrigin(i),a=this.getResolution(i),l=zt(this.getTileSize(i),this.tmpSize_);let h=(t-o[0])/a/l[0],c=(o[1]-e)/a/l[1];return n?(h=Vn(h,Ge)-1,c=Vn(c,Ge)-1):(h=Bn(h,Ge),c=Bn(c,Ge)),Ua(i,h,c,r)}getTileCoordForCoordAndZ(t,e,i){return this.getTileCoordForXYAndZ_(t[0],t[1],e,!1,i)}getTileCoordResolution(t){return this.resolutions_[t[0]]}getTileSize(t){return this.tileSize_?this.tileSize_:this.tileSizes_[t]}getFullTileRange(t){return this.fullTileRanges_?this.fullTileRanges_[t]:this.extent_?this.getTileRangeForExtentAndZ(this.extent_,t):null}getZForResolution(t,e){const i=Kr(this.resolutions_,t,e||0);return ct(i,this.minZoom,this.maxZoom)}tileCoordIntersectsViewport(t,e){return _l(e,0,e.length,2,this.getTileCoordExtent(t))}calculateTileRanges_(t){const e=this.resolutions_.length,i=new Array(e);for(let n=this.minZoom;n<e;++n)i[n]=this.getTileRangeForExtentAndZ(t,n);this.fullTileRanges_=i}}const ch=ig;function uh(s){let t=s.getDefaultTileGrid();return t||(t=og(s),s.setDefaultTileGrid(t)),t}function ng(s,t,e){const i=t[0],n=s.getTileCoordCenter(t),r=Go(e);if(!Gi(r,n)){const o=et(r),a=Math.ceil((r[0]-n[0])/o);return n[0]+=o*a,s.getTileCoordForCoordAndZ(n,i)}return t}function sg(s,t,e,i){i=i!==void 0?i:"top-left";const n=dh(s,t,e);return new ch({extent:s,origin:zh(s,i),resolutions:n,tileSize:e})}function rg(s){const t=s||{},e=t.extent||ut("EPSG:3857").getExtent(),i={extent:e,minZoom:t.minZoom,tileSize:t.tileSize,resolutions:dh(e,t.maxZoom,t.tileSize,t.maxResolution)};return new ch(i)}function dh(s,t,e,i){t=t!==void 0?t:Lh,e=zt(e!==void 0?e:qr);const n=wt(s),r=et(s);i=i>0?i:Math.max(r/e[0],n/e[1]);const o=t+1,a=new Array(o);for(let l=0;l<o;++l)a[l]=i/Math.pow(2,l);return a}function og(s,t,e,i){const n=Go(s);return sg(n,t,e,i)}function Go(s){s=ut(s);let t=s.getExtent();if(!t){const e=180*gn.degrees/s.getMetersPerUnit();t=Le(-e,-e,e,e)}return t}class ag extends nh{constructor(t){super({attributions:t.attributions,attributionsCollapsible:t.attributionsCollapsible,projection:t.projection,state:t.state,wrapX:t.wrapX,interpolate:t.interpolate}),this.on,this.once,this.un,this.opaque_=t.opaque!==void 0?t.opaque:!1,this.tilePixelRatio_=t.tilePixelRatio!==void 0?t.tilePixelRatio:1,this.tileGrid=t.tileGrid!==void 0?t.tileGrid:null;const e=[256,256];this.tileGrid&&zt(this.tileGrid.getTileSize(this.tileGrid.getMinZoom()),e),this.tileCache=new hh(t.cacheSize||0),this.tmpSize=[0,0],this.key_=t.key||"",this.tileOptions={transition:t.transition,interpolate:t.interpolate},this.zDirection=t.zDirection?t.zDirection:0}canExpireCache(){return this.tileCache.canExpireCache()}expireCache(t,e){const i=this.getTileCacheForProjection(t);i&&i.expireCache(e)}forEachLoadedTile(t,e,i,n){const r=this.getTileCacheForProjection(t);if(!r)return!1;let o=!0,a,l,h;for(let c=i.minX;c<=i.maxX;++c)for(let u=i.minY;u<=i.maxY;++u)l=Vs(e,c,u),h=!1,r.containsKey(l)&&(a=r.get(l),h=a.getState()===F.LOADED,h&&(h=n(a)!==!1)),h||(o=!1);return o}getGutterForProjection(t){return 0}getKey(){return this.key_}setKey(t){this.key_!==t&&(this.key_=t,this.changed())}getOpaque(t){return this.opaque_}getResolutions(t){const e=t?this.getTileGridForProjection(t):this.tileGrid;return e?e.getResolutions():null}getTile(t,e,i,n,r){return b()}getTileGrid(){return this.tileGrid}getTileGridForProjection(t){return this.tileGrid?this.tileGrid:uh(t)}getTileCacheForProjection(t){const e=this.getProjection();return H(e===null||ti(e,t),"A VectorTile source can only be rendered if it has a projection compatible with the view projection."),this.tileCache}getTilePixelRatio(t){return this.tilePixelRatio_}getTilePixelSize(t,e,i){const n=this.getTileGridForProjection(i),r=this.getTilePixelRatio(e),o=zt(n.getTileSize(t),this.tmpSize);return r==1?o:zc(o,r,this.tmpSize)}getTileCoordForTileUrlFunction(t,e){e=e!==void 0?e:this.getProjection();const i=this.getTileGridForProjection(e);return this.getWrapX()&&e.isGlobal()&&(t=ng(i,t,e)),eg(t,i)?t:null}clear(){this.tileCache.clear()}refresh(){this.clear(),super.refresh()}updateCacheSize(t,e){const i=this.getTileCacheForProjection(e);t>i.highWaterMark&&(i.highWaterMark=t)}useTile(t,e,i,n){}}class lg extends Wt{constructor(t,e){super(t),this.tile=e}}function hg(s,t){const e=/\{z\}/g,i=/\{x\}/g,n=/\{y\}/g,r=/\{-y\}/g;return function(o,a,l){if(o)return s.replace(e,o[0].toString()).replace(i,o[1].toString()).replace(n,o[2].toString()).replace(r,function(){const h=o[0],c=t.getFullTileRange(h);if(!c)throw new Error("The {-y} placeholder requires a tile grid with extent");return(c.getHeight()-o[2]-1).toString()})}}function cg(s,t){const e=s.length,i=new Array(e);for(let n=0;n<e;++n)i[n]=hg(s[n],t);return ug(i)}function ug(s){return s.length===1?s[0]:function(t,e,i){if(!t)return;const n=tg(t),r=si(n,s.length);return s[r](t,e,i)}}function dg(s){const t=[];let e=/\{([a-z])-([a-z])\}/.exec(s);if(e){const i=e[1].charCodeAt(0),n=e[2].charCodeAt(0);let r;for(r=i;r<=n;++r)t.push(s.replace(e[0],String.fromCharCode(r)));return t}if(e=/\{(\d+)-(\d+)\}/.exec(s),e){const i=parseInt(e[2],10);for(let n=parseInt(e[1],10);n<=i;n++)t.push(s.replace(e[0],n.toString()));return t}return t.push(s),t}class No extends ag{constructor(t){super({attributions:t.attributions,cacheSize:t.cacheSize,opaque:t.opaque,projection:t.projection,state:t.state,tileGrid:t.tileGrid,tilePixelRatio:t.tilePixelRatio,wrapX:t.wrapX,transition:t.transition,interpolate:t.interpolate,key:t.key,attributionsCollapsible:t.attributionsCollapsible,zDirection:t.zDirection}),this.generateTileUrlFunction_=this.tileUrlFunction===No.prototype.tileUrlFunction,this.tileLoadFunction=t.tileLoadFunction,t.tileUrlFunction&&(this.tileUrlFunction=t.tileUrlFunction),this.urls=null,t.urls?this.setUrls(t.urls):t.url&&this.setUrl(t.url),this.tileLoadingKeys_={}}getTileLoadFunction(){return this.tileLoadFunction}getTileUrlFunction(){return Object.getPrototypeOf(this).tileUrlFunction===this.tileUrlFunction?this.tileUrlFunction.bind(this):this.tileUrlFunction}getUrls(){return this.urls}handleTileChange(t){const e=t.target,i=G(e),n=e.getState();let r;n==F.LOADING?(this.tileLoadingKeys_[i]=!0,r=Tr.TILELOADSTART):i in this.tileLoadingKeys_&&(delete this.tileLoadingKeys_[i],r=n==F.ERROR?Tr.TILELOADERROR:n==F.LOADED?Tr.TILELOADEND:void 0),r!=null&&this.dispatchEvent(new lg(r,e))}setTileLoadFunction(t){this.tileCache.clear(),this.tileLoadFunction=t,this.changed()}setTileUrlFunction(t,e){this.tileUrlFunction=t,this.tileCache.pruneExceptNewestZ(),typeof e<"u"?this.setKey(e):this.changed()}setUrl(t){const e=dg(t);this.urls=e,this.setUrls(e)}setUrls(t){this.urls=t;const e=t.join(`
-`);this.generateTileUrlFunction_?this.setTileUrlFunction(cg(t,this.tileGrid),e):this.setKey(e)}tileUrlFunction(t,e,i){}useTile(t,e,i){const n=Vs(t,e,i);this.tileCache.containsKey(n)&&this.tileCache.get(n)}}class fg extends No{constructor(t){super({attributions:t.attributions,cacheSize:t.cacheSize,opaque:t.opaque,projection:t.projection,state:t.state,tileGrid:t.tileGrid,tileLoadFunction:t.tileLoadFunction?t.tileLoadFunction:gg,tilePixelRatio:t.tilePixelRatio,tileUrlFunction:t.tileUrlFunction,url:t.url,urls:t.urls,wrapX:t.wrapX,transition:t.transition,interpolate:t.interpolate!==void 0?t.interpolate:!0,key:t.key,attributionsCollapsible:t.attributionsCollapsible,zDirection:t.zDirection}),this.crossOrigin=t.crossOrigin!==void 0?t.crossOrigin:null,this.tileClass=t.tileClass!==void 0?t.tileClass:ah,this.tileCacheForProjection={},this.tileGridForProjection={},this.reprojectionErrorThreshold_=t.reprojectionErrorThreshold,this.renderReprojectionEdges_=!1}canExpireCache(){if(this.tileCache.canExpireCache())return!0;for(const t in this.tileCacheForProjection)if(this.tileCacheForProjection[t].canExpireCache())return!0;return!1}expireCache(t,e){const i=this.getTileCacheForProjection(t);this.tileCache.expireCache(this.tileCache==i?e:{});for(const n in this.tileCacheForProjection){const r=this.tileCacheForProjection[n];r.expireCache(r==i?e:{})}}getGutterForProjection(t){return this.getProjection()&&t&&!ti(this.getProjection(),t)?0:this.getGutter()}getGutter(){return 0}getKey(){let t=super.getKey();return this.getInterpolate()||(t+=":disable-interpolation"),t}getOpaque(t){return this.getProjection()&&t&&!ti(this.getProjection(),t)?!1:super.getOpaque(t)}getTileGridForProjection(t){const e=this.getProjection();if(this.tileGrid&&(!e||ti(e,t)))return this.tileGrid;const i=G(t);return i in this.tileGridForProjection||(this.tileGridForProjection[i]=uh(t)),this.tileGridForProjection[i]}getTileCacheForProjection(t){const e=this.getProjection();if(!e||ti(e,t))return this.tileCache;const i=G(t);return i in this.tileCacheForProjection||(this.tileCacheForProjection[i]=new hh(this.tileCache.highWaterMark)),this.tileCacheForProjection[i]}createTile_(t,e,i,n,r,o){const a=[t,e,i],l=this.getTileCoordForTileUrlFunction(a,r),h=l?this.tileUrlFunction(l,n,r):void 0,c=new this.tileClass(a,h!==void 0?F.IDLE:F.EMPTY,h!==void 0?h:"",this.crossOrigin,this.tileLoadFunction,this.tileOptions);return c.key=o,c.addEventListener(A.CHANGE,this.handleTileChange.bind(this)),c}getTile(t,e,i,n,r){const o=this.getProjection();if(!o||!r||ti(o,r))return this.getTileInternal(t,e,i,n,o||r);const a=this.getTileCacheForProjection(r),l=[t,e,i];let h;const c=lh(l);a.containsKey(c)&&(h=a.get(c));const u=this.getKey();if(h&&h.key==u)return h;const d=this.getTileGridForProjection(o),f=this.getTileGridForProjection(r),g=this.getTileCoordForTileUrlFunction(l,r),_=new Br(o,d,r,f,l,g,this.getTilePixelRatio(n),this.getGutter(),(m,y,p,x)=>this.getTileInternal(m,y,p,x,o),this.reprojectionErrorThreshold_,this.renderReprojectionEdges_,this.tileOptions);return _.key=u,h?(_.interimTile=h,_.refreshInterimChain(),a.replace(c,_)):a.set(c,_),_}getTileInternal(t,e,i,n,r){let o=null;const a=Vs(t,e,i),l=this.getKey();if(!this.tileCache.containsKey(a))o=this.createTile_(t,e,i,n,r,l),this.tileCache.set(a,o);else if(o=this.tileCache.get(a),o.key!=l){const h=o;o=this.createTile_(t,e,i,n,r,l),h.getState()==F.IDLE?o.interimTile=h.interimTile:o.interimTile=h,o.refreshInterimChain(),this.tileCache.replace(a,o)}return o}setRenderReprojectionEdges(t){if(this.renderReprojectionEdges_!=t){this.renderReprojectionEdges_=t;for(const e in this.tileCacheForProjection)this.tileCacheForProjection[e].clear();this.changed()}}setTileGridForProjection(t,e){const i=ut(t);if(i){const n=G(i);n in this.tileGridForProjection||(this.tileGridForProjection[n]=e)}}clear(){super.clear();for(const t in this.tileCacheForProjection)this.tileCacheForProjection[t].clear()}}function gg(s,t){s.getImage().src=t}class _g extends fg{constructor(t){t=t||{};const e=t.projection!==void 0?t.projection:"EPSG:3857",i=t.tileGrid!==void 0?t.tileGrid:rg({extent:Go(e),maxResolution:t.maxResolution,maxZoom:t.maxZoom,minZoom:t.minZoom,tileSize:t.tileSize});super({attributions:t.attributions,cacheSize:t.cacheSize,crossOrigin:t.crossOrigin,interpolate:t.interpolate,opaque:t.opaque,projection:e,reprojectionErrorThreshold:t.reprojectionErrorThreshold,tileGrid:i,tileLoadFunction:t.tileLoadFunction,tilePixelRatio:t.tilePixelRatio,tileUrlFunction:t.tileUrlFunction,url:t.url,urls:t.urls,wrapX:t.wrapX!==void 0?t.wrapX:!0,transition:t.transition,attributionsCollapsible:t.attributionsCollapsible,zDirection:t.zDirection}),this.gutter_=t.gutter!==void 0?t.gutter:0}getGutter(){return this.gutter_}}const mg='&#169; <a href="https://www.openstreetmap.org/copyright" target="_blank">OpenStreetMap</a> contributors.';class yg extends _g{constructor(t){t=t||{};let e;t.attributions!==void 0?e=t.attributions:e=[mg];const i=t.crossOrigin!==void 0?t.crossOrigin:"anonymous",n=t.url!==void 0?t.url:"https://tile.openstreetmap.org/{z}/{x}/{y}.png";super({attributions:e,attributionsCollapsible:!1,cacheSize:t.cacheSize,crossOrigin:i,interpolate:t.interpolate,maxZoom:t.maxZoom!==void 0?t.maxZoom:19,opaque:t.opaque!==void 0?t.opaque:!0,reprojectionErrorThreshold:t.reprojectionErrorThreshold,tileLoadFunction:t.tileLoadFunction,transition:t.transition,url:n,wrapX:t.wrapX,zDirection:t.zDirection})}}const rs={PRELOAD:"preload",USE_INTERIM_TILES_ON_ERROR:"useInterimTilesOnError"};class pg extends Ds{constructor(t){t=t||{};const e=Object.assign({},t);delete e.preload,delete e.useInterimTilesOnError,super(e),this.on,this.once,this.un,this.setPreload(t.preload!==void 0?t.preload:0),this.setUseInterimTilesOnError(t.useInterimTilesOnError!==void 0?t.useInterimTilesOnError:!0)}getPreload(){return this.get(rs.PRELOAD)}setPreload(t){this.set(rs.PRELOAD,t)}getUseInterimTilesOnError(){return this.get(rs.USE_INTERIM_TILES_ON_ERROR)}setUseInterimTilesOnError(t){this.set(rs.USE_INTERIM_TILES_ON_ERROR,t)}getData(t){return super.getData(t)}}class xg extends Jl{constructor(t){super(t),this.extentChanged=!0,this.renderedExtent_=null,this.renderedPixelRatio,this.renderedProjection=null,this.renderedRevision,this.renderedTiles=[],this.newTiles_=!1,this.tmpExtent=Xt(),this.tmpTileRange_=new ko(0,0,0,0)}isDrawableTile(t){const e=this.getLayer(),i=t.getState(),n=e.getUseInterimTilesOnError();return i==F.LOADED||i==F.EMPTY||i==F.ERROR&&!n}getTile(t,e,i,n){const r=n.pixelRatio,o=n.viewState.projection,a=this.getLayer();let h=a.getSource().getTile(t,e,i,r,o);return h.getState()==F.ERROR&&a.getUseInterimTilesOnError()&&a.getPreload()>0&&(this.newTiles_=!0),this.isDrawableTile(h)||(h=h.getInterimTile()),h}getData(t){const e=this.frameState;if(!e)return null;const i=this.getLayer(),n=gt(e.pixelToCoordinateTransform,t.slice()),r=i.getExtent();if(r&&!Gi(r,n))return null;const o=e.pixelRatio,a=e.viewState.projection,l=e.viewState,h=i.getRenderSource(),c=h.getTileGridForProjection(l.projection),u=h.getTilePixelRatio(e.pixelRatio);for(let d=c.getZForResolution(l.resolution);d>=c.getMinZoom();--d){const f=c.getTileCoordForCoordAndZ(n,d),g=h.getTile(d,f[1],f[2],o,a);if(!(g instanceof ah||g instanceof Br)||g instanceof Br&&g.getState()===F.EMPTY)return null;if(g.getState()!==F.LOADED)continue;const _=c.getOrigin(d),m=zt(c.getTileSize(d)),y=c.getResolution(d),p=Math.floor(u*((n[0]-_[0])/y-f[1]*m[0])),x=Math.floor(u*((_[1]-n[1])/y-f[2]*m[1])),E=Math.round(u*h.getGutterForProjection(l.projection));return this.getImageData(g.getImage(),p+E,x+E)}return null}loadedTileCallback(t,e,i){return this.isDrawableTile(i)?super.loadedTileCallback(t,e,i):!1}prepareFrame(t){return!!this.getLayer().getSource()}renderFrame(t,e){const i=t.layerStatesArray[t.layerIndex],n=t.viewState,r=n.projection,o=n.resolution,a=n.center,l=n.rotation,h=t.pixelRatio,c=this.getLayer(),u=c.getSource(),d=u.getRevision(),f=u.getTileGridForProjection(r),g=f.getZForResolution(o,u.zDirection),_=f.getResolution(g);let m=t.extent;const y=t.viewState.resolution,p=u.getTilePixelRatio(h),x=Math.round(et(m)/y*h),E=Math.round(wt(m)/y*h),C=i.extent&&Xe(i.extent);C&&(m=cn(m,Xe(i.extent)));const R=_*x/2/p,I=_*E/2/p,T=[a[0]-R,a[1]-I,a[0]+R,a[1]+I],S=f.getTileRangeForExtentAndZ(m,g),z={};z[g]={};const O=this.createLoadedTileFinder(u,r,z),N=this.tmpExtent,U=this.tmpTileRange_;this.newTiles_=!1;const V=l?Pr(n.center,y,l,t.size):void 0;for(let ht=S.minX;ht<=S.maxX;++ht)for(let v=S.minY;v<=S.maxY;++v){if(l&&!f.tileCoordIntersectsViewport([g,ht,v],V))continue;const rt=this.getTile(g,ht,v,t);if(this.isDrawableTile(rt)){const Lt=G(this);if(rt.getState()==F.LOADED){z[g][rt.tileCoord.toString()]=rt;let Kt=rt.inTransition(Lt);Kt&&i.opacity!==1&&(rt.endTransition(Lt),Kt=!1),!this.newTiles_&&(Kt||!this.renderedTiles.includes(rt))&&(this.newTiles_=!0)}if(rt.getAlpha(Lt,t.time)===1)continue}const bt=f.getTileCoordChildTileRange(rt.tileCoord,U,N);let dt=!1;bt&&(dt=O(g+1,bt)),dt||f.forEachTileCoordParentTileRange(rt.tileCoord,O,U,N)}const Y=_/o*h/p;ue(this.pixelTransform,t.size[0]/2,t.size[1]/2,1/h,1/h,l,-x/2,-E/2);const L=ol(this.pixelTransform);this.useContainer(e,L,this.getBackground(t));const D=this.getRenderContext(t),X=this.context.canvas;oo(this.inversePixelTransform,this.pixelTransform),ue(this.tempTransform,x/2,E/2,Y,Y,0,-x/2,-E/2),X.width!=x||X.height!=E?(X.width=x,X.height=E):this.containerReused||D.clearRect(0,0,x,E),C&&this.clipUnrotated(D,t,C),u.getInterpolate()||(D.imageSmoothingEnabled=!1),this.preRender(D,t),this.renderedTiles.length=0;let nt=Object.keys(z).map(Number);nt.sort(we);let Z,Q,$;i.opacity===1&&(!this.containerReused||u.getOpaque(t.viewState.projection))?nt=nt.reverse():(Z=[],Q=[]);for(let ht=nt.length-1;ht>=0;--ht){const v=nt[ht],rt=u.getTilePixelSize(v,h,r),dt=f.getResolution(v)/_,Lt=rt[0]*dt*Y,Kt=rt[1]*dt*Y,Pt=f.getTileCoordForCoordAndZ(ui(T),v),Hi=f.getTileCoordExtent(Pt),qe=gt(this.tempTransform,[p*(Hi[0]-T[0])/_,p*(T[3]-Hi[3])/_]),Ks=p*u.getGutterForProjection(r),Nn=z[v];for(const zn in Nn){const Yt=Nn[zn],fi=Yt.tileCoord,Xn=Pt[1]-fi[1],qs=Math.round(qe[0]-(Xn-1)*Lt),Wn=Pt[2]-fi[2],Yn=Math.round(qe[1]-(Wn-1)*Kt),Dt=Math.round(qe[0]-Xn*Lt),qt=Math.round(qe[1]-Wn*Kt),ne=qs-Dt,Ht=Yn-qt,gi=g===v,_i=gi&&Yt.getAlpha(G(this),t.time)!==1;let Ae=!1;if(!_i)if(Z){$=[Dt,qt,Dt+ne,qt,Dt+ne,qt+Ht,Dt,qt+Ht];for(let fe=0,Hs=Z.length;fe<Hs;++fe)if(g!==v&&v<Q[fe]){const vt=Z[fe];It([Dt,qt,Dt+ne,qt+Ht],[vt[0],vt[3],vt[4],vt[7]])&&(Ae||(D.save(),Ae=!0),D.beginPath(),D.moveTo($[0],$[1]),D.lineTo($[2],$[3]),D.lineTo($[4],$[5]),D.lineTo($[6],$[7]),D.moveTo(vt[6],vt[7]),D.lineTo(vt[4],vt[5]),D.lineTo(vt[2],vt[3]),D.lineTo(vt[0],vt[1]),D.clip())}Z.push($),Q.push(v)}else D.clearRect(Dt,qt,ne,Ht);this.drawTileImage(Yt,t,Dt,qt,ne,Ht,Ks,gi),Z&&!_i?(Ae&&D.restore(),this.renderedTiles.unshift(Yt)):this.renderedTiles.push(Yt),this.updateUsedTiles(t.usedTiles,u,Yt)}}return this.renderedRevision=d,this.renderedResolution=_,this.extentChanged=!this.renderedExtent_||!_n(this.renderedExtent_,T),this.renderedExtent_=T,this.renderedPixelRatio=h,this.renderedProjection=r,this.manageTilePyramid(t,u,f,h,r,m,g,c.getPreload()),this.scheduleExpireCache(t,u),this.postRender(this.context,t),i.extent&&D.restore(),D.imageSmoothingEnabled=!0,L!==X.style.transform&&(X.style.transform=L),this.container}drawTileImage(t,e,i,n,r,o,a,l){const h=this.getTileImage(t);if(!h)return;const c=this.getRenderContext(e),u=G(this),d=e.layerStatesArray[e.layerIndex],f=d.opacity*(l?t.getAlpha(u,e.time):1),g=f!==c.globalAlpha;g&&(c.save(),c.globalAlpha=f),c.drawImage(h,a,a,h.width-2*a,h.height-2*a,i,n,r,o),g&&c.restore(),f!==d.opacity?e.animate=!0:l&&t.endTransition(u)}getImage(){const t=this.context;return t?t.canvas:null}getTileImage(t){return t.getImage()}scheduleExpireCache(t,e){if(e.canExpireCache()){const i=(function(n,r,o){const a=G(n);a in o.usedTiles&&n.expireCache(o.viewState.projection,o.usedTiles[a])}).bind(null,e);t.postRenderFunctions.push(i)}}updateUsedTiles(t,e,i){const n=G(e);n in t||(t[n]={}),t[n][i.getKey()]=!0}manageTilePyramid(t,e,i,n,r,o,a,l,h){const c=G(e);c in t.wantedTiles||(t.wantedTiles[c]={});const u=t.wantedTiles[c],d=t.tileQueue,f=i.getMinZoom(),g=t.viewState.rotation,_=g?Pr(t.viewState.center,t.viewState.resolution,g,t.size):void 0;let m=0,y,p,x,E,C,R;for(R=f;R<=a;++R)for(p=i.getTileRangeForExtentAndZ(o,R,p),x=i.getResolution(R),E=p.minX;E<=p.maxX;++E)for(C=p.minY;C<=p.maxY;++C)g&&!i.tileCoordIntersectsViewport([R,E,C],_)||(a-R<=l?(++m,y=e.getTile(R,E,C,n,r),y.getState()==F.IDLE&&(u[y.getKey()]=!0,d.isKeyQueued(y.getKey())||d.enqueue([y,c,i.getTileCoordCenter(y.tileCoord),x])),h!==void 0&&h(y)):e.useTile(R,E,C,r));e.updateCacheSize(m,r)}}class Eg extends pg{constructor(t){super(t)}createRenderer(){return new xg(this)}}const Cg=Eg;class wg{constructor(){this.dataProjection=void 0,this.defaultFeatureProjection=void 0,this.featureClass=Gt,this.supportedMediaTypes=null}getReadOptions(t,e){if(e){let i=e.dataProjection?ut(e.dataProjection):this.readProjection(t);e.extent&&i&&i.getUnits()==="tile-pixels"&&(i=ut(i),i.setWorldExtent(e.extent)),e={dataProjection:i,featureProjection:e.featureProjection}}return this.adaptOptions(e)}adaptOptions(t){return Object.assign({dataProjection:this.dataProjection,featureProjection:this.defaultFeatureProjection,featureClass:this.featureClass},t)}getType(){return b()}readFeature(t,e){return b()}readFeatures(t,e){return b()}readGeometry(t,e){return b()}readProjection(t){return b()}writeFeature(t,e){return b()}writeFeatures(t,e){return b()}writeGeometry(t,e){return b()}}function zo(s,t,e){const i=e?ut(e.featureProjection):null,n=e?ut(e.dataProjection):null;let r=s;if(i&&n&&!ti(i,n)){t&&(r=s.clone());const o=t?i:n,a=t?n:i;o.getUnits()==="tile-pixels"?r.transform(o,a):r.applyTransform(mn(o,a))}if(t&&e&&e.decimals!==void 0){const o=Math.pow(10,e.decimals),a=function(l){for(let h=0,c=l.length;h<c;++h)l[h]=Math.round(l[h]*o)/o;return l};r===s&&(r=s.clone()),r.applyTransform(a)}return r}const Tg={Point:ee,LineString:ce,Polygon:zi,MultiPoint:On,MultiLineString:Yi,MultiPolygon:ji};function vg(s,t,e){return Array.isArray(t[0])?(yl(s,0,t,e)||(s=s.slice(),Ar(s,0,t,e)),s):(yo(s,0,t,e)||(s=s.slice(),fs(s,0,t,e)),s)}function fh(s,t){var r;const e=s.geometry;if(!e)return[];if(Array.isArray(e))return e.map(o=>fh({...s,geometry:o})).flat();const i=e.type==="MultiPolygon"?"Polygon":e.type;if(i==="GeometryCollection"||i==="Circle")throw new Error("Unsupported geometry type: "+i);const n=e.layout.length;return zo(new Mt(i,i==="Polygon"?vg(e.flatCoordinates,e.ends,n):e.flatCoordinates,(r=e.ends)==null?void 0:r.flat(),n,s.properties||{},s.id).enableSimplifyTransformed(),!1,t)}function Xo(s,t){if(!s)return null;if(Array.isArray(s)){const i=s.map(n=>Xo(n,t));return new Zl(i)}const e=Tg[s.type];return zo(new e(s.flatCoordinates,s.layout,s.ends),!1,t)}class Rg extends wg{constructor(){super()}getType(){return"json"}readFeature(t,e){return this.readFeatureFromObject(os(t),this.getReadOptions(t,e))}readFeatures(t,e){return this.readFeaturesFromObject(os(t),this.getReadOptions(t,e))}readFeatureFromObject(t,e){return b()}readFeaturesFromObject(t,e){return b()}readGeometry(t,e){return this.readGeometryFromObject(os(t),this.getReadOptions(t,e))}readGeometryFromObject(t,e){return b()}readProjection(t){return this.readProjectionFromObject(os(t))}readProjectionFromObject(t){return b()}writeFeature(t,e){return JSON.stringify(this.writeFeatureObject(t,e))}writeFeatureObject(t,e){return b()}writeFeatures(t,e){return JSON.stringify(this.writeFeaturesObject(t,e))}writeFeaturesObject(t,e){return b()}writeGeometry(t,e){return JSON.stringify(this.writeGeometryObject(t,e))}writeGeometryObject(t,e){return b()}}function os(s){if(typeof s=="string"){const t=JSON.parse(s);return t||null}return s!==null?s:null}class Us extends Rg{constructor(t){t=t||{},super(),this.dataProjection=ut(t.dataProjection?t.dataProjection:"EPSG:4326"),t.featureProjection&&(this.defaultFeatureProjection=ut(t.featureProjection)),t.featureClass&&(this.featureClass=t.featureClass),this.geometryName_=t.geometryName,this.extractGeometryName_=t.extractGeometryName,this.supportedMediaTypes=["application/geo+json","application/vnd.geo+json"]}readFeatureFromObject(t,e){let i=null;t.type==="Feature"?i=t:i={type:"Feature",geometry:t,properties:null};const n=Wo(i.geometry);if(this.featureClass===Mt)return fh({geometry:n,id:i.id,properties:i.properties},e);const r=new Gt;return this.geometryName_?r.setGeometryName(this.geometryName_):this.extractGeometryName_&&i.geometry_name&&r.setGeometryName(i.geometry_name),r.setGeometry(Xo(n,e)),"id"in i&&r.setId(i.id),i.properties&&r.setProperties(i.properties,!0),r}readFeaturesFromObject(t,e){const i=t;let n=null;if(i.type==="FeatureCollection"){const r=t;n=[];const o=r.features;for(let a=0,l=o.length;a<l;++a){const h=this.readFeatureFromObject(o[a],e);h&&n.push(h)}}else n=[this.readFeatureFromObject(t,e)];return n.flat()}readGeometryFromObject(t,e){return Sg(t,e)}readProjectionFromObject(t){const e=t.crs;let i;if(e)if(e.type=="name")i=ut(e.properties.name);else if(e.type==="EPSG")i=ut("EPSG:"+e.properties.code);else throw new Error("Unknown SRS type");else i=this.dataProjection;return i}writeFeatureObject(t,e){e=this.adaptOptions(e);const i={type:"Feature",geometry:null,properties:null},n=t.getId();if(n!==void 0&&(i.id=n),!t.hasProperties())return i;const r=t.getProperties(),o=t.getGeometry();return o&&(i.geometry=Vr(o,e),delete r[t.getGeometryName()]),oi(r)||(i.properties=r),i}writeFeaturesObject(t,e){e=this.adaptOptions(e);const i=[];for(let n=0,r=t.length;n<r;++n)i.push(this.writeFeatureObject(t[n],e));return{type:"FeatureCollection",features:i}}writeGeometryObject(t,e){return Vr(t,this.adaptOptions(e))}}function Wo(s,t){if(!s)return null;let e;switch(s.type){case"Point":{e=Lg(s);break}case"LineString":{e=Pg(s);break}case"Polygon":{e=bg(s);break}case"MultiPoint":{e=Fg(s);break}case"MultiLineString":{e=Mg(s);break}case"MultiPolygon":{e=Ag(s);break}case"GeometryCollection":{e=Ig(s);break}default:throw new Error("Unsupported GeoJSON type: "+s.type)}return e}function Sg(s,t){const e=Wo(s);return Xo(e,t)}function Ig(s,t){return s.geometries.map(function(i){return Wo(i)})}function Lg(s){const t=s.coordinates;return{type:"Point",flatCoordinates:t,layout:di(t.length)}}function Pg(s){var i;const t=s.coordinates,e=t.flat();return{type:"LineString",flatCoordinates:e,ends:[e.length],layout:di(((i=t[0])==null?void 0:i.length)||2)}}function Mg(s){var r,o;const t=s.coordinates,e=((o=(r=t[0])==null?void 0:r[0])==null?void 0:o.length)||2,i=[],n=bn(i,0,t,e);return{type:"MultiLineString",flatCoordinates:i,ends:n,layout:di(e)}}function Fg(s){var e;const t=s.coordinates;return{type:"MultiPoint",flatCoordinates:t.flat(),layout:di(((e=t[0])==null?void 0:e.length)||2)}}function Ag(s){var r,o;const t=s.coordinates,e=[],i=((o=(r=t[0])==null?void 0:r[0])==null?void 0:o[0].length)||2,n=hl(e,0,t,i);return{type:"MultiPolygon",flatCoordinates:e,ends:n,layout:di(i)}}function bg(s){var r,o;const t=s.coordinates,e=[],i=(o=(r=t[0])==null?void 0:r[0])==null?void 0:o.length,n=bn(e,0,t,i);return{type:"Polygon",flatCoordinates:e,ends:n,layout:di(i)}}function Vr(s,t){s=zo(s,!0,t);const e=s.getType();let i;switch(e){case"Point":{i=zg(s);break}case"LineString":{i=Og(s);break}case"Polygon":{i=Xg(s,t);break}case"MultiPoint":{i=Gg(s);break}case"MultiLineString":{i=kg(s);break}case"MultiPolygon":{i=Ng(s,t);break}case"GeometryCollection":{i=Dg(s,t);break}case"Circle":{i={type:"GeometryCollection",geometries:[]};break}default:throw new Error("Unsupported geometry type: "+e)}return i}function Dg(s,t){return t=Object.assign({},t),delete t.featureProjection,{type:"GeometryCollection",geometries:s.getGeometriesArray().map(function(i){return Vr(i,t)})}}function Og(s,t){return{type:"LineString",coordinates:s.getCoordinates()}}function kg(s,t){return{type:"MultiLineString",coordinates:s.getCoordinates()}}function Gg(s,t){return{type:"MultiPoint",coordinates:s.getCoordinates()}}function Ng(s,t){let e;return t&&(e=t.rightHanded),{type:"MultiPolygon",coordinates:s.getCoordinates(e)}}function zg(s,t){return{type:"Point",coordinates:s.getCoordinates()}}function Xg(s,t){let e;return t&&(e=t.rightHanded),{type:"Polygon",coordinates:s.getCoordinates(e)}}const Zs=document.getElementById("url"),Wg=new Cg({source:new yg});var Gn=new Do({strategy:Sf,loader:function(s,t,e){const i=e.getCode();fetch(`${Zs.value}/select?rect=${s.join(",")}&proj=${i}`,{cache:"no-cache"}).then(async function(n){n.ok||console.log(n);var r=await n.text(),o=new Us().readFeatures(r);Gn.addFeatures(o)})}});Gn.on("error",function(s){console.log("error",s)});const Ai=new Bs({source:Gn});let gh=12,Yo=[3374339,8388441],Za=localStorage.getItem("center");Za!=null&&(Yo=JSON.parse(Za));let Ka=localStorage.getItem("zoom");Ka!=null&&(gh=JSON.parse(Ka));console.log(Yo);let ls=new re({center:Yo,zoom:gh});ls.addEventListener("change",function(s){localStorage.setItem("center",JSON.stringify(ls.getCenter())),localStorage.setItem("zoom",JSON.stringify(ls.getZoom()))});const bi=new Xd({layers:[Wg,Ai],target:"map",view:ls}),Ur=document.getElementById("options-form"),vr=function(s){console.log("drawfinished"),s.feature.setId(crypto.randomUUID()),console.log(s);var t=new Us().writeFeature(s.feature);fetch(`${Zs.value}/insert`,{method:"POST",cache:"no-cache",headers:{"Content-Type":"application/json"},body:t}).then(async function(e){e.ok||console.log(e)})},fn={init:function(){bi.addInteraction(this.Point),this.Point.setActive(!1),this.Point.addEventListener("drawend",vr),bi.addInteraction(this.LineString),this.LineString.setActive(!1),this.LineString.addEventListener("drawend",vr),bi.addInteraction(this.Polygon),this.Polygon.setActive(!1),this.Polygon.addEventListener("drawend",vr)},Point:new yr({source:Ai.getSource(),type:"Point"}),LineString:new yr({source:Ai.getSource(),type:"LineString"}),Polygon:new yr({source:Ai.getSource(),type:"Polygon"}),activeDraw:null,setActive:function(s){if(this.activeDraw&&(this.activeDraw.setActive(!1),this.activeDraw=null),s){const t=Ur.elements["draw-type"].value;this.activeDraw=this[t],this.activeDraw.setActive(!0)}}};fn.init();const Yg=function(s){console.log("modifyend"),console.log(s);const t=s.features.getArray();console.log(t),t.forEach(function(e){if(e.getId()!=null){var i=new Us().writeFeature(e);fetch(`${Zs.value}/replace`,{method:"POST",cache:"no-cache",headers:{"Content-Type":"application/json"},body:i}).then(async function(n){n.ok||console.log(n)})}})},Di={init:function(){this.select=new Oo,bi.addInteraction(this.select),this.modify=new Gf({features:this.select.getFeatures()}),this.modify.addEventListener("modifyend",Yg),bi.addInteraction(this.modify),this.setEvents()},setEvents:function(){const s=this.select.getFeatures();this.select.on("change:active",function(){s.forEach(function(t){s.remove(t)})})},setActive:function(s){this.select.setActive(s),this.modify.setActive(s)}};Di.init();Ur.onchange=function(s){const t=s.target.getAttribute("name");if(t=="draw-type")Di.setActive(!1),fn.setActive(!0),Ur.elements.interaction.value="draw";else if(t=="interaction"){const e=s.target.value;e=="modify"?(fn.setActive(!1),Di.setActive(!0)):e=="draw"&&(fn.setActive(!0),Di.setActive(!1))}else t=="geojson"&&console.log(Ai)};fn.setActive(!0);Di.setActive(!1);const jg=new Bf({source:Ai.getSource()});bi.addInteraction(jg);var Bg=function(s){if(s.code=="Backspace"){var t=Di.select.getFeatures();t.forEach(function(e){if(Gn.removeFeature(e),e.getId()==null){console.log("no id for feature");return}let i=new Us().writeFeature(e);fetch(`${Zs.value}/delete`,{method:"POST",cache:"no-cache",headers:{"Content-Type":"application/json"},body:i}).then(async function(n){n.ok||console.log(n)})})}};document.addEventListener("keydown",Bg,!1);const Vg=document.getElementById("dump");Vg.onclick=function(s){var t=Gn.getFeatures();console.log(t)};
+`);this.generateTileUrlFunction_?this.setTileUrlFunction(cg(t,this.tileGrid),e):this.setKey(e)}tileUrlFunction(t,e,i){}useTile(t,e,i){const n=Vs(t,e,i);this.tileCache.containsKey(n)&&this.tileCache.get(n)}}class fg extends No{constructor(t){super({attributions:t.attributions,cacheSize:t.cacheSize,opaque:t.opaque,projection:t.projection,state:t.state,tileGrid:t.tileGrid,tileLoadFunction:t.tileLoadFunction?t.tileLoadFunction:gg,tilePixelRatio:t.tilePixelRatio,tileUrlFunction:t.tileUrlFunction,url:t.url,urls:t.urls,wrapX:t.wrapX,transition:t.transition,interpolate:t.interpolate!==void 0?t.interpolate:!0,key:t.key,attributionsCollapsible:t.attributionsCollapsible,zDirection:t.zDirection}),this.crossOrigin=t.crossOrigin!==void 0?t.crossOrigin:null,this.tileClass=t.tileClass!==void 0?t.tileClass:ah,this.tileCacheForProjection={},this.tileGridForProjection={},this.reprojectionErrorThreshold_=t.reprojectionErrorThreshold,this.renderReprojectionEdges_=!1}canExpireCache(){if(this.tileCache.canExpireCache())return!0;for(const t in this.tileCacheForProjection)if(this.tileCacheForProjection[t].canExpireCache())return!0;return!1}expireCache(t,e){const i=this.getTileCacheForProjection(t);this.tileCache.expireCache(this.tileCache==i?e:{});for(const n in this.tileCacheForProjection){const r=this.tileCacheForProjection[n];r.expireCache(r==i?e:{})}}getGutterForProjection(t){return this.getProjection()&&t&&!ti(this.getProjection(),t)?0:this.getGutter()}getGutter(){return 0}getKey(){let t=super.getKey();return this.getInterpolate()||(t+=":disable-interpolation"),t}getOpaque(t){return this.getProjection()&&t&&!ti(this.getProjection(),t)?!1:super.getOpaque(t)}getTileGridForProjection(t){const e=this.getProjection();if(this.tileGrid&&(!e||ti(e,t)))return this.tileGrid;const i=G(t);return i in this.tileGridForProjection||(this.tileGridForProjection[i]=uh(t)),this.tileGridForProjection[i]}getTileCacheForProjection(t){const e=this.getProjection();if(!e||ti(e,t))return this.tileCache;const i=G(t);return i in this.tileCacheForProjection||(this.tileCacheForProjection[i]=new hh(this.tileCache.highWaterMark)),this.tileCacheForProjection[i]}createTile_(t,e,i,n,r,o){const a=[t,e,i],l=this.getTileCoordForTileUrlFunction(a,r),h=l?this.tileUrlFunction(l,n,r):void 0,c=new this.tileClass(a,h!==void 0?F.IDLE:F.EMPTY,h!==void 0?h:"",this.crossOrigin,this.tileLoadFunction,this.tileOptions);return c.key=o,c.addEventListener(A.CHANGE,this.handleTileChange.bind(this)),c}getTile(t,e,i,n,r){const o=this.getProjection();if(!o||!r||ti(o,r))return this.getTileInternal(t,e,i,n,o||r);const a=this.getTileCacheForProjection(r),l=[t,e,i];let h;const c=lh(l);a.containsKey(c)&&(h=a.get(c));const u=this.getKey();if(h&&h.key==u)return h;const d=this.getTileGridForProjection(o),f=this.getTileGridForProjection(r),g=this.getTileCoordForTileUrlFunction(l,r),_=new Br(o,d,r,f,l,g,this.getTilePixelRatio(n),this.getGutter(),(m,y,p,x)=>this.getTileInternal(m,y,p,x,o),this.reprojectionErrorThreshold_,this.renderReprojectionEdges_,this.tileOptions);return _.key=u,h?(_.interimTile=h,_.refreshInterimChain(),a.replace(c,_)):a.set(c,_),_}getTileInternal(t,e,i,n,r){let o=null;const a=Vs(t,e,i),l=this.getKey();if(!this.tileCache.containsKey(a))o=this.createTile_(t,e,i,n,r,l),this.tileCache.set(a,o);else if(o=this.tileCache.get(a),o.key!=l){const h=o;o=this.createTile_(t,e,i,n,r,l),h.getState()==F.IDLE?o.interimTile=h.interimTile:o.interimTile=h,o.refreshInterimChain(),this.tileCache.replace(a,o)}return o}setRenderReprojectionEdges(t){if(this.renderReprojectionEdges_!=t){this.renderReprojectionEdges_=t;for(const e in this.tileCacheForProjection)this.tileCacheForProjection[e].clear();this.changed()}}setTileGridForProjection(t,e){const i=ut(t);if(i){const n=G(i);n in this.tileGridForProjection||(this.tileGridForProjection[n]=e)}}clear(){super.clear();for(const t in this.tileCacheForProjection)this.tileCacheForProjection[t].clear()}}function gg(s,t){s.getImage().src=t}class _g extends fg{constructor(t){t=t||{};const e=t.projection!==void 0?t.projection:"EPSG:3857",i=t.tileGrid!==void 0?t.tileGrid:rg({extent:Go(e),maxResolution:t.maxResolution,maxZoom:t.maxZoom,minZoom:t.minZoom,tileSize:t.tileSize});super({attributions:t.attributions,cacheSize:t.cacheSize,crossOrigin:t.crossOrigin,interpolate:t.interpolate,opaque:t.opaque,projection:e,reprojectionErrorThreshold:t.reprojectionErrorThreshold,tileGrid:i,tileLoadFunction:t.tileLoadFunction,tilePixelRatio:t.tilePixelRatio,tileUrlFunction:t.tileUrlFunction,url:t.url,urls:t.urls,wrapX:t.wrapX!==void 0?t.wrapX:!0,transition:t.transition,attributionsCollapsible:t.attributionsCollapsible,zDirection:t.zDirection}),this.gutter_=t.gutter!==void 0?t.gutter:0}getGutter(){return this.gutter_}}const mg='&#169; <a href="https://www.openstreetmap.org/copyright" target="_blank">OpenStreetMap</a> contributors.';class yg extends _g{constructor(t){t=t||{};let e;t.attributions!==void 0?e=t.attributions:e=[mg];const i=t.crossOrigin!==void 0?t.crossOrigin:"anonymous",n=t.url!==void 0?t.url:"https://tile.openstreetmap.org/{z}/{x}/{y}.png";super({attributions:e,attributionsCollapsible:!1,cacheSize:t.cacheSize,crossOrigin:i,interpolate:t.interpolate,maxZoom:t.maxZoom!==void 0?t.maxZoom:19,opaque:t.opaque!==void 0?t.opaque:!0,reprojectionErrorThreshold:t.reprojectionErrorThreshold,tileLoadFunction:t.tileLoadFunction,transition:t.transition,url:n,wrapX:t.wrapX,zDirection:t.zDirection})}}const rs={PRELOAD:"preload",USE_INTERIM_TILES_ON_ERROR:"useInterimTilesOnError"};class pg extends Ds{constructor(t){t=t||{};const e=Object.assign({},t);delete e.preload,delete e.useInterimTilesOnError,super(e),this.on,this.once,this.un,this.setPreload(t.preload!==void 0?t.preload:0),this.setUseInterimTilesOnError(t.useInterimTilesOnError!==void 0?t.useInterimTilesOnError:!0)}getPreload(){return this.get(rs.PRELOAD)}setPreload(t){this.set(rs.PRELOAD,t)}getUseInterimTilesOnError(){return this.get(rs.USE_INTERIM_TILES_ON_ERROR)}setUseInterimTilesOnError(t){this.set(rs.USE_INTERIM_TILES_ON_ERROR,t)}getData(t){return super.getData(t)}}class xg extends Jl{constructor(t){super(t),this.extentChanged=!0,this.renderedExtent_=null,this.renderedPixelRatio,this.renderedProjection=null,this.renderedRevision,this.renderedTiles=[],this.newTiles_=!1,this.tmpExtent=Xt(),this.tmpTileRange_=new ko(0,0,0,0)}isDrawableTile(t){const e=this.getLayer(),i=t.getState(),n=e.getUseInterimTilesOnError();return i==F.LOADED||i==F.EMPTY||i==F.ERROR&&!n}getTile(t,e,i,n){const r=n.pixelRatio,o=n.viewState.projection,a=this.getLayer();let h=a.getSource().getTile(t,e,i,r,o);return h.getState()==F.ERROR&&a.getUseInterimTilesOnError()&&a.getPreload()>0&&(this.newTiles_=!0),this.isDrawableTile(h)||(h=h.getInterimTile()),h}getData(t){const e=this.frameState;if(!e)return null;const i=this.getLayer(),n=gt(e.pixelToCoordinateTransform,t.slice()),r=i.getExtent();if(r&&!Gi(r,n))return null;const o=e.pixelRatio,a=e.viewState.projection,l=e.viewState,h=i.getRenderSource(),c=h.getTileGridForProjection(l.projection),u=h.getTilePixelRatio(e.pixelRatio);for(let d=c.getZForResolution(l.resolution);d>=c.getMinZoom();--d){const f=c.getTileCoordForCoordAndZ(n,d),g=h.getTile(d,f[1],f[2],o,a);if(!(g instanceof ah||g instanceof Br)||g instanceof Br&&g.getState()===F.EMPTY)return null;if(g.getState()!==F.LOADED)continue;const _=c.getOrigin(d),m=zt(c.getTileSize(d)),y=c.getResolution(d),p=Math.floor(u*((n[0]-_[0])/y-f[1]*m[0])),x=Math.floor(u*((_[1]-n[1])/y-f[2]*m[1])),E=Math.round(u*h.getGutterForProjection(l.projection));return this.getImageData(g.getImage(),p+E,x+E)}return null}loadedTileCallback(t,e,i){return this.isDrawableTile(i)?super.loadedTileCallback(t,e,i):!1}prepareFrame(t){return!!this.getLayer().getSource()}renderFrame(t,e){const i=t.layerStatesArray[t.layerIndex],n=t.viewState,r=n.projection,o=n.resolution,a=n.center,l=n.rotation,h=t.pixelRatio,c=this.getLayer(),u=c.getSource(),d=u.getRevision(),f=u.getTileGridForProjection(r),g=f.getZForResolution(o,u.zDirection),_=f.getResolution(g);let m=t.extent;const y=t.viewState.resolution,p=u.getTilePixelRatio(h),x=Math.round(et(m)/y*h),E=Math.round(wt(m)/y*h),C=i.extent&&Xe(i.extent);C&&(m=cn(m,Xe(i.extent)));const R=_*x/2/p,I=_*E/2/p,T=[a[0]-R,a[1]-I,a[0]+R,a[1]+I],S=f.getTileRangeForExtentAndZ(m,g),z={};z[g]={};const O=this.createLoadedTileFinder(u,r,z),N=this.tmpExtent,U=this.tmpTileRange_;this.newTiles_=!1;const V=l?Pr(n.center,y,l,t.size):void 0;for(let ht=S.minX;ht<=S.maxX;++ht)for(let v=S.minY;v<=S.maxY;++v){if(l&&!f.tileCoordIntersectsViewport([g,ht,v],V))continue;const rt=this.getTile(g,ht,v,t);if(this.isDrawableTile(rt)){const Lt=G(this);if(rt.getState()==F.LOADED){z[g][rt.tileCoord.toString()]=rt;let Kt=rt.inTransition(Lt);Kt&&i.opacity!==1&&(rt.endTransition(Lt),Kt=!1),!this.newTiles_&&(Kt||!this.renderedTiles.includes(rt))&&(this.newTiles_=!0)}if(rt.getAlpha(Lt,t.time)===1)continue}const bt=f.getTileCoordChildTileRange(rt.tileCoord,U,N);let dt=!1;bt&&(dt=O(g+1,bt)),dt||f.forEachTileCoordParentTileRange(rt.tileCoord,O,U,N)}const Y=_/o*h/p;ue(this.pixelTransform,t.size[0]/2,t.size[1]/2,1/h,1/h,l,-x/2,-E/2);const L=ol(this.pixelTransform);this.useContainer(e,L,this.getBackground(t));const D=this.getRenderContext(t),X=this.context.canvas;oo(this.inversePixelTransform,this.pixelTransform),ue(this.tempTransform,x/2,E/2,Y,Y,0,-x/2,-E/2),X.width!=x||X.height!=E?(X.width=x,X.height=E):this.containerReused||D.clearRect(0,0,x,E),C&&this.clipUnrotated(D,t,C),u.getInterpolate()||(D.imageSmoothingEnabled=!1),this.preRender(D,t),this.renderedTiles.length=0;let nt=Object.keys(z).map(Number);nt.sort(we);let Z,Q,$;i.opacity===1&&(!this.containerReused||u.getOpaque(t.viewState.projection))?nt=nt.reverse():(Z=[],Q=[]);for(let ht=nt.length-1;ht>=0;--ht){const v=nt[ht],rt=u.getTilePixelSize(v,h,r),dt=f.getResolution(v)/_,Lt=rt[0]*dt*Y,Kt=rt[1]*dt*Y,Pt=f.getTileCoordForCoordAndZ(ui(T),v),Hi=f.getTileCoordExtent(Pt),qe=gt(this.tempTransform,[p*(Hi[0]-T[0])/_,p*(T[3]-Hi[3])/_]),Ks=p*u.getGutterForProjection(r),Nn=z[v];for(const zn in Nn){const Yt=Nn[zn],fi=Yt.tileCoord,Xn=Pt[1]-fi[1],qs=Math.round(qe[0]-(Xn-1)*Lt),Wn=Pt[2]-fi[2],Yn=Math.round(qe[1]-(Wn-1)*Kt),Dt=Math.round(qe[0]-Xn*Lt),qt=Math.round(qe[1]-Wn*Kt),ne=qs-Dt,Ht=Yn-qt,gi=g===v,_i=gi&&Yt.getAlpha(G(this),t.time)!==1;let Ae=!1;if(!_i)if(Z){$=[Dt,qt,Dt+ne,qt,Dt+ne,qt+Ht,Dt,qt+Ht];for(let fe=0,Hs=Z.length;fe<Hs;++fe)if(g!==v&&v<Q[fe]){const vt=Z[fe];It([Dt,qt,Dt+ne,qt+Ht],[vt[0],vt[3],vt[4],vt[7]])&&(Ae||(D.save(),Ae=!0),D.beginPath(),D.moveTo($[0],$[1]),D.lineTo($[2],$[3]),D.lineTo($[4],$[5]),D.lineTo($[6],$[7]),D.moveTo(vt[6],vt[7]),D.lineTo(vt[4],vt[5]),D.lineTo(vt[2],vt[3]),D.lineTo(vt[0],vt[1]),D.clip())}Z.push($),Q.push(v)}else D.clearRect(Dt,qt,ne,Ht);this.drawTileImage(Yt,t,Dt,qt,ne,Ht,Ks,gi),Z&&!_i?(Ae&&D.restore(),this.renderedTiles.unshift(Yt)):this.renderedTiles.push(Yt),this.updateUsedTiles(t.usedTiles,u,Yt)}}return this.renderedRevision=d,this.renderedResolution=_,this.extentChanged=!this.renderedExtent_||!_n(this.renderedExtent_,T),this.renderedExtent_=T,this.renderedPixelRatio=h,this.renderedProjection=r,this.manageTilePyramid(t,u,f,h,r,m,g,c.getPreload()),this.scheduleExpireCache(t,u),this.postRender(this.context,t),i.extent&&D.restore(),D.imageSmoothingEnabled=!0,L!==X.style.transform&&(X.style.transform=L),this.container}drawTileImage(t,e,i,n,r,o,a,l){const h=this.getTileImage(t);if(!h)return;const c=this.getRenderContext(e),u=G(this),d=e.layerStatesArray[e.layerIndex],f=d.opacity*(l?t.getAlpha(u,e.time):1),g=f!==c.globalAlpha;g&&(c.save(),c.globalAlpha=f),c.drawImage(h,a,a,h.width-2*a,h.height-2*a,i,n,r,o),g&&c.restore(),f!==d.opacity?e.animate=!0:l&&t.endTransition(u)}getImage(){const t=this.context;return t?t.canvas:null}getTileImage(t){return t.getImage()}scheduleExpireCache(t,e){if(e.canExpireCache()){const i=(function(n,r,o){const a=G(n);a in o.usedTiles&&n.expireCache(o.viewState.projection,o.usedTiles[a])}).bind(null,e);t.postRenderFunctions.push(i)}}updateUsedTiles(t,e,i){const n=G(e);n in t||(t[n]={}),t[n][i.getKey()]=!0}manageTilePyramid(t,e,i,n,r,o,a,l,h){const c=G(e);c in t.wantedTiles||(t.wantedTiles[c]={});const u=t.wantedTiles[c],d=t.tileQueue,f=i.getMinZoom(),g=t.viewState.rotation,_=g?Pr(t.viewState.center,t.viewState.resolution,g,t.size):void 0;let m=0,y,p,x,E,C,R;for(R=f;R<=a;++R)for(p=i.getTileRangeForExtentAndZ(o,R,p),x=i.getResolution(R),E=p.minX;E<=p.maxX;++E)for(C=p.minY;C<=p.maxY;++C)g&&!i.tileCoordIntersectsViewport([R,E,C],_)||(a-R<=l?(++m,y=e.getTile(R,E,C,n,r),y.getState()==F.IDLE&&(u[y.getKey()]=!0,d.isKeyQueued(y.getKey())||d.enqueue([y,c,i.getTileCoordCenter(y.tileCoord),x])),h!==void 0&&h(y)):e.useTile(R,E,C,r));e.updateCacheSize(m,r)}}class Eg extends pg{constructor(t){super(t)}createRenderer(){return new xg(this)}}const Cg=Eg;class wg{constructor(){this.dataProjection=void 0,this.defaultFeatureProjection=void 0,this.featureClass=Gt,this.supportedMediaTypes=null}getReadOptions(t,e){if(e){let i=e.dataProjection?ut(e.dataProjection):this.readProjection(t);e.extent&&i&&i.getUnits()==="tile-pixels"&&(i=ut(i),i.setWorldExtent(e.extent)),e={dataProjection:i,featureProjection:e.featureProjection}}return this.adaptOptions(e)}adaptOptions(t){return Object.assign({dataProjection:this.dataProjection,featureProjection:this.defaultFeatureProjection,featureClass:this.featureClass},t)}getType(){return b()}readFeature(t,e){return b()}readFeatures(t,e){return b()}readGeometry(t,e){return b()}readProjection(t){return b()}writeFeature(t,e){return b()}writeFeatures(t,e){return b()}writeGeometry(t,e){return b()}}function zo(s,t,e){const i=e?ut(e.featureProjection):null,n=e?ut(e.dataProjection):null;let r=s;if(i&&n&&!ti(i,n)){t&&(r=s.clone());const o=t?i:n,a=t?n:i;o.getUnits()==="tile-pixels"?r.transform(o,a):r.applyTransform(mn(o,a))}if(t&&e&&e.decimals!==void 0){const o=Math.pow(10,e.decimals),a=function(l){for(let h=0,c=l.length;h<c;++h)l[h]=Math.round(l[h]*o)/o;return l};r===s&&(r=s.clone()),r.applyTransform(a)}return r}const Tg={Point:ee,LineString:ce,Polygon:zi,MultiPoint:On,MultiLineString:Yi,MultiPolygon:ji};function vg(s,t,e){return Array.isArray(t[0])?(yl(s,0,t,e)||(s=s.slice(),Ar(s,0,t,e)),s):(yo(s,0,t,e)||(s=s.slice(),fs(s,0,t,e)),s)}function fh(s,t){var r;const e=s.geometry;if(!e)return[];if(Array.isArray(e))return e.map(o=>fh({...s,geometry:o})).flat();const i=e.type==="MultiPolygon"?"Polygon":e.type;if(i==="GeometryCollection"||i==="Circle")throw new Error("Unsupported geometry type: "+i);const n=e.layout.length;return zo(new Mt(i,i==="Polygon"?vg(e.flatCoordinates,e.ends,n):e.flatCoordinates,(r=e.ends)==null?void 0:r.flat(),n,s.properties||{},s.id).enableSimplifyTransformed(),!1,t)}function Xo(s,t){if(!s)return null;if(Array.isArray(s)){const i=s.map(n=>Xo(n,t));return new Zl(i)}const e=Tg[s.type];return zo(new e(s.flatCoordinates,s.layout,s.ends),!1,t)}class Rg extends wg{constructor(){super()}getType(){return"json"}readFeature(t,e){return this.readFeatureFromObject(os(t),this.getReadOptions(t,e))}readFeatures(t,e){return this.readFeaturesFromObject(os(t),this.getReadOptions(t,e))}readFeatureFromObject(t,e){return b()}readFeaturesFromObject(t,e){return b()}readGeometry(t,e){return this.readGeometryFromObject(os(t),this.getReadOptions(t,e))}readGeometryFromObject(t,e){return b()}readProjection(t){return this.readProjectionFromObject(os(t))}readProjectionFromObject(t){return b()}writeFeature(t,e){return JSON.stringify(this.writeFeatureObject(t,e))}writeFeatureObject(t,e){return b()}writeFeatures(t,e){return JSON.stringify(this.writeFeaturesObject(t,e))}writeFeaturesObject(t,e){return b()}writeGeometry(t,e){return JSON.stringify(this.writeGeometryObject(t,e))}writeGeometryObject(t,e){return b()}}function os(s){if(typeof s=="string"){const t=JSON.parse(s);return t||null}return s!==null?s:null}class Us extends Rg{constructor(t){t=t||{},super(),this.dataProjection=ut(t.dataProjection?t.dataProjection:"EPSG:4326"),t.featureProjection&&(this.defaultFeatureProjection=ut(t.featureProjection)),t.featureClass&&(this.featureClass=t.featureClass),this.geometryName_=t.geometryName,this.extractGeometryName_=t.extractGeometryName,this.supportedMediaTypes=["application/geo+json","application/vnd.geo+json"]}readFeatureFromObject(t,e){let i=null;t.type==="Feature"?i=t:i={type:"Feature",geometry:t,properties:null};const n=Wo(i.geometry);if(this.featureClass===Mt)return fh({geometry:n,id:i.id,properties:i.properties},e);const r=new Gt;return this.geometryName_?r.setGeometryName(this.geometryName_):this.extractGeometryName_&&i.geometry_name&&r.setGeometryName(i.geometry_name),r.setGeometry(Xo(n,e)),"id"in i&&r.setId(i.id),i.properties&&r.setProperties(i.properties,!0),r}readFeaturesFromObject(t,e){const i=t;let n=null;if(i.type==="FeatureCollection"){const r=t;n=[];const o=r.features;for(let a=0,l=o.length;a<l;++a){const h=this.readFeatureFromObject(o[a],e);h&&n.push(h)}}else n=[this.readFeatureFromObject(t,e)];return n.flat()}readGeometryFromObject(t,e){return Sg(t,e)}readProjectionFromObject(t){const e=t.crs;let i;if(e)if(e.type=="name")i=ut(e.properties.name);else if(e.type==="EPSG")i=ut("EPSG:"+e.properties.code);else throw new Error("Unknown SRS type");else i=this.dataProjection;return i}writeFeatureObject(t,e){e=this.adaptOptions(e);const i={type:"Feature",geometry:null,properties:null},n=t.getId();if(n!==void 0&&(i.id=n),!t.hasProperties())return i;const r=t.getProperties(),o=t.getGeometry();return o&&(i.geometry=Vr(o,e),delete r[t.getGeometryName()]),oi(r)||(i.properties=r),i}writeFeaturesObject(t,e){e=this.adaptOptions(e);const i=[];for(let n=0,r=t.length;n<r;++n)i.push(this.writeFeatureObject(t[n],e));return{type:"FeatureCollection",features:i}}writeGeometryObject(t,e){return Vr(t,this.adaptOptions(e))}}function Wo(s,t){if(!s)return null;let e;switch(s.type){case"Point":{e=Lg(s);break}case"LineString":{e=Pg(s);break}case"Polygon":{e=bg(s);break}case"MultiPoint":{e=Fg(s);break}case"MultiLineString":{e=Mg(s);break}case"MultiPolygon":{e=Ag(s);break}case"GeometryCollection":{e=Ig(s);break}default:throw new Error("Unsupported GeoJSON type: "+s.type)}return e}function Sg(s,t){const e=Wo(s);return Xo(e,t)}function Ig(s,t){return s.geometries.map(function(i){return Wo(i)})}function Lg(s){const t=s.coordinates;return{type:"Point",flatCoordinates:t,layout:di(t.length)}}function Pg(s){var i;const t=s.coordinates,e=t.flat();return{type:"LineString",flatCoordinates:e,ends:[e.length],layout:di(((i=t[0])==null?void 0:i.length)||2)}}function Mg(s){var r,o;const t=s.coordinates,e=((o=(r=t[0])==null?void 0:r[0])==null?void 0:o.length)||2,i=[],n=bn(i,0,t,e);return{type:"MultiLineString",flatCoordinates:i,ends:n,layout:di(e)}}function Fg(s){var e;const t=s.coordinates;return{type:"MultiPoint",flatCoordinates:t.flat(),layout:di(((e=t[0])==null?void 0:e.length)||2)}}function Ag(s){var r,o;const t=s.coordinates,e=[],i=((o=(r=t[0])==null?void 0:r[0])==null?void 0:o[0].length)||2,n=hl(e,0,t,i);return{type:"MultiPolygon",flatCoordinates:e,ends:n,layout:di(i)}}function bg(s){var r,o;const t=s.coordinates,e=[],i=(o=(r=t[0])==null?void 0:r[0])==null?void 0:o.length,n=bn(e,0,t,i);return{type:"Polygon",flatCoordinates:e,ends:n,layout:di(i)}}function Vr(s,t){s=zo(s,!0,t);const e=s.getType();let i;switch(e){case"Point":{i=zg(s);break}case"LineString":{i=Og(s);break}case"Polygon":{i=Xg(s,t);break}case"MultiPoint":{i=Gg(s);break}case"MultiLineString":{i=kg(s);break}case"MultiPolygon":{i=Ng(s,t);break}case"GeometryCollection":{i=Dg(s,t);break}case"Circle":{i={type:"GeometryCollection",geometries:[]};break}default:throw new Error("Unsupported geometry type: "+e)}return i}function Dg(s,t){return t=Object.assign({},t),delete t.featureProjection,{type:"GeometryCollection",geometries:s.getGeometriesArray().map(function(i){return Vr(i,t)})}}function Og(s,t){return{type:"LineString",coordinates:s.getCoordinates()}}function kg(s,t){return{type:"MultiLineString",coordinates:s.getCoordinates()}}function Gg(s,t){return{type:"MultiPoint",coordinates:s.getCoordinates()}}function Ng(s,t){let e;return t&&(e=t.rightHanded),{type:"MultiPolygon",coordinates:s.getCoordinates(e)}}function zg(s,t){return{type:"Point",coordinates:s.getCoordinates()}}function Xg(s,t){let e;return t&&(e=t.rightHanded),{type:"Polygon",coordinates:s.getCoordinates(e)}}const Zs=document.getElementById("url"),Wg=new Cg({source:new yg});var Gn=new Do({strategy:Sf,loader:function(s,t,e){const i=e.getCode();fetch(`${Zs.value}/select?rect=${s.join(",")}&proj=${i}`,{cache:"no-cache"}).then(async function(n){n.ok||console.log(n);var r=await n.text(),o=new Us().readFeatures(r);Gn.addFeatures(o)})}});Gn.on("error",function(s){console.log("error",s)});const Ai=new Bs({source:Gn});let gh=12,Yo=[3374339,8388441],Za=localStorage.getItem("center");Za!=null&&(Yo=JSON.parse(Za));let Ka=localStorage.getItem("zoom");Ka!=null&&(gh=JSON.parse(Ka));console.log(Yo);let ls=new re({center:Yo,zoom:gh});ls.addEventListener("change",function(s){localStorage.setItem("center",JSON.stringify(ls.getCenter())),localStorage.setItem("zoom",JSON.stringify(ls.getZoom()))});const bi=new Xd({layers:[Wg,Ai],target:"map",view:ls}),Ur=document.getElementById("options-form"),vr=function(s){console.log("drawfinished"),s.feature.setId(crypto.randomUUID()),console.log(s);var t=new Us().writeFeature(s.feature);fetch(`${Zs.value}/insert?proj=${ls.getProjection().getCode()}`,{method:"POST",cache:"no-cache",headers:{"Content-Type":"application/json"},body:t}).then(async function(e){e.ok||console.log(e)})},fn={init:function(){bi.addInteraction(this.Point),this.Point.setActive(!1),this.Point.addEventListener("drawend",vr),bi.addInteraction(this.LineString),this.LineString.setActive(!1),this.LineString.addEventListener("drawend",vr),bi.addInteraction(this.Polygon),this.Polygon.setActive(!1),this.Polygon.addEventListener("drawend",vr)},Point:new yr({source:Ai.getSource(),type:"Point"}),LineString:new yr({source:Ai.getSource(),type:"LineString"}),Polygon:new yr({source:Ai.getSource(),type:"Polygon"}),activeDraw:null,setActive:function(s){if(this.activeDraw&&(this.activeDraw.setActive(!1),this.activeDraw=null),s){const t=Ur.elements["draw-type"].value;this.activeDraw=this[t],this.activeDraw.setActive(!0)}}};fn.init();const Yg=function(s){console.log("modifyend"),console.log(s);const t=s.features.getArray();console.log(t),t.forEach(function(e){if(e.getId()!=null){var i=new Us().writeFeature(e);fetch(`${Zs.value}/replace?proj=${ls.getProjection().getCode()}`,{method:"POST",cache:"no-cache",headers:{"Content-Type":"application/json"},body:i}).then(async function(n){n.ok||console.log(n)})}})},Di={init:function(){this.select=new Oo,bi.addInteraction(this.select),this.modify=new Gf({features:this.select.getFeatures()}),this.modify.addEventListener("modifyend",Yg),bi.addInteraction(this.modify),this.setEvents()},setEvents:function(){const s=this.select.getFeatures();this.select.on("change:active",function(){s.forEach(function(t){s.remove(t)})})},setActive:function(s){this.select.setActive(s),this.modify.setActive(s)}};Di.init();Ur.onchange=function(s){const t=s.target.getAttribute("name");if(t=="draw-type")Di.setActive(!1),fn.setActive(!0),Ur.elements.interaction.value="draw";else if(t=="interaction"){const e=s.target.value;e=="modify"?(fn.setActive(!1),Di.setActive(!0)):e=="draw"&&(fn.setActive(!0),Di.setActive(!1))}else t=="geojson"&&console.log(Ai)};fn.setActive(!0);Di.setActive(!1);const jg=new Bf({source:Ai.getSource()});bi.addInteraction(jg);var Bg=function(s){if(s.code=="Backspace"){var t=Di.select.getFeatures();t.forEach(function(e){if(Gn.removeFeature(e),e.getId()==null){console.log("no id for feature");return}let i=new Us().writeFeature(e);fetch(`${Zs.value}/delete?proj=${ls.getProjection().getCode()}`,{method:"POST",cache:"no-cache",headers:{"Content-Type":"application/json"},body:i}).then(async function(n){n.ok||console.log(n)})})}};document.addEventListener("keydown",Bg,!1);const Vg=document.getElementById("dump");Vg.onclick=function(s){var t=Gn.getFeatures();console.log(t)};
 //# sourceMappingURL=index-CxSum6um.js.map
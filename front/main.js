@@ -76,7 +76,7 @@ const DrawEnd = function (ev) {
   console.log(ev);
 
   var encoded = new GeoJSON().writeFeature(ev.feature);
-  fetch(`${url.value}/insert`, {
+  fetch(`${url.value}/insert?proj=${view.getProjection().getCode()}`, {
     method: "POST",
     cache: "no-cache",
     headers: {
@@ -141,7 +141,7 @@ const ModifyEnd = function (ev) {
     }
 
     var encoded = new GeoJSON().writeFeature(each);
-    fetch(`${url.value}/replace`, {
+    fetch(`${url.value}/replace?proj=${view.getProjection().getCode()}`, {
       method: "POST",
       cache: "no-cache",
       headers: {
@@ -232,7 +232,7 @@ var deleteFeature = function (evt) {
       }
 
       let encoded = new GeoJSON().writeFeature(each);
-      fetch(`${url.value}/delete`, {
+      fetch(`${url.value}/delete?proj=${view.getProjection().getCode()}`, {
         method: "POST",
         cache: "no-cache",
         headers: {
@@ -0,0 +1,215 @@
+package practice2
+
+import (
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Максимальное количество ячеек гистограммы плотности
+const maxHistogramCells = 65536
+
+// Aggregation — параметры запроса aggregate: группировка по свойству и сетка гистограммы плотности
+type Aggregation struct {
+	// Свойство для подсчёта объектов по значениям; пустая строка — без группировки
+	GroupBy string
+	// Размер сетки гистограммы; 0 — без гистограммы
+	Cols, Rows int
+	// Прямоугольник сетки в системе координат запроса
+	grid orb.Bound
+	proj *Projection
+	// Прямоугольник сетки в градусах; восточная граница больше 180°, если запрос пересекает
+	// линию перемены дат
+	native orb.Bound
+}
+
+// setGrid задаёт сетку гистограммы по охвату области запроса в системе координат хранилища
+func (agg *Aggregation) setGrid(proj *Projection, native orb.Bound) {
+	agg.proj = proj
+	agg.native = native
+	agg.grid = proj.boundFromNative(native)
+}
+
+// Aggregate — результат aggregate. Агрегаты шардов складываются Router без доступа к объектам.
+// Экстент и сетка гистограммы выражены в системе координат запроса.
+type Aggregate struct {
+	Count int `json:"count"`
+	// Общий охват объектов; null, если объектов нет
+	Extent geojson.BBox `json:"extent"`
+	// Количество объектов по значениям свойства groupBy; объекты без свойства не учитываются
+	Groups map[string]int `json:"groups"`
+	// Гистограмма плотности; null, если не запрошена
+	Histogram *Histogram `json:"histogram"`
+}
+
+// Histogram — количество объектов в ячейках сетки над прямоугольником запроса.
+// Counts упорядочены по строкам, строка 0 — у нижней границы (minY).
+// Объект учитывается один раз — в ячейке центра своего bounding box; центр за пределами
+// прямоугольника относится к ближайшей крайней ячейке, поэтому сумма Counts равна Count.
+type Histogram struct {
+	BBox   geojson.BBox `json:"bbox"`
+	Cols   int          `json:"cols"`
+	Rows   int          `json:"rows"`
+	Counts []int        `json:"counts"`
+}
+
+// Функция для разбора параметров groupBy и grid (N — сетка N×N, C,R — C столбцов и R строк)
+func parseAggregation(query url.Values) (*Aggregation, error) {
+	agg := &Aggregation{GroupBy: query.Get("groupBy")}
+	raw := query.Get("grid")
+	if raw == "" {
+		return agg, nil
+	}
+	parts := strings.Split(raw, ",")
+	if len(parts) > 2 {
+		return nil, errors.New("Invalid grid parameter")
+	}
+	var size [2]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 1 {
+			return nil, errors.New("Invalid grid parameter")
+		}
+		size[i] = n
+	}
+	if len(parts) == 1 {
+		size[1] = size[0]
+	}
+	if size[0]*size[1] > maxHistogramCells {
+		return nil, errors.New("слишком много ячеек гистограммы: " + raw)
+	}
+	agg.Cols, agg.Rows = size[0], size[1]
+	return agg, nil
+}
+
+// aggregator накапливает агрегаты в горутине Engine по мере обхода объектов
+type aggregator struct {
+	agg    *Aggregation
+	count  int
+	bound  orb.Bound
+	groups map[string]int
+	counts []int
+}
+
+func newAggregator(agg *Aggregation) *aggregator {
+	a := &aggregator{agg: agg}
+	if agg.GroupBy != "" {
+		a.groups = make(map[string]int)
+	}
+	if agg.Cols > 0 {
+		a.counts = make([]int, agg.Cols*agg.Rows)
+	}
+	return a
+}
+
+func (a *aggregator) add(feature *geojson.Feature) {
+	bound := feature.Geometry.Bound()
+	// Объекты за линией перемены дат переносятся на оборот сетки, чтобы экстент и ячейки
+	// гистограммы оставались непрерывными, как прямоугольник запроса на карте
+	if native := a.agg.native; native.Max[0] > 180 && bound.Center()[0] < native.Center()[0]-180 {
+		bound = orb.Bound{Min: orb.Point{bound.Min[0] + 360, bound.Min[1]}, Max: orb.Point{bound.Max[0] + 360, bound.Max[1]}}
+	}
+	if a.count == 0 {
+		a.bound = bound
+	} else {
+		a.bound = a.bound.Union(bound)
+	}
+	a.count++
+	if a.groups != nil {
+		if key, ok := groupKey(feature.Properties[a.agg.GroupBy]); ok {
+			a.groups[key]++
+		}
+	}
+	if a.counts != nil {
+		center := bound.Center()
+		if a.agg.proj.fromNative != nil {
+			center = a.agg.proj.fromNative(center)
+		}
+		grid := a.agg.grid
+		col := gridCell(center[0], grid.Min[0], grid.Max[0], a.agg.Cols)
+		row := gridCell(center[1], grid.Min[1], grid.Max[1], a.agg.Rows)
+		a.counts[row*a.agg.Cols+col]++
+	}
+}
+
+// Функция для получения ключа группы: строки — как есть, числа и логические значения — в текстовом виде
+func groupKey(value interface{}) (string, bool) {
+	if n, ok := toFloat(value); ok {
+		return strconv.FormatFloat(n, 'f', -1, 64), true
+	}
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// Функция для получения номера ячейки координаты v на отрезке [min, max], разбитом на n частей
+func gridCell(v, min, max float64, n int) int {
+	if max <= min {
+		return 0
+	}
+	cell := int(math.Floor((v - min) / (max - min) * float64(n)))
+	return int(math.Max(0, math.Min(float64(n-1), float64(cell))))
+}
+
+func (a *aggregator) result() *Aggregate {
+	result := &Aggregate{Count: a.count, Groups: a.groups}
+	if a.count > 0 {
+		result.Extent = geojson.NewBBox(a.agg.proj.boundFromNative(a.bound))
+	}
+	if a.counts != nil {
+		result.Histogram = &Histogram{
+			BBox:   geojson.NewBBox(a.agg.grid),
+			Cols:   a.agg.Cols,
+			Rows:   a.agg.Rows,
+			Counts: a.counts,
+		}
+	}
+	return result
+}
+
+// merge добавляет агрегат шарда — шаг reduce в Router. Гистограммы шардов построены
+// по одному и тому же прямоугольнику запроса, поэтому складываются поячеечно.
+func (a *Aggregate) merge(other *Aggregate) error {
+	if other.Extent.Valid() {
+		if a.Extent.Valid() {
+			a.Extent = geojson.NewBBox(a.Extent.Bound().Union(other.Extent.Bound()))
+		} else {
+			a.Extent = other.Extent
+		}
+	}
+	a.Count += other.Count
+	if other.Groups != nil {
+		if a.Groups == nil {
+			a.Groups = make(map[string]int)
+		}
+		for key, n := range other.Groups {
+			a.Groups[key] += n
+		}
+	}
+	if other.Histogram != nil {
+		if a.Histogram == nil {
+			a.Histogram = &Histogram{
+				BBox:   other.Histogram.BBox,
+				Cols:   other.Histogram.Cols,
+				Rows:   other.Histogram.Rows,
+				Counts: make([]int, len(other.Histogram.Counts)),
+			}
+		}
+		if len(a.Histogram.Counts) != len(other.Histogram.Counts) || a.Histogram.Cols != other.Histogram.Cols {
+			return errors.New("гистограммы шардов построены по разным сеткам")
+		}
+		for i, n := range other.Histogram.Counts {
+			a.Histogram.Counts[i] += n
+		}
+	}
+	return nil
+}
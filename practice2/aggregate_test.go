@@ -0,0 +1,69 @@
+package practice2
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+func TestAggregator(t *testing.T) {
+	proj, _ := parseProjection("")
+	agg, err := parseAggregation(url.Values{"groupBy": {"category"}, "grid": {"2,1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg.proj = proj
+	agg.grid = orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{10, 10}}
+
+	a := newAggregator(agg)
+	for i, category := range []interface{}{"cafe", "cafe", 1, true, nil} {
+		feature := newTestFeature("f", float64(i*3), 5)
+		if category != nil {
+			feature.Properties["category"] = category
+		}
+		a.add(feature)
+	}
+	// Центр объекта за пределами прямоугольника относится к крайней ячейке
+	a.add(newTestFeature("outside", 50, 50))
+	result := a.result()
+
+	if result.Count != 6 {
+		t.Errorf("Count = %d, expected 6", result.Count)
+	}
+	if !reflect.DeepEqual(result.Groups, map[string]int{"cafe": 2, "1": 1, "true": 1}) {
+		t.Errorf("Groups = %v", result.Groups)
+	}
+	if !reflect.DeepEqual(result.Histogram.Counts, []int{2, 4}) {
+		t.Errorf("Histogram = %v, expected [2 4]", result.Histogram.Counts)
+	}
+	if !reflect.DeepEqual(result.Extent, geojson.BBox{0, 5, 50, 50}) {
+		t.Errorf("Extent = %v", result.Extent)
+	}
+
+	// Reduce: пустой агрегат шарда не меняет результат, второй такой же удваивает количества
+	total := &Aggregate{}
+	for _, partial := range []*Aggregate{result, newAggregator(agg).result(), result} {
+		if err := total.merge(partial); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if total.Count != 12 || total.Groups["cafe"] != 4 || !reflect.DeepEqual(total.Histogram.Counts, []int{4, 8}) {
+		t.Errorf("Merged aggregate = %+v", total)
+	}
+	if !reflect.DeepEqual(total.Extent, result.Extent) {
+		t.Errorf("Merged extent = %v, expected %v", total.Extent, result.Extent)
+	}
+	other := &Aggregate{Histogram: &Histogram{Cols: 3, Rows: 1, Counts: []int{0, 0, 0}}}
+	if err := total.merge(other); err == nil {
+		t.Error("Merge of histograms with different grids succeeded")
+	}
+
+	for _, grid := range []string{"0", "a", "1,2,3", "1000"} {
+		if _, err := parseAggregation(url.Values{"grid": {grid}}); err == nil {
+			t.Errorf("parseAggregation accepted grid=%s", grid)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package practice2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Загрузка чекпоинта лидера новой или отставшей репликой. Лидер отдаёт последний чекпоинт
+// с /<name>/replication/snapshot как файл с поддержкой Range; ETag — имя узла и LSN чекпоинта:
+// чекпоинты разных узлов с одним LSN могут различаться. Реплика пишет его в
+// snapshots/bootstrap-<name>-<lsn>.part и после разрыва продолжает загрузку с того же места,
+// если у того же узла остался тот же чекпоинт (If-Range), иначе начинает заново.
+// Незавершённая загрузка с другого узла удаляется до запроса.
+const (
+	bootstrapPrefix = "bootstrap-"
+	bootstrapExt    = ".part"
+	// Заголовки ответа с именем узла и LSN отдаваемого чекпоинта
+	snapshotSourceHeader = "X-Snapshot-Source"
+	snapshotLSNHeader    = "X-Snapshot-LSN"
+)
+
+// ReplicationStatus — ответ GET /<name>/replication/status
+type ReplicationStatus struct {
+	Leader bool              `json:"leader"`
+	VClock map[string]uint64 `json:"vclock"`
+	// Term и адрес текущего лидера при включённых выборах
+	Term       uint64 `json:"term"`
+	LeaderAddr string `json:"leaderAddr,omitempty"`
+	// Узел был лидером и должен заново загрузить чекпоинт нового лидера
+	Resync bool `json:"resync,omitempty"`
+	// Количество реплик, получающих транзакции лидера
+	Followers int `json:"followers"`
+	// Term последней применённой транзакции
+	LastTerm uint64 `json:"lastTerm,omitempty"`
+	// Состояние подключения реплики к узлам репликасета: live, bootstrap или disconnected
+	Upstreams map[string]string `json:"upstreams,omitempty"`
+	// Последняя загрузка чекпоинта; null, если реплика не загружала чекпоинт
+	Bootstrap *BootstrapProgress `json:"bootstrap"`
+	// Состояние узла Raft; null, если Raft выключен
+	Raft *RaftStatus `json:"raft,omitempty"`
+}
+
+type BootstrapProgress struct {
+	Source string `json:"source"`
+	LSN    uint64 `json:"lsn"`
+	// Получено байт с учётом продолженной загрузки и размер чекпоинта; -1, если размер неизвестен
+	Received int64 `json:"received"`
+	Total    int64 `json:"total"`
+	// Байт, загруженных до разрыва и не запрошенных повторно
+	Resumed   int64     `json:"resumed"`
+	Started   time.Time `json:"started"`
+	Installed bool      `json:"installed"`
+}
+
+// replicationProgress обновляется горутинами репликации и читается обработчиком статуса,
+// поэтому, в отличие от состояния Engine, защищён мьютексом
+type replicationProgress struct {
+	mu        sync.Mutex
+	upstreams map[string]string
+	bootstrap *BootstrapProgress
+	// Закрывается при смене лидера, чтобы горутины репликации не ждали паузы переподключения
+	changed chan struct{}
+}
+
+func newReplicationProgress() *replicationProgress {
+	return &replicationProgress{upstreams: make(map[string]string), changed: make(chan struct{})}
+}
+
+// wait возвращает канал, который закроется при следующей смене лидера
+func (p *replicationProgress) wait() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.changed
+}
+
+func (p *replicationProgress) notify() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+func (p *replicationProgress) setUpstream(addr, state string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.upstreams[addr] = state
+}
+
+func (p *replicationProgress) update(f func(b *BootstrapProgress)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f(p.bootstrap)
+}
+
+func (p *replicationProgress) fill(status *ReplicationStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.upstreams) > 0 {
+		status.Upstreams = make(map[string]string, len(p.upstreams))
+		for addr, state := range p.upstreams {
+			status.Upstreams[addr] = state
+		}
+	}
+	if p.bootstrap != nil {
+		progress := *p.bootstrap
+		status.Bootstrap = &progress
+	}
+}
+
+// progressWriter учитывает полученные байты в состоянии загрузки
+type progressWriter struct {
+	w        io.Writer
+	progress *replicationProgress
+}
+
+func (pw progressWriter) Write(b []byte) (int, error) {
+	n, err := pw.w.Write(b)
+	pw.progress.update(func(p *BootstrapProgress) { p.Received += int64(n) })
+	return n, err
+}
+
+// Функция для поиска незавершённой загрузки чекпоинта с узла source; лишние файлы загрузок
+// и загрузки с других узлов удаляются
+func findBootstrapPart(dir, source string) (path string, lsn uint64, size int64, err error) {
+	matches, err := filepath.Glob(filepath.Join(dir, bootstrapPrefix+"*"+bootstrapExt))
+	if err != nil {
+		return "", 0, 0, err
+	}
+	for _, match := range matches {
+		name, n, parseErr := parseBootstrapPart(filepath.Base(match))
+		info, statErr := os.Stat(match)
+		if path != "" || parseErr != nil || statErr != nil || name != source {
+			os.Remove(match)
+			continue
+		}
+		path, lsn, size = match, n, info.Size()
+	}
+	return path, lsn, size, nil
+}
+
+func bootstrapPartPath(dir, source string, lsn uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%s-%020d%s", bootstrapPrefix, source, lsn, bootstrapExt))
+}
+
+// Функция для разбора имени файла загрузки bootstrap-<name>-<lsn>.part; имя узла может содержать дефис
+func parseBootstrapPart(file string) (source string, lsn uint64, err error) {
+	base := strings.TrimSuffix(strings.TrimPrefix(file, bootstrapPrefix), bootstrapExt)
+	i := strings.LastIndexByte(base, '-')
+	if i <= 0 {
+		return "", 0, errors.New("некорректное имя файла загрузки: " + file)
+	}
+	lsn, err = strconv.ParseUint(base[i+1:], 10, 64)
+	return base[:i], lsn, err
+}
+
+// Функция для получения ETag чекпоинта узла source
+func snapshotETag(source string, lsn uint64) string {
+	return strconv.Quote(fmt.Sprintf("%s-%d", source, lsn))
+}
+
+// bootstrap загружает чекпоинт с узла addr, продолжая прерванную загрузку, и устанавливает его.
+// Выполняется в горутине репликации; после установки реплика запрашивает у лидера хвост журнала.
+func (e *Engine) bootstrap(addr string) error {
+	dir := e.dir.snapshotDir()
+	// Последний сегмент адреса host:port/<name> — имя узла, с которого загружается чекпоинт
+	source := path.Base(addr)
+	partPath, partLSN, partSize, err := findBootstrapPart(dir, source)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(e.ctx, http.MethodGet, "http://"+addr+"/replication/snapshot", nil)
+	if err != nil {
+		return err
+	}
+	if partPath != "" {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", partSize))
+		req.Header.Set("If-Range", snapshotETag(source, partLSN))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	lsn, offset := partLSN, partSize
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Загрузка с начала: у лидера другой чекпоинт либо незавершённой загрузки нет
+		lsn, err = strconv.ParseUint(resp.Header.Get(snapshotLSNHeader), 10, 64)
+		if err != nil {
+			return errors.New("лидер не сообщил LSN чекпоинта")
+		}
+		if name := resp.Header.Get(snapshotSourceHeader); name != source {
+			return fmt.Errorf("чекпоинт отдаёт узел %q вместо %q", name, source)
+		}
+		if partPath != "" {
+			os.Remove(partPath)
+		}
+		partPath, offset = bootstrapPartPath(dir, source, lsn), 0
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Файл уже загружен целиком, разрыв произошёл до установки
+		if partPath == "" {
+			return errors.New("лидер отклонил запрос чекпоинта: " + resp.Status)
+		}
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("лидер отклонил запрос чекпоинта: %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	total := int64(-1)
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		total = offset
+	} else if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	e.progress.mu.Lock()
+	e.progress.bootstrap = &BootstrapProgress{
+		Source:   addr,
+		LSN:      lsn,
+		Received: offset,
+		Total:    total,
+		Resumed:  offset,
+		Started:  time.Now(),
+	}
+	e.progress.mu.Unlock()
+	if offset > 0 {
+		log.Printf("Реплика %s продолжает загрузку чекпоинта LSN %d с %s с байта %d", e.name, lsn, addr, offset)
+	} else {
+		log.Printf("Реплика %s загружает чекпоинт LSN %d с %s (%d байт)", e.name, lsn, addr, total)
+	}
+
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		if err := downloadPart(partPath, offset, resp.Body, e.progress); err != nil {
+			return err
+		}
+	}
+	// Чекпоинт применяется прямо из загруженного файла, по одному объекту
+	file, err := os.Open(partPath)
+	if err != nil {
+		return err
+	}
+	err = e.execute(Command{action: "installSnapshot", snapshot: file, result: make(chan error, 1)})
+	file.Close()
+	if err != nil {
+		// Повреждённый файл загружается заново
+		os.Remove(partPath)
+		return err
+	}
+	os.Remove(partPath)
+	e.progress.update(func(p *BootstrapProgress) { p.Installed = true })
+	log.Printf("Реплика %s установила чекпоинт LSN %d", e.name, lsn)
+	return nil
+}
+
+// Функция для дозаписи загружаемого чекпоинта в файл начиная с offset. Полученные данные
+// сохраняются и при ошибке чтения, чтобы следующая попытка продолжила загрузку.
+func downloadPart(path string, offset int64, body io.Reader, progress *replicationProgress) error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return err
+	}
+	_, copyErr := io.Copy(progressWriter{w: file, progress: progress}, body)
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return copyErr
+}
+
+// serveSnapshot отдаёт последний чекпоинт узла. Если чекпоинтов ещё нет, он создаётся:
+// вместе с хвостом журнала после него чекпоинт восстанавливает всё состояние узла.
+func (s *Storage) serveSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dir := s.engine.dir.snapshotDir()
+	snapshots, err := listSnapshots(dir)
+	if err == nil && len(snapshots) == 0 {
+		if err = s.engine.execute(Command{action: "checkpoint", result: make(chan error, 1)}); err == nil {
+			snapshots, err = listSnapshots(dir)
+		}
+	}
+	if err == nil && len(snapshots) == 0 {
+		err = errors.New("чекпоинт не найден")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Открытый файл остаётся доступен, даже если чекпоинт удалят во время передачи
+	file, err := os.Open(snapshots[0].path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", snapshotETag(s.name, snapshots[0].lsn))
+	w.Header().Set(snapshotSourceHeader, s.name)
+	w.Header().Set(snapshotLSNHeader, strconv.FormatUint(snapshots[0].lsn, 10))
+	http.ServeContent(w, r, filepath.Base(snapshots[0].path), info.ModTime(), file)
+}
+
+func (s *Storage) serveReplicationStatus(w http.ResponseWriter, r *http.Request) {
+	cmd := Command{action: "replicationState", replicationResult: make(chan ReplicationStatus)}
+	s.engine.commands <- cmd
+	status := <-cmd.replicationResult
+	s.engine.progress.fill(&status)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,203 @@
+package practice2
+
+import (
+	"slices"
+	"sort"
+)
+
+// B-дерево записей упорядоченного индекса: вставка, удаление и поиск начала диапазона за O(log n).
+// Узел, кроме корня, хранит от btreeDegree-1 до 2*btreeDegree-1 записей. Вставка заранее делит полные
+// узлы на пути вниз, а удаление заранее пополняет узлы с минимумом записей, поэтому оба проходят
+// по дереву один раз, без возврата к родителям.
+const (
+	btreeDegree   = 32
+	btreeMaxItems = 2*btreeDegree - 1
+)
+
+type btreeNode struct {
+	items []orderedEntry
+	// Пусто у листьев; у внутреннего узла len(children) == len(items)+1
+	children []*btreeNode
+}
+
+type btree struct {
+	root   *btreeNode
+	length int
+}
+
+func (n *btreeNode) leaf() bool {
+	return len(n.children) == 0
+}
+
+// find возвращает позицию первой записи узла не меньше entry и признак, что она равна entry
+func (n *btreeNode) find(entry *orderedEntry) (int, bool) {
+	i := sort.Search(len(n.items), func(i int) bool { return !n.items[i].less(entry) })
+	return i, i < len(n.items) && !entry.less(&n.items[i])
+}
+
+func (t *btree) insert(entry orderedEntry) {
+	if t.root == nil {
+		t.root = &btreeNode{}
+	}
+	if len(t.root.items) >= btreeMaxItems {
+		t.root = &btreeNode{children: []*btreeNode{t.root}}
+		t.root.splitChild(0)
+	}
+	if t.root.insert(entry) {
+		t.length++
+	}
+}
+
+// insert добавляет запись в поддерево неполного узла; false — такая запись уже есть
+func (n *btreeNode) insert(entry orderedEntry) bool {
+	i, found := n.find(&entry)
+	if found {
+		n.items[i] = entry
+		return false
+	}
+	if n.leaf() {
+		n.items = slices.Insert(n.items, i, entry)
+		return true
+	}
+	if len(n.children[i].items) >= btreeMaxItems {
+		n.splitChild(i)
+		switch {
+		case n.items[i].less(&entry):
+			i++
+		case !entry.less(&n.items[i]):
+			n.items[i] = entry
+			return false
+		}
+	}
+	return n.children[i].insert(entry)
+}
+
+// splitChild делит полный потомок i пополам, поднимая среднюю запись в узел
+func (n *btreeNode) splitChild(i int) {
+	child := n.children[i]
+	mid := btreeDegree - 1
+	median := child.items[mid]
+	right := &btreeNode{items: slices.Clone(child.items[mid+1:])}
+	clear(child.items[mid:])
+	child.items = child.items[:mid]
+	if !child.leaf() {
+		right.children = slices.Clone(child.children[mid+1:])
+		clear(child.children[mid+1:])
+		child.children = child.children[:mid+1]
+	}
+	n.items = slices.Insert(n.items, i, median)
+	n.children = slices.Insert(n.children, i+1, right)
+}
+
+func (t *btree) remove(entry orderedEntry) {
+	if t.root == nil {
+		return
+	}
+	if t.root.remove(&entry) {
+		t.length--
+	}
+	if len(t.root.items) == 0 && !t.root.leaf() {
+		t.root = t.root.children[0]
+	}
+}
+
+// remove удаляет запись из поддерева узла, в котором больше минимума записей (или корня)
+func (n *btreeNode) remove(entry *orderedEntry) bool {
+	i, found := n.find(entry)
+	if n.leaf() {
+		if found {
+			n.items = slices.Delete(n.items, i, i+1)
+		}
+		return found
+	}
+	if len(n.children[i].items) < btreeDegree {
+		// Пополнение потомка меняет записи узла, поэтому позиция ищется заново
+		n.growChild(i)
+		return n.remove(entry)
+	}
+	if found {
+		// Запись внутреннего узла заменяется наибольшей записью левого поддерева
+		n.items[i] = n.children[i].removeMax()
+		return true
+	}
+	return n.children[i].remove(entry)
+}
+
+func (n *btreeNode) removeMax() orderedEntry {
+	if n.leaf() {
+		last := n.items[len(n.items)-1]
+		n.items = slices.Delete(n.items, len(n.items)-1, len(n.items))
+		return last
+	}
+	i := len(n.children) - 1
+	if len(n.children[i].items) < btreeDegree {
+		n.growChild(i)
+		return n.removeMax()
+	}
+	return n.children[i].removeMax()
+}
+
+// growChild добавляет запись потомку i с минимумом записей: забирает её у соседа через разделяющую
+// запись узла или, если у соседей тоже минимум, сливает потомка с соседом
+func (n *btreeNode) growChild(i int) {
+	child := n.children[i]
+	if i > 0 && len(n.children[i-1].items) >= btreeDegree {
+		left := n.children[i-1]
+		child.items = slices.Insert(child.items, 0, n.items[i-1])
+		n.items[i-1] = left.items[len(left.items)-1]
+		left.items = slices.Delete(left.items, len(left.items)-1, len(left.items))
+		if !left.leaf() {
+			child.children = slices.Insert(child.children, 0, left.children[len(left.children)-1])
+			left.children = slices.Delete(left.children, len(left.children)-1, len(left.children))
+		}
+		return
+	}
+	if i < len(n.items) && len(n.children[i+1].items) >= btreeDegree {
+		right := n.children[i+1]
+		child.items = append(child.items, n.items[i])
+		n.items[i] = right.items[0]
+		right.items = slices.Delete(right.items, 0, 1)
+		if !right.leaf() {
+			child.children = append(child.children, right.children[0])
+			right.children = slices.Delete(right.children, 0, 1)
+		}
+		return
+	}
+	if i == len(n.items) {
+		i--
+		child = n.children[i]
+	}
+	right := n.children[i+1]
+	child.items = append(append(child.items, n.items[i]), right.items...)
+	child.children = append(child.children, right.children...)
+	n.items = slices.Delete(n.items, i, i+1)
+	n.children = slices.Delete(n.children, i+1, i+2)
+}
+
+// ascend обходит записи по возрастанию, начиная с первой, для которой from возвращает true;
+// from монотонна: false для начала порядка и true после него. Обход прекращается, когда iter возвращает false.
+func (t *btree) ascend(from func(e *orderedEntry) bool, iter func(e *orderedEntry) bool) {
+	if t.root != nil {
+		t.root.ascend(from, iter)
+	}
+}
+
+func (n *btreeNode) ascend(from func(e *orderedEntry) bool, iter func(e *orderedEntry) bool) bool {
+	i := 0
+	if from != nil {
+		i = sort.Search(len(n.items), func(i int) bool { return from(&n.items[i]) })
+	}
+	if !n.leaf() && !n.children[i].ascend(from, iter) {
+		return false
+	}
+	for ; i < len(n.items); i++ {
+		if !iter(&n.items[i]) {
+			return false
+		}
+		// Правее найденной записи все записи подходят, поддеревья обходятся целиком
+		if !n.leaf() && !n.children[i+1].ascend(nil, iter) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package practice2
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// Функция для проверки инвариантов поддерева: порядок записей, их количество в узлах и одинаковая глубина листьев
+func checkBtreeNode(t *testing.T, n *btreeNode, root bool, lo, hi *orderedEntry) (depth, count int) {
+	t.Helper()
+	if !root && (len(n.items) < btreeDegree-1 || len(n.items) > btreeMaxItems) {
+		t.Fatalf("Node has %d items, expected from %d to %d", len(n.items), btreeDegree-1, btreeMaxItems)
+	}
+	for i := range n.items {
+		if (i > 0 && !n.items[i-1].less(&n.items[i])) || (lo != nil && !lo.less(&n.items[i])) || (hi != nil && !n.items[i].less(hi)) {
+			t.Fatalf("Items are out of order at %d", i)
+		}
+	}
+	if n.leaf() {
+		return 1, len(n.items)
+	}
+	if len(n.children) != len(n.items)+1 {
+		t.Fatalf("Node has %d children for %d items", len(n.children), len(n.items))
+	}
+	count = len(n.items)
+	for i, child := range n.children {
+		clo, chi := lo, hi
+		if i > 0 {
+			clo = &n.items[i-1]
+		}
+		if i < len(n.items) {
+			chi = &n.items[i]
+		}
+		d, c := checkBtreeNode(t, child, false, clo, chi)
+		if i > 0 && d != depth {
+			t.Fatalf("Leaves at depths %d and %d", depth, d)
+		}
+		depth, count = d, count+c
+	}
+	return depth + 1, count
+}
+
+func TestBtree(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	var tree btree
+	present := make(map[string]bool)
+	for i := 0; i < 20000; i++ {
+		id := fmt.Sprint(rng.Intn(3000))
+		entry := orderedEntry{number: float64(len(id)), numeric: true, id: id}
+		if rng.Intn(3) == 0 {
+			tree.remove(entry)
+			delete(present, id)
+		} else {
+			tree.insert(entry)
+			present[id] = true
+		}
+	}
+	if _, count := checkBtreeNode(t, tree.root, true, nil, nil); count != len(present) || tree.length != len(present) {
+		t.Fatalf("Tree has %d items (length %d), expected %d", count, tree.length, len(present))
+	}
+
+	var expected []string
+	for id := range present {
+		if len(id) >= 3 {
+			expected = append(expected, id)
+		}
+	}
+	// Записи упорядочены по значению — длине ID, затем по ID
+	slices.SortFunc(expected, func(a, b string) int { return cmp.Or(cmp.Compare(len(a), len(b)), cmp.Compare(a, b)) })
+	var got []string
+	tree.ascend(func(e *orderedEntry) bool { return e.number >= 3 }, func(e *orderedEntry) bool {
+		got = append(got, e.id)
+		return true
+	})
+	if !slices.Equal(got, expected) {
+		t.Errorf("Ascend from 3 returned %d ids, expected %d", len(got), len(expected))
+	}
+
+	for id := range present {
+		tree.remove(orderedEntry{number: float64(len(id)), numeric: true, id: id})
+	}
+	if tree.length != 0 || len(tree.root.items) != 0 || !tree.root.leaf() {
+		t.Errorf("Tree is not empty after removing all items: %d", tree.length)
+	}
+}
+
+func BenchmarkOrderedIndexAdd(b *testing.B) {
+	var idx orderedIndex
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < b.N; i++ {
+		feature := newTestFeature(fmt.Sprint(i), 0, 0)
+		idx.add(rng.Float64(), feature)
+	}
+}
@@ -0,0 +1,363 @@
+package practice2
+
+import (
+	"errors"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"time"
+
+	"github.com/paulmach/orb/geojson"
+	"github.com/tidwall/rtree"
+)
+
+// CheckpointPolicy задаёт условия автоматического чекпоинта; нулевое значение отключает условие
+type CheckpointPolicy struct {
+	// Объём журнала в байтах, записанный с последнего чекпоинта
+	WALSize int64
+	// Количество транзакций с последнего чекпоинта
+	Transactions uint64
+	// Период чекпоинтов; чекпоинт не создаётся, если с последнего не было транзакций
+	Interval time.Duration
+}
+
+var DefaultCheckpointPolicy = CheckpointPolicy{
+	WALSize:      128 << 20,
+	Transactions: 100000,
+	Interval:     10 * time.Minute,
+}
+
+// Пауза перед повтором автоматического чекпоинта после ошибки
+const checkpointRetryDelay = 10 * time.Second
+
+// CheckpointStatus — ответ GET /<name>/checkpoint
+type CheckpointStatus struct {
+	LSN     uint64    `json:"lsn"`
+	Time    time.Time `json:"time"`
+	Running bool      `json:"running"`
+	// Объём журнала и количество транзакций с последнего чекпоинта
+	WALSize      int64  `json:"walSize"`
+	Transactions uint64 `json:"transactions"`
+}
+
+type checkpointStats struct {
+	lastLSN  uint64
+	lastTime time.Time
+	// Объём журнала на момент последнего чекпоинта
+	lastWALWritten int64
+	// LSN и объём журнала выполняющегося чекпоинта
+	forkLSN        uint64
+	forkWALWritten int64
+	retryAt        time.Time
+}
+
+// Вызывается в горутине записи чекпоинта перед записью файла; используется тестами,
+// чтобы удержать чекпоинт в процессе и проверить, что Engine продолжает обслуживать команды
+var checkpointHook func()
+
+func (e *Engine) handleCheckpoint(cmd Command) {
+	if e.checkpointRunning {
+		// Текущий чекпоинт не содержит транзакций, подтверждённых после его начала
+		e.checkpointQueue = append(e.checkpointQueue, cmd.result)
+		return
+	}
+	e.checkpointWaiters = append(e.checkpointWaiters, cmd.result)
+	e.startCheckpoint()
+}
+
+// startCheckpoint фиксирует консистентное состояние Engine и записывает его в фоновой горутине.
+// Объекты в data не изменяются на месте: replace и delete только меняют указатели в карте,
+// поэтому поверхностной копии карты достаточно для неизменяемого снапшота.
+func (e *Engine) startCheckpoint() {
+	checkpoint, err := e.forkCheckpoint()
+	if err != nil {
+		log.Printf("Ошибка при создании чекпоинта: %v", err)
+		e.checkpointStats.retryAt = time.Now().Add(checkpointRetryDelay)
+		e.replyCheckpoint(err)
+		return
+	}
+	e.checkpointRunning = true
+	go func() {
+		if checkpointHook != nil {
+			checkpointHook()
+		}
+		e.checkpointDone <- e.writeCheckpoint(checkpoint)
+	}()
+}
+
+// forkCheckpoint копирует состояние для чекпоинта и закрывает текущий сегмент журнала,
+// чтобы граница сегментов совпала с LSN снапшота и покрытые им сегменты можно было удалить целиком
+func (e *Engine) forkCheckpoint() (*Checkpoint, error) {
+	e.wal.syncPending()
+	if e.walErr != nil {
+		// Журнал мог сохранить транзакции, которых нет в памяти: его нельзя обрезать чекпоинтом
+		return nil, e.walErr
+	}
+	if err := e.wal.closeSegment(); err != nil {
+		return nil, err
+	}
+	e.checkpointStats.forkLSN = e.lsn
+	e.checkpointStats.forkWALWritten = e.wal.written
+	return &Checkpoint{
+		Data:   maps.Clone(e.data),
+		VClock: maps.Clone(e.vclock),
+		LSN:    e.lsn,
+		Term:   e.lastTerm,
+	}, nil
+}
+
+// writeCheckpoint выполняется вне горутины Engine и не обращается к её состоянию
+func (e *Engine) writeCheckpoint(checkpoint *Checkpoint) error {
+	_, err := writeSnapshot(e.dir.snapshotDir(), checkpoint.LSN, func(w io.Writer) error {
+		return e.encodeCheckpoint(w, checkpoint)
+	})
+	return err
+}
+
+// finishCheckpoint удаляет лишние чекпоинты и журнал до самого старого хранимого чекпоинта
+func (e *Engine) finishCheckpoint() error {
+	stats := &e.checkpointStats
+	stats.lastLSN = stats.forkLSN
+	stats.lastTime = time.Now()
+	stats.lastWALWritten = stats.forkWALWritten
+
+	oldestLSN, err := pruneSnapshots(e.dir.snapshotDir(), e.snapshotRetention)
+	if err != nil {
+		return err
+	}
+	if e.raft != nil {
+		// Записи Raft до чекпоинта больше не нужны: отставшая реплика получит сам чекпоинт
+		e.raft.compactTo(stats.forkLSN)
+	}
+	return e.wal.truncate(oldestLSN)
+}
+
+// maybeCheckpoint запускает фоновый чекпоинт, если выполнено условие политики.
+// tick — сработал таймер периодического чекпоинта.
+func (e *Engine) maybeCheckpoint(tick bool) {
+	if e.checkpointRunning || time.Now().Before(e.checkpointStats.retryAt) {
+		return
+	}
+	policy := e.checkpointPolicy
+	transactions := e.lsn - e.checkpointStats.lastLSN
+	walSize := e.wal.written - e.checkpointStats.lastWALWritten
+
+	switch {
+	case transactions == 0:
+		return
+	case tick:
+	case policy.Transactions > 0 && transactions >= policy.Transactions:
+	case policy.WALSize > 0 && walSize >= policy.WALSize:
+	default:
+		return
+	}
+	e.startCheckpoint()
+}
+
+func (e *Engine) handleCheckpointStatus(cmd Command) {
+	cmd.statusResult <- CheckpointStatus{
+		LSN:          e.checkpointStats.lastLSN,
+		Time:         e.checkpointStats.lastTime,
+		Running:      e.checkpointRunning,
+		WALSize:      e.wal.written - e.checkpointStats.lastWALWritten,
+		Transactions: e.lsn - e.checkpointStats.lastLSN,
+	}
+}
+
+func (e *Engine) handleCheckpointDone(err error) {
+	e.checkpointRunning = false
+	if err == nil {
+		err = e.finishCheckpoint()
+	}
+	if err != nil {
+		log.Printf("Ошибка при создании чекпоинта: %v", err)
+		e.checkpointStats.retryAt = time.Now().Add(checkpointRetryDelay)
+	}
+	e.replyCheckpoint(err)
+
+	if len(e.checkpointQueue) > 0 {
+		e.checkpointWaiters, e.checkpointQueue = e.checkpointQueue, nil
+		e.startCheckpoint()
+	}
+}
+
+func (e *Engine) replyCheckpoint(err error) {
+	for _, result := range e.checkpointWaiters {
+		result <- err
+	}
+	e.checkpointWaiters = nil
+}
+
+// checkpoint синхронно сохраняет чекпоинт в горутине Engine
+func (e *Engine) checkpoint() error {
+	checkpoint, err := e.forkCheckpoint()
+	if err != nil {
+		return err
+	}
+	if err := e.writeCheckpoint(checkpoint); err != nil {
+		return err
+	}
+	return e.finishCheckpoint()
+}
+
+// finalCheckpoint дожидается фонового чекпоинта и сохраняет последнее состояние перед остановкой Engine
+func (e *Engine) finalCheckpoint() error {
+	if e.checkpointRunning {
+		err := <-e.checkpointDone
+		e.checkpointRunning = false
+		if err == nil {
+			err = e.finishCheckpoint()
+		}
+		e.replyCheckpoint(err)
+	}
+	err := e.checkpoint()
+	e.checkpointWaiters, e.checkpointQueue = e.checkpointQueue, nil
+	e.replyCheckpoint(err)
+	return err
+}
+
+// encodeCheckpoint записывает чекпоинт в потоковом формате, по одной insert транзакции на объект
+func (e *Engine) encodeCheckpoint(w io.Writer, checkpoint *Checkpoint) error {
+	cw, err := NewCheckpointWriter(w, CheckpointHeader{
+		Name:   e.name,
+		VClock: checkpoint.VClock,
+		LSN:    checkpoint.LSN,
+		Term:   checkpoint.Term,
+		Count:  len(checkpoint.Data),
+	})
+	if err != nil {
+		return err
+	}
+	for _, feature := range checkpoint.Data {
+		if err := cw.Write(feature); err != nil {
+			return err
+		}
+	}
+	return cw.Close()
+}
+
+// loadCheckpoint загружает последний читаемый чекпоинт. Если он повреждён, откатывается к предыдущему:
+// журнал хранится начиная с самого старого чекпоинта, поэтому воспроизведение восстановит остальное.
+func (e *Engine) loadCheckpoint() error {
+	if err := removeTempSnapshots(e.dir.snapshotDir()); err != nil {
+		return err
+	}
+	snapshots, err := listSnapshots(e.dir.snapshotDir())
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		return nil // Чекпоинт не существует
+	}
+
+	for _, snapshot := range snapshots {
+		header, err := e.applyCheckpointFile(snapshot.path)
+		if err != nil {
+			log.Printf("Ошибка чтения чекпоинта %s: %v", snapshot.path, err)
+			// Сбрасываем частично применённый чекпоинт перед откатом к предыдущему
+			e.resetState()
+			continue
+		}
+		e.checkpointStats.lastLSN = header.LSN
+		if info, err := os.Stat(snapshot.path); err == nil {
+			e.checkpointStats.lastTime = info.ModTime()
+		}
+		return nil
+	}
+	return errors.New("не удалось прочитать ни один чекпоинт")
+}
+
+// resetState очищает данные, индексы и векторные часы узла
+func (e *Engine) resetState() {
+	e.data = make(map[string]*geojson.Feature)
+	e.spatialIdx = &rtree.RTree{}
+	e.resetIndexes()
+	e.vclock = make(map[string]uint64)
+	e.lsn = 0
+	e.lastTerm = 0
+}
+
+func (e *Engine) applyCheckpointFile(path string) (*CheckpointHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return e.applyCheckpoint(file)
+}
+
+// applyCheckpoint применяет чекпоинт из потока по одному объекту, не загружая его в память целиком
+func (e *Engine) applyCheckpoint(r io.Reader) (*CheckpointHeader, error) {
+	cr, err := NewCheckpointReader(r)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		txn, err := cr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		idStr, ok := txn.Feature.ID.(string)
+		if !ok {
+			return nil, errors.New("ID объекта должен быть строкой")
+		}
+		e.storeFeature(idStr, txn.Feature)
+	}
+	e.vclock = cr.Header.VClock
+	e.lastTerm = cr.Header.Term
+	return &cr.Header, nil
+}
+
+// verifyCheckpoint проверяет контрольные суммы всех записей чекпоинта, не загружая его в память
+func verifyCheckpoint(r io.Reader) error {
+	cr, err := NewCheckpointReader(r)
+	if err != nil {
+		return err
+	}
+	for {
+		if _, err := cr.Next(); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// readCheckpoint читает чекпоинт целиком в память
+func readCheckpoint(path string) (*Checkpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return decodeCheckpoint(file)
+}
+
+// decodeCheckpoint читает чекпоинт из потока: файла или снапшота, переданного лидером по сети
+func decodeCheckpoint(r io.Reader) (*Checkpoint, error) {
+	cr, err := NewCheckpointReader(r)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := &Checkpoint{
+		Data:   make(map[string]*geojson.Feature, cr.Header.Count),
+		VClock: cr.Header.VClock,
+		LSN:    cr.Header.LSN,
+		Term:   cr.Header.Term,
+	}
+	for {
+		txn, err := cr.Next()
+		if errors.Is(err, io.EOF) {
+			return checkpoint, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		idStr, _ := txn.Feature.ID.(string)
+		checkpoint.Data[idStr] = txn.Feature
+	}
+}
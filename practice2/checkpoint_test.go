@@ -0,0 +1,164 @@
+package practice2
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackgroundCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStorage(http.NewServeMux(), dir, "storage1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+
+	execCommand(t, s, "insert", newTestFeature("a", 1, 1))
+
+	// Удерживаем запись чекпоинта, пока проверяем, что Engine обслуживает команды
+	started := make(chan struct{})
+	release := make(chan struct{})
+	checkpointHook = func() {
+		close(started)
+		<-release
+	}
+	defer func() { checkpointHook = nil }()
+
+	checkpoint := Command{action: "checkpoint", result: make(chan error)}
+	s.engine.commands <- checkpoint
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		execCommand(t, s, "insert", newTestFeature("b", 2, 2))
+		if ids := searchIDs(t, s); !ids["a"] || !ids["b"] {
+			t.Errorf("Search during checkpoint returned %v", ids)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Engine blocked while checkpoint was being written")
+	}
+
+	close(release)
+	if err := <-checkpoint.result; err != nil {
+		t.Fatal(err)
+	}
+
+	// Чекпоинт содержит состояние на момент начала, а транзакция после него осталась в журнале
+	snapshots, err := listSnapshots(filepath.Join(dir, snapshotDirName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err := readCheckpoint(snapshots[0].path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.LSN != 1 || len(cp.Data) != 1 || cp.Data["a"] == nil {
+		t.Errorf("Checkpoint LSN %d with %d features, expected LSN 1 with feature a", cp.LSN, len(cp.Data))
+	}
+	segments, err := s.engine.wal.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 || segments[0].firstLSN != 2 {
+		t.Errorf("Expected WAL to be cut at checkpoint LSN, got segments %v", segments)
+	}
+	s.Stop()
+
+	s, err = NewStorage(http.NewServeMux(), dir, "storage1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+	if ids := searchIDs(t, s); !ids["a"] || !ids["b"] {
+		t.Errorf("Features lost after restart: %v", ids)
+	}
+}
+
+// Функция для ожидания чекпоинта с заданным LSN через GET /<name>/checkpoint
+func waitCheckpointLSN(t *testing.T, mux *http.ServeMux, name string, lsn uint64) CheckpointStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		req, err := http.NewRequest("GET", "/"+name+"/checkpoint", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Checkpoint status returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		var status CheckpointStatus
+		if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+		if status.LSN >= lsn && !status.Running {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Checkpoint for LSN %d was not taken, last status %+v", lsn, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCheckpointPolicyTransactions(t *testing.T) {
+	mux := http.NewServeMux()
+	s, err := NewStorage(mux, t.TempDir(), "storage1", nil, true,
+		WithCheckpointPolicy(CheckpointPolicy{Transactions: 3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	execCommand(t, s, "insert", newTestFeature("a", 1, 1))
+	execCommand(t, s, "insert", newTestFeature("b", 2, 2))
+	status := waitCheckpointLSN(t, mux, "storage1", 0)
+	if status.LSN != 0 || status.Transactions != 2 {
+		t.Errorf("Unexpected status before policy threshold: %+v", status)
+	}
+
+	execCommand(t, s, "insert", newTestFeature("c", 3, 3))
+	status = waitCheckpointLSN(t, mux, "storage1", 3)
+	if status.Time.IsZero() || status.Transactions != 0 {
+		t.Errorf("Unexpected status after automatic checkpoint: %+v", status)
+	}
+}
+
+func TestCheckpointPolicyWALSize(t *testing.T) {
+	mux := http.NewServeMux()
+	s, err := NewStorage(mux, t.TempDir(), "storage1", nil, true,
+		WithCheckpointPolicy(CheckpointPolicy{WALSize: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	execCommand(t, s, "insert", newTestFeature("a", 1, 1))
+	waitCheckpointLSN(t, mux, "storage1", 1)
+}
+
+func TestCheckpointPolicyInterval(t *testing.T) {
+	mux := http.NewServeMux()
+	s, err := NewStorage(mux, t.TempDir(), "storage1", nil, true,
+		WithCheckpointPolicy(CheckpointPolicy{Interval: 20 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	execCommand(t, s, "insert", newTestFeature("a", 1, 1))
+	waitCheckpointLSN(t, mux, "storage1", 1)
+}
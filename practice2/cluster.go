@@ -0,0 +1,180 @@
+package practice2
+
+import (
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Радиус кластера по умолчанию и максимальный радиус, в пикселях
+const (
+	defaultClusterRadius = 60
+	maxClusterRadius     = 512
+)
+
+// Clustering — параметры кластеризации точечных объектов select.
+// Кластеры строятся в системе координат запроса: на карте в Web Mercator ячейки выглядят квадратными.
+type Clustering struct {
+	// grid — объединение точек в ячейках сетки, distance — объединение точек в пределах радиуса от первой точки кластера
+	Mode string
+	// Размер ячейки или радиус кластера в единицах proj
+	Radius float64
+	proj   *Projection
+}
+
+// Функция для разбора параметров cluster=grid|distance и clusterRadius в пикселях.
+// Размер пикселя берётся из zoom или resolution, поэтому без них кластеризация невозможна.
+func parseClustering(query url.Values, gen Generalization, proj *Projection) (*Clustering, error) {
+	mode := query.Get("cluster")
+	switch mode {
+	case "":
+		return nil, nil
+	case "grid", "distance":
+	default:
+		return nil, errors.New("неизвестный режим кластеризации: " + mode)
+	}
+	if !gen.Enabled() {
+		return nil, errors.New("для кластеризации нужен параметр zoom или resolution")
+	}
+	if query.Get("limit") != "" || query.Get("format") == "ndjson" {
+		return nil, errors.New("кластеризация не поддерживает limit и format=ndjson")
+	}
+	radius := float64(defaultClusterRadius)
+	if raw := query.Get("clusterRadius"); raw != "" {
+		var err error
+		radius, err = strconv.ParseFloat(raw, 64)
+		if err != nil || radius <= 0 || radius > maxClusterRadius {
+			return nil, errors.New("Invalid clusterRadius parameter")
+		}
+	}
+	return &Clustering{Mode: mode, Radius: radius * proj.resolutionFromNative(gen.Resolution), proj: proj}, nil
+}
+
+// Функция, обратная resolutionToNative: размер пикселя в градусах переводится в единицы proj
+func (p *Projection) resolutionFromNative(resolution float64) float64 {
+	if p.toNative == nil {
+		return resolution
+	}
+	return resolution * orb.EarthRadius * math.Pi / 180
+}
+
+// Кластер хранит сумму координат с весами, чтобы центр можно было пересчитать при объединении
+type cluster struct {
+	// Первая точка кластера: относительно неё проверяется радиус в режиме distance
+	anchor orb.Point
+	sum    orb.Point
+	count  int
+	bound  orb.Bound
+	// Единственный объект кластера; выдаётся вместо кластера из одной точки
+	feature *geojson.Feature
+}
+
+// clusterer собирает точки в кластеры. Точки добавляются с весом: Engine добавляет объекты,
+// а Router — кластеры шардов, поэтому объединение кластеров шардов выполняется тем же кодом.
+type clusterer struct {
+	c        *Clustering
+	cells    map[[2]int64][]*cluster
+	clusters []*cluster
+}
+
+func newClusterer(c *Clustering) *clusterer {
+	return &clusterer{c: c, cells: make(map[[2]int64][]*cluster)}
+}
+
+func (cl *clusterer) cell(p orb.Point) [2]int64 {
+	return [2]int64{int64(math.Floor(p[0] / cl.c.Radius)), int64(math.Floor(p[1] / cl.c.Radius))}
+}
+
+// add добавляет точку p с весом count и охватом bound; feature задаётся для отдельного объекта
+func (cl *clusterer) add(p orb.Point, count int, bound orb.Bound, feature *geojson.Feature) {
+	target := cl.find(p)
+	if target == nil {
+		key := cl.cell(p)
+		target = &cluster{anchor: p, bound: bound, feature: feature}
+		cl.cells[key] = append(cl.cells[key], target)
+		cl.clusters = append(cl.clusters, target)
+	} else {
+		target.bound = target.bound.Union(bound)
+		target.feature = nil
+	}
+	target.sum[0] += p[0] * float64(count)
+	target.sum[1] += p[1] * float64(count)
+	target.count += count
+}
+
+// Функция для поиска кластера, к которому относится точка
+func (cl *clusterer) find(p orb.Point) *cluster {
+	key := cl.cell(p)
+	if cl.c.Mode == "grid" {
+		if clusters := cl.cells[key]; len(clusters) > 0 {
+			return clusters[0]
+		}
+		return nil
+	}
+	// Кластер в радиусе может находиться только в соседних ячейках
+	var nearest *cluster
+	best := cl.c.Radius
+	for dx := int64(-1); dx <= 1; dx++ {
+		for dy := int64(-1); dy <= 1; dy++ {
+			for _, c := range cl.cells[[2]int64{key[0] + dx, key[1] + dy}] {
+				if d := math.Hypot(c.anchor[0]-p[0], c.anchor[1]-p[1]); d <= best {
+					nearest, best = c, d
+				}
+			}
+		}
+	}
+	return nearest
+}
+
+// addFeature добавляет объект Engine, переводя его точку в систему координат запроса
+func (cl *clusterer) addFeature(feature *geojson.Feature) {
+	p := feature.Geometry.(orb.Point)
+	if cl.c.proj.fromNative != nil {
+		p = cl.c.proj.fromNative(p)
+	}
+	cl.add(p, 1, p.Bound(), feature)
+}
+
+// features возвращает кластеры в системе координат запроса. Кластер из одной точки выдаётся
+// исходным объектом; остальные — точкой в центре масс со свойствами cluster и count и охватом в bbox.
+// project указывает, что отдельные объекты хранятся в системе координат хранилища и их нужно перевести.
+func (cl *clusterer) features(project bool) []*geojson.Feature {
+	features := make([]*geojson.Feature, 0, len(cl.clusters))
+	for _, c := range cl.clusters {
+		if c.count == 1 && c.feature != nil {
+			if project {
+				features = append(features, cl.c.proj.featuresFromNative([]*geojson.Feature{c.feature})...)
+			} else {
+				features = append(features, c.feature)
+			}
+			continue
+		}
+		center := orb.Point{c.sum[0] / float64(c.count), c.sum[1] / float64(c.count)}
+		feature := geojson.NewFeature(center)
+		feature.BBox = geojson.NewBBox(c.bound)
+		feature.Properties["cluster"] = true
+		feature.Properties["count"] = c.count
+		features = append(features, feature)
+	}
+	return features
+}
+
+// Функция для разбора кластера из ответа шарда: точка, количество объектов и охват
+func clusterOf(feature *geojson.Feature) (p orb.Point, count int, bound orb.Bound, ok bool) {
+	p, ok = feature.Geometry.(orb.Point)
+	if !ok {
+		return p, 0, bound, false
+	}
+	if isCluster, _ := feature.Properties["cluster"].(bool); !isCluster {
+		return p, 1, p.Bound(), true
+	}
+	n, ok := toFloat(feature.Properties["count"])
+	if !ok || n < 1 || !feature.BBox.Valid() {
+		return p, 0, bound, false
+	}
+	return p, int(n), feature.BBox.Bound(), true
+}
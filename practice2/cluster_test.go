@@ -0,0 +1,96 @@
+package practice2
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Функция для подсчёта объектов в ответе с кластерами и количества кластеров из нескольких объектов
+func clusterCounts(features []*geojson.Feature) (total int, clusters int) {
+	for _, feature := range features {
+		_, count, _, ok := clusterOf(feature)
+		if !ok {
+			continue
+		}
+		total += count
+		if count > 1 {
+			clusters++
+		}
+	}
+	return total, clusters
+}
+
+func TestClusterer(t *testing.T) {
+	proj, _ := parseProjection("")
+	rng := rand.New(rand.NewSource(5))
+	var points []*geojson.Feature
+	// Две плотные группы и отдельная точка далеко от них
+	for i := 0; i < 200; i++ {
+		center := orb.Point{10.1, 10.1}
+		if i%2 == 1 {
+			center = orb.Point{-30.1, 40.1}
+		}
+		points = append(points, newTestFeature(fmt.Sprint(i), center[0]+rng.Float64()*0.1, center[1]+rng.Float64()*0.1))
+	}
+	points = append(points, newTestFeature("lone", 100, -50))
+
+	for _, mode := range []string{"grid", "distance"} {
+		query := url.Values{"zoom": {"5"}, "cluster": {mode}}
+		gen, _ := parseGeneralization(query, proj)
+		c, err := parseClustering(query, gen, proj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cl := newClusterer(c)
+		for _, feature := range points {
+			cl.addFeature(feature)
+		}
+		features := cl.features(true)
+		if len(features) != 3 {
+			t.Fatalf("%s: got %d features, expected two clusters and a lone point", mode, len(features))
+		}
+		for _, feature := range features {
+			if feature.ID == "lone" {
+				continue
+			}
+			if feature.Properties["count"] != 100 {
+				t.Errorf("%s: cluster has %v points, expected 100", mode, feature.Properties["count"])
+			}
+			center := feature.Geometry.(orb.Point)
+			if !feature.BBox.Bound().Contains(center) || feature.BBox.Bound().Right()-feature.BBox.Bound().Left() > 0.1 {
+				t.Errorf("%s: cluster center %v or bbox %v is wrong", mode, center, feature.BBox)
+			}
+		}
+
+		// Кластеры двух половин данных, объединённые Router, дают те же количества
+		left, right := newClusterer(c), newClusterer(c)
+		for i, feature := range points {
+			if i%3 == 0 {
+				left.addFeature(feature)
+			} else {
+				right.addFeature(feature)
+			}
+		}
+		merged := mergeClusters(c, append(left.features(true), right.features(true)...))
+		if total, clusters := clusterCounts(merged); total != len(points) || clusters != 2 || len(merged) != 3 {
+			t.Errorf("%s: merged clusters cover %d points in %d clusters (%d features)", mode, total, clusters, len(merged))
+		}
+	}
+
+	for _, query := range []url.Values{
+		{"cluster": {"grid"}},
+		{"cluster": {"hex"}, "zoom": {"5"}},
+		{"cluster": {"grid"}, "zoom": {"5"}, "limit": {"10"}},
+		{"cluster": {"grid"}, "zoom": {"5"}, "clusterRadius": {"0"}},
+	} {
+		gen, _ := parseGeneralization(query, proj)
+		if _, err := parseClustering(query, gen, proj); err == nil {
+			t.Errorf("parseClustering(%v) accepted invalid parameters", query)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package practice2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Раскладка рабочей директории хранилища:
+//
+//	<wrkdir>/LOCK       — блокировка, не дающая двум процессам открыть директорию
+//	<wrkdir>/wal/       — журнал транзакций
+//	<wrkdir>/snapshots/ — чекпоинты и незавершённая загрузка чекпоинта лидера
+//	<wrkdir>/election.json — term и голос узла при включённых выборах лидера
+//	<wrkdir>/raft/      — term, голос и журнал Raft (см. raftstorage.go)
+const (
+	lockFileName    = "LOCK"
+	walDirName      = "wal"
+	snapshotDirName = "snapshots"
+	electionName    = "election.json"
+	raftDirName     = "raft"
+)
+
+var ErrDataDirLocked = errors.New("рабочая директория уже используется другим процессом")
+
+type dataDir struct {
+	path string
+	lock *os.File
+}
+
+// Функция для открытия рабочей директории хранилища, создаёт недостающие поддиректории
+// и захватывает эксклюзивную блокировку на всё время работы Engine
+func openDataDir(path string) (*dataDir, error) {
+	if path == "" {
+		return nil, errors.New("не задана рабочая директория")
+	}
+	for _, dir := range []string{path, filepath.Join(path, walDirName), filepath.Join(path, snapshotDirName)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	lock, err := os.OpenFile(filepath.Join(path, lockFileName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// flock снимается ядром при завершении процесса, поэтому упавший узел не оставит директорию заблокированной
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		lock.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrDataDirLocked
+		}
+		return nil, err
+	}
+
+	return &dataDir{path: path, lock: lock}, nil
+}
+
+func (d *dataDir) walDir() string {
+	return filepath.Join(d.path, walDirName)
+}
+
+func (d *dataDir) snapshotDir() string {
+	return filepath.Join(d.path, snapshotDirName)
+}
+
+func (d *dataDir) electionPath() string {
+	return filepath.Join(d.path, electionName)
+}
+
+func (d *dataDir) raftDir() string {
+	return filepath.Join(d.path, raftDirName)
+}
+
+// Функция для атомарной замены небольшого файла: данные пишутся во временный файл рядом,
+// который после fsync переименовывается в path
+func writeFileAtomic(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+"*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// Close снимает блокировку с рабочей директории
+func (d *dataDir) Close() error {
+	if err := syscall.Flock(int(d.lock.Fd()), syscall.LOCK_UN); err != nil {
+		d.lock.Close()
+		return err
+	}
+	return d.lock.Close()
+}
@@ -0,0 +1,379 @@
+package practice2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Выборы лидера репликасета по образцу Raft. Каждый узел хранит term и голос в <wrkdir>/election.json.
+// Лидер рассылает heartbeat по соединениям репликации; реплика, не получавшая сообщений лидера
+// дольше таймаута выборов, увеличивает term и запрашивает голоса у остальных узлов через
+// POST /<name>/replication/vote. Узел голосует один раз за term и только за кандидата, история
+// которого не старше его собственной: сравниваются term последней транзакции, затем её LSN.
+// Транзакции отстранённого лидера, не дошедшие до большинства, имеют меньший term, поэтому
+// их длина не даёт преимущества на выборах. Новый лидер при подключении реплики сверяет её последнюю
+// транзакцию со своей транзакцией с тем же LSN и при расхождении отправляет реплике свой чекпоинт
+// (см. replication.go), так что реплика отказывается от чужого хвоста до получения новых транзакций.
+// Узел, узнавший о большем term, перестаёт быть лидером; реплики не принимают сообщения лидера
+// с меньшим term, а writeConcern=majority не подтвердит запись на отстранённом лидере.
+
+// ElectionOptions включает выборы лидера. Без них роль узла задаётся параметром leader в NewStorage.
+type ElectionOptions struct {
+	// Адрес узла, под которым его знают остальные узлы репликасета: host:port/<name>, как в replicas NewStorage
+	Addr string
+	// Период heartbeat лидера
+	HeartbeatInterval time.Duration
+	// Минимальное время без сообщений лидера до начала выборов; фактический таймаут случайный, до удвоенного
+	ElectionTimeout time.Duration
+}
+
+var DefaultElectionOptions = ElectionOptions{
+	HeartbeatInterval: 100 * time.Millisecond,
+	ElectionTimeout:   time.Second,
+}
+
+// WithElection включает выборы лидера; opts.Addr обязателен. При первом запуске репликасета узел
+// с leader=true начинает выборы сразу, остальные — по таймауту.
+func WithElection(opts ElectionOptions) Option {
+	return func(e *Engine) {
+		e.election = opts
+	}
+}
+
+// Функция для проверки, что выборы лидера включены
+func (e *Engine) electionEnabled() bool {
+	return e.election.Addr != ""
+}
+
+// electionState — сохраняемое состояние выборов
+type electionState struct {
+	Term     uint64 `json:"term"`
+	VotedFor string `json:"votedFor"`
+	// Последний term, в котором узел был лидером. Транзакции отстранённого лидера могли не дойти
+	// до нового, поэтому при подключении к нему узел заново загружает чекпоинт
+	LeaderTerm uint64 `json:"leaderTerm"`
+}
+
+func loadElectionState(path string) (electionState, error) {
+	var state electionState
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	return state, json.Unmarshal(data, &state)
+}
+
+// saveElection атомарно сохраняет term и голос: узел не должен проголосовать дважды за один term после перезапуска
+func (e *Engine) saveElection() error {
+	data, err := json.Marshal(electionState{Term: e.term, VotedFor: e.votedFor, LeaderTerm: e.leaderTerm})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(e.dir.electionPath(), data)
+}
+
+// recoverElection загружает состояние выборов. При включённых выборах узел всегда стартует репликой:
+// лидер прошлого запуска мог быть уже заменён.
+func (e *Engine) recoverElection() error {
+	if !e.electionEnabled() {
+		return nil
+	}
+	state, err := loadElectionState(e.dir.electionPath())
+	if err != nil {
+		return err
+	}
+	e.term, e.votedFor, e.leaderTerm = state.Term, state.VotedFor, state.LeaderTerm
+	// После перезапуска немедленные выборы отстранили бы действующего лидера
+	e.startElectionFirst = e.leader && state.Term == 0
+	e.leader = false
+	return nil
+}
+
+// NotLeaderError возвращается на запись в узел, который не является лидером
+type NotLeaderError struct {
+	// Адрес текущего лидера; пустой, если лидер неизвестен
+	Leader string
+}
+
+func (err *NotLeaderError) Error() string {
+	if err.Leader == "" {
+		return "только лидер может создавать новые транзакции, лидер не выбран"
+	}
+	return "только лидер может создавать новые транзакции, лидер: " + err.Leader
+}
+
+func (e *Engine) notLeader() error {
+	return &NotLeaderError{Leader: e.leaderAddr}
+}
+
+// Функция для ответа на ошибку записи: клиент перенаправляется к лидеру, неподтверждённая
+// репликами транзакция отличается от ошибки записи
+func writeCommandError(w http.ResponseWriter, r *http.Request, name string, err error) {
+	var notLeader *NotLeaderError
+	switch {
+	case errors.As(err, &notLeader) && notLeader.Leader != "":
+		// Адрес лидера включает его имя, поэтому префикс узла в пути запроса заменяется
+		w.Header().Set("X-Leader", notLeader.Leader)
+		target := "http://" + notLeader.Leader + strings.TrimPrefix(r.URL.RequestURI(), "/"+name)
+		http.Redirect(w, r, target, http.StatusTemporaryRedirect)
+	case errors.As(err, &notLeader), errors.Is(err, ErrNotEnoughReplicas):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, ErrWriteConcernTimeout):
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// VoteRequest — запрос голоса кандидата
+type VoteRequest struct {
+	Term      uint64 `json:"term"`
+	Candidate string `json:"candidate"`
+	// Последний применённый кандидатом LSN репликасета и term транзакции с этим LSN
+	LSN      uint64 `json:"lsn"`
+	LastTerm uint64 `json:"lastTerm"`
+}
+
+type VoteResponse struct {
+	Term    uint64 `json:"term"`
+	Granted bool   `json:"granted"`
+}
+
+// electionTally — итог сбора голосов кандидатом
+type electionTally struct {
+	term    uint64
+	granted int
+	// Наибольший term из ответов; больше term кандидата, если его выборы устарели
+	maxTerm uint64
+}
+
+// Функция для получения количества голосов, составляющих большинство репликасета
+func (e *Engine) quorum() int {
+	return (len(e.replicas)+1)/2 + 1
+}
+
+// resetElectionTimer откладывает выборы: вызывается при сообщении лидера и отданном голосе
+func (e *Engine) resetElectionTimer() {
+	if e.electionTimer != nil {
+		e.electionTimer.Stop()
+		e.electionTimer = nil
+	}
+	if !e.electionEnabled() || e.leader {
+		return
+	}
+	timeout := e.election.ElectionTimeout
+	e.electionTimer = time.NewTimer(timeout + rand.N(timeout))
+}
+
+func (e *Engine) electionTimeout() <-chan time.Time {
+	if e.electionTimer == nil {
+		return nil
+	}
+	return e.electionTimer.C
+}
+
+// startElection начинает выборы в следующем term. Голоса собираются вне горутины Engine,
+// итог приходит командой electionResult; если большинство не набрано, выборы повторятся по таймауту.
+func (e *Engine) startElection() {
+	if e.walErr != nil {
+		// Узел с недоступным журналом не может стать лидером
+		return
+	}
+	e.term++
+	e.votedFor = e.election.Addr
+	e.setLeaderAddr("")
+	if err := e.saveElection(); err != nil {
+		log.Printf("Ошибка сохранения состояния выборов: %v", err)
+		e.resetElectionTimer()
+		return
+	}
+	log.Printf("Узел %s начинает выборы, term %d", e.election.Addr, e.term)
+	if e.quorum() <= 1 {
+		e.becomeLeader()
+		return
+	}
+	e.resetElectionTimer()
+
+	req := VoteRequest{Term: e.term, Candidate: e.election.Addr, LSN: vclockLSN(e.vclock), LastTerm: e.lastTerm}
+	go func() {
+		cmd := Command{action: "electionResult", tally: e.requestVotes(req)}
+		select {
+		case e.commands <- cmd:
+		case <-e.ctx.Done():
+		}
+	}()
+}
+
+// requestVotes параллельно запрашивает голоса у остальных узлов репликасета
+func (e *Engine) requestVotes(req VoteRequest) *electionTally {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return &electionTally{term: req.Term}
+	}
+	client := &http.Client{Timeout: e.election.ElectionTimeout}
+	responses := make(chan VoteResponse, len(e.replicas))
+	for _, addr := range e.replicas {
+		go func(addr string) {
+			var vote VoteResponse
+			httpReq, err := http.NewRequestWithContext(e.ctx, http.MethodPost,
+				"http://"+addr+"/replication/vote", bytes.NewReader(body))
+			if err == nil {
+				var resp *http.Response
+				if resp, err = client.Do(httpReq); err == nil {
+					if resp.StatusCode == http.StatusOK {
+						err = json.NewDecoder(resp.Body).Decode(&vote)
+					}
+					resp.Body.Close()
+				}
+			}
+			responses <- vote
+		}(addr)
+	}
+	tally := &electionTally{term: req.Term, maxTerm: req.Term}
+	for range e.replicas {
+		vote := <-responses
+		if vote.Granted && vote.Term == req.Term {
+			tally.granted++
+		}
+		tally.maxTerm = max(tally.maxTerm, vote.Term)
+	}
+	return tally
+}
+
+func (e *Engine) handleElectionResult(cmd Command) {
+	tally := cmd.tally
+	if tally.maxTerm > e.term {
+		e.stepDown(tally.maxTerm, "")
+		return
+	}
+	// Выборы устарели: за это время начались новые или лидер уже найден
+	if tally.term != e.term || e.leader || e.leaderAddr != "" {
+		return
+	}
+	if tally.granted+1 >= e.quorum() {
+		e.becomeLeader()
+	}
+}
+
+// becomeLeader делает узел лидером текущего term. Нумерация транзакций продолжается
+// с последнего LSN, записанного в журнал узла.
+func (e *Engine) becomeLeader() {
+	// Транзакции прежнего лидера, ожидающие группового коммита, уже записаны в журнал, но ещё не применены
+	// и не учтены в векторных часах. Они подтверждаются до выбора следующего LSN, иначе лидер выдал бы их LSN повторно.
+	e.wal.syncPending()
+	e.leader = true
+	e.leaderTerm = e.term
+	e.lsn = max(vclockLSN(e.vclock), e.wal.lastLSN)
+	if err := e.saveElection(); err != nil {
+		log.Printf("Ошибка сохранения состояния выборов: %v", err)
+	}
+	e.resetElectionTimer()
+	e.setLeaderAddr(e.election.Addr)
+	log.Printf("Узел %s избран лидером, term %d, LSN %d", e.election.Addr, e.term, e.lsn)
+}
+
+// stepDown переводит узел в реплики при известии о term не меньше своего. leader — адрес нового лидера, если он известен.
+func (e *Engine) stepDown(term uint64, leader string) {
+	if term > e.term {
+		e.term = term
+		e.votedFor = ""
+		if err := e.saveElection(); err != nil {
+			log.Printf("Ошибка сохранения состояния выборов: %v", err)
+		}
+	}
+	if e.leader {
+		log.Printf("Узел %s больше не лидер, term %d", e.election.Addr, e.term)
+		e.leader = false
+		e.closeFollowers()
+		e.failWriteConcern(e.notLeader())
+	}
+	e.setLeaderAddr(leader)
+	e.resetElectionTimer()
+}
+
+func (e *Engine) setLeaderAddr(addr string) {
+	if e.leaderAddr != addr {
+		e.leaderAddr = addr
+		// Горутины репликации переподключаются к новому лидеру без ожидания паузы
+		e.progress.notify()
+	}
+}
+
+// observeLeader проверяет term сообщения лидера и откладывает выборы.
+// Сообщение с меньшим term пришло от отстранённого лидера и отклоняется.
+func (e *Engine) observeLeader(term uint64, leader string) error {
+	if !e.electionEnabled() {
+		return nil
+	}
+	if term < e.term {
+		return errors.New("сообщение от отстранённого лидера")
+	}
+	if term > e.term || e.leader || e.leaderAddr != leader {
+		e.stepDown(term, leader)
+	} else {
+		e.resetElectionTimer()
+	}
+	return nil
+}
+
+func (e *Engine) handleHeartbeat(cmd Command) {
+	cmd.result <- e.observeLeader(cmd.term, cmd.leaderAddr)
+}
+
+func (e *Engine) handleRequestVote(cmd Command) {
+	req := cmd.vote
+	if !e.electionEnabled() || req.Term < e.term {
+		cmd.voteResult <- VoteResponse{Term: e.term}
+		return
+	}
+	if req.Term > e.term {
+		e.stepDown(req.Term, "")
+	}
+	granted := (e.votedFor == "" || e.votedFor == req.Candidate) && e.candidateUpToDate(req)
+	if granted {
+		e.votedFor = req.Candidate
+		if err := e.saveElection(); err != nil {
+			log.Printf("Ошибка сохранения состояния выборов: %v", err)
+			granted = false
+		} else {
+			e.resetElectionTimer()
+		}
+	}
+	cmd.voteResult <- VoteResponse{Term: e.term, Granted: granted}
+}
+
+// candidateUpToDate сравнивает историю кандидата со своей: сначала по term последней транзакции, затем по LSN
+func (e *Engine) candidateUpToDate(req *VoteRequest) bool {
+	if req.LastTerm != e.lastTerm {
+		return req.LastTerm > e.lastTerm
+	}
+	return req.LSN >= vclockLSN(e.vclock)
+}
+
+func (s *Storage) serveVote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req VoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cmd := Command{action: "requestVote", vote: &req, voteResult: make(chan VoteResponse)}
+	s.engine.commands <- cmd
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(<-cmd.voteResult); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
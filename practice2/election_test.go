@@ -0,0 +1,298 @@
+package practice2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testElectionOptions = ElectionOptions{HeartbeatInterval: 20 * time.Millisecond, ElectionTimeout: 150 * time.Millisecond}
+
+type testNode struct {
+	mux    *http.ServeMux
+	server *httptest.Server
+	name   string
+	// Адрес HTTP сервера узла
+	addr    string
+	dir     string
+	storage *Storage
+}
+
+// start запускает хранилище узла на его адресе; адрес сохраняется между перезапусками
+func (n *testNode) start(t *testing.T, peers []string, leader bool) {
+	t.Helper()
+	n.mux = http.NewServeMux()
+	opts := testElectionOptions
+	opts.Addr = n.peer()
+	s, err := NewStorage(n.mux, n.dir, n.name, peers, leader, WithElection(opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	n.storage = s
+	listener, err := net.Listen("tcp", n.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.server = &httptest.Server{Listener: listener, Config: &http.Server{Handler: n.mux}}
+	n.server.Start()
+}
+
+// peer возвращает адрес узла, под которым его знают остальные узлы репликасета
+func (n *testNode) peer() string {
+	return n.addr + "/" + n.name
+}
+
+func (n *testNode) stop() {
+	if n.storage != nil {
+		n.storage.Stop()
+		n.server.Close()
+		n.storage = nil
+	}
+}
+
+// Функция для запуска репликасета с выборами; первый узел начинает выборы сразу
+func startCluster(t *testing.T, size int) []*testNode {
+	t.Helper()
+	nodes := make([]*testNode, size)
+	for i := range nodes {
+		// Свободный порт занимается заранее, чтобы узлы знали адреса друг друга
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes[i] = &testNode{name: fmt.Sprintf("storage%d", i+1), addr: listener.Addr().String(), dir: t.TempDir()}
+		listener.Close()
+	}
+	for i, node := range nodes {
+		node.start(t, clusterPeers(nodes, i), i == 0)
+	}
+	t.Cleanup(func() {
+		for _, node := range nodes {
+			node.stop()
+		}
+	})
+	return nodes
+}
+
+func clusterPeers(nodes []*testNode, self int) []string {
+	var peers []string
+	for i, node := range nodes {
+		if i != self {
+			peers = append(peers, node.peer())
+		}
+	}
+	return peers
+}
+
+func replicationStatus(s *Storage) ReplicationStatus {
+	cmd := Command{action: "replicationState", replicationResult: make(chan ReplicationStatus)}
+	s.engine.commands <- cmd
+	return <-cmd.replicationResult
+}
+
+func TestLeaderElection(t *testing.T) {
+	nodes := startCluster(t, 3)
+	waitFor(t, "initial leader", func() bool { return replicationStatus(nodes[0].storage).Leader })
+	// Запись с majority отклоняется, пока к лидеру не подключилась ни одна реплика
+	waitFor(t, "followers attach", func() bool { return replicationStatus(nodes[0].storage).Followers == 2 })
+	firstTerm := replicationStatus(nodes[0].storage).Term
+
+	if code := postFeature(t, nodes[0].mux, "/storage1/insert?writeConcern=majority", newTestFeature("a", 1, 1)); code != http.StatusOK {
+		t.Fatalf("Insert on leader failed with %d", code)
+	}
+	waitFor(t, "replication to followers", func() bool {
+		return searchIDs(t, nodes[1].storage)["a"] && searchIDs(t, nodes[2].storage)["a"]
+	})
+
+	// Реплика перенаправляет запись к лидеру
+	body, _ := json.Marshal(newTestFeature("b", 2, 2))
+	w := httptest.NewRecorder()
+	nodes[1].mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/storage2/insert", bytes.NewReader(body)))
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("X-Leader") != nodes[0].peer() ||
+		w.Header().Get("Location") != "http://"+nodes[0].peer()+"/insert" {
+		t.Errorf("Expected redirect to leader %s, got %d %v", nodes[0].peer(), w.Code, w.Header())
+	}
+
+	// После остановки лидера оставшиеся узлы выбирают нового
+	nodes[0].stop()
+	var leader, follower *testNode
+	waitFor(t, "new leader", func() bool {
+		for i, node := range nodes[1:] {
+			if status := replicationStatus(node.storage); status.Leader && status.Term > firstTerm {
+				leader, follower = node, nodes[2-i]
+				return true
+			}
+		}
+		return false
+	})
+	execCommand(t, leader.storage, "insert", newTestFeature("c", 3, 3))
+	waitFor(t, "replication from new leader", func() bool { return sameIDs(searchIDs(t, follower.storage), "a", "c") })
+	// Новый лидер продолжает сквозную нумерацию под своим именем
+	if vclock := replicationStatus(follower.storage).VClock; len(vclock) != 2 || vclock["storage1"] != 1 || vclock[leader.name] != 2 {
+		t.Errorf("Expected follower vclock {storage1:1 %s:2}, got %v", leader.name, vclock)
+	}
+
+	// Прежний лидер возвращается репликой и заново загружает состояние нового лидера
+	nodes[0].start(t, clusterPeers(nodes, 0), true)
+	waitFor(t, "old leader rejoin", func() bool {
+		status := replicationStatus(nodes[0].storage)
+		return !status.Leader && status.LeaderAddr == leader.peer() && !status.Resync &&
+			sameIDs(searchIDs(t, nodes[0].storage), "a", "c")
+	})
+	if !replicationStatus(leader.storage).Leader {
+		t.Error("Restarted node should not depose the elected leader")
+	}
+}
+
+func postVote(t *testing.T, mux *http.ServeMux, req VoteRequest) VoteResponse {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/storage/replication/vote", bytes.NewReader(body)))
+	var resp VoteResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestRequestVote(t *testing.T) {
+	// Узел без реплик сразу становится лидером term 1
+	mux := http.NewServeMux()
+	opts := testElectionOptions
+	opts.Addr = "node1"
+	// Узел не должен начать новые выборы во время проверки
+	opts.ElectionTimeout = time.Minute
+	s, err := NewStorage(mux, t.TempDir(), "storage", nil, true, WithElection(opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+	waitFor(t, "single node leader", func() bool { return replicationStatus(s).Leader })
+	execCommand(t, s, "insert", newTestFeature("a", 1, 1))
+	execCommand(t, s, "insert", newTestFeature("c", 3, 3))
+
+	// Кандидат с устаревшим term не получает голос
+	if resp := postVote(t, mux, VoteRequest{Term: 1, Candidate: "node2", LSN: 5}); resp.Granted || resp.Term != 1 {
+		t.Errorf("Expected vote for stale term to be denied, got %+v", resp)
+	}
+	// Кандидат, отставший по журналу, отстраняет лидера, но голос не получает
+	if resp := postVote(t, mux, VoteRequest{Term: 2, Candidate: "node2", LSN: 0}); resp.Granted || resp.Term != 2 {
+		t.Errorf("Expected vote for lagging candidate to be denied, got %+v", resp)
+	}
+	if status := replicationStatus(s); status.Leader || status.Term != 2 {
+		t.Errorf("Expected leader to step down on higher term, got %+v", status)
+	}
+	if resp := postVote(t, mux, VoteRequest{Term: 2, Candidate: "node3", LSN: 2, LastTerm: 1}); !resp.Granted {
+		t.Errorf("Expected vote for up-to-date candidate, got %+v", resp)
+	}
+	// Один голос за term
+	if resp := postVote(t, mux, VoteRequest{Term: 2, Candidate: "node2", LSN: 2, LastTerm: 1}); resp.Granted {
+		t.Errorf("Expected second vote in the same term to be denied, got %+v", resp)
+	}
+	// Длинный журнал со старым term последней транзакции проигрывает
+	if resp := postVote(t, mux, VoteRequest{Term: 3, Candidate: "node4", LSN: 5, LastTerm: 0}); resp.Granted {
+		t.Errorf("Expected vote for candidate with older last term to be denied, got %+v", resp)
+	}
+	// Более новый term последней транзакции выигрывает даже при меньшем LSN
+	if resp := postVote(t, mux, VoteRequest{Term: 4, Candidate: "node5", LSN: 1, LastTerm: 2}); !resp.Granted {
+		t.Errorf("Expected vote for candidate with newer last term, got %+v", resp)
+	}
+	// Записи на отстранённом лидере отклоняются
+	if code := postFeature(t, mux, "/storage/insert", newTestFeature("b", 2, 2)); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d from deposed leader without known leader, got %d", http.StatusServiceUnavailable, code)
+	}
+}
+
+func TestFollowerDivergedTail(t *testing.T) {
+	// Реплика применила транзакцию отстранённого лидера term 1, которая не дошла до нового лидера
+	dir := t.TempDir()
+	d, err := openDataDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+	w, err := openWAL(filepath.Join(dir, walDirName), DefaultWALOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.append(&Transaction{Action: "insert", Name: "storage", LSN: 1, Term: 1, Feature: newTestFeature("x", 9, 9)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leader := &testNode{name: "storage", addr: listener.Addr().String(), dir: t.TempDir()}
+	listener.Close()
+	defer leader.stop()
+	// Перезапуск переводит лидера в term 2: его транзакции с тем же LSN имеют другой term
+	for range 2 {
+		leader.stop()
+		leader.start(t, nil, true)
+		waitFor(t, "single node leader", func() bool { return replicationStatus(leader.storage).Leader })
+	}
+	execCommand(t, leader.storage, "insert", newTestFeature("a", 1, 1))
+	execCommand(t, leader.storage, "insert", newTestFeature("b", 2, 2))
+
+	follower, err := NewStorage(http.NewServeMux(), dir, "replica", []string{leader.peer()}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	follower.Run()
+	defer follower.Stop()
+	waitFor(t, "follower resync", func() bool { return sameIDs(searchIDs(t, follower), "a", "b") })
+	if status := replicationStatus(follower); status.VClock["storage"] != 2 || status.LastTerm != 2 {
+		t.Errorf("Expected follower at LSN 2 of term 2, got %+v", status)
+	}
+}
+
+func TestLeaderSeedsLSNFromGroupCommit(t *testing.T) {
+	// Транзакции прежнего лидера ждут группового коммита, когда реплика побеждает на выборах
+	walOpts := DefaultWALOptions
+	walOpts.Durability = DurabilityGroup
+	walOpts.GroupWindow = time.Second
+	walOpts.GroupBatch = 100
+	opts := ElectionOptions{Addr: "127.0.0.1:1/replica", HeartbeatInterval: 10 * time.Millisecond, ElectionTimeout: 50 * time.Millisecond}
+	s, err := NewStorage(http.NewServeMux(), t.TempDir(), "replica", nil, false, WithElection(opts), WithWAL(walOpts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	var results []chan error
+	for lsn := uint64(1); lsn <= 3; lsn++ {
+		txn := &Transaction{Action: "insert", Name: "storage", LSN: lsn, Term: 1, Feature: newTestFeature(fmt.Sprint(lsn), 1, 1)}
+		// Результат приходит только после fsync, поэтому канал буферизован
+		cmd := Command{action: "replicate", txn: txn, term: 1, leaderAddr: "127.0.0.1:2/storage", result: make(chan error, 1)}
+		s.engine.commands <- cmd
+		results = append(results, cmd.result)
+	}
+	waitFor(t, "single node leader", func() bool { return replicationStatus(s).Leader })
+	// Запись нового лидера приходит раньше, чем истекает окно группового коммита
+	execCommand(t, s, "insert", newTestFeature("a", 2, 2))
+	for _, result := range results {
+		if err := <-result; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if status := replicationStatus(s); status.VClock["replica"] != 4 || status.VClock["storage"] != 3 {
+		t.Errorf("Expected the new leader to continue from LSN 3, got %v", status.VClock)
+	}
+	if ids := searchIDs(t, s); !sameIDs(ids, "1", "2", "3", "a") {
+		t.Errorf("Expected replicated and new features, got %v", ids)
+	}
+}
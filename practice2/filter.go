@@ -0,0 +1,291 @@
+package practice2
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// Filter — фильтр по свойствам объекта, все условия объединяются через И.
+// Синтаксис параметра filter, условия разделяются запятой вне скобок и кавычек
+// (точку с запятой net/url отбрасывает вместе со всем параметром):
+//
+//	category=restaurant          равенство (!= — неравенство)
+//	rating>=4,rating<5           диапазон: <, <=, >, >=
+//	category in (cafe,bar)       одно из значений
+//	exists(name)                 свойство задано (!exists(name) — не задано)
+//	name^=Кафе                   строка начинается с префикса
+//
+// Значения в кавычках всегда строки, без кавычек — число, true/false или строка.
+// Условие на отсутствующее свойство не выполняется, кроме !exists.
+type Filter []Condition
+
+type Condition struct {
+	Key    string
+	Op     string
+	Values []FilterValue
+}
+
+// FilterValue — значение из выражения фильтра: исходный текст и его разобранная форма
+type FilterValue struct {
+	Raw    string
+	Number *float64
+	Bool   *bool
+	Quoted bool
+}
+
+// Операторы сравнения; двухсимвольные проверяются раньше односимвольных
+var filterOperators = []string{"!=", ">=", "<=", "^=", "=", ">", "<"}
+
+// Функция для разбора параметра filter, пустое выражение означает отсутствие фильтра
+func parseFilter(expr string) (Filter, error) {
+	clauses, err := splitOutside(expr, ',')
+	if err != nil {
+		return nil, err
+	}
+	var filter Filter
+	for _, clause := range clauses {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+		cond, err := parseCondition(clause)
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, cond)
+	}
+	return filter, nil
+}
+
+func parseCondition(clause string) (Condition, error) {
+	for _, op := range []string{"!exists", "exists"} {
+		if strings.HasPrefix(clause, op+"(") && strings.HasSuffix(clause, ")") {
+			key := strings.TrimSpace(clause[len(op)+1 : len(clause)-1])
+			if key == "" {
+				return Condition{}, errors.New("не указано свойство в условии: " + clause)
+			}
+			return Condition{Key: key, Op: op}, nil
+		}
+	}
+
+	if key, list, ok := splitIn(clause); ok {
+		items, err := splitOutside(list, ',')
+		if err != nil {
+			return Condition{}, err
+		}
+		cond := Condition{Key: key, Op: "in"}
+		for _, item := range items {
+			value, err := parseFilterValue(item)
+			if err != nil {
+				return Condition{}, err
+			}
+			cond.Values = append(cond.Values, value)
+		}
+		return cond, nil
+	}
+
+	index, op := findOperator(clause)
+	if op == "" {
+		return Condition{}, errors.New("некорректное условие фильтра: " + clause)
+	}
+	key := strings.TrimSpace(clause[:index])
+	if key == "" {
+		return Condition{}, errors.New("не указано свойство в условии: " + clause)
+	}
+	value, err := parseFilterValue(clause[index+len(op):])
+	if err != nil {
+		return Condition{}, err
+	}
+	return Condition{Key: key, Op: op, Values: []FilterValue{value}}, nil
+}
+
+// Функция для разбора условия вида "key in (a,b)"
+func splitIn(clause string) (key, list string, ok bool) {
+	lower := strings.ToLower(clause)
+	index := strings.Index(lower, " in ")
+	if index < 0 || strings.ContainsAny(clause[:index], `"=<>!^`) {
+		return "", "", false
+	}
+	rest := strings.TrimSpace(clause[index+len(" in "):])
+	if !strings.HasPrefix(rest, "(") || !strings.HasSuffix(rest, ")") {
+		return "", "", false
+	}
+	return strings.TrimSpace(clause[:index]), rest[1 : len(rest)-1], true
+}
+
+// Функция для поиска первого оператора сравнения вне кавычек
+func findOperator(clause string) (int, string) {
+	quoted := false
+	for i := 0; i < len(clause); i++ {
+		if clause[i] == '"' {
+			quoted = !quoted
+			continue
+		}
+		if quoted {
+			continue
+		}
+		for _, op := range filterOperators {
+			if strings.HasPrefix(clause[i:], op) {
+				return i, op
+			}
+		}
+	}
+	return -1, ""
+}
+
+// Функция для разбиения строки по разделителю вне кавычек и скобок
+func splitOutside(s string, sep byte) ([]string, error) {
+	var parts []string
+	quoted, depth, start := false, 0, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	if quoted || depth != 0 {
+		return nil, errors.New("незакрытые кавычки или скобки в фильтре: " + s)
+	}
+	return append(parts, s[start:]), nil
+}
+
+func parseFilterValue(raw string) (FilterValue, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, `"`) {
+		s, err := strconv.Unquote(raw)
+		if err != nil {
+			return FilterValue{}, errors.New("некорректная строка в фильтре: " + raw)
+		}
+		return FilterValue{Raw: s, Quoted: true}, nil
+	}
+	value := FilterValue{Raw: raw}
+	if n, err := strconv.ParseFloat(raw, 64); err == nil {
+		value.Number = &n
+	}
+	if raw == "true" || raw == "false" {
+		b := raw == "true"
+		value.Bool = &b
+	}
+	return value, nil
+}
+
+// Match проверяет, что свойства объекта удовлетворяют всем условиям фильтра
+func (f Filter) Match(props geojson.Properties) bool {
+	for _, cond := range f {
+		if !cond.match(props) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Condition) match(props geojson.Properties) bool {
+	prop, ok := props[c.Key]
+	switch c.Op {
+	case "exists":
+		return ok
+	case "!exists":
+		return !ok
+	}
+	if !ok {
+		return false
+	}
+
+	switch c.Op {
+	case "=":
+		return equalValue(prop, c.Values[0])
+	case "!=":
+		return !equalValue(prop, c.Values[0])
+	case "in":
+		for _, value := range c.Values {
+			if equalValue(prop, value) {
+				return true
+			}
+		}
+		return false
+	case "^=":
+		s, ok := prop.(string)
+		return ok && strings.HasPrefix(s, c.Values[0].Raw)
+	}
+
+	cmp, ok := compareValue(prop, c.Values[0])
+	if !ok {
+		return false
+	}
+	switch c.Op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func equalValue(prop interface{}, value FilterValue) bool {
+	if prop == nil {
+		return value.Raw == "null" && !value.Quoted
+	}
+	if b, ok := prop.(bool); ok {
+		return value.Bool != nil && *value.Bool == b
+	}
+	cmp, ok := compareValue(prop, value)
+	return ok && cmp == 0
+}
+
+// Функция для сравнения свойства со значением: числа сравниваются как числа, строки — лексикографически
+func compareValue(prop interface{}, value FilterValue) (int, bool) {
+	if n, ok := toFloat(prop); ok {
+		if value.Number == nil || value.Quoted {
+			return 0, false
+		}
+		switch {
+		case n < *value.Number:
+			return -1, true
+		case n > *value.Number:
+			return 1, true
+		}
+		return 0, true
+	}
+	if s, ok := prop.(string); ok {
+		return strings.Compare(s, value.Raw), true
+	}
+	return 0, false
+}
+
+// Свойства из JSON всегда float64, но объекты, созданные в Go, могут содержать целые числа
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,62 @@
+package practice2
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+func TestFilter(t *testing.T) {
+	props := geojson.Properties{
+		"category": "restaurant",
+		"name":     "Кафе Пушкин",
+		"rating":   4.5,
+		"seats":    40,
+		"open":     true,
+		"code":     "007",
+	}
+	cases := []struct {
+		expr     string
+		expected bool
+	}{
+		{"", true},
+		{"category=restaurant", true},
+		{"category=cafe", false},
+		{"category!=cafe", true},
+		{"rating>=4,rating<5", true},
+		{"rating>4.5", false},
+		{"seats<=40", true},
+		{"category in (cafe,restaurant)", true},
+		{"category in (cafe, bar)", false},
+		{"seats in (10,40)", true},
+		{"category in (cafe,restaurant),seats>40", false},
+		{"exists(name)", true},
+		{"exists(phone)", false},
+		{"!exists(phone)", true},
+		{"phone!=123", false},
+		{"name^=Кафе", true},
+		{"name^=Бар", false},
+		{"open=true", true},
+		{"open=1", false},
+		{`code="007"`, true},
+		{"code=007", true},
+		{`rating="4.5"`, false},
+		{`name="Кафе Пушкин",category in ("restaurant,bar")`, false},
+	}
+	for _, c := range cases {
+		filter, err := parseFilter(c.expr)
+		if err != nil {
+			t.Errorf("parseFilter(%q) failed: %v", c.expr, err)
+			continue
+		}
+		if got := filter.Match(props); got != c.expected {
+			t.Errorf("Filter %q returned %v, expected %v", c.expr, got, c.expected)
+		}
+	}
+
+	for _, expr := range []string{"category", "=cafe", `name="Кафе`, "category in (cafe", "exists()"} {
+		if _, err := parseFilter(expr); err == nil {
+			t.Errorf("parseFilter(%q) accepted invalid expression", expr)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package practice2
+
+import (
+	"container/list"
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/planar"
+	"github.com/paulmach/orb/simplify"
+)
+
+// Размер тайла в пикселях, для которого уровень масштаба переводится в разрешение
+const generalizeTileSize = 256
+
+// Generalization — параметры генерализации геометрий select для заданного масштаба карты.
+// Resolution — размер пикселя в градусах; нулевое значение означает выдачу без изменений.
+type Generalization struct {
+	Resolution float64
+	// Уровень масштаба, из которого получено разрешение; -1 — разрешение задано явно.
+	// Только генерализация по уровню масштаба кэшируется
+	Zoom int
+	// Алгоритм упрощения: dp (Дуглас — Пекер) или vw (Висвалингам — Уайетт)
+	Algorithm string
+	// Объекты, у которых обе стороны bounding box меньше MinSize пикселей, считаются мелкими
+	MinSize float64
+	// Что делать с мелкими объектами: point — заменить точкой, drop — не выдавать, keep — оставить
+	Small string
+}
+
+// Функция для разбора параметров генерализации: zoom либо resolution (в единицах proj на пиксель),
+// simplify=dp|vw, minSize в пикселях и small=point|drop|keep
+func parseGeneralization(query url.Values, proj *Projection) (Generalization, error) {
+	gen := Generalization{Zoom: -1, Algorithm: "dp", MinSize: 1, Small: "point"}
+	rawZoom, rawResolution := query.Get("zoom"), query.Get("resolution")
+	switch {
+	case rawZoom != "" && rawResolution != "":
+		return gen, errors.New("zoom и resolution не задаются одновременно")
+	case rawZoom != "":
+		zoom, err := strconv.Atoi(rawZoom)
+		if err != nil || zoom < 0 || zoom > maxTileZoom {
+			return gen, errors.New("Invalid zoom parameter")
+		}
+		gen.Zoom = zoom
+		gen.Resolution = 360 / (generalizeTileSize * math.Exp2(float64(zoom)))
+	case rawResolution != "":
+		resolution, err := strconv.ParseFloat(rawResolution, 64)
+		if err != nil || resolution <= 0 || math.IsInf(resolution, 0) || math.IsNaN(resolution) {
+			return gen, errors.New("Invalid resolution parameter")
+		}
+		gen.Resolution = proj.resolutionToNative(resolution)
+	}
+
+	switch algorithm := query.Get("simplify"); algorithm {
+	case "":
+	case "dp", "vw":
+		gen.Algorithm = algorithm
+	default:
+		return gen, errors.New("неизвестный алгоритм упрощения: " + algorithm)
+	}
+	if raw := query.Get("minSize"); raw != "" {
+		minSize, err := strconv.ParseFloat(raw, 64)
+		if err != nil || minSize < 0 || math.IsInf(minSize, 0) || math.IsNaN(minSize) {
+			return gen, errors.New("Invalid minSize parameter")
+		}
+		gen.MinSize = minSize
+	}
+	switch small := query.Get("small"); small {
+	case "":
+	case "point", "drop", "keep":
+		gen.Small = small
+	default:
+		return gen, errors.New("Invalid small parameter")
+	}
+	return gen, nil
+}
+
+// Функция для перевода разрешения из единиц proj на пиксель в градусы на пиксель.
+// Для Web Mercator пересчёт точен по долготе; по широте на высоких широтах допуск получается больше.
+func (p *Projection) resolutionToNative(resolution float64) float64 {
+	if p.toNative == nil {
+		return resolution
+	}
+	return resolution / orb.EarthRadius * 180 / math.Pi
+}
+
+// Enabled сообщает, задан ли масштаб генерализации
+func (g Generalization) Enabled() bool {
+	return g.Resolution > 0
+}
+
+func (g Generalization) simplifier() orb.Simplifier {
+	if g.Algorithm == "vw" {
+		// Отбрасываются вершины, образующие с соседями треугольник площадью меньше пикселя
+		return simplify.VisvalingamThreshold(g.Resolution * g.Resolution)
+	}
+	return simplify.DouglasPeucker(g.Resolution)
+}
+
+// apply возвращает генерализованную копию объекта или nil, если объект не нужно выдавать.
+// Объект Engine не изменяется: геометрия копируется перед упрощением.
+func (g Generalization) apply(feature *geojson.Feature) *geojson.Feature {
+	if !g.Enabled() {
+		return feature
+	}
+	geometry := feature.Geometry
+	switch geometry.(type) {
+	case orb.Point, orb.MultiPoint:
+		return feature
+	}
+
+	bound := geometry.Bound()
+	size := g.MinSize * g.Resolution
+	small := bound.Right()-bound.Left() < size && bound.Top()-bound.Bottom() < size
+	if !small || g.Small == "keep" {
+		geometry = g.simplifier().Simplify(orb.Clone(geometry))
+		if !degenerate(geometry) {
+			return &geojson.Feature{ID: feature.ID, Type: feature.Type, Geometry: geometry, Properties: feature.Properties}
+		}
+		// Упрощение выродило геометрию — поступаем с ней как с мелким объектом
+		if g.Small == "keep" {
+			return feature
+		}
+	}
+	if g.Small == "drop" {
+		return nil
+	}
+	center, _ := planar.CentroidArea(feature.Geometry)
+	return &geojson.Feature{ID: feature.ID, Type: feature.Type, Geometry: center, Properties: feature.Properties}
+}
+
+// Функция для проверки, что после упрощения от геометрии ничего не осталось
+func degenerate(g orb.Geometry) bool {
+	switch g := g.(type) {
+	case nil:
+		return true
+	case orb.LineString:
+		return len(g) < 2
+	case orb.MultiLineString:
+		for _, ls := range g {
+			if len(ls) >= 2 {
+				return false
+			}
+		}
+		return true
+	case orb.Polygon:
+		return len(g) == 0 || len(g[0]) < 4
+	case orb.MultiPolygon:
+		for _, p := range g {
+			if len(p) > 0 && len(p[0]) >= 4 {
+				return false
+			}
+		}
+		return true
+	case orb.Collection:
+		for _, part := range g {
+			if !degenerate(part) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// generalizeCache хранит генерализованные копии объектов для уровней масштаба.
+// Ключ содержит указатель на объект Engine: при замене объекта появляется новый указатель,
+// и устаревшие записи вытесняются как давно не использованные.
+type generalizeCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[generalizeKey]*list.Element
+	order   *list.List
+}
+
+type generalizeKey struct {
+	feature   *geojson.Feature
+	zoom      int
+	algorithm string
+	minSize   float64
+	small     string
+}
+
+type generalizeEntry struct {
+	key     generalizeKey
+	feature *geojson.Feature
+}
+
+// WithGeneralizationCache включает кэш генерализованных геометрий на size объектов.
+// Кэшируются только запросы с параметром zoom: разрешение resolution меняется непрерывно.
+func WithGeneralizationCache(size int) Option {
+	return func(e *Engine) {
+		if size > 0 {
+			e.generalized = &generalizeCache{
+				size:    size,
+				entries: make(map[generalizeKey]*list.Element),
+				order:   list.New(),
+			}
+		}
+	}
+}
+
+// generalize применяет генерализацию к объектам select, используя кэш, если он включён.
+// Вызывается из обработчика HTTP, поэтому кэш защищён мьютексом.
+func (c *generalizeCache) generalize(g Generalization, features []*geojson.Feature) []*geojson.Feature {
+	if !g.Enabled() {
+		return features
+	}
+	result := make([]*geojson.Feature, 0, len(features))
+	for _, feature := range features {
+		if generalized := c.apply(g, feature); generalized != nil {
+			result = append(result, generalized)
+		}
+	}
+	return result
+}
+
+func (c *generalizeCache) apply(g Generalization, feature *geojson.Feature) *geojson.Feature {
+	if c == nil || g.Zoom < 0 {
+		return g.apply(feature)
+	}
+	key := generalizeKey{feature: feature, zoom: g.Zoom, algorithm: g.Algorithm, minSize: g.MinSize, small: g.Small}
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		c.mu.Unlock()
+		return elem.Value.(*generalizeEntry).feature
+	}
+	c.mu.Unlock()
+
+	// Упрощение выполняется без блокировки; одновременные запросы могут посчитать один объект дважды
+	generalized := g.apply(feature)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(&generalizeEntry{key: key, feature: generalized})
+		if c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*generalizeEntry).key)
+		}
+	}
+	return generalized
+}
@@ -0,0 +1,107 @@
+package practice2
+
+import (
+	"math"
+	"net/url"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Функция для построения окружности из n точек радиусом r градусов
+func circlePolygon(center orb.Point, r float64, n int) orb.Polygon {
+	ring := make(orb.Ring, 0, n+1)
+	for i := 0; i < n; i++ {
+		a := 2 * math.Pi * float64(i) / float64(n)
+		ring = append(ring, orb.Point{center[0] + r*math.Cos(a), center[1] + r*math.Sin(a)})
+	}
+	return orb.Polygon{append(ring, ring[0])}
+}
+
+func TestGeneralization(t *testing.T) {
+	proj, _ := parseProjection("")
+	feature := geojson.NewFeature(circlePolygon(orb.Point{10, 10}, 1, 1000))
+	feature.ID = "circle"
+	original := orb.Clone(feature.Geometry)
+
+	var previous int
+	for _, zoom := range []string{"10", "8", "4"} {
+		for _, algorithm := range []string{"dp", "vw"} {
+			gen, err := parseGeneralization(url.Values{"zoom": {zoom}, "simplify": {algorithm}}, proj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := gen.apply(feature)
+			polygon, ok := result.Geometry.(orb.Polygon)
+			if !ok {
+				t.Fatalf("zoom %s %s: expected polygon, got %T", zoom, algorithm, result.Geometry)
+			}
+			points := len(polygon[0])
+			if points >= 1001 || (algorithm == "dp" && previous != 0 && points > previous) {
+				t.Errorf("zoom %s %s: polygon has %d points, previous zoom %d", zoom, algorithm, points, previous)
+			}
+			if algorithm == "dp" {
+				previous = points
+			}
+		}
+	}
+	if !orb.Equal(feature.Geometry, original) {
+		t.Error("Generalization modified the stored feature")
+	}
+
+	// На нулевом уровне масштаба пиксель больше градуса: круг становится точкой или отбрасывается
+	gen, _ := parseGeneralization(url.Values{"zoom": {"0"}}, proj)
+	if point, ok := gen.apply(feature).Geometry.(orb.Point); !ok || planarDistance(point, orb.Point{10, 10}) > 1e-6 {
+		t.Errorf("Small feature collapsed to %v, expected centroid point", gen.apply(feature).Geometry)
+	}
+	gen.Small = "drop"
+	if gen.apply(feature) != nil {
+		t.Error("Small feature was not dropped")
+	}
+
+	// Разрешение в метрах Web Mercator переводится в градусы
+	mercator, _ := parseProjection("EPSG:3857")
+	byZoom, _ := parseGeneralization(url.Values{"zoom": {"5"}}, proj)
+	byResolution, _ := parseGeneralization(url.Values{"resolution": {"4891.969809375"}}, mercator)
+	if math.Abs(byZoom.Resolution-byResolution.Resolution) > 1e-9 {
+		t.Errorf("Resolution %v does not match zoom resolution %v", byResolution.Resolution, byZoom.Resolution)
+	}
+
+	for _, query := range []url.Values{
+		{"zoom": {"25"}}, {"zoom": {"a"}}, {"resolution": {"-1"}}, {"zoom": {"1"}, "resolution": {"1"}},
+		{"simplify": {"rdp"}}, {"small": {"hide"}}, {"minSize": {"-1"}},
+	} {
+		if _, err := parseGeneralization(query, proj); err == nil {
+			t.Errorf("parseGeneralization(%v) accepted invalid parameters", query)
+		}
+	}
+}
+
+func planarDistance(a, b orb.Point) float64 {
+	return math.Hypot(a[0]-b[0], a[1]-b[1])
+}
+
+func TestGeneralizationCache(t *testing.T) {
+	engine := &Engine{}
+	WithGeneralizationCache(2)(engine)
+	cache := engine.generalized
+	proj, _ := parseProjection("")
+	gen, _ := parseGeneralization(url.Values{"zoom": {"6"}}, proj)
+	features := []*geojson.Feature{
+		geojson.NewFeature(circlePolygon(orb.Point{0, 0}, 1, 100)),
+		geojson.NewFeature(circlePolygon(orb.Point{5, 0}, 1, 100)),
+		geojson.NewFeature(circlePolygon(orb.Point{10, 0}, 1, 100)),
+	}
+	first := cache.generalize(gen, features[:1])[0]
+	if cache.generalize(gen, features[:1])[0] != first {
+		t.Error("Cached generalization was recomputed")
+	}
+	cache.generalize(gen, features[1:])
+	if cache.order.Len() != 2 {
+		t.Errorf("Cache holds %d entries, expected 2", cache.order.Len())
+	}
+	if cache.generalize(gen, features[:1])[0] == first {
+		t.Error("Least recently used entry was not evicted")
+	}
+}
@@ -0,0 +1,341 @@
+package practice2
+
+import (
+	"math"
+	"strings"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// IndexKind — тип вторичного индекса по свойству объекта
+type IndexKind int
+
+const (
+	// IndexHash отвечает на условия = и in
+	IndexHash IndexKind = iota
+	// IndexOrdered дополнительно отвечает на диапазоны <, <=, >, >= и префикс ^=
+	IndexOrdered
+)
+
+// WithIndex объявляет вторичный индекс по свойству key.
+// Индекс поддерживается при каждой записи и перестраивается при загрузке чекпоинта.
+func WithIndex(key string, kind IndexKind) Option {
+	return func(e *Engine) {
+		if e.indexes == nil {
+			e.indexes = make(map[string]propertyIndex)
+		}
+		switch kind {
+		case IndexOrdered:
+			e.indexes[key] = &orderedIndex{}
+		default:
+			e.indexes[key] = &hashIndex{}
+		}
+	}
+}
+
+type propertyIndex interface {
+	add(value interface{}, feature *geojson.Feature)
+	remove(value interface{}, feature *geojson.Feature)
+	// lookup возвращает объекты, которые могут удовлетворять условию; ok == false, если индекс условие не поддерживает
+	lookup(cond Condition) (features []*geojson.Feature, ok bool)
+	reset()
+}
+
+// Функция для приведения значения свойства к ключу индекса: числа — float64, как после разбора JSON.
+// Значения других типов (null, объекты, массивы) не индексируются.
+func indexKey(value interface{}) (interface{}, bool) {
+	if n, ok := toFloat(value); ok {
+		return n, true
+	}
+	switch v := value.(type) {
+	case string, bool:
+		return v, true
+	}
+	return nil, false
+}
+
+// Функция для получения ключей индекса, равных значению фильтра по правилам equalValue
+func equalKeys(value FilterValue) []interface{} {
+	if value.Quoted {
+		return []interface{}{value.Raw}
+	}
+	keys := []interface{}{value.Raw}
+	if value.Number != nil {
+		keys = append(keys, *value.Number)
+	}
+	if value.Bool != nil {
+		keys = append(keys, *value.Bool)
+	}
+	return keys
+}
+
+// Функция для проверки, что условие может совпасть с неиндексируемым значением
+func matchesUnindexed(cond Condition) bool {
+	if cond.Op != "=" && cond.Op != "in" {
+		return false
+	}
+	for _, value := range cond.Values {
+		if value.Raw == "null" && !value.Quoted {
+			return true
+		}
+	}
+	return false
+}
+
+type hashIndex struct {
+	entries map[interface{}]map[*geojson.Feature]struct{}
+}
+
+func (idx *hashIndex) add(value interface{}, feature *geojson.Feature) {
+	key, ok := indexKey(value)
+	if !ok {
+		return
+	}
+	if idx.entries == nil {
+		idx.entries = make(map[interface{}]map[*geojson.Feature]struct{})
+	}
+	if idx.entries[key] == nil {
+		idx.entries[key] = make(map[*geojson.Feature]struct{})
+	}
+	idx.entries[key][feature] = struct{}{}
+}
+
+func (idx *hashIndex) remove(value interface{}, feature *geojson.Feature) {
+	key, ok := indexKey(value)
+	if !ok {
+		return
+	}
+	delete(idx.entries[key], feature)
+	if len(idx.entries[key]) == 0 {
+		delete(idx.entries, key)
+	}
+}
+
+func (idx *hashIndex) lookup(cond Condition) ([]*geojson.Feature, bool) {
+	if (cond.Op != "=" && cond.Op != "in") || matchesUnindexed(cond) {
+		return nil, false
+	}
+	var features []*geojson.Feature
+	seen := make(map[interface{}]bool)
+	for _, value := range cond.Values {
+		for _, key := range equalKeys(value) {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			for feature := range idx.entries[key] {
+				features = append(features, feature)
+			}
+		}
+	}
+	return features, true
+}
+
+func (idx *hashIndex) reset() {
+	idx.entries = nil
+}
+
+// Запись упорядоченного индекса: все числа идут раньше всех строк, одинаковые значения упорядочены по ID
+type orderedEntry struct {
+	number  float64
+	str     string
+	numeric bool
+	id      string
+	feature *geojson.Feature
+}
+
+func (a *orderedEntry) less(b *orderedEntry) bool {
+	if a.numeric != b.numeric {
+		return a.numeric
+	}
+	if a.numeric && a.number != b.number {
+		return a.number < b.number
+	}
+	if !a.numeric && a.str != b.str {
+		return a.str < b.str
+	}
+	return a.id < b.id
+}
+
+// orderedIndex — B-дерево записей: вставка, удаление и поиск начала диапазона за O(log n)
+type orderedIndex struct {
+	tree btree
+}
+
+func newOrderedEntry(value interface{}, feature *geojson.Feature) (orderedEntry, bool) {
+	id, _ := feature.ID.(string)
+	if n, ok := toFloat(value); ok {
+		return orderedEntry{number: n, numeric: true, id: id, feature: feature}, true
+	}
+	if s, ok := value.(string); ok {
+		return orderedEntry{str: s, id: id, feature: feature}, true
+	}
+	return orderedEntry{}, false
+}
+
+func (idx *orderedIndex) add(value interface{}, feature *geojson.Feature) {
+	if entry, ok := newOrderedEntry(value, feature); ok {
+		idx.tree.insert(entry)
+	}
+}
+
+func (idx *orderedIndex) remove(value interface{}, feature *geojson.Feature) {
+	if entry, ok := newOrderedEntry(value, feature); ok {
+		idx.tree.remove(entry)
+	}
+}
+
+// Функция для обхода записей с числовыми значениями в диапазоне от lo до hi
+func (idx *orderedIndex) numberRange(lo, hi float64, loIncl, hiIncl bool, visit func(e *orderedEntry)) {
+	idx.tree.ascend(func(e *orderedEntry) bool {
+		return !e.numeric || e.number > lo || (loIncl && e.number == lo)
+	}, func(e *orderedEntry) bool {
+		if !e.numeric || e.number > hi || (!hiIncl && e.number == hi) {
+			return false
+		}
+		visit(e)
+		return true
+	})
+}
+
+// Функция для обхода записей со строковыми значениями в диапазоне; hiOpen — без верхней границы.
+// Обход также прекращается, когда visit возвращает false.
+func (idx *orderedIndex) stringRange(lo, hi string, loIncl, hiIncl, hiOpen bool, visit func(e *orderedEntry) bool) {
+	idx.tree.ascend(func(e *orderedEntry) bool {
+		return !e.numeric && (e.str > lo || (loIncl && e.str == lo))
+	}, func(e *orderedEntry) bool {
+		if !hiOpen && (e.str > hi || (!hiIncl && e.str == hi)) {
+			return false
+		}
+		return visit(e)
+	})
+}
+
+func (idx *orderedIndex) lookup(cond Condition) ([]*geojson.Feature, bool) {
+	var features []*geojson.Feature
+	seen := make(map[*geojson.Feature]bool)
+	visit := func(e *orderedEntry) {
+		if !seen[e.feature] {
+			seen[e.feature] = true
+			features = append(features, e.feature)
+		}
+	}
+	visitAll := func(e *orderedEntry) bool {
+		visit(e)
+		return true
+	}
+	inf := math.Inf(1)
+	switch cond.Op {
+	case "=", "in":
+		if matchesUnindexed(cond) {
+			return nil, false
+		}
+		for _, value := range cond.Values {
+			// Логические значения в упорядоченный индекс не попадают
+			if value.Bool != nil {
+				return nil, false
+			}
+		}
+		for _, value := range cond.Values {
+			idx.stringRange(value.Raw, value.Raw, true, true, false, visitAll)
+			if value.Number != nil && !value.Quoted {
+				idx.numberRange(*value.Number, *value.Number, true, true, visit)
+			}
+		}
+	case "<", "<=", ">", ">=":
+		value := cond.Values[0]
+		incl := cond.Op == "<=" || cond.Op == ">="
+		if cond.Op[0] == '<' {
+			idx.stringRange("", value.Raw, true, incl, false, visitAll)
+			if value.Number != nil && !value.Quoted {
+				idx.numberRange(-inf, *value.Number, true, incl, visit)
+			}
+		} else {
+			idx.stringRange(value.Raw, "", incl, false, true, visitAll)
+			if value.Number != nil && !value.Quoted {
+				idx.numberRange(*value.Number, inf, incl, true, visit)
+			}
+		}
+	case "^=":
+		prefix := cond.Values[0].Raw
+		idx.stringRange(prefix, "", true, false, true, func(e *orderedEntry) bool {
+			if !strings.HasPrefix(e.str, prefix) {
+				return false
+			}
+			visit(e)
+			return true
+		})
+	default:
+		return nil, false
+	}
+	return features, true
+}
+
+func (idx *orderedIndex) reset() {
+	idx.tree = btree{}
+}
+
+// Функции для поддержки вторичных индексов при изменении объекта
+func (e *Engine) indexFeature(feature *geojson.Feature) {
+	for key, idx := range e.indexes {
+		if value, ok := feature.Properties[key]; ok {
+			idx.add(value, feature)
+		}
+	}
+}
+
+func (e *Engine) unindexFeature(feature *geojson.Feature) {
+	for key, idx := range e.indexes {
+		if value, ok := feature.Properties[key]; ok {
+			idx.remove(value, feature)
+		}
+	}
+}
+
+func (e *Engine) resetIndexes() {
+	for _, idx := range e.indexes {
+		idx.reset()
+	}
+}
+
+// planSearch выбирает способ выполнения select. Если условие фильтра покрыто индексом и отбирает меньше
+// объектов, чем ожидается в прямоугольниках запроса, возвращает кандидатов из самого селективного индекса.
+// Ожидаемое количество объектов в прямоугольнике оценивается по доле площади данных, которую он покрывает.
+func (e *Engine) planSearch(cmd Command) (candidates []*geojson.Feature, ok bool) {
+	for _, cond := range cmd.filter {
+		idx, exists := e.indexes[cond.Key]
+		if !exists {
+			continue
+		}
+		features, supported := idx.lookup(cond)
+		if supported && (!ok || len(features) < len(candidates)) {
+			candidates, ok = features, true
+		}
+	}
+	if !ok {
+		return nil, false
+	}
+	expected := 0.0
+	for _, box := range cmd.boxes {
+		expected += e.estimateBoxCount(box.Min, box.Max)
+	}
+	return candidates, float64(len(candidates)) < expected
+}
+
+// Функция для оценки количества объектов в прямоугольнике при равномерном распределении данных
+func (e *Engine) estimateBoxCount(min, max [2]float64) float64 {
+	total := float64(len(e.data))
+	dataMin, dataMax := e.spatialIdx.Bounds()
+	overlap := 1.0
+	for axis := 0; axis < 2; axis++ {
+		extent := dataMax[axis] - dataMin[axis]
+		covered := math.Min(max[axis], dataMax[axis]) - math.Max(min[axis], dataMin[axis])
+		if covered < 0 {
+			return 0
+		}
+		if extent > 0 {
+			overlap *= math.Min(covered/extent, 1)
+		}
+	}
+	return total * overlap
+}
@@ -0,0 +1,154 @@
+package practice2
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+func TestIndexLookup(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	values := []interface{}{1.0, 2, 2.5, 10.0, "1", "10", "a", "ab", "abc", "b", true, false, nil}
+	indexes := map[string]propertyIndex{"hash": &hashIndex{}, "ordered": &orderedIndex{}}
+	var features []*geojson.Feature
+	for i := 0; i < 300; i++ {
+		feature := newTestFeature(fmt.Sprint(i), 0, 0)
+		feature.Properties["v"] = values[rng.Intn(len(values))]
+		features = append(features, feature)
+		for _, idx := range indexes {
+			idx.add(feature.Properties["v"], feature)
+		}
+	}
+	// Удаление части объектов проверяет поддержку индексов при изменениях
+	for _, feature := range features[:100] {
+		for _, idx := range indexes {
+			idx.remove(feature.Properties["v"], feature)
+		}
+	}
+	features = features[100:]
+
+	exprs := []string{"v=1", "v=10", `v="10"`, "v=a", "v in (1,b)", "v=true", "v=null",
+		"v<2", "v<=2", "v>2.5", "v>=a", "v<b", `v>"1"`, "v^=a", "v^=ab", "v!=1", "exists(v)"}
+	for _, expr := range exprs {
+		filter, err := parseFilter(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var expected []string
+		for _, feature := range features {
+			if filter.Match(feature.Properties) {
+				expected = append(expected, feature.ID.(string))
+			}
+		}
+		sort.Strings(expected)
+
+		for name, idx := range indexes {
+			candidates, ok := idx.lookup(filter[0])
+			if !ok {
+				continue
+			}
+			var got []string
+			for _, feature := range candidates {
+				if filter.Match(feature.Properties) {
+					got = append(got, feature.ID.(string))
+				}
+			}
+			sort.Strings(got)
+			if fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Errorf("%s index lookup for %q found %d matching features, expected %d", name, expr, len(got), len(expected))
+			}
+		}
+	}
+}
+
+func TestIndexMaintenance(t *testing.T) {
+	dir := t.TempDir()
+	opts := []Option{WithIndex("category", IndexHash), WithIndex("rating", IndexOrdered)}
+	s, err := NewStorage(http.NewServeMux(), dir, "storage1", nil, true, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	for i := 0; i < 20; i++ {
+		feature := newTestFeature(fmt.Sprint(i), float64(i), float64(i))
+		feature.Properties["category"] = "cafe"
+		feature.Properties["rating"] = float64(i % 5)
+		execCommand(t, s, "insert", feature)
+	}
+	replaced := newTestFeature("0", 0, 0)
+	replaced.Properties["category"] = "restaurant"
+	execCommand(t, s, "replace", replaced)
+	execCommand(t, s, "delete", newTestFeature("1", 0, 0))
+	execCommand(t, s, "checkpoint", nil)
+	execCommand(t, s, "delete", newTestFeature("2", 0, 0))
+	s.Stop()
+
+	// После перезапуска индексы перестраиваются из чекпоинта и журнала; Engine ещё не запущен
+	mux := http.NewServeMux()
+	s, err = NewStorage(mux, dir, "storage1", nil, true, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	e := s.engine
+
+	check := func(expr string, expected int) {
+		t.Helper()
+		filter, err := parseFilter(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		candidates, ok := e.indexes[filter[0].Key].lookup(filter[0])
+		if !ok || len(candidates) != expected {
+			t.Errorf("Index lookup for %q returned %d candidates, expected %d", expr, len(candidates), expected)
+		}
+	}
+	check("category=restaurant", 1)
+	check("category=cafe", 17)
+	check("rating>=4", 4)
+
+	// Фильтр по редкому значению выполняется по индексу, по частому — по rtree
+	filter, _ := parseFilter("category=restaurant")
+	if _, ok := e.planSearch(Command{boxes: []orb.Bound{{Min: orb.Point{-1, -1}, Max: orb.Point{20, 20}}}, filter: filter}); !ok {
+		t.Error("Planner did not use the index for a selective filter")
+	}
+	filter, _ = parseFilter("category=cafe")
+	if _, ok := e.planSearch(Command{boxes: []orb.Bound{{Min: orb.Point{0, 0}, Max: orb.Point{2, 2}}}, filter: filter}); ok {
+		t.Error("Planner used the index for a filter less selective than the bbox")
+	}
+
+	s.Run()
+	cmd := Command{
+		action:       "search",
+		boxes:        []orb.Bound{{Min: orb.Point{-1, -1}, Max: orb.Point{20, 20}}},
+		filter:       filter,
+		searchResult: make(chan SearchResult),
+	}
+	s.engine.commands <- cmd
+	if result := <-cmd.searchResult; len(result.Features) != 17 {
+		t.Errorf("Indexed select returned %d features, expected 17", len(result.Features))
+	}
+
+	// Потоковая выдача использует тот же планировщик
+	filter, _ = parseFilter("category=restaurant")
+	cmd.filter, cmd.page = filter, Page{Stream: true}
+	s.engine.commands <- cmd
+	if result := <-cmd.searchResult; result.Tree != nil || len(result.Features) != 1 {
+		t.Errorf("Stream select did not use the index: tree %v, %d candidates", result.Tree != nil, len(result.Features))
+	}
+	req := httptest.NewRequest(http.MethodGet, "/storage1/select?rect=-1,-1,20,20&format=ndjson&filter="+url.QueryEscape("category=restaurant"), nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	feature, err := geojson.UnmarshalFeature(bytes.TrimSpace(rr.Body.Bytes()))
+	if err != nil || feature.ID != "0" {
+		t.Errorf("Indexed stream select returned %q, expected feature 0", rr.Body.String())
+	}
+}
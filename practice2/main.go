@@ -1,46 +1,108 @@
 package practice2
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
-	"github.com/gorilla/websocket"
+	"flag"
+	"fmt"
 	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/geojson"
 	"github.com/tidwall/rtree"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 )
 
+// Checkpoint — консистентное состояние Engine, из которого записывается файл чекпоинта
 type Checkpoint struct {
-	Data   map[string]*geojson.Feature `json:"data"`
-	VClock map[string]uint64           `json:"vclock"`
+	Data   map[string]*geojson.Feature
+	VClock map[string]uint64
+	// Последний LSN Engine, вошедший в чекпоинт
+	LSN uint64
+	// Term последней транзакции чекпоинта
+	Term uint64
 }
 
 type Transaction struct {
-	Action  string           `json:"action"`
-	Name    string           `json:"name"`
-	LSN     uint64           `json:"lsn"`
+	Action string `json:"action"`
+	// Имя лидера, принявшего транзакцию
+	Name string `json:"name"`
+	// Сквозной номер транзакции в репликасете: новый лидер продолжает нумерацию с последнего
+	// применённого LSN, поэтому журнал любого узла упорядочен по LSN
+	LSN uint64 `json:"lsn"`
+	// Term лидера, принявшего транзакцию; 0 без выборов. Вместе с LSN определяет, чья история новее
+	Term    uint64           `json:"term,omitempty"`
 	Feature *geojson.Feature `json:"feature"`
 }
 
 type Command struct {
 	action       string
 	feature      *geojson.Feature
-	min          [2]float64
-	max          [2]float64
+	ids          []string
 	result       chan error
 	searchResult chan SearchResult
+	statusResult chan CheckpointStatus
+	// Прямоугольники поиска в rtree: два, если прямоугольник запроса пересекает линию перемены дат
+	boxes []orb.Bound
+	// Точная проверка геометрии после отбора по rtree; nil — только bounding box.
+	// Область разбирается один раз на команду и используется для всех кандидатов
+	predicate Predicate
+	area      *parts
+	// Фильтр по свойствам, проверяется после пространственного отбора; nil — без фильтра
+	filter Filter
+	// Постраничная или потоковая выдача select
+	page Page
+	// Кластеризация точечных объектов select; nil — без кластеризации
+	cluster *Clustering
+	// Параметры агрегации для команды aggregate
+	aggregation *Aggregation
+	// Параметры поиска ближайших объектов
+	point       orb.Point
+	k           int
+	maxDistance float64
+	metric      *Metric
+	// Репликация: транзакция или снапшот лидера, приветствие подключившейся реплики
+	txn               *Transaction
+	snapshot          io.Reader
+	hello             *ReplicationHello
+	replicaResult     chan replicaPlan
+	replicationResult chan ReplicationStatus
+	// Подтверждение реплики для команды replicaAck
+	replica *replicaSession
+	ackLSN  uint64
+	// Уровень подтверждения записи запроса; nil — уровень хранилища
+	writeConcern *WriteConcern
+	// Выборы лидера: term и адрес лидера из сообщения репликации, запрос голоса и итог выборов
+	term       uint64
+	leaderAddr string
+	vote       *VoteRequest
+	voteResult chan VoteResponse
+	tally      *electionTally
+	// Закоммиченные записи Raft для команды raftApply
+	committed []raftCommitted
 }
 
 type SearchResult struct {
 	Features []*geojson.Feature
-	Error    error
+	// Расстояния до объектов для команды nearest, в том же порядке, что и Features
+	Distances []float64
+	// Курсор следующей страницы select, пустой для последней страницы
+	Next string
+	// Копия rtree для потоковой выдачи select вне горутины Engine; nil, если планировщик выбрал
+	// вторичный индекс и кандидаты переданы в Features
+	Tree *rtree.RTree
+	// Кластеры точечных объектов select, уже в системе координат запроса
+	Clusters []*geojson.Feature
+	// Результат команды aggregate
+	Aggregate *Aggregate
+	Error     error
 }
 
 type Engine struct {
@@ -51,110 +113,198 @@ type Engine struct {
 	ctx        context.Context
 	cancel     context.CancelFunc
 	commands   chan Command
+	dir        *dataDir
+	wal        *wal
+	walOpts    WALOptions
+	// Вторичные индексы по свойствам объектов, ключ — имя свойства
+	indexes map[string]propertyIndex
+	// Кэш генерализованных геометрий select по уровням масштаба; nil — кэш выключен
+	generalized *generalizeCache
+	// Количество хранимых чекпоинтов, к которым можно откатиться
+	snapshotRetention int
+	// Состояние фонового чекпоинта
+	checkpointRunning bool
+	checkpointDone    chan error
+	// Ожидающие текущего чекпоинта и ожидающие следующего, запрошенные во время текущего
+	checkpointWaiters []chan error
+	checkpointQueue   []chan error
+	// Политика автоматических чекпоинтов и сведения о последнем чекпоинте
+	checkpointPolicy CheckpointPolicy
+	checkpointStats  checkpointStats
+	// Закрывается, когда горутина Engine сохранила чекпоинт и освободила рабочую директорию
+	done chan struct{}
 
-	vclock   map[string]uint64
+	vclock map[string]uint64
+	// Адреса остальных узлов репликасета в виде host:port/<name>
 	replicas []string
 	leader   bool
-	// Реестр подключенных реплик
-	replicaConns map[string]*websocket.Conn
+	// Подключённые к лидеру реплики; доступны только из горутины Engine
+	followers map[*replicaSession]struct{}
+	// Состояние подключений реплики к узлам репликасета и загрузки чекпоинта
+	progress *replicationProgress
+	// Уровень подтверждения записи по умолчанию и транзакции, ожидающие подтверждений реплик
+	writeConcern   WriteConcern
+	writeTimeout   time.Duration
+	concernWaiters []*concernWaiter
+	concernTimer   *time.Timer
+	// Срок ожидания, на который заведён concernTimer
+	concernDeadline time.Time
+	// Последний LSN, подтверждённый каждой репликой, по имени хранилища реплики. Переживает
+	// разрыв соединения: транзакция, записанная репликой, остаётся записанной
+	replicaAcks map[string]uint64
+	// Выборы лидера; при выключенных выборах роль узла задана флагом leader
+	election           ElectionOptions
+	term               uint64
+	votedFor           string
+	leaderTerm         uint64
+	leaderAddr         string
+	electionTimer      *time.Timer
+	startElectionFirst bool
+	// Репликация через Raft; nil — транзакции рассылает лидер
+	raftOpts RaftOptions
+	raft     *raftNode
+	// Ошибка записи журнала; после неё узел не принимает транзакции
+	walErr error
+	// Term последней применённой транзакции
+	lastTerm uint64
 }
 
 func (e *Engine) applyTransaction(txn *Transaction) {
 	// Проверяем, применяли ли мы уже эту транзакцию
 	lastLSN, exists := e.vclock[txn.Name]
 	if exists && txn.LSN <= lastLSN {
-		return // Уже применили эту или более новую транзакцию от этого узла
+		return // Уже применили эту или более новую транзакцию от этого лидера
 	}
-	// Обновляем vclock
+	// Обновляем vclock: прогресс репликации хранится как последний LSN каждого лидера
 	e.vclock[txn.Name] = txn.LSN
-	// Применяем транзакцию
+	e.lastTerm = txn.Term
+	// Применяем транзакцию; транзакция без объекта не меняет данных
+	if txn.Feature == nil {
+		return
+	}
+	idStr, ok := txn.Feature.ID.(string)
+	if !ok {
+		return
+	}
 	switch txn.Action {
 	case "insert", "replace":
-		idStr, ok := txn.Feature.ID.(string)
-		if !ok {
-			return
-		}
-		e.data[idStr] = txn.Feature
-		minX, minY, maxX, maxY := getBoundingBox(txn.Feature.Geometry)
-		e.spatialIdx.Insert([2]float64{minX, minY}, [2]float64{maxX, maxY}, txn.Feature)
+		e.storeFeature(idStr, txn.Feature)
 	case "delete":
-		idStr, ok := txn.Feature.ID.(string)
-		if !ok {
-			return
-		}
-		feature, exists := e.data[idStr]
-		if !exists {
-			return
-		}
-		minX, minY, maxX, maxY := getBoundingBox(feature.Geometry)
-		e.spatialIdx.Delete([2]float64{minX, minY}, [2]float64{maxX, maxY}, feature)
-		delete(e.data, idStr)
+		e.removeFeature(idStr)
 	}
 }
 
-func (e *Engine) connectToReplicas() {
-	for _, addr := range e.replicas {
-		go func(addr string) {
-			// Установить соединение с репликой по WebSocket
-			conn, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/replication", nil)
-			if err != nil {
-				log.Printf("Ошибка подключения к реплике %s: %v", addr, err)
-				return
-			}
-			e.replicaConns[addr] = conn
-
-			// Слушаем входящие сообщения от реплики
-			for {
-				var txn Transaction
-				err := conn.ReadJSON(&txn)
-				if err != nil {
-					log.Printf("Ошибка чтения транзакции от реплики %s: %v", addr, err)
-					conn.Close()
-					delete(e.replicaConns, addr)
-					return
-				}
-				e.applyTransaction(&txn)
-			}
-		}(addr)
+// storeFeature сохраняет объект в памяти, заменяя прежний объект с тем же ID в rtree и вторичных индексах
+func (e *Engine) storeFeature(id string, feature *geojson.Feature) {
+	e.removeFeature(id)
+	e.data[id] = feature
+	minX, minY, maxX, maxY := getBoundingBox(feature.Geometry)
+	e.spatialIdx.Insert([2]float64{minX, minY}, [2]float64{maxX, maxY}, feature)
+	e.indexFeature(feature)
+}
+
+// removeFeature удаляет объект из памяти, rtree и вторичных индексов
+func (e *Engine) removeFeature(id string) {
+	feature, exists := e.data[id]
+	if !exists {
+		return
 	}
+	minX, minY, maxX, maxY := getBoundingBox(feature.Geometry)
+	e.spatialIdx.Delete([2]float64{minX, minY}, [2]float64{maxX, maxY}, feature)
+	e.unindexFeature(feature)
+	delete(e.data, id)
+}
+
+// recover загружает чекпоинт и воспроизводит журнал транзакций.
+// Выполняется до запуска горутины Engine, чтобы повреждённый журнал не дал хранилищу стартовать
+// и не был затёрт чекпоинтом при остановке.
+func (e *Engine) recover() error {
+	if err := e.loadCheckpoint(); err != nil {
+		return fmt.Errorf("ошибка загрузки чекпоинта: %w", err)
+	}
+	if err := e.replayTransactions(); err != nil {
+		return fmt.Errorf("ошибка воспроизведения транзакций: %w", err)
+	}
+	// Продолжаем нумерацию транзакций с последнего применённого LSN
+	e.lsn = vclockLSN(e.vclock)
+	return nil
+}
+
+// Функция для получения последнего применённого LSN по векторным часам: LSN сквозные,
+// поэтому это наибольший LSN среди всех лидеров
+func vclockLSN(vclock map[string]uint64) uint64 {
+	var lsn uint64
+	for _, l := range vclock {
+		lsn = max(lsn, l)
+	}
+	return lsn
 }
 
 func (e *Engine) Run() {
+	if e.raft != nil {
+		go e.raft.run()
+	} else if !e.leader || e.electionEnabled() {
+		// Реплика подключается к остальным узлам репликасета и получает транзакции лидера.
+		// При выборах роль меняется, поэтому подключения поддерживаются всегда и простаивают, пока узел — лидер
+		for _, addr := range e.replicas {
+			go e.follow(addr)
+		}
+	}
 	go func() {
-		// Загрузка чекпоинта и воспроизведение транзакций
-		if err := e.loadCheckpoint(); err != nil {
-			log.Printf("Ошибка загрузки чекпоинта: %v", err)
+		if e.startElectionFirst {
+			e.startElection()
+		} else {
+			e.resetElectionTimer()
 		}
-		if err := e.replayTransactions(); err != nil {
-			log.Printf("Ошибка воспроизведения транзакций: %v", err)
+		var interval <-chan time.Time
+		if e.checkpointPolicy.Interval > 0 {
+			ticker := time.NewTicker(e.checkpointPolicy.Interval)
+			defer ticker.Stop()
+			interval = ticker.C
 		}
-		e.connectToReplicas()
 		for {
 			select {
 			case <-e.ctx.Done():
+				e.closeFollowers()
 				// Перед завершением сохраняем чекпоинт
-				if err := e.checkpoint(); err != nil {
+				if err := e.finalCheckpoint(); err != nil {
 					log.Printf("Ошибка при создании чекпоинта: %v", err)
 				}
+				if err := e.wal.close(); err != nil {
+					log.Printf("Ошибка закрытия журнала транзакций: %v", err)
+				}
+				e.failWriteConcern(errors.New("хранилище остановлено до подтверждения транзакции репликами"))
+				if e.raft != nil {
+					// Журнал Raft находится в рабочей директории
+					<-e.raft.done
+				}
+				if err := e.dir.Close(); err != nil {
+					log.Printf("Ошибка освобождения рабочей директории: %v", err)
+				}
+				close(e.done)
 				return
 			case cmd := <-e.commands:
 				e.handleCommand(cmd)
+				e.checkWriteConcern()
+				e.maybeCheckpoint(false)
+			case <-interval:
+				e.maybeCheckpoint(true)
+			case <-e.wal.groupCommit():
+				e.wal.syncPending()
+				e.checkWriteConcern()
+			case <-e.concernTimeout():
+				e.concernTimer = nil
+				e.checkWriteConcern()
+			case <-e.electionTimeout():
+				e.electionTimer = nil
+				e.startElection()
+			case err := <-e.checkpointDone:
+				e.handleCheckpointDone(err)
 			}
 		}
 	}()
 }
 
-func (e *Engine) broadcastTransaction(txn *Transaction) {
-	for addr, conn := range e.replicaConns {
-		err := conn.WriteJSON(txn)
-		if err != nil {
-			log.Printf("Ошибка отправки транзакции на реплику %s: %v", addr, err)
-			conn.Close()
-			delete(e.replicaConns, addr)
-		}
-	}
-}
-
 func (e *Engine) handleCommand(cmd Command) {
 	switch cmd.action {
 	case "insert":
@@ -165,265 +315,328 @@ func (e *Engine) handleCommand(cmd Command) {
 		e.handleDelete(cmd)
 	case "checkpoint":
 		e.handleCheckpoint(cmd)
+	case "checkpointStatus":
+		e.handleCheckpointStatus(cmd)
 	case "search":
 		e.handleSearch(cmd)
+	case "get":
+		e.handleGet(cmd)
+	case "nearest":
+		e.handleNearest(cmd)
+	case "within":
+		e.handleWithin(cmd)
+	case "aggregate":
+		e.handleAggregate(cmd)
+	case "attachReplica":
+		e.handleAttachReplica(cmd)
+	case "replicate":
+		e.handleReplicate(cmd)
+	case "installSnapshot":
+		e.handleInstallSnapshot(cmd)
+	case "replicationState":
+		e.handleReplicationState(cmd)
+	case "replicaAck":
+		e.handleReplicaAck(cmd)
+	case "heartbeat":
+		e.handleHeartbeat(cmd)
+	case "requestVote":
+		e.handleRequestVote(cmd)
+	case "electionResult":
+		e.handleElectionResult(cmd)
+	case "raftApply":
+		e.handleRaftApply(cmd)
+	case "raftSnapshot":
+		e.handleRaftSnapshot(cmd)
 	default:
 		cmd.result <- errors.New("неизвестная команда: " + cmd.action)
 	}
-	if e.leader && cmd.action != "search" && cmd.action != "checkpoint" {
-		txn := Transaction{
-			Action:  cmd.action,
-			Name:    e.name,
-			LSN:     e.lsn,
-			Feature: cmd.feature,
-		}
-		e.broadcastTransaction(&txn)
-	}
 }
 
 func (e *Engine) handleInsert(cmd Command) {
-	if !e.leader {
-		cmd.result <- errors.New("только лидер может создавать новые транзакции")
+	if e.raft != nil {
+		e.propose(cmd, "insert")
 		return
 	}
-	e.lsn++
-	e.lsn++
-	txn := Transaction{
-		Action:  "insert",
-		Name:    e.name,
-		LSN:     e.lsn,
-		Feature: cmd.feature,
-	}
-	// Логирование транзакции
-	if err := e.logTransaction(&txn); err != nil {
-		cmd.result <- err
+	if !e.leader {
+		cmd.result <- e.notLeader()
 		return
 	}
-	// Обновление данных в памяти
-	idStr, ok := cmd.feature.ID.(string)
+	_, ok := cmd.feature.ID.(string)
 	if !ok {
 		cmd.result <- errors.New("ID объекта должен быть строкой")
 		return
 	}
-	e.data[idStr] = cmd.feature
-	minX, minY, maxX, maxY := getBoundingBox(cmd.feature.Geometry)
-	e.spatialIdx.Insert([2]float64{minX, minY}, [2]float64{maxX, maxY}, cmd.feature)
-	cmd.result <- nil
+	e.writeTransaction(cmd, "insert")
 }
 
 func (e *Engine) handleReplace(cmd Command) {
-	if !e.leader {
-		cmd.result <- errors.New("только лидер может создавать новые транзакции")
+	if e.raft != nil {
+		e.propose(cmd, "replace")
 		return
 	}
-	e.lsn++
-	txn := Transaction{
-		Action:  "replace",
-		Name:    e.name,
-		LSN:     e.lsn,
-		Feature: cmd.feature,
-	}
-	// Логирование транзакции
-	if err := e.logTransaction(&txn); err != nil {
-		cmd.result <- err
+	if !e.leader {
+		cmd.result <- e.notLeader()
 		return
 	}
-	// Обновление данных в памяти
-	idStr, ok := cmd.feature.ID.(string)
+	_, ok := cmd.feature.ID.(string)
 	if !ok {
 		cmd.result <- errors.New("ID объекта должен быть строкой")
 		return
 	}
-	// Удаляем старый объект из индекса
-	oldFeature, exists := e.data[idStr]
-	if exists {
-		minX, minY, maxX, maxY := getBoundingBox(oldFeature.Geometry)
-		e.spatialIdx.Delete([2]float64{minX, minY}, [2]float64{maxX, maxY}, oldFeature)
-	}
-	e.data[idStr] = cmd.feature
-	// Добавляем новый объект в индекс
-	minX, minY, maxX, maxY := getBoundingBox(cmd.feature.Geometry)
-	e.spatialIdx.Insert([2]float64{minX, minY}, [2]float64{maxX, maxY}, cmd.feature)
-	cmd.result <- nil
+	e.writeTransaction(cmd, "replace")
 }
 
 func (e *Engine) handleDelete(cmd Command) {
-	if !e.leader {
-		cmd.result <- errors.New("только лидер может создавать новые транзакции")
+	if e.raft != nil {
+		e.propose(cmd, "delete")
 		return
 	}
-	e.lsn++
-	txn := Transaction{
-		Action:  "delete",
-		Name:    e.name,
-		LSN:     e.lsn,
-		Feature: cmd.feature,
-	}
-	// Логирование транзакции
-	if err := e.logTransaction(&txn); err != nil {
-		cmd.result <- err
+	if !e.leader {
+		cmd.result <- e.notLeader()
 		return
 	}
-	// Удаление данных из памяти и индекса
 	idStr, ok := cmd.feature.ID.(string)
 	if !ok {
 		cmd.result <- errors.New("ID объекта должен быть строкой")
 		return
 	}
-	feature, exists := e.data[idStr]
+	_, exists := e.data[idStr]
 	if !exists {
 		cmd.result <- errors.New("объект не найден")
 		return
 	}
-	minX, minY, maxX, maxY := getBoundingBox(feature.Geometry)
-	e.spatialIdx.Delete([2]float64{minX, minY}, [2]float64{maxX, maxY}, feature)
-	delete(e.data, idStr)
-	cmd.result <- nil
+	e.writeTransaction(cmd, "delete")
 }
 
-func (e *Engine) handleCheckpoint(cmd Command) {
-	if err := e.checkpoint(); err != nil {
+// writeTransaction пишет транзакцию лидера в журнал. Данные в памяти изменяются и транзакция
+// рассылается репликам только после того, как запись в журнале стала durable, поэтому при ошибке
+// fsync ни память, ни реплики не содержат транзакцию, о неудаче которой узнал клиент.
+func (e *Engine) writeTransaction(cmd Command, action string) {
+	if e.walErr != nil {
+		cmd.result <- e.walErr
+		return
+	}
+	if err := e.checkReplicas(cmd); err != nil {
 		cmd.result <- err
 		return
 	}
-	cmd.result <- nil
+	e.lsn++
+	txn := &Transaction{
+		Action:  action,
+		Name:    e.name,
+		LSN:     e.lsn,
+		Term:    e.term,
+		Feature: cmd.feature,
+	}
+	if err := e.logTransaction(txn); err != nil {
+		e.failWAL(err)
+		cmd.result <- err
+		return
+	}
+	e.wal.commit(func(err error) {
+		if err != nil {
+			e.failWAL(err)
+			cmd.result <- err
+			return
+		}
+		// Обновление данных в памяти и индексах
+		e.applyTransaction(txn)
+		e.broadcastTransaction(txn)
+		// Ответ клиенту сразу либо после подтверждений реплик
+		e.commit(cmd, txn.LSN)
+	})
+}
+
+// failWAL останавливает запись на узле после ошибки журнала. После неудачного fsync содержимое
+// журнала на диске не определено, поэтому узел больше не принимает транзакции и не рассылает их репликам.
+func (e *Engine) failWAL(err error) {
+	if e.walErr != nil {
+		return
+	}
+	e.walErr = fmt.Errorf("журнал транзакций недоступен, узел остановлен для записи: %w", err)
+	log.Printf("Хранилище %s: %v", e.name, e.walErr)
+	e.wal.abandon(e.walErr)
+	e.closeFollowers()
+	e.failWriteConcern(e.walErr)
 }
 
 func (e *Engine) handleSearch(cmd Command) {
+	if cmd.page.Stream {
+		// Обход и запись в ответ выполняет обработчик, чтобы медленный клиент не задерживал Engine.
+		// Кандидатов выбирает тот же планировщик, что и для обычной выдачи
+		if candidates, ok := e.planSearch(cmd); ok {
+			cmd.searchResult <- SearchResult{Features: candidates}
+			return
+		}
+		cmd.searchResult <- SearchResult{Tree: e.spatialIdx.Copy()}
+		return
+	}
 	var features []*geojson.Feature
-	e.spatialIdx.Search(cmd.min, cmd.max, func(min, max [2]float64, data interface{}) bool {
-		feature, ok := data.(*geojson.Feature)
-		if ok {
+	pc := &pageCollector{page: cmd.page}
+	var cl *clusterer
+	if cmd.cluster != nil {
+		cl = newClusterer(cmd.cluster)
+	}
+	e.scan(cmd, func(feature *geojson.Feature) {
+		if _, isPoint := feature.Geometry.(orb.Point); isPoint && cl != nil {
+			// Точки собираются в кластеры, не попадая в список объектов
+			cl.addFeature(feature)
+		} else if cmd.page.Limit > 0 {
+			pc.add(feature)
+		} else {
 			features = append(features, feature)
 		}
-		return true // Продолжить поиск
 	})
+	var next string
+	if cmd.page.Limit > 0 {
+		features, next = pc.result()
+	}
+	var clusters []*geojson.Feature
+	if cl != nil {
+		clusters = cl.features(true)
+	}
 	// Отправляем результаты обратно через канал
-	cmd.searchResult <- SearchResult{Features: features, Error: nil}
-}
-
-var upgrader = websocket.Upgrader{}
-
-func (s *Storage) setupReplicationHandler() {
-	s.mux.HandleFunc("/"+s.name+"/replication", func(w http.ResponseWriter, r *http.Request) {
-		conn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			log.Printf("Ошибка апгрейда соединения: %v", err)
-			return
-		}
-		addr := conn.RemoteAddr().String()
-		s.engine.replicaConns[addr] = conn
-
-		// Слушаем входящие сообщения от реплики
-		go func() {
-			defer func() {
-				conn.Close()
-				delete(s.engine.replicaConns, addr)
-			}()
-			for {
-				var txn Transaction
-				err := conn.ReadJSON(&txn)
-				if err != nil {
-					log.Printf("Ошибка чтения транзакции от реплики %s: %v", addr, err)
-					return
-				}
-				s.engine.applyTransaction(&txn)
-			}
-		}()
-	})
+	cmd.searchResult <- SearchResult{Features: features, Next: next, Clusters: clusters, Error: nil}
 }
 
-func (e *Engine) logTransaction(txn *Transaction) error {
-	file, err := os.OpenFile("transactions.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
+// scan передаёт в match объекты из прямоугольников команды, удовлетворяющие фильтру и предикату.
+// Кандидаты отбираются вторичным индексом, если планировщик считает его выгоднее rtree.
+func (e *Engine) scan(cmd Command, match func(feature *geojson.Feature)) {
+	check := func(feature *geojson.Feature) bool {
+		if !cmd.filter.Match(feature.Properties) {
+			return true
+		}
+		if cmd.predicate != nil && !cmd.predicate(feature.Geometry, cmd.area) {
+			return true
+		}
+		match(feature)
+		return true
 	}
-	defer file.Close()
-
-	data, err := json.Marshal(txn)
-	if err != nil {
-		return err
+	if candidates, ok := e.planSearch(cmd); ok {
+		searchCandidates(candidates, cmd.boxes, check)
+		return
 	}
-
-	_, err = file.Write(append(data, '\n'))
-	return err
+	searchBoxes(e.spatialIdx, cmd.boxes, check)
 }
 
-func (e *Engine) checkpoint() error {
-	file, err := os.Create("checkpoint.json")
-	if err != nil {
-		return err
+// searchBoxes передаёт в visit объекты rtree, bounding box которых пересекает прямоугольники boxes.
+// Объект, задевающий оба прямоугольника по разные стороны линии перемены дат, передаётся один раз.
+// Обход прекращается, если visit возвращает false.
+func searchBoxes(tree *rtree.RTree, boxes []orb.Bound, visit func(feature *geojson.Feature) bool) {
+	var seen map[*geojson.Feature]bool
+	if len(boxes) > 1 {
+		seen = make(map[*geojson.Feature]bool)
 	}
-	defer file.Close()
-
-	checkpoint := Checkpoint{
-		Data:   e.data,
-		VClock: e.vclock,
-	}
-
-	encoder := json.NewEncoder(file)
-	err = encoder.Encode(&checkpoint)
-	if err != nil {
-		return err
+	for _, box := range boxes {
+		stopped := false
+		tree.Search(box.Min, box.Max, func(min, max [2]float64, data interface{}) bool {
+			feature, ok := data.(*geojson.Feature)
+			if !ok || seen[feature] {
+				return true
+			}
+			if seen != nil {
+				seen[feature] = true
+			}
+			stopped = !visit(feature)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
 	}
+}
 
-	// Очистка журнала транзакций
-	err = os.Remove("transactions.log")
-	if err != nil && !os.IsNotExist(err) {
-		return err
+// searchCandidates передаёт в visit кандидатов из вторичного индекса, пересекающих прямоугольники boxes
+func searchCandidates(candidates []*geojson.Feature, boxes []orb.Bound, visit func(feature *geojson.Feature) bool) {
+	for _, feature := range candidates {
+		bound := feature.Geometry.Bound()
+		for _, box := range boxes {
+			if box.Intersects(bound) {
+				if !visit(feature) {
+					return
+				}
+				break
+			}
+		}
 	}
+}
 
-	return nil
+// handleAggregate вычисляет агрегаты по объектам области, не передавая сами объекты
+func (e *Engine) handleAggregate(cmd Command) {
+	agg := newAggregator(cmd.aggregation)
+	e.scan(cmd, agg.add)
+	cmd.searchResult <- SearchResult{Aggregate: agg.result(), Error: nil}
 }
 
-func (e *Engine) loadCheckpoint() error {
-	file, err := os.Open("checkpoint.json")
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil // Чекпоинт не существует
+// handleGet ищет объекты по первичному индексу, отсутствующие ID пропускаются
+func (e *Engine) handleGet(cmd Command) {
+	features := make([]*geojson.Feature, 0, len(cmd.ids))
+	for _, id := range cmd.ids {
+		if feature, ok := e.data[id]; ok {
+			features = append(features, feature)
 		}
-		return err
 	}
-	defer file.Close()
-
-	var checkpoint Checkpoint
+	cmd.searchResult <- SearchResult{Features: features, Error: nil}
+}
 
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&checkpoint)
-	if err != nil {
-		return err
+// handleNearest обходит rtree в порядке возрастания расстояния. Узлы дерева упорядочиваются
+// по нижней оценке расстояния до их прямоугольников, объекты — по точному расстоянию до геометрии,
+// поэтому первые k найденных объектов и есть k ближайших.
+func (e *Engine) handleNearest(cmd Command) {
+	var features []*geojson.Feature
+	var distances []float64
+	dist := func(min, max [2]float64, data interface{}, item bool) float64 {
+		if feature, ok := data.(*geojson.Feature); item && ok {
+			return cmd.metric.Distance(feature.Geometry, cmd.point)
+		}
+		return cmd.metric.boxDistance(cmd.point, min, max)
 	}
+	e.spatialIdx.Nearby(dist, func(min, max [2]float64, data interface{}, dist float64) bool {
+		if cmd.maxDistance > 0 && dist > cmd.maxDistance {
+			return false
+		}
+		if feature, ok := data.(*geojson.Feature); ok {
+			features = append(features, feature)
+			distances = append(distances, dist)
+		}
+		return len(features) < cmd.k
+	})
+	cmd.searchResult <- SearchResult{Features: features, Distances: distances, Error: nil}
+}
 
-	e.data = checkpoint.Data
-	e.vclock = checkpoint.VClock
-	for _, feature := range e.data {
-		minX, minY, maxX, maxY := getBoundingBox(feature.Geometry)
-		e.spatialIdx.Insert([2]float64{minX, minY}, [2]float64{maxX, maxY}, feature)
+// handleWithin ищет объекты не дальше cmd.maxDistance метров от cmd.point. Узлы и объекты rtree
+// обходятся в порядке нижней оценки расстояния по большому кругу, как в handleNearest: оценка учитывает
+// дуги, выгибающиеся к полюсу за прямоугольник вершин, и антимеридиан. Обход заканчивается на первом
+// прямоугольнике дальше радиуса, поэтому объекты возвращаются в порядке возрастания расстояния.
+func (e *Engine) handleWithin(cmd Command) {
+	var features []*geojson.Feature
+	var distances []float64
+	dist := func(min, max [2]float64, data interface{}, item bool) float64 {
+		if feature, ok := data.(*geojson.Feature); item && ok {
+			return HaversineMetric.Distance(feature.Geometry, cmd.point)
+		}
+		return HaversineMetric.boxDistance(cmd.point, min, max)
 	}
+	e.spatialIdx.Nearby(dist, func(min, max [2]float64, data interface{}, dist float64) bool {
+		if dist > cmd.maxDistance {
+			return false
+		}
+		if feature, ok := data.(*geojson.Feature); ok {
+			features = append(features, feature)
+			distances = append(distances, dist)
+		}
+		return true
+	})
+	cmd.searchResult <- SearchResult{Features: features, Distances: distances, Error: nil}
+}
 
-	return nil
+// logTransaction дописывает транзакцию в журнал; durable она становится после wal.commit
+func (e *Engine) logTransaction(txn *Transaction) error {
+	return e.wal.append(txn)
 }
 
 func (e *Engine) replayTransactions() error {
-	file, err := os.Open("transactions.log")
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil // Журнал транзакций пуст
-		}
-		return err
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		var txn Transaction
-		err := json.Unmarshal(scanner.Bytes(), &txn)
-		if err != nil {
-			return err
-		}
-		e.applyTransaction(&txn)
-	}
-	return scanner.Err()
+	return e.wal.replay(e.applyTransaction)
 }
 
 // Функция для получения bounding box из геометрии
@@ -439,21 +652,44 @@ func getBoundingBox(geometry orb.Geometry) (minX, minY, maxX, maxY float64) {
 type Router struct {
 	mux   *http.ServeMux
 	nodes [][]string
-	stop  chan struct{}
+	// Области данных шардов в порядке nodes; пусто — каждый шард может хранить любые объекты
+	bounds []orb.Bound
+	stop   chan struct{}
 }
 
-func NewRouter(mux *http.ServeMux, nodes [][]string) *Router {
+func NewRouter(mux *http.ServeMux, nodes [][]string, opts ...RouterOption) *Router {
 	r := &Router{mux: mux, nodes: nodes, stop: make(chan struct{})}
+	for _, opt := range opts {
+		opt(r)
+	}
 
 	mux.Handle("/", http.FileServer(http.Dir("../front/dist")))
-	mux.Handle("/select", http.RedirectHandler("/storage/select", http.StatusTemporaryRedirect))
-	mux.Handle("/insert", http.RedirectHandler("/storage/insert", http.StatusTemporaryRedirect))
-	mux.Handle("/replace", http.RedirectHandler("/storage/replace", http.StatusTemporaryRedirect))
-	mux.Handle("/delete", http.RedirectHandler("/storage/delete", http.StatusTemporaryRedirect))
+	// select рассылается по шардам, области которых пересекают запрос, результаты объединяются
+	mux.HandleFunc("/select", r.handleSelect)
+	// aggregate: шарды считают частичные агрегаты (map), Router складывает их (reduce)
+	mux.HandleFunc("/aggregate", r.handleAggregate)
+	mux.HandleFunc("GET /nearest", r.handleNearest)
+	mux.HandleFunc("GET /tiles/{z}/{x}/{y}", r.handleTile)
+	// Объект по ID ищется во всех шардах: шард объекта по ID не определить
+	mux.HandleFunc("GET /feature/{id}", r.handleFeature)
+	mux.HandleFunc("/features", r.handleFeatures)
+	// Запросы записи сохраняют параметр writeConcern
+	mux.HandleFunc("/insert", redirectToStorage)
+	mux.HandleFunc("/replace", redirectToStorage)
+	mux.HandleFunc("/delete", redirectToStorage)
 	mux.Handle("/checkpoint", http.RedirectHandler("/storage/checkpoint", http.StatusTemporaryRedirect))
 	return r
 }
 
+// Функция для редиректа запроса в хранилище с сохранением пути и параметров
+func redirectToStorage(w http.ResponseWriter, req *http.Request) {
+	target := "/storage" + req.URL.Path
+	if req.URL.RawQuery != "" {
+		target += "?" + req.URL.RawQuery
+	}
+	http.Redirect(w, req, target, http.StatusTemporaryRedirect)
+}
+
 func (r *Router) Run() {
 	r.stop = make(chan struct{})
 	go func() {
@@ -480,7 +716,35 @@ type Storage struct {
 	replicas     []string
 }
 
-func NewStorage(mux *http.ServeMux, name string, replicas []string, leader bool) *Storage {
+// Option задаёт необязательные параметры Engine при создании Storage
+type Option func(e *Engine)
+
+// WithCheckpointPolicy задаёт условия автоматического чекпоинта, по умолчанию DefaultCheckpointPolicy
+func WithCheckpointPolicy(policy CheckpointPolicy) Option {
+	return func(e *Engine) {
+		e.checkpointPolicy = policy
+	}
+}
+
+// WithSnapshotRetention задаёт количество хранимых чекпоинтов, по умолчанию DefaultSnapshotRetention
+func WithSnapshotRetention(n int) Option {
+	return func(e *Engine) {
+		e.snapshotRetention = n
+	}
+}
+
+// WithWAL задаёт параметры журнала транзакций, по умолчанию DefaultWALOptions
+func WithWAL(opts WALOptions) Option {
+	return func(e *Engine) {
+		e.walOpts = opts
+	}
+}
+
+func NewStorage(mux *http.ServeMux, wrkdir string, name string, replicas []string, leader bool, opts ...Option) (*Storage, error) {
+	dir, err := openDataDir(wrkdir)
+	if err != nil {
+		return nil, err
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	engine := &Engine{
 		data:         make(map[string]*geojson.Feature),
@@ -490,10 +754,44 @@ func NewStorage(mux *http.ServeMux, name string, replicas []string, leader bool)
 		ctx:          ctx,
 		cancel:       cancel,
 		commands:     make(chan Command),
+		dir:          dir,
+		done:         make(chan struct{}),
 		vclock:       make(map[string]uint64),
 		replicas:     replicas,
 		leader:       leader,
-		replicaConns: make(map[string]*websocket.Conn),
+		followers:    make(map[*replicaSession]struct{}),
+		replicaAcks:  make(map[string]uint64),
+		progress:     newReplicationProgress(),
+		writeTimeout: DefaultWriteConcernTimeout,
+		walOpts:      DefaultWALOptions,
+
+		snapshotRetention: DefaultSnapshotRetention,
+		checkpointDone:    make(chan error),
+		checkpointPolicy:  DefaultCheckpointPolicy,
+	}
+	for _, opt := range opts {
+		opt(engine)
+	}
+	engine.wal, err = openWAL(dir.walDir(), engine.walOpts)
+	if err == nil {
+		err = engine.recover()
+	}
+	if err == nil {
+		err = engine.recoverElection()
+	}
+	if err == nil && engine.raftOpts.ID != "" {
+		if engine.electionEnabled() {
+			err = errors.New("Raft и выборы лидера нельзя включить одновременно")
+		} else {
+			// Транзакции узлам доставляет Raft, репликация по websocket не используется
+			engine.leader = false
+			engine.raft, err = newRaftNode(engine)
+		}
+	}
+	if err != nil {
+		dir.Close()
+		cancel()
+		return nil, err
 	}
 
 	s := &Storage{
@@ -525,7 +823,7 @@ func NewStorage(mux *http.ServeMux, name string, replicas []string, leader bool)
 					}
 					// Добавляем заголовок
 					r.Header.Set("X-Redirected", "true")
-					http.Redirect(w, r, "http://"+replicaAddr+"/"+name+"/select"+r.URL.RawQuery, http.StatusTemporaryRedirect)
+					http.Redirect(w, r, "http://"+replicaAddr+"/select?"+r.URL.RawQuery, http.StatusTemporaryRedirect)
 					redirected = true
 					break
 				}
@@ -534,31 +832,57 @@ func NewStorage(mux *http.ServeMux, name string, replicas []string, leader bool)
 				return
 			}
 		}
-		minX, err := strconv.ParseFloat(r.URL.Query().Get("minX"), 64)
+		query := r.URL.Query()
+		proj, err := parseProjection(query.Get("proj"))
 		if err != nil {
-			http.Error(w, "Invalid minX parameter", http.StatusBadRequest)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		minY, err := strconv.ParseFloat(r.URL.Query().Get("minY"), 64)
+		predicate, err := parsePredicate(query.Get("predicate"))
 		if err != nil {
-			http.Error(w, "Invalid minY parameter", http.StatusBadRequest)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter, err := parseFilter(query.Get("filter"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		page, err := parsePage(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		gen, err := parseGeneralization(query, proj)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		maxX, err := strconv.ParseFloat(r.URL.Query().Get("maxX"), 64)
+		clustering, err := parseClustering(query, gen, proj)
 		if err != nil {
-			http.Error(w, "Invalid maxX parameter", http.StatusBadRequest)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		maxY, err := strconv.ParseFloat(r.URL.Query().Get("maxY"), 64)
+		area, bound, err := parseRequestArea(r, proj)
 		if err != nil {
-			http.Error(w, "Invalid maxY parameter", http.StatusBadRequest)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
+		// rtree отбирает кандидатов по bounding box области, точную проверку выполняет предикат
 		cmd := Command{
 			action:       "search",
-			min:          [2]float64{minX, minY},
-			max:          [2]float64{maxX, maxY},
+			boxes:        splitAntimeridian(bound),
+			predicate:    predicate,
+			area:         decompose(area),
+			filter:       filter,
+			page:         page,
+			cluster:      clustering,
 			searchResult: make(chan SearchResult),
 		}
 		s.engine.commands <- cmd
@@ -567,8 +891,44 @@ func NewStorage(mux *http.ServeMux, name string, replicas []string, leader bool)
 			http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 			return
 		}
+		if page.Stream {
+			streamFeatures(w, result, cmd, proj, page.Limit, func(feature *geojson.Feature) *geojson.Feature {
+				return s.engine.generalized.apply(gen, feature)
+			})
+			s.requestCount--
+			return
+		}
 		fc := geojson.NewFeatureCollection()
-		fc.Features = result.Features
+		clusters := result.Clusters
+		// Генерализуем геометрии под масштаб карты и возвращаем их в системе координат клиента.
+		// Мелкие объекты могут быть отброшены (small=drop): тогда страница дополняется объектами
+		// следующих страниц, поэтому в ней limit объектов, пока курсор указывает, что объекты ещё есть.
+		// Кластеризация с limit не используется, кластеры приходят только в непостраничной выдаче.
+		features := s.engine.generalized.generalize(gen, result.Features)
+		for page.Limit > 0 && len(features) < page.Limit && result.Next != "" {
+			after, err := decodeCursor(result.Next)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			cmd.page = Page{Limit: page.Limit - len(features), After: after}
+			s.engine.commands <- cmd
+			if result = <-cmd.searchResult; result.Error != nil {
+				http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+				return
+			}
+			features = append(features, s.engine.generalized.generalize(gen, result.Features)...)
+		}
+		fc.Features = proj.featuresFromNative(features)
+		fc.Features = append(fc.Features, clusters...)
+		if page.Limit > 0 {
+			// Курсор следующей страницы; null — это последняя страница
+			var next interface{}
+			if result.Next != "" {
+				next = result.Next
+			}
+			fc.ExtraMembers = geojson.Properties{"next": next}
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(fc); err != nil {
@@ -577,20 +937,284 @@ func NewStorage(mux *http.ServeMux, name string, replicas []string, leader bool)
 		s.requestCount--
 	})
 
+	// Агрегаты по области без выдачи объектов: количество, охват, количество по значениям свойства
+	// groupBy и гистограмма плотности grid. Область и фильтры задаются так же, как у select.
+	mux.HandleFunc("/"+name+"/aggregate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		proj, err := parseProjection(query.Get("proj"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		predicate, err := parsePredicate(query.Get("predicate"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter, err := parseFilter(query.Get("filter"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		aggregation, err := parseAggregation(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		area, bound, err := parseRequestArea(r, proj)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		aggregation.setGrid(proj, bound)
+		cmd := Command{
+			action:       "aggregate",
+			boxes:        splitAntimeridian(bound),
+			predicate:    predicate,
+			area:         decompose(area),
+			filter:       filter,
+			aggregation:  aggregation,
+			searchResult: make(chan SearchResult),
+		}
+		s.engine.commands <- cmd
+		result := <-cmd.searchResult
+		if result.Error != nil {
+			http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result.Aggregate); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	mux.HandleFunc("GET /"+name+"/feature/{id}", func(w http.ResponseWriter, r *http.Request) {
+		proj, err := parseProjection(r.URL.Query().Get("proj"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cmd := Command{
+			action:       "get",
+			ids:          []string{r.PathValue("id")},
+			searchResult: make(chan SearchResult),
+		}
+		s.engine.commands <- cmd
+		result := <-cmd.searchResult
+		if result.Error != nil {
+			http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(result.Features) == 0 {
+			http.Error(w, "объект не найден", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(proj.featuresFromNative(result.Features)[0]); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	// Векторные тайлы для карты: GET /tiles/{z}/{x}/{y}.mvt, необязательный параметр filter
+	mux.HandleFunc("GET /"+name+"/tiles/{z}/{x}/{y}", func(w http.ResponseWriter, r *http.Request) {
+		tile, err := parseTile(r.PathValue("z"), r.PathValue("x"), r.PathValue("y"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter, err := parseFilter(r.URL.Query().Get("filter"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		cmd := Command{
+			action:       "search",
+			boxes:        []orb.Bound{tileSearchBound(tile)},
+			filter:       filter,
+			searchResult: make(chan SearchResult),
+		}
+		s.engine.commands <- cmd
+		result := <-cmd.searchResult
+		if result.Error != nil {
+			http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		data, err := encodeTile(tile, result.Features)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", mvtContentType)
+		w.Write(data)
+	})
+
+	// Поиск k ближайших объектов: GET ?lon=&lat=&k=&maxDistance=&metric=planar|haversine.
+	// Для haversine расстояния в метрах, для planar — в градусах системы координат хранилища.
+	mux.HandleFunc("GET /"+name+"/nearest", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		point, k, maxDistance, err := parseNearest(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		metric, err := parseMetric(query.Get("metric"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		proj, err := parseProjection(query.Get("proj"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		point = proj.geometryToNative(point).(orb.Point)
+		if point[0] < -180 || point[0] > 180 || point[1] < -90 || point[1] > 90 {
+			http.Error(w, "точка запроса вне допустимых координат", http.StatusBadRequest)
+			return
+		}
+
+		cmd := Command{
+			action:       "nearest",
+			point:        point,
+			k:            k,
+			maxDistance:  maxDistance,
+			metric:       metric,
+			searchResult: make(chan SearchResult),
+		}
+		s.engine.commands <- cmd
+		result := <-cmd.searchResult
+		if result.Error != nil {
+			http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeDistanceCollection(w, proj, result)
+	})
+
+	// Поиск объектов в радиусе: GET ?lon=&lat=&radius= (метры). Расстояние измеряется по большому кругу
+	// до ближайшей точки геометрии; в ответе, как и у nearest, есть расстояния до объектов.
+	mux.HandleFunc("GET /"+name+"/within", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		point, radius, err := parseRadius(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		proj, err := parseProjection(query.Get("proj"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		point = proj.geometryToNative(point).(orb.Point)
+		if point[0] < -180 || point[0] > 180 || point[1] < -90 || point[1] > 90 {
+			http.Error(w, "точка запроса вне допустимых координат", http.StatusBadRequest)
+			return
+		}
+
+		cmd := Command{
+			action:       "within",
+			point:        point,
+			maxDistance:  radius,
+			searchResult: make(chan SearchResult),
+		}
+		s.engine.commands <- cmd
+		result := <-cmd.searchResult
+		if result.Error != nil {
+			http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeDistanceCollection(w, proj, result)
+	})
+
+	// Пакетный запрос: GET ?ids=a,b,c или POST с JSON массивом ID.
+	// Отсутствующие ID перечисляются в поле missing коллекции.
+	mux.HandleFunc("/"+name+"/features", func(w http.ResponseWriter, r *http.Request) {
+		var ids []string
+		switch r.Method {
+		case http.MethodGet:
+			if raw := r.URL.Query().Get("ids"); raw != "" {
+				ids = strings.Split(raw, ",")
+			}
+		case http.MethodPost:
+			if err := json.NewDecoder(r.Body).Decode(&ids); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		proj, err := parseProjection(r.URL.Query().Get("proj"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		cmd := Command{
+			action:       "get",
+			ids:          ids,
+			searchResult: make(chan SearchResult),
+		}
+		s.engine.commands <- cmd
+		result := <-cmd.searchResult
+		if result.Error != nil {
+			http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		found := make(map[string]bool, len(result.Features))
+		for _, feature := range result.Features {
+			found[feature.ID.(string)] = true
+		}
+		missing := []string{}
+		for _, id := range ids {
+			if !found[id] {
+				missing = append(missing, id)
+			}
+		}
+
+		fc := geojson.NewFeatureCollection()
+		fc.Features = proj.featuresFromNative(result.Features)
+		fc.ExtraMembers = geojson.Properties{"missing": missing}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(fc); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
 	mux.HandleFunc("/"+name+"/insert", func(w http.ResponseWriter, r *http.Request) {
 		var feature geojson.Feature
 		if err := json.NewDecoder(r.Body).Decode(&feature); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		if err := featureToNative(r, &feature); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		concern, err := requestWriteConcern(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		cmd := Command{
-			action:  "insert",
-			feature: &feature,
-			result:  make(chan error),
+			action:       "insert",
+			feature:      &feature,
+			result:       make(chan error),
+			writeConcern: concern,
 		}
 		s.engine.commands <- cmd
 		if err := <-cmd.result; err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeCommandError(w, r, name, err)
 			return
 		}
 		w.WriteHeader(http.StatusOK)
@@ -602,14 +1226,24 @@ func NewStorage(mux *http.ServeMux, name string, replicas []string, leader bool)
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		if err := featureToNative(r, &feature); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		concern, err := requestWriteConcern(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		cmd := Command{
-			action:  "replace",
-			feature: &feature,
-			result:  make(chan error),
+			action:       "replace",
+			feature:      &feature,
+			result:       make(chan error),
+			writeConcern: concern,
 		}
 		s.engine.commands <- cmd
 		if err := <-cmd.result; err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeCommandError(w, r, name, err)
 			return
 		}
 		w.WriteHeader(http.StatusOK)
@@ -621,20 +1255,40 @@ func NewStorage(mux *http.ServeMux, name string, replicas []string, leader bool)
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		// Удаление выполняется по ID: координаты тела не проверяются и не переводятся
+		concern, err := requestWriteConcern(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		cmd := Command{
-			action:  "delete",
-			feature: &feature,
-			result:  make(chan error),
+			action:       "delete",
+			feature:      &feature,
+			result:       make(chan error),
+			writeConcern: concern,
 		}
 		s.engine.commands <- cmd
 		if err := <-cmd.result; err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeCommandError(w, r, name, err)
 			return
 		}
 		w.WriteHeader(http.StatusOK)
 	})
 
 	mux.HandleFunc("/"+name+"/checkpoint", func(w http.ResponseWriter, r *http.Request) {
+		// GET возвращает сведения о последнем чекпоинте, POST запускает новый
+		if r.Method == http.MethodGet {
+			cmd := Command{
+				action:       "checkpointStatus",
+				statusResult: make(chan CheckpointStatus),
+			}
+			s.engine.commands <- cmd
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(<-cmd.statusResult); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
 		cmd := Command{
 			action: "checkpoint",
 			result: make(chan error),
@@ -647,7 +1301,23 @@ func NewStorage(mux *http.ServeMux, name string, replicas []string, leader bool)
 		w.WriteHeader(http.StatusOK)
 	})
 
-	return s
+	return s, nil
+}
+
+// Функция для записи результата поиска с расстояниями: коллекция объектов и массив distances
+func writeDistanceCollection(w http.ResponseWriter, proj *Projection, result SearchResult) {
+	fc := geojson.NewFeatureCollection()
+	fc.Features = proj.featuresFromNative(result.Features)
+	distances := result.Distances
+	if distances == nil {
+		distances = []float64{}
+	}
+	fc.ExtraMembers = geojson.Properties{"distances": distances}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(fc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
 }
 
 func (s *Storage) Run() {
@@ -659,6 +1329,8 @@ func (s *Storage) Run() {
 func (s *Storage) Stop() {
 	if s.engine != nil {
 		s.engine.cancel()
+		// Дожидаемся финального чекпоинта, чтобы директорию можно было сразу открыть снова
+		<-s.engine.done
 	}
 	if s.stop != nil {
 		close(s.stop)
@@ -666,15 +1338,35 @@ func (s *Storage) Stop() {
 	}
 }
 
+// Режим репликации: election — лидер рассылает транзакции и переизбирается при падении, raft — репликация через Raft
+var replicationMode = flag.String("replication", "election", "режим репликации: election или raft")
+
 func main() {
+	flag.Parse()
+	if *replicationMode != "election" && *replicationMode != "raft" {
+		log.Fatalf("Неизвестный режим репликации: %s", *replicationMode)
+	}
+
 	storage1Mux := http.NewServeMux()
-	storage1 := NewStorage(storage1Mux, "storage1", []string{"127.0.0.1:8081", "127.0.0.1:8082"}, true)
+	storage1Peers := []string{"127.0.0.1:8081/storage2", "127.0.0.1:8082/storage3"}
+	storage1, err := NewStorage(storage1Mux, filepath.Join("data", "storage1"), "storage1", storage1Peers, true, withReplication(storage1Mux, "127.0.0.1:8080/storage1", storage1Peers))
+	if err != nil {
+		log.Fatalf("Ошибка запуска storage1: %v", err)
+	}
 
 	storage2Mux := http.NewServeMux()
-	storage2 := NewStorage(storage2Mux, "storage2", []string{"127.0.0.1:8080", "127.0.0.1:8082"}, false)
+	storage2Peers := []string{"127.0.0.1:8080/storage1", "127.0.0.1:8082/storage3"}
+	storage2, err := NewStorage(storage2Mux, filepath.Join("data", "storage2"), "storage2", storage2Peers, false, withReplication(storage2Mux, "127.0.0.1:8081/storage2", storage2Peers))
+	if err != nil {
+		log.Fatalf("Ошибка запуска storage2: %v", err)
+	}
 
 	storage3Mux := http.NewServeMux()
-	storage3 := NewStorage(storage3Mux, "storage3", []string{"127.0.0.1:8080", "127.0.0.1:8081"}, false)
+	storage3Peers := []string{"127.0.0.1:8080/storage1", "127.0.0.1:8081/storage2"}
+	storage3, err := NewStorage(storage3Mux, filepath.Join("data", "storage3"), "storage3", storage3Peers, false, withReplication(storage3Mux, "127.0.0.1:8082/storage3", storage3Peers))
+	if err != nil {
+		log.Fatalf("Ошибка запуска storage3: %v", err)
+	}
 	go runStorage(storage1, storage1Mux, ":8080")
 	go runStorage(storage2, storage2Mux, ":8081")
 	go runStorage(storage3, storage3Mux, ":8082")
@@ -687,6 +1379,26 @@ func main() {
 	storage3.Stop()
 }
 
+// Функция для включения выборов лидера с параметрами по умолчанию для узла addr
+func withElection(addr string) Option {
+	opts := DefaultElectionOptions
+	opts.Addr = addr
+	return WithElection(opts)
+}
+
+// Функция для включения выбранного режима репликации узла addr. Узлы Raft обмениваются сообщениями
+// по HTTP через mux узла и хранят журнал Raft в рабочей директории.
+func withReplication(mux *http.ServeMux, addr string, peers []string) Option {
+	if *replicationMode != "raft" {
+		return withElection(addr)
+	}
+	opts := DefaultRaftOptions
+	opts.ID = addr
+	opts.Peers = peers
+	opts.Transport = NewHTTPRaftTransport(mux)
+	return WithRaft(opts)
+}
+
 func runStorage(s *Storage, mux *http.ServeMux, addr string) {
 	s.Run()
 	server := &http.Server{
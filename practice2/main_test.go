@@ -3,19 +3,33 @@ package practice2
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geo"
 	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/project"
 )
 
 func TestInsertHandler(t *testing.T) {
 	mux := http.NewServeMux()
-	s := NewStorage(mux, "storage1", []string{"localhost:8082"}, true)
+	s, err := NewStorage(mux, t.TempDir(), "storage1", []string{"localhost:8082"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
 	s.Run()
 	defer s.Stop()
 
@@ -41,7 +55,10 @@ func TestInsertHandler(t *testing.T) {
 
 func TestSelectHandler(t *testing.T) {
 	mux := http.NewServeMux()
-	s := NewStorage(mux, "storage1", []string{"localhost:8082"}, true)
+	s, err := NewStorage(mux, t.TempDir(), "storage1", []string{"localhost:8082"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
 	s.Run()
 	defer s.Stop()
 
@@ -89,7 +106,10 @@ func TestSelectHandler(t *testing.T) {
 
 func TestReplaceHandler(t *testing.T) {
 	mux := http.NewServeMux()
-	s := NewStorage(mux, "storage1", []string{"localhost:8082"}, true)
+	s, err := NewStorage(mux, t.TempDir(), "storage1", []string{"localhost:8082"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
 	s.Run()
 	defer s.Stop()
 
@@ -134,7 +154,10 @@ func TestReplaceHandler(t *testing.T) {
 
 func TestDeleteHandler(t *testing.T) {
 	mux := http.NewServeMux()
-	s := NewStorage(mux, "storage1", []string{"localhost:8082"}, true)
+	s, err := NewStorage(mux, t.TempDir(), "storage1", []string{"localhost:8082"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
 	s.Run()
 	defer s.Stop()
 
@@ -173,7 +196,10 @@ func TestDeleteHandler(t *testing.T) {
 
 func TestRedirectHandler(t *testing.T) {
 	mux := http.NewServeMux()
-	s := NewStorage(mux, "storage1", []string{"localhost:8082"}, true)
+	s, err := NewStorage(mux, t.TempDir(), "storage1", []string{"localhost:8082"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
 	s.Run()
 	defer s.Stop()
 
@@ -198,3 +224,1605 @@ func TestRedirectHandler(t *testing.T) {
 		}
 	}
 }
+
+func TestSelectRectProjHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	s, err := NewStorage(mux, t.TempDir(), "storage1", []string{"localhost:8082"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	// Объект хранится в EPSG:4326
+	feature := geojson.NewFeature(orb.Point{30.3, 59.9})
+	feature.ID = uuid.New().String()
+	body, err := json.Marshal(feature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqInsert, err := http.NewRequest("POST", "/storage1/insert", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rrInsert := httptest.NewRecorder()
+	mux.ServeHTTP(rrInsert, reqInsert)
+
+	if rrInsert.Code != http.StatusOK {
+		t.Errorf("Insert handler returned wrong status code: got %v want %v", rrInsert.Code, http.StatusOK)
+	}
+
+	// Запрос в формате OpenLayers: экстент карты в Web Mercator
+	req, err := http.NewRequest("GET", "/storage1/select?rect=3300000,8300000,3450000,8450000&proj=EPSG:3857", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Select handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var fc geojson.FeatureCollection
+	if err := json.Unmarshal(rr.Body.Bytes(), &fc); err != nil {
+		t.Fatal(err)
+	}
+
+	var found *geojson.Feature
+	for _, f := range fc.Features {
+		if f.ID == feature.ID {
+			found = f
+		}
+	}
+	if found == nil {
+		t.Fatalf("Select handler did not return inserted feature")
+	}
+
+	// Геометрия должна вернуться в системе координат запроса
+	point := found.Geometry.(orb.Point)
+	if point[0] < 3300000 || point[0] > 3450000 || point[1] < 8300000 || point[1] > 8450000 {
+		t.Errorf("Select handler returned geometry not in EPSG:3857: %v", point)
+	}
+
+	req, err = http.NewRequest("GET", "/storage1/select?rect=0,0,1,1&proj=EPSG:27700", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Select handler returned wrong status code for unknown proj: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSelectAntimeridian(t *testing.T) {
+	mux := http.NewServeMux()
+	west := orb.Bound{Min: orb.Point{-180, -90}, Max: orb.Point{0, 90}}
+	east := orb.Bound{Min: orb.Point{0, -90}, Max: orb.Point{180, 90}}
+	NewRouter(mux, [][]string{{"storage1"}, {"storage2"}}, WithShardBounds(west, east))
+	for _, name := range []string{"storage1", "storage2"} {
+		s, err := NewStorage(mux, t.TempDir(), name, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Run()
+		defer s.Stop()
+	}
+	for i, feature := range []*geojson.Feature{newTestFeature("west", -179.5, 0), newTestFeature("east", 179.5, 0), newTestFeature("far", 100, 0)} {
+		feature.Properties["kind"] = "point"
+		insertFeature(t, mux, []string{"storage1", "storage2", "storage2"}[i], feature)
+	}
+	// Линия через всю карту задевает обе части прямоугольника, но выдаётся один раз
+	line := geojson.NewFeature(orb.LineString{{-179.5, 0.5}, {179.5, 0.5}})
+	line.ID = "line"
+	insertFeature(t, mux, "storage1", line)
+
+	selectIDs := func(url string) []string {
+		t.Helper()
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s returned wrong status code: got %v want %v: %s", url, rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var features []*geojson.Feature
+		if strings.Contains(url, "format=ndjson") {
+			for _, line := range strings.Split(strings.TrimSpace(rr.Body.String()), "\n") {
+				feature, err := geojson.UnmarshalFeature([]byte(line))
+				if err != nil {
+					t.Fatal(err)
+				}
+				features = append(features, feature)
+			}
+		} else {
+			var fc geojson.FeatureCollection
+			if err := json.Unmarshal(rr.Body.Bytes(), &fc); err != nil {
+				t.Fatal(err)
+			}
+			features = fc.Features
+		}
+		var ids []string
+		for _, f := range features {
+			ids = append(ids, f.ID.(string))
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	world := 20037508.342789244
+	for url, expected := range map[string][]string{
+		"/select?rect=179,-1,181,1":   {"east", "line", "west"},
+		"/select?rect=-181,-1,-179,1": {"east", "line", "west"},
+		fmt.Sprintf("/select?rect=%f,-100000,%f,100000&proj=EPSG:3857", world-100000, world+100000): {"east", "line", "west"},
+		"/storage1/select?rect=179,-1,181,1":                      {"line", "west"},
+		"/storage1/select?rect=179,-1,181,1&limit=10":             {"line", "west"},
+		"/storage1/select?rect=179,-1,181,1&format=ndjson":        {"line", "west"},
+		"/storage1/select?rect=179,-1,181,1&filter=kind%3Dpoint":  {"west"},
+		"/storage1/select?rect=179,-1,181,1&predicate=intersects": {"line", "west"},
+	} {
+		if ids := selectIDs(url); !reflect.DeepEqual(ids, expected) {
+			t.Errorf("%s returned %v, expected %v", url, ids, expected)
+		}
+	}
+
+	// Гистограмма и экстент непрерывны через линию перемены дат, как прямоугольник на карте
+	result := queryAggregate(t, mux, "GET", "/aggregate?rect=179,-1,181,1&filter=kind%3Dpoint&grid=2,1", nil)
+	if result.Count != 2 || !reflect.DeepEqual(result.Extent, geojson.BBox{179.5, 0, 180.5, 0}) {
+		t.Errorf("Aggregate across the antimeridian = %+v, expected extent [179.5 0 180.5 0]", result)
+	}
+	if result.Histogram == nil || !reflect.DeepEqual(result.Histogram.Counts, []int{1, 1}) {
+		t.Errorf("Aggregate across the antimeridian histogram = %+v, expected [1 1]", result.Histogram)
+	}
+}
+
+func TestInsertProjHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	s, err := NewStorage(mux, t.TempDir(), "storage1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	// Карта отправляет нарисованный объект в Web Mercator
+	feature := geojson.NewFeature(project.WGS84.ToMercator(orb.Point{30.3, 59.9}))
+	feature.ID = uuid.New().String()
+	if code := postFeature(t, mux, "/storage1/insert?proj=EPSG:3857", feature); code != http.StatusOK {
+		t.Fatalf("Insert handler returned wrong status code: got %v want %v", code, http.StatusOK)
+	}
+	if code := postFeature(t, mux, "/storage1/insert?proj=EPSG:27700", feature); code != http.StatusBadRequest {
+		t.Errorf("Insert handler returned wrong status code for unknown proj: got %v want %v", code, http.StatusBadRequest)
+	}
+	// Клиент без proj отправляет метры Web Mercator: они не сохраняются как градусы
+	if code := postFeature(t, mux, "/storage1/insert", feature); code != http.StatusBadRequest {
+		t.Errorf("Insert handler accepted coordinates out of EPSG:4326 range: got %v want %v", code, http.StatusBadRequest)
+	}
+	if code := postFeature(t, mux, "/storage1/replace?proj=EPSG:4326", feature); code != http.StatusBadRequest {
+		t.Errorf("Replace handler accepted coordinates out of EPSG:4326 range: got %v want %v", code, http.StatusBadRequest)
+	}
+
+	// Объект хранится в EPSG:4326
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/storage1/feature/"+feature.ID.(string), nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Get handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	stored, err := geojson.UnmarshalFeature(rr.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := stored.Geometry.(orb.Point)
+	if math.Abs(point[0]-30.3) > 1e-6 || math.Abs(point[1]-59.9) > 1e-6 {
+		t.Errorf("Inserted feature stored in wrong coordinates: %v", point)
+	}
+
+	// Для удаления нужен только ID: тело в метрах без proj удаляет объект
+	if code := postFeature(t, mux, "/storage1/delete", feature); code != http.StatusOK {
+		t.Errorf("Delete handler returned wrong status code for projected body without proj: got %v want %v", code, http.StatusOK)
+	}
+	if searchIDs(t, s)[feature.ID.(string)] {
+		t.Error("Feature is still stored after delete")
+	}
+}
+
+func TestSideBySideStorages(t *testing.T) {
+	names := []string{"storage1", "storage2", "storage3"}
+	dirs := make([]string, len(names))
+	muxes := make([]*http.ServeMux, len(names))
+	storages := make([]*Storage, len(names))
+	const perStorage = 10
+	ids := make([][]string, len(names))
+
+	// Хранилища работают одновременно в одном процессе, каждое со своей рабочей директорией
+	for i, name := range names {
+		dirs[i] = t.TempDir()
+		muxes[i] = http.NewServeMux()
+		s, err := NewStorage(muxes[i], dirs[i], name, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Run()
+		storages[i] = s
+	}
+
+	// Записи в разные хранилища чередуются и выполняются параллельно
+	var wg sync.WaitGroup
+	for n := 0; n < perStorage; n++ {
+		for i, name := range names {
+			feature := geojson.NewFeature(orb.Point{1.0, 1.0})
+			feature.ID = uuid.New().String()
+			ids[i] = append(ids[i], feature.ID.(string))
+			wg.Add(1)
+			go func(mux *http.ServeMux, name string, feature *geojson.Feature) {
+				defer wg.Done()
+				if code := postFeature(t, mux, "/"+name+"/insert", feature); code != http.StatusOK {
+					t.Errorf("Insert into %s returned wrong status code: got %v want %v", name, code, http.StatusOK)
+				}
+			}(muxes[i], name, feature)
+		}
+	}
+	wg.Wait()
+
+	// Журнал каждого хранилища содержит только его транзакции; при остановке чекпоинт его удалит
+	for i, name := range names {
+		var logged []string
+		err := readWALRange(filepath.Join(dirs[i], walDirName), 0, perStorage, func(txn *Transaction) error {
+			if txn.Name != name {
+				t.Errorf("WAL of %s contains transaction of %s", name, txn.Name)
+			}
+			logged = append(logged, txn.Feature.ID.(string))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameIDs(idSet(logged), ids[i]...) {
+			t.Errorf("WAL of %s contains %v, expected %v", name, logged, ids[i])
+		}
+	}
+	for _, s := range storages {
+		s.Stop()
+	}
+
+	// После перезапуска каждое хранилище должно видеть только свои данные
+	for i, name := range names {
+		mux := http.NewServeMux()
+		s, err := NewStorage(mux, dirs[i], name, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Run()
+
+		req, err := http.NewRequest("GET", "/"+name+"/select?minX=0&minY=0&maxX=2&maxY=2", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		var fc geojson.FeatureCollection
+		if err := json.Unmarshal(rr.Body.Bytes(), &fc); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0, len(fc.Features))
+		for _, feature := range fc.Features {
+			got = append(got, feature.ID.(string))
+		}
+		if !sameIDs(idSet(got), ids[i]...) {
+			t.Errorf("Storage %s returned %d features, expected only its own %d", name, len(fc.Features), len(ids[i]))
+		}
+		s.Stop()
+	}
+}
+
+func idSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+func TestDataDirLock(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStorage(http.NewServeMux(), dir, "storage1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+
+	if _, err := NewStorage(http.NewServeMux(), dir, "storage2", nil, true); !errors.Is(err, ErrDataDirLocked) {
+		t.Errorf("Expected ErrDataDirLocked for a directory in use, got %v", err)
+	}
+
+	// После остановки директорию можно открыть снова
+	s.Stop()
+	s, err = NewStorage(http.NewServeMux(), dir, "storage1", nil, true)
+	if err != nil {
+		t.Fatalf("Expected directory to be released after Stop, got %v", err)
+	}
+	s.Run()
+	s.Stop()
+}
+
+func TestGetFeatureHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	s, err := NewStorage(mux, t.TempDir(), "storage1", []string{"localhost:8082"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	feature := geojson.NewFeature(orb.Point{rand.Float64(), rand.Float64()})
+	feature.ID = uuid.New().String()
+	body, err := json.Marshal(feature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqInsert, err := http.NewRequest("POST", "/storage1/insert", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rrInsert := httptest.NewRecorder()
+	mux.ServeHTTP(rrInsert, reqInsert)
+
+	if rrInsert.Code != http.StatusOK {
+		t.Errorf("Insert handler returned wrong status code: got %v want %v", rrInsert.Code, http.StatusOK)
+	}
+
+	req, err := http.NewRequest("GET", "/storage1/feature/"+feature.ID.(string), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Feature handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var got geojson.Feature
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != feature.ID {
+		t.Errorf("Feature handler returned wrong feature: got %v want %v", got.ID, feature.ID)
+	}
+
+	req, err = http.NewRequest("GET", "/storage1/feature/"+uuid.New().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Feature handler returned wrong status code for missing ID: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	// Пакетный запрос с одним существующим и одним отсутствующим ID
+	missingID := uuid.New().String()
+	ids, err := json.Marshal([]string{feature.ID.(string), missingID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err = http.NewRequest("POST", "/storage1/features", bytes.NewReader(ids))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Features handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var fc geojson.FeatureCollection
+	if err := json.Unmarshal(rr.Body.Bytes(), &fc); err != nil {
+		t.Fatal(err)
+	}
+	if len(fc.Features) != 1 || fc.Features[0].ID != feature.ID {
+		t.Errorf("Features handler returned %d features, expected the inserted one", len(fc.Features))
+	}
+	missing, _ := fc.ExtraMembers["missing"].([]interface{})
+	if len(missing) != 1 || missing[0] != missingID {
+		t.Errorf("Features handler returned missing %v, expected [%s]", fc.ExtraMembers["missing"], missingID)
+	}
+}
+
+func TestRouterFeature(t *testing.T) {
+	mux := http.NewServeMux()
+	NewRouter(mux, [][]string{{"storage1"}, {"storage2"}})
+	for _, name := range []string{"storage1", "storage2"} {
+		s, err := NewStorage(mux, t.TempDir(), name, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Run()
+		defer s.Stop()
+	}
+	insertFeature(t, mux, "storage1", newTestFeature("a", 1, 1))
+	insertFeature(t, mux, "storage2", newTestFeature("b", 2, 2))
+
+	// Объект из второго шарда находится, proj доходит до шарда
+	req, err := http.NewRequest("GET", "/feature/b?proj=EPSG:3857", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Router feature returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var got geojson.Feature
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	expected := project.Point(orb.Point{2, 2}, project.WGS84.ToMercator)
+	if p, ok := got.Geometry.(orb.Point); got.ID != "b" || !ok || math.Abs(p[0]-expected[0]) > 1e-6 || math.Abs(p[1]-expected[1]) > 1e-6 {
+		t.Errorf("Router feature returned %v at %v, expected b at %v", got.ID, got.Geometry, expected)
+	}
+
+	req, err = http.NewRequest("GET", "/feature/c", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Router feature for missing ID returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	// Пакетный запрос собирает объекты со всех шардов; missing — ID, которых нет ни в одном
+	req, err = http.NewRequest("GET", "/features?ids=a,b,c", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Router features returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var fc geojson.FeatureCollection
+	if err := json.Unmarshal(rr.Body.Bytes(), &fc); err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]bool)
+	for _, feature := range fc.Features {
+		found[feature.ID.(string)] = true
+	}
+	if len(fc.Features) != 2 || !found["a"] || !found["b"] {
+		t.Errorf("Router features returned %v, expected a and b", found)
+	}
+	missing, _ := fc.ExtraMembers["missing"].([]interface{})
+	if len(missing) != 1 || missing[0] != "c" {
+		t.Errorf("Router features returned missing %v, expected [c]", fc.ExtraMembers["missing"])
+	}
+}
+
+func TestSelectPredicateHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	s, err := NewStorage(mux, t.TempDir(), "storage1", []string{"localhost:8082"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	// Диагональная линия, bounding box которой накрывает запрос, а сама линия его не задевает
+	feature := geojson.NewFeature(orb.LineString{{1.5, 10}, {10, 1.5}})
+	feature.ID = uuid.New().String()
+	body, err := json.Marshal(feature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqInsert, err := http.NewRequest("POST", "/storage1/insert", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rrInsert := httptest.NewRecorder()
+	mux.ServeHTTP(rrInsert, reqInsert)
+
+	if rrInsert.Code != http.StatusOK {
+		t.Errorf("Insert handler returned wrong status code: got %v want %v", rrInsert.Code, http.StatusOK)
+	}
+
+	for predicate, expected := range map[string]int{"": 0, "intersects": 0, "bbox": 1} {
+		req, err := http.NewRequest("GET", "/storage1/select?minX=0&minY=0&maxX=2&maxY=2&predicate="+predicate, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Select handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		var fc geojson.FeatureCollection
+		if err := json.Unmarshal(rr.Body.Bytes(), &fc); err != nil {
+			t.Fatal(err)
+		}
+		if len(fc.Features) != expected {
+			t.Errorf("Select with predicate %q returned %d features, expected %d", predicate, len(fc.Features), expected)
+		}
+	}
+}
+
+// Функция для вставки объекта через обработчик insert
+func insertFeature(t *testing.T, mux *http.ServeMux, name string, feature *geojson.Feature) {
+	t.Helper()
+	body, err := json.Marshal(feature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", "/"+name+"/insert", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Insert handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestSelectAreaHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	s, err := NewStorage(mux, t.TempDir(), "storage1", []string{"localhost:8082"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	// Точка a внутри треугольника, точка b — внутри его bounding box, но вне треугольника
+	insertFeature(t, mux, "storage1", newTestFeature("a", 1, 1))
+	insertFeature(t, mux, "storage1", newTestFeature("b", 3.5, 3.5))
+
+	triangle := orb.Polygon{{{0, 0}, {4, 0}, {0, 4}, {0, 0}}}
+	geometry, err := json.Marshal(geojson.NewGeometry(triangle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	feature, err := json.Marshal(geojson.NewFeature(triangle))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, body := range map[string][]byte{"geometry": geometry, "feature": feature} {
+		req, err := http.NewRequest("POST", "/storage1/select", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Select with %s body returned wrong status code: got %v want %v", name, rr.Code, http.StatusOK)
+		}
+		fc, err := geojson.UnmarshalFeatureCollection(rr.Body.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fc.Features) != 1 || fc.Features[0].ID != "a" {
+			t.Errorf("Select with %s body returned %d features, expected only a", name, len(fc.Features))
+		}
+	}
+
+	req, err := http.NewRequest("POST", "/storage1/select", strings.NewReader(`{"type":"FeatureCollection","features":[]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Select with collection body returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	// Область с лишними вершинами отклоняется до попарной проверки отрезков
+	ring := orb.Ring{}
+	for i := 0; i < maxAreaVertices; i++ {
+		angle := 2 * math.Pi * float64(i) / maxAreaVertices
+		ring = append(ring, orb.Point{math.Cos(angle), math.Sin(angle)})
+	}
+	ring = append(ring, ring[0])
+	body, err := json.Marshal(geojson.NewGeometry(orb.Polygon{ring}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err = http.NewRequest("POST", "/storage1/select", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Select with oversized area returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRouterSelectScatter(t *testing.T) {
+	mux := http.NewServeMux()
+	NewRouter(mux, [][]string{{"storage1"}, {"storage2"}})
+	for i, name := range []string{"storage1", "storage2"} {
+		s, err := NewStorage(mux, t.TempDir(), name, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Run()
+		defer s.Stop()
+		insertFeature(t, mux, name, newTestFeature(name, float64(i), float64(i)))
+	}
+
+	area, err := json.Marshal(geojson.NewGeometry(orb.Polygon{{{-1, -1}, {3, -1}, {-1, 3}, {-1, -1}}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := map[string]func() (*http.Request, error){
+		"GET": func() (*http.Request, error) {
+			return http.NewRequest("GET", "/select?rect=-1,-1,2,2", nil)
+		},
+		"POST": func() (*http.Request, error) {
+			return http.NewRequest("POST", "/select", bytes.NewReader(area))
+		},
+	}
+	for method, newRequest := range requests {
+		req, err := newRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Router %s select returned wrong status code: got %v want %v", method, rr.Code, http.StatusOK)
+		}
+		fc, err := geojson.UnmarshalFeatureCollection(rr.Body.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fc.Features) != 2 {
+			t.Errorf("Router %s select returned %d features, expected one from each shard", method, len(fc.Features))
+		}
+	}
+}
+
+// Функция для запроса nearest и разбора ответа: ID объектов и расстояния
+func queryNearest(t *testing.T, mux *http.ServeMux, url string) ([]string, []interface{}) {
+	t.Helper()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Nearest %s returned wrong status code: got %v want %v: %s", url, rr.Code, http.StatusOK, rr.Body.String())
+	}
+	fc, err := geojson.UnmarshalFeatureCollection(rr.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, feature := range fc.Features {
+		ids = append(ids, feature.ID.(string))
+	}
+	distances, _ := fc.ExtraMembers["distances"].([]interface{})
+	if len(distances) != len(ids) {
+		t.Fatalf("Nearest %s returned %d distances for %d features", url, len(distances), len(ids))
+	}
+	return ids, distances
+}
+
+func TestNearestHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	s, err := NewStorage(mux, t.TempDir(), "storage1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	// По метрике haversine объект за антимеридианом ближе, чем объект с той же стороны
+	insertFeature(t, mux, "storage1", newTestFeature("east", 179, 0))
+	insertFeature(t, mux, "storage1", newTestFeature("west", -179.95, 0))
+	insertFeature(t, mux, "storage1", newTestFeature("far", 170, 10))
+
+	ids, distances := queryNearest(t, mux, "/storage1/nearest?lon=179.9&lat=0&k=2")
+	if len(ids) != 2 || ids[0] != "west" || ids[1] != "east" {
+		t.Errorf("Nearest returned %v, expected [west east]", ids)
+	}
+	if d := distances[0].(float64); d < 16000 || d > 17500 {
+		t.Errorf("Distance to west is %f meters, expected about 16.7 km", d)
+	}
+
+	ids, _ = queryNearest(t, mux, "/storage1/nearest?lon=179.9&lat=0&k=2&metric=planar")
+	if len(ids) != 2 || ids[0] != "east" {
+		t.Errorf("Planar nearest returned %v, expected east first", ids)
+	}
+
+	ids, _ = queryNearest(t, mux, "/storage1/nearest?lon=179.9&lat=0&maxDistance=50000")
+	if len(ids) != 1 || ids[0] != "west" {
+		t.Errorf("Nearest with maxDistance returned %v, expected [west]", ids)
+	}
+
+	for _, url := range []string{"/storage1/nearest?lon=0", "/storage1/nearest?lon=0&lat=0&k=0", "/storage1/nearest?lon=0&lat=0&metric=manhattan"} {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Nearest %s returned wrong status code: got %v want %v", url, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestRouterNearest(t *testing.T) {
+	mux := http.NewServeMux()
+	NewRouter(mux, [][]string{{"storage1"}, {"storage2"}})
+	for _, name := range []string{"storage1", "storage2"} {
+		s, err := NewStorage(mux, t.TempDir(), name, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Run()
+		defer s.Stop()
+	}
+	// Ближайшие объекты распределены по шардам вперемешку
+	insertFeature(t, mux, "storage1", newTestFeature("d1", 1, 0))
+	insertFeature(t, mux, "storage2", newTestFeature("d2", 2, 0))
+	insertFeature(t, mux, "storage1", newTestFeature("d3", 3, 0))
+	insertFeature(t, mux, "storage2", newTestFeature("d4", 4, 0))
+
+	ids, distances := queryNearest(t, mux, "/nearest?lon=0&lat=0&k=3")
+	if len(ids) != 3 || ids[0] != "d1" || ids[1] != "d2" || ids[2] != "d3" {
+		t.Errorf("Router nearest returned %v, expected [d1 d2 d3]", ids)
+	}
+	for i := 1; i < len(distances); i++ {
+		if distances[i].(float64) < distances[i-1].(float64) {
+			t.Errorf("Router nearest distances are not sorted: %v", distances)
+		}
+	}
+}
+
+func TestWithinHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	s, err := NewStorage(mux, t.TempDir(), "storage1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	// 0.003° по экватору — около 334 м; объект за антимеридианом тоже в радиусе
+	insertFeature(t, mux, "storage1", newTestFeature("near", 179.998, 0))
+	insertFeature(t, mux, "storage1", newTestFeature("across", -179.999, 0))
+	insertFeature(t, mux, "storage1", newTestFeature("far", 179.99, 0))
+	// Линия, вершины которой далеко, а сама она проходит рядом с точкой запроса
+	line := geojson.NewFeature(orb.LineString{{179.9995, -1}, {179.9995, 1}})
+	line.ID = "line"
+	insertFeature(t, mux, "storage1", line)
+
+	req, err := http.NewRequest("GET", "/storage1/within?lon=179.9995&lat=0.001&radius=500", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Within handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	fc, err := geojson.UnmarshalFeatureCollection(rr.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]bool)
+	for _, feature := range fc.Features {
+		found[feature.ID.(string)] = true
+	}
+	if len(found) != 3 || !found["near"] || !found["across"] || !found["line"] {
+		t.Errorf("Within returned %v, expected near, across and line", found)
+	}
+
+	// Дуга большого круга между вершинами на 70° широты проходит у нулевого меридиана около 80°,
+	// далеко за прямоугольником вершин
+	arc := geojson.NewFeature(orb.LineString{{-60, 70}, {60, 70}})
+	arc.ID = "arc"
+	insertFeature(t, mux, "storage1", arc)
+	point := orb.Point{0, 79.5}
+	if d := HaversineMetric.Distance(arc.Geometry, point); d > 100000 {
+		t.Fatalf("Distance to the arc is %f, expected below 100 km", d)
+	}
+	req, err = http.NewRequest("GET", "/storage1/within?lon=0&lat=79.5&radius=100000", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Within handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if fc, err = geojson.UnmarshalFeatureCollection(rr.Body.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if len(fc.Features) != 1 || fc.Features[0].ID != "arc" {
+		t.Errorf("Within near the pole returned %d features, expected the arc", len(fc.Features))
+	}
+
+	req, err = http.NewRequest("GET", "/storage1/within?lon=0&lat=0&radius=-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Within with negative radius returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// Окружности поиска у антимеридиана и у полюсов: каждая точка в радиусе должна найтись,
+// даже если она по другую сторону от ±180° или на противоположном меридиане за полюсом
+func TestWithinAntimeridianAndPole(t *testing.T) {
+	mux := http.NewServeMux()
+	s, err := NewStorage(mux, t.TempDir(), "storage1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	wrap := func(p orb.Point) orb.Point {
+		p[0] = math.Mod(p[0]+540, 360) - 180
+		return p
+	}
+	type circle struct {
+		center  orb.Point
+		radius  float64
+		inside  []orb.Point
+		outside []orb.Point
+	}
+	circles := []circle{
+		{center: orb.Point{179.999, 0}, radius: 1000, inside: []orb.Point{{-179.995, 0}}},
+		{center: orb.Point{10, 89.99}, radius: 5000, inside: []orb.Point{{-170, 89.99}, {100, 89.97}}},
+	}
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 12; i++ {
+		var center orb.Point
+		if i%2 == 0 {
+			center = orb.Point{math.Copysign(179.5+rng.Float64()*0.5, rng.Float64()-0.5), rng.Float64()*160 - 80}
+		} else {
+			center = orb.Point{rng.Float64()*360 - 180, math.Copysign(89+rng.Float64(), rng.Float64()-0.5)}
+		}
+		c := circle{center: center, radius: math.Pow(10, rng.Float64()*4+1.5)}
+		for j := 0; j < 8; j++ {
+			c.inside = append(c.inside, wrap(geo.PointAtBearingAndDistance(center, rng.Float64()*360, c.radius*0.99*rng.Float64())))
+		}
+		for j := 0; j < 2; j++ {
+			c.outside = append(c.outside, wrap(geo.PointAtBearingAndDistance(center, rng.Float64()*360, c.radius*(1.1+rng.Float64()))))
+		}
+		circles = append(circles, c)
+	}
+
+	for i, c := range circles {
+		for j, p := range c.inside {
+			insertFeature(t, mux, "storage1", newTestFeature(fmt.Sprintf("in-%d-%d", i, j), p[0], p[1]))
+		}
+		for j, p := range c.outside {
+			insertFeature(t, mux, "storage1", newTestFeature(fmt.Sprintf("out-%d-%d", i, j), p[0], p[1]))
+		}
+	}
+	for i, c := range circles {
+		ids, _ := queryNearest(t, mux, fmt.Sprintf("/storage1/within?lon=%v&lat=%v&radius=%v", c.center[0], c.center[1], c.radius))
+		found := make(map[string]bool)
+		for _, id := range ids {
+			found[id] = true
+		}
+		for j, p := range c.inside {
+			if !found[fmt.Sprintf("in-%d-%d", i, j)] {
+				t.Errorf("Within %v m of %v missed %v at %f m", c.radius, c.center, p, geo.DistanceHaversine(c.center, p))
+			}
+		}
+		for j, p := range c.outside {
+			if found[fmt.Sprintf("out-%d-%d", i, j)] {
+				t.Errorf("Within %v m of %v returned %v at %f m", c.radius, c.center, p, geo.DistanceHaversine(c.center, p))
+			}
+		}
+	}
+}
+
+func TestSelectFilterHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	s, err := NewStorage(mux, t.TempDir(), "storage1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	ratings := map[string]float64{"a": 4.5, "b": 4.8, "c": 3}
+	for id, category := range map[string]string{"a": "restaurant", "b": "cafe", "c": "restaurant"} {
+		feature := newTestFeature(id, 1, 1)
+		feature.Properties["category"] = category
+		feature.Properties["rating"] = ratings[id]
+		insertFeature(t, mux, "storage1", feature)
+	}
+
+	req, err := http.NewRequest("GET", "/storage1/select?rect=0,0,2,2&filter=category%3Drestaurant", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Select handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	fc, err := geojson.UnmarshalFeatureCollection(rr.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fc.Features) != 2 {
+		t.Errorf("Select with filter returned %d features, expected 2", len(fc.Features))
+	}
+	for _, feature := range fc.Features {
+		if feature.Properties["category"] != "restaurant" {
+			t.Errorf("Select with filter returned feature %v with category %v", feature.ID, feature.Properties["category"])
+		}
+	}
+
+	// Несколько условий в одном параметре должны пережить разбор query string
+	req, err = http.NewRequest("GET", "/storage1/select?rect=0,0,2,2&filter=category%3Drestaurant,rating>=4", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Select handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if fc, err = geojson.UnmarshalFeatureCollection(rr.Body.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if len(fc.Features) != 1 || fc.Features[0].ID != "a" {
+		t.Errorf("Select with two filter clauses returned %d features, expected only a", len(fc.Features))
+	}
+
+	req, err = http.NewRequest("GET", "/storage1/select?rect=0,0,2,2&filter=category", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Select with invalid filter returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// Функция для постраничного обхода select; возвращает ID всех объектов по порядку страниц
+func selectAllPages(t *testing.T, mux *http.ServeMux, prefix string, limit int) []string {
+	t.Helper()
+	var ids []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatal("Pagination does not terminate")
+		}
+		url := fmt.Sprintf("%s/select?rect=-180,-90,180,90&limit=%d", prefix, limit)
+		if cursor != "" {
+			url += "&cursor=" + cursor
+		}
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Select page returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		fc, err := geojson.UnmarshalFeatureCollection(rr.Body.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fc.Features) > limit {
+			t.Fatalf("Select page returned %d features, limit %d", len(fc.Features), limit)
+		}
+		for _, feature := range fc.Features {
+			ids = append(ids, feature.ID.(string))
+		}
+		next, _ := fc.ExtraMembers["next"].(string)
+		if next == "" {
+			return ids
+		}
+		cursor = next
+	}
+}
+
+func TestSelectPagination(t *testing.T) {
+	mux := http.NewServeMux()
+	s, err := NewStorage(mux, t.TempDir(), "storage1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	for i := 0; i < 25; i++ {
+		insertFeature(t, mux, "storage1", newTestFeature(fmt.Sprintf("f%02d", i), float64(i), 0))
+	}
+
+	ids := selectAllPages(t, mux, "/storage1", 10)
+	if len(ids) != 25 {
+		t.Fatalf("Pagination returned %d features, expected 25", len(ids))
+	}
+	for i, id := range ids {
+		if id != fmt.Sprintf("f%02d", i) {
+			t.Fatalf("Pagination returned %s at position %d, expected stable order by ID", id, i)
+		}
+	}
+
+	req, err := http.NewRequest("GET", "/storage1/select?rect=-180,-90,180,90&cursor=!!", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Select with invalid cursor returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSelectStream(t *testing.T) {
+	mux := http.NewServeMux()
+	s, err := NewStorage(mux, t.TempDir(), "storage1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	for i := 0; i < 5; i++ {
+		insertFeature(t, mux, "storage1", newTestFeature(fmt.Sprint(i), float64(i), 0))
+	}
+
+	for limit, expected := range map[string]int{"": 5, "&limit=3": 3} {
+		req, err := http.NewRequest("GET", "/storage1/select?rect=-180,-90,180,90&format=ndjson"+limit, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Stream select returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("Stream select returned Content-Type %s", ct)
+		}
+		lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+		if len(lines) != expected {
+			t.Fatalf("Stream select returned %d lines, expected %d", len(lines), expected)
+		}
+		for _, line := range lines {
+			if _, err := geojson.UnmarshalFeature([]byte(line)); err != nil {
+				t.Errorf("Stream line is not a GeoJSON feature: %v", err)
+			}
+		}
+	}
+}
+
+func TestRouterSelectStream(t *testing.T) {
+	mux := http.NewServeMux()
+	NewRouter(mux, [][]string{{"storage1"}, {"storage2"}})
+	for _, name := range []string{"storage1", "storage2"} {
+		s, err := NewStorage(mux, t.TempDir(), name, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Run()
+		defer s.Stop()
+	}
+	for i := 0; i < 300; i++ {
+		insertFeature(t, mux, fmt.Sprintf("storage%d", i%2+1), newTestFeature(fmt.Sprintf("f%03d", i), float64(i%360-180), 0))
+	}
+
+	stream := func(query string) (int, []string) {
+		t.Helper()
+		req, err := http.NewRequest("GET", "/select?rect=-180,-90,180,90&format=ndjson"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			return rr.Code, nil
+		}
+		var ids []string
+		for _, line := range strings.Split(strings.TrimSpace(rr.Body.String()), "\n") {
+			feature, err := geojson.UnmarshalFeature([]byte(line))
+			if err != nil {
+				t.Fatalf("Stream line %q is not a GeoJSON feature: %v", line, err)
+			}
+			ids = append(ids, feature.ID.(string))
+		}
+		return rr.Code, ids
+	}
+
+	// Строки шардов пересылаются по мере поступления, без потерь и склеек
+	_, ids := stream("")
+	if len(ids) != 300 || len(idSet(ids)) != 300 {
+		t.Errorf("Router stream returned %d lines (%d unique), expected 300", len(ids), len(idSet(ids)))
+	}
+	if _, ids := stream("&limit=7"); len(ids) != 7 {
+		t.Errorf("Router stream with limit returned %d lines, expected 7", len(ids))
+	}
+
+	// Недоступный шард обнаруживается до начала выдачи
+	broken := http.NewServeMux()
+	NewRouter(broken, [][]string{{"storage1"}, {"storage2"}})
+	req, err := http.NewRequest("GET", "/select?rect=-180,-90,180,90&format=ndjson", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	broken.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("Router stream with unavailable shard returned %d, expected %d", rr.Code, http.StatusBadGateway)
+	}
+}
+
+func TestRouterSelectPagination(t *testing.T) {
+	mux := http.NewServeMux()
+	NewRouter(mux, [][]string{{"storage1"}, {"storage2"}})
+	for _, name := range []string{"storage1", "storage2"} {
+		s, err := NewStorage(mux, t.TempDir(), name, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Run()
+		defer s.Stop()
+	}
+	for i := 0; i < 17; i++ {
+		insertFeature(t, mux, fmt.Sprintf("storage%d", i%2+1), newTestFeature(fmt.Sprintf("f%02d", i), float64(i), 0))
+	}
+
+	ids := selectAllPages(t, mux, "", 5)
+	if len(ids) != 17 {
+		t.Fatalf("Router pagination returned %d features, expected 17", len(ids))
+	}
+	for i, id := range ids {
+		if id != fmt.Sprintf("f%02d", i) {
+			t.Fatalf("Router pagination returned %s at position %d", id, i)
+		}
+	}
+}
+
+func TestSelectGeneralizationHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	s, err := NewStorage(mux, t.TempDir(), "storage1", nil, true, WithGeneralizationCache(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	large := geojson.NewFeature(circlePolygon(orb.Point{0, 0}, 5, 500))
+	large.ID = "large"
+	insertFeature(t, mux, "storage1", large)
+	small := geojson.NewFeature(circlePolygon(orb.Point{20, 20}, 0.01, 50))
+	small.ID = "small"
+	insertFeature(t, mux, "storage1", small)
+
+	selectGeometries := func(query string) map[string]orb.Geometry {
+		t.Helper()
+		if !strings.Contains(query, "rect=") {
+			query += "&rect=-180,-90,180,90"
+		}
+		req, err := http.NewRequest("GET", "/storage1/select?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Select %s returned wrong status code: got %v want %v", query, rr.Code, http.StatusOK)
+		}
+		geometries := make(map[string]orb.Geometry)
+		for _, line := range strings.Split(strings.TrimSpace(rr.Body.String()), "\n") {
+			if strings.Contains(query, "ndjson") {
+				feature, err := geojson.UnmarshalFeature([]byte(line))
+				if err != nil {
+					t.Fatal(err)
+				}
+				geometries[feature.ID.(string)] = feature.Geometry
+				continue
+			}
+			fc, err := geojson.UnmarshalFeatureCollection([]byte(line))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, feature := range fc.Features {
+				geometries[feature.ID.(string)] = feature.Geometry
+			}
+		}
+		return geometries
+	}
+
+	full := selectGeometries("")
+	if len(full["large"].(orb.Polygon)[0]) != 501 {
+		t.Fatal("Select without zoom must return full-resolution geometry")
+	}
+	for _, query := range []string{"&zoom=3", "&zoom=3", "&zoom=3&format=ndjson", "&resolution=20000&proj=EPSG:3857&rect=-2e7,-2e7,2e7,2e7"} {
+		geometries := selectGeometries(query)
+		polygon, ok := geometries["large"].(orb.Polygon)
+		if !ok || len(polygon[0]) >= 501 || len(polygon[0]) < 4 {
+			t.Errorf("Select %s returned large feature %v, expected simplified polygon", query, geometries["large"])
+		}
+		if _, ok := geometries["small"].(orb.Point); !ok {
+			t.Errorf("Select %s returned small feature %T, expected point", query, geometries["small"])
+		}
+	}
+	if _, ok := selectGeometries("&zoom=3&small=drop")["small"]; ok {
+		t.Error("Select with small=drop returned small feature")
+	}
+
+	// Отброшенные объекты не укорачивают страницу: она дополняется объектами следующих страниц
+	for i := 0; i < 5; i++ {
+		tiny := geojson.NewFeature(circlePolygon(orb.Point{float64(-20 - i), 20}, 0.01, 50))
+		tiny.ID = fmt.Sprintf("a%d", i)
+		insertFeature(t, mux, "storage1", tiny)
+	}
+	req, err := http.NewRequest("GET", "/storage1/select?rect=-180,-90,180,90&zoom=3&small=drop&limit=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	fc, err := geojson.UnmarshalFeatureCollection(rr.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fc.Features) != 1 || fc.Features[0].ID != "large" || fc.ExtraMembers["next"] != nil {
+		t.Errorf("Select page with small=drop returned %d features and cursor %v, expected only large and no cursor", len(fc.Features), fc.ExtraMembers["next"])
+	}
+	// Генерализация не должна изменять хранимые объекты
+	if len(selectGeometries("")["large"].(orb.Polygon)[0]) != 501 {
+		t.Error("Generalization modified stored geometry")
+	}
+}
+
+func TestSelectClusterHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	NewRouter(mux, [][]string{{"storage1"}, {"storage2"}})
+	for _, name := range []string{"storage1", "storage2"} {
+		s, err := NewStorage(mux, t.TempDir(), name, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Run()
+		defer s.Stop()
+	}
+	for i := 0; i < 100; i++ {
+		name := []string{"storage1", "storage2"}[i%2]
+		insertFeature(t, mux, name, newTestFeature(fmt.Sprint(i), 10+float64(i)*0.0005, 10+float64(i%10)*0.005))
+	}
+	insertFeature(t, mux, "storage1", newTestFeature("lone", -60, -30))
+	area := geojson.NewFeature(orb.Polygon{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}})
+	area.ID = "area"
+	insertFeature(t, mux, "storage2", area)
+
+	queryClusters := func(url string) []*geojson.Feature {
+		t.Helper()
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Select %s returned wrong status code: got %v want %v", url, rr.Code, http.StatusOK)
+		}
+		fc, err := geojson.UnmarshalFeatureCollection(rr.Body.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fc.Features
+	}
+
+	features := queryClusters("/storage1/select?rect=-180,-90,180,90&zoom=5&cluster=grid")
+	if total, clusters := clusterCounts(features); total != 51 || clusters != 1 || len(features) != 2 {
+		t.Errorf("Shard clustering returned %d points in %d clusters (%d features)", total, clusters, len(features))
+	}
+	for _, url := range []string{
+		"/select?rect=-180,-90,180,90&zoom=5&cluster=grid",
+		"/select?rect=-180,-90,180,90&zoom=5&cluster=distance",
+		"/select?rect=-2e7,-2e7,2e7,2e7&proj=EPSG:3857&zoom=5&cluster=grid",
+		"/select?rect=-2e7,-2e7,2e7,2e7&proj=EPSG:3857&zoom=5&cluster=distance",
+	} {
+		features := queryClusters(url)
+		if total, clusters := clusterCounts(features); total != 101 || clusters != 1 || len(features) != 3 {
+			t.Errorf("Router %s returned %d points in %d clusters (%d features)", url, total, clusters, len(features))
+		}
+		ids := make(map[interface{}]bool)
+		for _, feature := range features {
+			ids[feature.ID] = true
+		}
+		if !ids["lone"] || !ids["area"] {
+			t.Errorf("Router %s lost unclustered features: %v", url, ids)
+		}
+	}
+
+	req, err := http.NewRequest("GET", "/select?rect=-180,-90,180,90&cluster=grid", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Select cluster without zoom returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// Функция для запроса aggregate и разбора ответа
+func queryAggregate(t *testing.T, mux *http.ServeMux, method, url string, body []byte) Aggregate {
+	t.Helper()
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Aggregate %s returned wrong status code: got %v want %v", url, rr.Code, http.StatusOK)
+	}
+	var result Aggregate
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestAggregateHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	NewRouter(mux, [][]string{{"storage1"}, {"storage2"}})
+	for _, name := range []string{"storage1", "storage2"} {
+		s, err := NewStorage(mux, t.TempDir(), name, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Run()
+		defer s.Stop()
+	}
+	categories := []string{"cafe", "bar", "shop"}
+	for i := 0; i < 30; i++ {
+		feature := newTestFeature(fmt.Sprint(i), float64(i%10), float64(i/10))
+		feature.Properties["category"] = categories[i%3]
+		insertFeature(t, mux, []string{"storage1", "storage2"}[i%2], feature)
+	}
+
+	shard := queryAggregate(t, mux, "GET", "/storage1/aggregate?rect=-1,-1,10,10&groupBy=category", nil)
+	if shard.Count != 15 || shard.Histogram != nil {
+		t.Errorf("Shard aggregate = %+v, expected 15 features without histogram", shard)
+	}
+
+	result := queryAggregate(t, mux, "GET", "/aggregate?rect=-1,-1,10,10&groupBy=category&grid=11", nil)
+	if result.Count != 30 {
+		t.Errorf("Router aggregate count = %d, expected 30", result.Count)
+	}
+	if !reflect.DeepEqual(result.Groups, map[string]int{"cafe": 10, "bar": 10, "shop": 10}) {
+		t.Errorf("Router aggregate groups = %v", result.Groups)
+	}
+	if !reflect.DeepEqual(result.Extent, geojson.BBox{0, 0, 9, 2}) {
+		t.Errorf("Router aggregate extent = %v, expected [0 0 9 2]", result.Extent)
+	}
+	// Ячейки сетки 11×11 шириной 1 градус: каждая точка в своей ячейке
+	if result.Histogram == nil || result.Histogram.Counts[1*11+1] != 1 || result.Histogram.Counts[5*11+5] != 0 {
+		t.Errorf("Router aggregate histogram = %+v", result.Histogram)
+	}
+
+	filtered := queryAggregate(t, mux, "GET", "/aggregate?rect=-1,-1,10,10&filter=category%3Dcafe&groupBy=category", nil)
+	if filtered.Count != 10 || len(filtered.Groups) != 1 {
+		t.Errorf("Filtered aggregate = %+v", filtered)
+	}
+
+	area, err := json.Marshal(geojson.NewGeometry(orb.Polygon{{{-0.5, -0.5}, {4.5, -0.5}, {4.5, 0.5}, {-0.5, 0.5}, {-0.5, -0.5}}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	posted := queryAggregate(t, mux, "POST", "/aggregate?predicate=intersects", area)
+	if posted.Count != 5 || posted.Groups != nil {
+		t.Errorf("Aggregate over polygon = %+v, expected 5 features without groups", posted)
+	}
+
+	empty := queryAggregate(t, mux, "GET", "/aggregate?rect=50,50,60,60&proj=EPSG:3857", nil)
+	if empty.Count != 0 || empty.Extent != nil {
+		t.Errorf("Empty aggregate = %+v", empty)
+	}
+
+	req, err := http.NewRequest("GET", "/aggregate?rect=-1,-1,10,10&grid=0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Aggregate with invalid grid returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// Функция для запроса тайла и разбора слоя features
+func queryTile(t *testing.T, mux *http.ServeMux, url string) []*geojson.Feature {
+	t.Helper()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Tile %s returned wrong status code: got %v want %v: %s", url, rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != mvtContentType {
+		t.Errorf("Tile %s returned Content-Type %s", url, ct)
+	}
+	layers, err := mvt.Unmarshal(rr.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, layer := range layers {
+		if layer.Name == tileLayer {
+			return layer.Features
+		}
+	}
+	return nil
+}
+
+func TestTileHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	s, err := NewStorage(mux, t.TempDir(), "storage1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	square := geojson.NewFeature(orb.Polygon{{{30, 59}, {31, 59}, {31, 60}, {30, 60}, {30, 59}}})
+	square.ID = "square"
+	square.Properties["category"] = "park"
+	insertFeature(t, mux, "storage1", square)
+	insertFeature(t, mux, "storage1", newTestFeature("point", -70, -30))
+
+	features := queryTile(t, mux, "/storage1/tiles/0/0/0.mvt")
+	if len(features) != 2 {
+		t.Fatalf("Tile 0/0/0 returned %d features, expected 2", len(features))
+	}
+	// Тайл 1/1/0 — северо-восточная четверть мира, точка в южном полушарии в него не попадает
+	features = queryTile(t, mux, "/storage1/tiles/1/1/0.mvt")
+	if len(features) != 1 || features[0].Properties["id"] != "square" || features[0].Properties["category"] != "park" {
+		t.Fatalf("Tile 1/1/0 returned %v, expected only the square with its properties", features)
+	}
+	queryTile(t, mux, "/storage1/tiles/0/0/0.mvt?filter=category%3Dpark")
+
+	// Проецирование в тайл не должно менять объекты хранилища
+	req, err := http.NewRequest("GET", "/storage1/feature/square", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	stored, err := geojson.UnmarshalFeature(rr.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.Geometry.Bound().Equal(square.Geometry.Bound()) {
+		t.Errorf("Stored geometry changed after tile encoding: %v", stored.Geometry.Bound())
+	}
+
+	for _, url := range []string{"/storage1/tiles/1/2/0.mvt", "/storage1/tiles/25/0/0.mvt", "/storage1/tiles/a/0/0.mvt"} {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Tile %s returned wrong status code: got %v want %v", url, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestRouterTile(t *testing.T) {
+	mux := http.NewServeMux()
+	NewRouter(mux, [][]string{{"storage1"}, {"storage2"}})
+	for i, name := range []string{"storage1", "storage2"} {
+		s, err := NewStorage(mux, t.TempDir(), name, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Run()
+		defer s.Stop()
+		insertFeature(t, mux, name, newTestFeature(name, float64(10*i), 10))
+	}
+
+	features := queryTile(t, mux, "/tiles/0/0/0.mvt")
+	if len(features) != 2 {
+		t.Errorf("Router tile returned %d features, expected one from each shard", len(features))
+	}
+}
+
+func TestRouterShardBounds(t *testing.T) {
+	// Второй шард недоступен: запросы, которые до него доходят, завершаются ошибкой
+	mux := http.NewServeMux()
+	west := orb.Bound{Min: orb.Point{-180, -90}, Max: orb.Point{0, 90}}
+	east := orb.Bound{Min: orb.Point{10, -90}, Max: orb.Point{180, 90}}
+	NewRouter(mux, [][]string{{"storage1"}, {"storage2"}}, WithShardBounds(west, east))
+	s, err := NewStorage(mux, t.TempDir(), "storage1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+	insertFeature(t, mux, "storage1", newTestFeature("a", -100, 40))
+
+	if features := queryTile(t, mux, "/tiles/1/0/0.mvt"); len(features) != 1 {
+		t.Errorf("Router tile returned %d features, expected one from the western shard", len(features))
+	}
+	for _, url := range []string{"/select?rect=-120,30,-90,50", "/select?rect=-120,30,-90,50&format=ndjson", "/aggregate?rect=-120,30,-90,50"} {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s returned %d, expected the eastern shard to be skipped", url, rr.Code)
+		}
+	}
+	// Область между шардами: ответ той же формы, что и у шарда без объектов
+	req, err := http.NewRequest("GET", "/aggregate?rect=2,0,8,10&groupBy=category&grid=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(rr.Body.Bytes(), &raw); err != nil {
+		t.Fatalf("Aggregate without shards returned %d: %s", rr.Code, rr.Body.String())
+	}
+	if string(raw["groups"]) != "{}" {
+		t.Errorf("Aggregate without shards returned groups %s, expected {}", raw["groups"])
+	}
+	empty := queryAggregate(t, mux, "GET", "/aggregate?rect=2,0,8,10&groupBy=category&grid=2", nil)
+	if empty.Count != 0 || empty.Histogram == nil || !reflect.DeepEqual(empty.Histogram.Counts, []int{0, 0, 0, 0}) {
+		t.Errorf("Aggregate without shards returned %+v, expected an empty 2x2 histogram", empty)
+	}
+
+	for _, url := range []string{"/tiles/1/1/0.mvt", "/select?rect=-120,30,20,50"} {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadGateway {
+			t.Errorf("%s returned %d, expected a request to the eastern shard", url, rr.Code)
+		}
+	}
+}
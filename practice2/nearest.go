@@ -0,0 +1,243 @@
+package practice2
+
+import (
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/planar"
+)
+
+// Количество соседей по умолчанию и максимальное количество за один запрос
+const (
+	defaultNearestK = 10
+	maxNearestK     = 1000
+)
+
+// Metric задаёт способ измерения расстояния для поиска ближайших объектов
+type Metric struct {
+	Name string
+	// Расстояние между точками и от точки до отрезка [a, b]
+	pointDistance   func(a, b orb.Point) float64
+	segmentDistance func(a, b, p orb.Point) float64
+	// Нижняя оценка расстояния от точки до прямоугольника: по ней rtree выбирает порядок обхода узлов
+	boxDistance func(p orb.Point, min, max [2]float64) float64
+}
+
+// PlanarMetric — евклидово расстояние в координатах хранилища (градусах)
+var PlanarMetric = &Metric{
+	Name:            "planar",
+	pointDistance:   planar.Distance,
+	segmentDistance: planar.DistanceFromSegment,
+	boxDistance: func(p orb.Point, min, max [2]float64) float64 {
+		dx := math.Max(math.Max(min[0]-p[0], p[0]-max[0]), 0)
+		dy := math.Max(math.Max(min[1]-p[1], p[1]-max[1]), 0)
+		return math.Hypot(dx, dy)
+	},
+}
+
+// HaversineMetric — расстояние по большому кругу в метрах, учитывает антимеридиан и полюса
+var HaversineMetric = &Metric{
+	Name:            "haversine",
+	pointDistance:   geo.DistanceHaversine,
+	segmentDistance: haversineSegmentDistance,
+	boxDistance:     haversineBoxDistance,
+}
+
+// Функция для выбора метрики по параметру metric, по умолчанию расстояние в метрах
+func parseMetric(name string) (*Metric, error) {
+	switch name {
+	case "", "haversine":
+		return HaversineMetric, nil
+	case "planar":
+		return PlanarMetric, nil
+	}
+	return nil, errors.New("неизвестная метрика: " + name)
+}
+
+// Distance возвращает расстояние от точки до геометрии; для точки внутри полигона оно равно нулю
+func (m *Metric) Distance(g orb.Geometry, pt orb.Point) float64 {
+	p := decompose(g)
+	if p.areal() && p.locate(pt) != exterior {
+		return 0
+	}
+	dist := math.Inf(1)
+	for _, point := range p.points {
+		dist = math.Min(dist, m.pointDistance(point, pt))
+	}
+	for _, s := range p.segments {
+		dist = math.Min(dist, m.segmentDistance(s[0], s[1], pt))
+	}
+	return dist
+}
+
+// Функция для разбора параметров nearest: lon, lat, k, maxDistance (0 — без ограничения), metric
+func parseNearest(query url.Values) (point orb.Point, k int, maxDistance float64, err error) {
+	point, err = parsePoint(query)
+	if err != nil {
+		return point, 0, 0, err
+	}
+	k, err = parseK(query)
+	if err != nil {
+		return point, 0, 0, err
+	}
+	if raw := query.Get("maxDistance"); raw != "" {
+		maxDistance, err = strconv.ParseFloat(raw, 64)
+		if err != nil || maxDistance < 0 || math.IsNaN(maxDistance) {
+			return point, 0, 0, errors.New("Invalid maxDistance parameter")
+		}
+	}
+	return point, k, maxDistance, nil
+}
+
+// Функция для разбора точки запроса из параметров lon и lat
+func parsePoint(query url.Values) (point orb.Point, err error) {
+	for i, name := range []string{"lon", "lat"} {
+		point[i], err = strconv.ParseFloat(query.Get(name), 64)
+		if err != nil || math.IsNaN(point[i]) || math.IsInf(point[i], 0) {
+			return point, errors.New("Invalid " + name + " parameter")
+		}
+	}
+	return point, nil
+}
+
+// Функция для разбора параметров поиска в радиусе: lon, lat и radius в метрах
+func parseRadius(query url.Values) (point orb.Point, radius float64, err error) {
+	point, err = parsePoint(query)
+	if err != nil {
+		return point, 0, err
+	}
+	radius, err = strconv.ParseFloat(query.Get("radius"), 64)
+	if err != nil || radius <= 0 || math.IsNaN(radius) || math.IsInf(radius, 0) {
+		return point, 0, errors.New("Invalid radius parameter")
+	}
+	return point, radius, nil
+}
+
+// Функция для разбора количества соседей k; Router использует её для отбора общего top-k
+func parseK(query url.Values) (int, error) {
+	raw := query.Get("k")
+	if raw == "" {
+		return defaultNearestK, nil
+	}
+	k, err := strconv.Atoi(raw)
+	if err != nil || k < 1 || k > maxNearestK {
+		return 0, errors.New("Invalid k parameter")
+	}
+	return k, nil
+}
+
+// Угловое расстояние между точками в радианах
+func angularDistance(a, b orb.Point) float64 {
+	return geo.DistanceHaversine(a, b) / orb.EarthRadius
+}
+
+// Начальный азимут из a в b в радианах
+func initialBearing(a, b orb.Point) float64 {
+	lat1, lat2 := deg2rad(a[1]), deg2rad(b[1])
+	dLon := deg2rad(b[0] - a[0])
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Atan2(y, x)
+}
+
+func deg2rad(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+// Расстояние от точки до дуги большого круга [a, b] в метрах
+func haversineSegmentDistance(a, b, p orb.Point) float64 {
+	dist := math.Min(geo.DistanceHaversine(a, p), geo.DistanceHaversine(b, p))
+	if a.Equal(b) {
+		return dist
+	}
+	d13 := angularDistance(a, p)
+	delta := initialBearing(a, p) - initialBearing(a, b)
+	if math.Cos(delta) <= 0 {
+		// Проекция точки на большой круг лежит до начала дуги
+		return dist
+	}
+	crossTrack := math.Asin(math.Sin(d13) * math.Sin(delta))
+	alongTrack := math.Acos(math.Max(-1, math.Min(1, math.Cos(d13)/math.Cos(crossTrack))))
+	if alongTrack > angularDistance(a, b) {
+		return dist
+	}
+	return math.Min(dist, math.Abs(crossTrack)*orb.EarthRadius)
+}
+
+// Разница долгот в градусах по кратчайшему пути, с переходом через антимеридиан
+func lonDelta(a, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), 360)
+	if d > 180 {
+		d = 360 - d
+	}
+	return d
+}
+
+// Нижняя оценка расстояния в метрах от точки до геометрий в прямоугольнике долготы/широты.
+// Рёбра геометрий — дуги большого круга, которые у полюсов выгибаются за широты своих вершин,
+// поэтому прямоугольник сначала расширяется к полюсу на величину такого выгиба. Для расширенного
+// прямоугольника расстояние точное: если точка в полосе его долгот, ближайшая точка лежит на том же
+// меридиане, иначе — на одном из меридианных краёв, с учётом расстояния по перпендикуляру до него.
+func haversineBoxDistance(p orb.Point, min, max [2]float64) float64 {
+	lon, lat := p[0], p[1]
+	span := max[0] - min[0]
+	min[1], max[1] = arcLatitudes(min[1], max[1], span)
+	// Дуга между вершинами, разнесёнными больше чем на 180° долготы, идёт через антимеридиан,
+	// то есть вне прямоугольника по долготе
+	inLon := span > 180
+	for _, shift := range []float64{-360, 0, 360} {
+		if lon+shift >= min[0] && lon+shift <= max[0] {
+			inLon = true
+		}
+	}
+	if inLon {
+		// Ближайшая точка лежит на том же меридиане
+		nearest := math.Max(min[1], math.Min(max[1], lat))
+		return deg2rad(math.Abs(lat-nearest)) * orb.EarthRadius
+	}
+	return math.Min(meridianDistance(p, min[0], min[1], max[1]), meridianDistance(p, max[0], min[1], max[1]))
+}
+
+// Функция для расширения диапазона широт [minLat, maxLat] так, чтобы он покрывал дуги большого круга
+// между любыми точками прямоугольника шириной span градусов долготы. Дуга достигает наибольшей
+// широты в вершине, и для концов на широте φ, разнесённых на span, tg φв = tg φ / cos(span/2);
+// к экватору дуги не выгибаются.
+func arcLatitudes(minLat, maxLat, span float64) (float64, float64) {
+	bulge := func(lat float64) float64 {
+		if span >= 180 {
+			return math.Copysign(90, lat)
+		}
+		return math.Atan(math.Tan(deg2rad(lat))/math.Cos(deg2rad(span/2))) * 180 / math.Pi
+	}
+	if maxLat > 0 {
+		maxLat = bulge(maxLat)
+	}
+	if minLat < 0 {
+		minLat = bulge(minLat)
+	}
+	return minLat, maxLat
+}
+
+// Расстояние в метрах от точки до отрезка меридиана lon между широтами minLat и maxLat
+func meridianDistance(p orb.Point, lon, minLat, maxLat float64) float64 {
+	ends := math.Min(
+		geo.DistanceHaversine(p, orb.Point{lon, minLat}),
+		geo.DistanceHaversine(p, orb.Point{lon, maxLat}),
+	)
+	delta := deg2rad(lonDelta(p[0], lon))
+	if delta >= math.Pi/2 {
+		// Меридиан на другой стороне Земли: расстояние монотонно по широте, ближайший — один из концов
+		return ends
+	}
+	lat := deg2rad(p[1])
+	// Широта ближайшей к точке точки большого круга меридиана
+	nearest := math.Atan2(math.Sin(lat), math.Cos(lat)*math.Cos(delta)) * 180 / math.Pi
+	if nearest < minLat || nearest > maxLat {
+		return ends
+	}
+	return math.Asin(math.Min(1, math.Cos(lat)*math.Sin(delta))) * orb.EarthRadius
+}
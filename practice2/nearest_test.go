@@ -0,0 +1,79 @@
+package practice2
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+)
+
+func TestHaversineBoxDistance(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		p := orb.Point{rng.Float64()*360 - 180, rng.Float64()*180 - 90}
+		minLon, minLat := rng.Float64()*340-180, rng.Float64()*170-90
+		min := [2]float64{minLon, minLat}
+		max := [2]float64{minLon + rng.Float64()*20, minLat + rng.Float64()*10}
+
+		// Перебор точек прямоугольника, расширенного на выгиб дуг, по сетке даёт верхнюю оценку истинного расстояния
+		minLat, maxLat := arcLatitudes(min[1], max[1], max[0]-min[0])
+		brute := math.Inf(1)
+		for x := 0; x <= 100; x++ {
+			for y := 0; y <= 100; y++ {
+				q := orb.Point{min[0] + (max[0]-min[0])*float64(x)/100, minLat + (maxLat-minLat)*float64(y)/100}
+				brute = math.Min(brute, geo.DistanceHaversine(p, q))
+			}
+		}
+		got := haversineBoxDistance(p, min, max)
+		if got > brute+1e-6 || brute-got > 2000 {
+			t.Fatalf("Box distance from %v to %v-%v is %f, brute force %f", p, min, max, got, brute)
+		}
+	}
+
+	// Через антимеридиан и у полюса
+	if d := haversineBoxDistance(orb.Point{179.9, 0}, [2]float64{-180, -1}, [2]float64{-179.9, 1}); d > 12000 {
+		t.Errorf("Distance across the antimeridian is %f, expected about 11 km", d)
+	}
+	if d := haversineBoxDistance(orb.Point{0, 89.9}, [2]float64{179, 89}, [2]float64{180, 89.95}); d > 17000 {
+		t.Errorf("Distance across the pole is %f, expected about 16.7 km", d)
+	}
+}
+
+func TestHaversineBoxDistanceHighLatitude(t *testing.T) {
+	// Дуга большого круга между точками на 80° широты проходит у полюса гораздо выше 80°
+	a, b, p := orb.Point{-60, 80}, orb.Point{60, 80}, orb.Point{0, 89}
+	bound := orb.LineString{a, b}.Bound()
+	if box, arc := haversineBoxDistance(p, bound.Min, bound.Max), haversineSegmentDistance(a, b, p); box > arc {
+		t.Errorf("Box distance %f is above the distance to the arc %f", box, arc)
+	}
+
+	// Расстояние до прямоугольника не больше расстояния до любой дуги между его точками
+	rng := rand.New(rand.NewSource(3))
+	for i := 0; i < 2000; i++ {
+		lat := func() float64 { return math.Copysign(60+rng.Float64()*30, rng.Float64()-0.5) }
+		a := orb.Point{rng.Float64()*340 - 180, lat()}
+		b := orb.Point{a[0] + rng.Float64()*170, math.Copysign(rng.Float64()*90, a[1])}
+		p := orb.Point{rng.Float64()*360 - 180, lat()}
+		bound := orb.LineString{a, b}.Bound()
+		if box, arc := haversineBoxDistance(p, bound.Min, bound.Max), haversineSegmentDistance(a, b, p); box > arc+1e-6 {
+			t.Fatalf("Box distance from %v to arc %v-%v is %f, above the distance to the arc %f", p, a, b, box, arc)
+		}
+	}
+}
+
+func TestMetricDistance(t *testing.T) {
+	square := orb.Polygon{{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}}}
+	if d := HaversineMetric.Distance(square, orb.Point{0.5, 0.5}); d != 0 {
+		t.Errorf("Distance to a point inside polygon is %f, expected 0", d)
+	}
+	// До стороны полигона ближе, чем до его вершин
+	expected := geo.DistanceHaversine(orb.Point{0.5, 0}, orb.Point{0.5, -1})
+	if d := HaversineMetric.Distance(square, orb.Point{0.5, -1}); math.Abs(d-expected) > 10 {
+		t.Errorf("Distance to polygon edge is %f, expected %f", d, expected)
+	}
+	if d := PlanarMetric.Distance(orb.LineString{{0, 0}, {2, 0}}, orb.Point{1, 1}); d != 1 {
+		t.Errorf("Planar distance to line is %f, expected 1", d)
+	}
+}
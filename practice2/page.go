@@ -0,0 +1,149 @@
+package practice2
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// Максимальный размер страницы select и частота сброса буфера при потоковой выдаче
+const (
+	maxPageLimit     = 10000
+	streamFlushEvery = 256
+)
+
+// Page — параметры постраничной выдачи select: limit объектов с ID больше After.
+// Страницы упорядочены по ID объекта, поэтому порядок стабилен между запросами.
+type Page struct {
+	Limit int
+	After string
+	// Потоковая выдача объектов по одному в строке (application/x-ndjson)
+	Stream bool
+}
+
+// Функция для разбора параметров limit, cursor и format=ndjson
+func parsePage(query url.Values) (Page, error) {
+	var page Page
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return page, errors.New("Invalid limit parameter")
+		}
+		page.Limit = limit
+	}
+	if raw := query.Get("cursor"); raw != "" {
+		after, err := decodeCursor(raw)
+		if err != nil {
+			return page, err
+		}
+		if page.Limit == 0 {
+			return page, errors.New("cursor используется только вместе с limit")
+		}
+		page.After = after
+	}
+	switch query.Get("format") {
+	case "", "geojson":
+	case "ndjson":
+		page.Stream = true
+	default:
+		return page, errors.New("неизвестный формат: " + query.Get("format"))
+	}
+	if page.Stream && page.After != "" {
+		return page, errors.New("потоковая выдача не поддерживает cursor")
+	}
+	return page, nil
+}
+
+// Курсор — ID последнего объекта страницы; кодируется, чтобы клиенты не полагались на его формат
+func encodeCursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	id, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", errors.New("Invalid cursor parameter")
+	}
+	return string(id), nil
+}
+
+// pageCollector отбирает первые limit объектов по ID, храня в памяти не больше 2*(limit+1) объектов
+type pageCollector struct {
+	page     Page
+	features []*geojson.Feature
+}
+
+func (pc *pageCollector) add(feature *geojson.Feature) {
+	id, _ := feature.ID.(string)
+	if pc.page.After != "" && id <= pc.page.After {
+		return
+	}
+	pc.features = append(pc.features, feature)
+	if len(pc.features) >= 2*(pc.page.Limit+1) {
+		pc.truncate()
+	}
+}
+
+// truncate оставляет limit+1 первых объектов: лишний объект показывает, что есть следующая страница
+func (pc *pageCollector) truncate() {
+	sort.Slice(pc.features, func(i, j int) bool {
+		return pc.features[i].ID.(string) < pc.features[j].ID.(string)
+	})
+	if len(pc.features) > pc.page.Limit+1 {
+		pc.features = pc.features[:pc.page.Limit+1]
+	}
+}
+
+// result возвращает страницу и курсор следующей страницы (пустой для последней)
+func (pc *pageCollector) result() ([]*geojson.Feature, string) {
+	pc.truncate()
+	if len(pc.features) <= pc.page.Limit {
+		return pc.features, ""
+	}
+	features := pc.features[:pc.page.Limit]
+	return features, encodeCursor(features[len(features)-1].ID.(string))
+}
+
+// streamFeatures обходит кандидатов из result и пишет подходящие объекты в ответ по мере обхода.
+// Кандидаты — объекты, отобранные вторичным индексом, либо копия rtree. Копия rtree создаётся Engine
+// без копирования данных (copy-on-write), а список кандидатов — новый срез, поэтому обход
+// не блокирует Engine, а последующие записи не влияют на уже начатую выдачу.
+// generalize возвращает выдаваемую копию объекта или nil, если объект пропускается.
+func streamFeatures(w http.ResponseWriter, result SearchResult, cmd Command, proj *Projection, limit int, generalize func(*geojson.Feature) *geojson.Feature) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	written := 0
+	emit := func(feature *geojson.Feature) bool {
+		if !cmd.filter.Match(feature.Properties) {
+			return true
+		}
+		if cmd.predicate != nil && !cmd.predicate(feature.Geometry, cmd.area) {
+			return true
+		}
+		if feature = generalize(feature); feature == nil {
+			return true
+		}
+		// Ошибка записи означает, что клиент отключился
+		if err := enc.Encode(proj.featuresFromNative([]*geojson.Feature{feature})[0]); err != nil {
+			return false
+		}
+		written++
+		if flusher != nil && written%streamFlushEvery == 0 {
+			flusher.Flush()
+		}
+		return limit == 0 || written < limit
+	}
+	if result.Tree == nil {
+		// Кандидаты из вторичного индекса проверяются на пересечение с прямоугольниками запроса, как в Engine.scan
+		searchCandidates(result.Features, cmd.boxes, emit)
+		return
+	}
+	searchBoxes(result.Tree, cmd.boxes, emit)
+}
@@ -0,0 +1,539 @@
+package practice2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/planar"
+)
+
+// Наибольшее число вершин области поиска из тела POST: предикаты сравнивают отрезки попарно,
+// поэтому размер области ограничивает время проверки одного кандидата
+const maxAreaVertices = 10000
+
+// Predicate — пространственный предикат между геометрией объекта и областью запроса.
+// Область разбирается decompose один раз на команду, геометрия объекта — при каждой проверке.
+type Predicate func(feature orb.Geometry, area *parts) bool
+
+// Функция для выбора предиката по параметру predicate запроса.
+// bbox сохраняет прежнее поведение: совпадение только по bounding box из rtree.
+func parsePredicate(name string) (Predicate, error) {
+	switch name {
+	case "", "intersects":
+		return Intersects, nil
+	case "within":
+		return Within, nil
+	case "contains":
+		return Contains, nil
+	case "touches":
+		return Touches, nil
+	case "bbox":
+		return nil, nil
+	}
+	return nil, errors.New("неизвестный предикат: " + name)
+}
+
+// Функция для разбора области запроса select и aggregate в системе координат хранилища:
+// прямоугольник из параметров GET либо произвольная геометрия в теле POST. Вместе с областью
+// возвращается её охват; у прямоугольника, пересекающего линию перемены дат, восточная граница
+// охвата больше 180°, а область состоит из двух частей по обе стороны от неё.
+func parseRequestArea(r *http.Request, proj *Projection) (orb.Geometry, orb.Bound, error) {
+	if r.Method == http.MethodPost {
+		geometry, err := parseArea(r.Body)
+		if err != nil {
+			return nil, orb.Bound{}, err
+		}
+		area := proj.geometryToNative(geometry)
+		return area, area.Bound(), nil
+	}
+	min, max, err := parseRect(r.URL.Query())
+	if err != nil {
+		return nil, orb.Bound{}, err
+	}
+	// Переводим прямоугольник запроса в систему координат хранилища
+	bound := proj.rectToNative(min, max)
+	if boxes := splitAntimeridian(bound); len(boxes) > 1 {
+		return orb.Collection{boxes[0], boxes[1]}, bound, nil
+	}
+	return bound, bound, nil
+}
+
+// Функция для разбора области поиска из тела POST запроса: GeoJSON геометрия либо Feature,
+// как её отдаёт инструмент рисования на карте
+func parseArea(body io.Reader) (orb.Geometry, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	var object struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+
+	var area orb.Geometry
+	switch object.Type {
+	case "Feature":
+		feature, err := geojson.UnmarshalFeature(data)
+		if err != nil {
+			return nil, err
+		}
+		area = feature.Geometry
+	case "FeatureCollection":
+		return nil, errors.New("область поиска должна быть одной геометрией, а не коллекцией объектов")
+	default:
+		geometry, err := geojson.UnmarshalGeometry(data)
+		if err != nil {
+			return nil, err
+		}
+		area = geometry.Geometry()
+	}
+	if area == nil {
+		return nil, errors.New("не задана геометрия области поиска")
+	}
+	if vertexCount(area) > maxAreaVertices {
+		return nil, fmt.Errorf("область поиска содержит больше %d вершин", maxAreaVertices)
+	}
+	return area, nil
+}
+
+func vertexCount(g orb.Geometry) int {
+	switch g := g.(type) {
+	case orb.Point:
+		return 1
+	case orb.MultiPoint:
+		return len(g)
+	case orb.LineString:
+		return len(g)
+	case orb.Ring:
+		return len(g)
+	case orb.MultiLineString:
+		n := 0
+		for _, ls := range g {
+			n += len(ls)
+		}
+		return n
+	case orb.Polygon:
+		n := 0
+		for _, ring := range g {
+			n += len(ring)
+		}
+		return n
+	case orb.MultiPolygon:
+		n := 0
+		for _, polygon := range g {
+			n += vertexCount(polygon)
+		}
+		return n
+	case orb.Collection:
+		n := 0
+		for _, child := range g {
+			n += vertexCount(child)
+		}
+		return n
+	case orb.Bound:
+		return 4
+	}
+	return 0
+}
+
+// Intersects — у объекта и области есть хотя бы одна общая точка
+func Intersects(feature orb.Geometry, area *parts) bool {
+	return intersects(decompose(feature), area)
+}
+
+// Within — все точки объекта лежат в области и их внутренности пересекаются
+func Within(feature orb.Geometry, area *parts) bool {
+	return contains(area, decompose(feature))
+}
+
+// Contains — все точки области лежат в объекте и их внутренности пересекаются
+func Contains(feature orb.Geometry, area *parts) bool {
+	return contains(decompose(feature), area)
+}
+
+// Touches — объект и область пересекаются только по границе
+func Touches(feature orb.Geometry, area *parts) bool {
+	p := decompose(feature)
+	return intersects(p, area) && !interiorsIntersect(p, area) && !interiorsIntersect(area, p)
+}
+
+// Геометрия, разобранная на точки, отрезки и полигоны
+type parts struct {
+	points   []orb.Point
+	segments [][2]orb.Point
+	polygons []orb.Polygon
+	// Концы незамкнутых линий — граница линейной геометрии
+	endpoints []orb.Point
+	bound     orb.Bound
+}
+
+func (p *parts) areal() bool {
+	return len(p.polygons) > 0
+}
+
+func decompose(g orb.Geometry) *parts {
+	p := &parts{bound: g.Bound()}
+	p.add(g)
+	return p
+}
+
+// segmentsNear возвращает отрезки, bounding box которых задевает bound: только они
+// могут пересечь другую геометрию, остальные пары отрезков можно не сравнивать
+func (p *parts) segmentsNear(bound orb.Bound) [][2]orb.Point {
+	// Запас на допуск onSegment
+	bound = bound.Pad(predicateEpsilon * math.Max(1, segmentScale(bound.Min, bound.Max)))
+	var near [][2]orb.Point
+	for _, s := range p.segments {
+		if bound.Intersects(orb.Bound{Min: s[0], Max: s[0]}.Extend(s[1])) {
+			near = append(near, s)
+		}
+	}
+	return near
+}
+
+func (p *parts) add(g orb.Geometry) {
+	switch g := g.(type) {
+	case orb.Point:
+		p.points = append(p.points, g)
+	case orb.MultiPoint:
+		p.points = append(p.points, g...)
+	case orb.LineString:
+		p.addLine(g)
+		if len(g) > 1 && !g[0].Equal(g[len(g)-1]) {
+			p.endpoints = append(p.endpoints, g[0], g[len(g)-1])
+		}
+	case orb.MultiLineString:
+		for _, ls := range g {
+			p.add(ls)
+		}
+	case orb.Ring:
+		p.add(orb.Polygon{g})
+	case orb.Polygon:
+		if len(g) == 0 {
+			return
+		}
+		p.polygons = append(p.polygons, g)
+		for _, ring := range g {
+			p.addLine(orb.LineString(ring))
+		}
+	case orb.MultiPolygon:
+		for _, polygon := range g {
+			p.add(polygon)
+		}
+	case orb.Collection:
+		for _, child := range g {
+			p.add(child)
+		}
+	case orb.Bound:
+		p.add(g.ToPolygon())
+	}
+}
+
+func (p *parts) addLine(ls orb.LineString) {
+	if len(ls) == 1 {
+		p.points = append(p.points, ls[0])
+	}
+	for i := 0; i+1 < len(ls); i++ {
+		p.segments = append(p.segments, [2]orb.Point{ls[i], ls[i+1]})
+	}
+}
+
+// vertices возвращает все вершины геометрии
+func (p *parts) vertices() []orb.Point {
+	vertices := append([]orb.Point(nil), p.points...)
+	for _, s := range p.segments {
+		vertices = append(vertices, s[0], s[1])
+	}
+	return vertices
+}
+
+type location int
+
+const (
+	exterior location = iota
+	boundary
+	interior
+)
+
+// locate определяет положение точки относительно геометрии.
+// Для смешанных коллекций берётся наибольшая размерность, содержащая точку.
+func (p *parts) locate(pt orb.Point) location {
+	loc := exterior
+	for _, polygon := range p.polygons {
+		switch locatePolygon(polygon, pt) {
+		case interior:
+			return interior
+		case boundary:
+			loc = boundary
+		}
+	}
+	if loc == boundary {
+		return boundary
+	}
+	for _, s := range p.segments {
+		if onSegment(pt, s[0], s[1]) {
+			for _, end := range p.endpoints {
+				if end.Equal(pt) {
+					return boundary
+				}
+			}
+			return interior
+		}
+	}
+	for _, point := range p.points {
+		if point.Equal(pt) {
+			return interior
+		}
+	}
+	return exterior
+}
+
+func locatePolygon(polygon orb.Polygon, pt orb.Point) location {
+	for _, ring := range polygon {
+		for i := 0; i+1 < len(ring); i++ {
+			if onSegment(pt, ring[i], ring[i+1]) {
+				return boundary
+			}
+		}
+	}
+	if !planar.RingContains(polygon[0], pt) {
+		return exterior
+	}
+	for _, hole := range polygon[1:] {
+		if planar.RingContains(hole, pt) {
+			return exterior
+		}
+	}
+	return interior
+}
+
+func intersects(a, b *parts) bool {
+	nearB := b.segmentsNear(a.bound)
+	for _, sa := range a.segmentsNear(b.bound) {
+		for _, sb := range nearB {
+			if hit, _ := segmentsIntersect(sa[0], sa[1], sb[0], sb[1]); hit {
+				return true
+			}
+		}
+	}
+	// Без пересечения границ геометрии пересекаются, только если одна лежит внутри другой
+	for _, v := range a.vertices() {
+		if b.locate(v) != exterior {
+			return true
+		}
+	}
+	for _, v := range b.vertices() {
+		if a.locate(v) != exterior {
+			return true
+		}
+	}
+	return false
+}
+
+// contains проверяет, что b лежит в a целиком и их внутренности пересекаются
+func contains(a, b *parts) bool {
+	samples := b.samples(a)
+	if len(samples) == 0 {
+		return false
+	}
+	for _, s := range samples {
+		if a.locate(s) == exterior {
+			return false
+		}
+	}
+	// Граница a внутри b означает, что рядом с ней есть точки b вне a (например, дыра полигона)
+	if b.areal() {
+		for _, v := range a.vertices() {
+			if b.locate(v) == interior && a.locate(v) == boundary {
+				return false
+			}
+		}
+	}
+	return interiorsIntersect(b, a)
+}
+
+// interiorsIntersect проверяет, что внутренность a пересекается с внутренностью b
+func interiorsIntersect(a, b *parts) bool {
+	nearB := b.segmentsNear(a.bound)
+	for _, sa := range a.segmentsNear(b.bound) {
+		for _, sb := range nearB {
+			if _, proper := segmentsIntersect(sa[0], sa[1], sb[0], sb[1]); proper {
+				return true
+			}
+		}
+	}
+	for _, s := range a.interiorSamples(b) {
+		if b.locate(s) == interior {
+			return true
+		}
+	}
+	return false
+}
+
+// samples возвращает точки, представляющие геометрию относительно other:
+// вершины и середины отрезков, разбитых в точках пересечения с other
+func (p *parts) samples(other *parts) []orb.Point {
+	samples := p.vertices()
+	near := other.segmentsNear(p.bound)
+	for _, s := range p.segments {
+		cuts := []float64{0, 1}
+		for _, o := range near {
+			cuts = append(cuts, segmentCuts(s[0], s[1], o[0], o[1])...)
+		}
+		sort.Float64s(cuts)
+		for i := 0; i+1 < len(cuts); i++ {
+			if cuts[i+1]-cuts[i] < 1e-12 {
+				continue
+			}
+			samples = append(samples, interpolate(s[0], s[1], (cuts[i]+cuts[i+1])/2))
+		}
+	}
+	for _, polygon := range p.polygons {
+		if pt, ok := interiorPoint(polygon); ok {
+			samples = append(samples, pt)
+		}
+	}
+	return samples
+}
+
+// interiorSamples возвращает точки внутренности геометрии. Для полигонов к точкам на границе
+// добавляются точки, смещённые от неё по нормали в обе стороны, — одна из них лежит внутри.
+func (p *parts) interiorSamples(other *parts) []orb.Point {
+	var result []orb.Point
+	for _, s := range p.samples(other) {
+		if p.locate(s) == interior {
+			result = append(result, s)
+			continue
+		}
+		if !p.areal() {
+			continue
+		}
+		for _, seg := range p.segments {
+			if !onSegment(s, seg[0], seg[1]) {
+				continue
+			}
+			for _, offset := range normalOffsets(seg[0], seg[1], s) {
+				if p.locate(offset) == interior {
+					result = append(result, offset)
+				}
+			}
+		}
+	}
+	return result
+}
+
+const predicateEpsilon = 1e-12
+
+func orientation(a, b, c orb.Point) float64 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+}
+
+func onSegment(p, a, b orb.Point) bool {
+	if math.Abs(orientation(a, b, p)) > predicateEpsilon*math.Max(1, segmentScale(a, b)) {
+		return false
+	}
+	return p[0] >= math.Min(a[0], b[0]) && p[0] <= math.Max(a[0], b[0]) &&
+		p[1] >= math.Min(a[1], b[1]) && p[1] <= math.Max(a[1], b[1])
+}
+
+func segmentScale(a, b orb.Point) float64 {
+	return math.Abs(b[0]-a[0]) + math.Abs(b[1]-a[1])
+}
+
+// segmentsIntersect возвращает, пересекаются ли отрезки, и является ли пересечение собственным:
+// отрезки пересекают друг друга во внутренних точках, а не касаются концами или вдоль
+func segmentsIntersect(p1, p2, q1, q2 orb.Point) (hit, proper bool) {
+	d1 := orientation(q1, q2, p1)
+	d2 := orientation(q1, q2, p2)
+	d3 := orientation(p1, p2, q1)
+	d4 := orientation(p1, p2, q2)
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true, true
+	}
+	hit = onSegment(p1, q1, q2) || onSegment(p2, q1, q2) || onSegment(q1, p1, p2) || onSegment(q2, p1, p2)
+	return hit, false
+}
+
+// segmentCuts возвращает параметры t на отрезке a-b, в которых его пересекает или касается отрезок c-d
+func segmentCuts(a, b, c, d orb.Point) []float64 {
+	var cuts []float64
+	r := orb.Point{b[0] - a[0], b[1] - a[1]}
+	s := orb.Point{d[0] - c[0], d[1] - c[1]}
+	denom := r[0]*s[1] - r[1]*s[0]
+	if denom != 0 {
+		t := ((c[0]-a[0])*s[1] - (c[1]-a[1])*s[0]) / denom
+		u := ((c[0]-a[0])*r[1] - (c[1]-a[1])*r[0]) / denom
+		if t > 0 && t < 1 && u >= 0 && u <= 1 {
+			cuts = append(cuts, t)
+		}
+		return cuts
+	}
+	// Коллинеарные отрезки делят друг друга концами
+	length := r[0]*r[0] + r[1]*r[1]
+	if length == 0 {
+		return nil
+	}
+	for _, pt := range []orb.Point{c, d} {
+		if onSegment(pt, a, b) {
+			t := ((pt[0]-a[0])*r[0] + (pt[1]-a[1])*r[1]) / length
+			if t > 0 && t < 1 {
+				cuts = append(cuts, t)
+			}
+		}
+	}
+	return cuts
+}
+
+func interpolate(a, b orb.Point, t float64) orb.Point {
+	return orb.Point{a[0] + (b[0]-a[0])*t, a[1] + (b[1]-a[1])*t}
+}
+
+func normalOffsets(a, b, p orb.Point) []orb.Point {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return nil
+	}
+	step := length * 1e-6
+	nx, ny := -dy/length*step, dx/length*step
+	return []orb.Point{{p[0] + nx, p[1] + ny}, {p[0] - nx, p[1] - ny}}
+}
+
+// interiorPoint находит точку строго внутри полигона: середину самого широкого отрезка
+// горизонтали, проходящей через середину полигона по высоте
+func interiorPoint(polygon orb.Polygon) (orb.Point, bool) {
+	bound := polygon.Bound()
+	y := (bound.Min[1] + bound.Max[1]) / 2
+	var xs []float64
+	for _, ring := range polygon {
+		for i := 0; i+1 < len(ring); i++ {
+			a, b := ring[i], ring[i+1]
+			if (a[1] > y) != (b[1] > y) {
+				xs = append(xs, a[0]+(y-a[1])*(b[0]-a[0])/(b[1]-a[1]))
+			}
+		}
+	}
+	sort.Float64s(xs)
+	best, found := orb.Point{}, false
+	width := 0.0
+	for i := 0; i+1 < len(xs); i += 2 {
+		if xs[i+1]-xs[i] > width {
+			width = xs[i+1] - xs[i]
+			best = orb.Point{(xs[i] + xs[i+1]) / 2, y}
+			found = true
+		}
+	}
+	if found && locatePolygon(polygon, best) != interior {
+		return best, false
+	}
+	return best, found
+}
@@ -0,0 +1,61 @@
+package practice2
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb"
+)
+
+func TestPredicates(t *testing.T) {
+	area := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{2, 2}}
+	// L-образный полигон, bounding box которого накрывает area, а сам он её не задевает
+	lShape := orb.Polygon{{{3, -5}, {10, -5}, {10, 10}, {-5, 10}, {-5, 3}, {3, 3}, {3, -5}}}
+	// Полигон с дырой, в которую целиком попадает area
+	donut := orb.Polygon{
+		{{-5, -5}, {5, -5}, {5, 5}, {-5, 5}, {-5, -5}},
+		{{-1, -1}, {3, -1}, {3, 3}, {-1, 3}, {-1, -1}},
+	}
+
+	cases := []struct {
+		name     string
+		geometry orb.Geometry
+		expected map[string]bool
+	}{
+		{"point inside", orb.Point{1, 1},
+			map[string]bool{"intersects": true, "within": true, "contains": false, "touches": false}},
+		{"point on boundary", orb.Point{2, 1},
+			map[string]bool{"intersects": true, "within": false, "contains": false, "touches": true}},
+		{"point outside", orb.Point{3, 3},
+			map[string]bool{"intersects": false, "within": false, "contains": false, "touches": false}},
+		{"diagonal line far away", orb.LineString{{3, -10}, {10, 1}},
+			map[string]bool{"intersects": false, "within": false, "contains": false, "touches": false}},
+		{"line crossing", orb.LineString{{-1, 1}, {3, 1}},
+			map[string]bool{"intersects": true, "within": false, "contains": false, "touches": false}},
+		{"line along edge", orb.LineString{{0, 0}, {2, 0}},
+			map[string]bool{"intersects": true, "within": false, "contains": false, "touches": true}},
+		{"L-shaped polygon", lShape,
+			map[string]bool{"intersects": false, "within": false, "contains": false, "touches": false}},
+		{"polygon around", orb.Polygon{{{-1, -1}, {3, -1}, {3, 3}, {-1, 3}, {-1, -1}}},
+			map[string]bool{"intersects": true, "within": false, "contains": true, "touches": false}},
+		{"same polygon", area.ToPolygon(),
+			map[string]bool{"intersects": true, "within": true, "contains": true, "touches": false}},
+		{"adjacent polygon", orb.Polygon{{{2, 0}, {4, 0}, {4, 2}, {2, 2}, {2, 0}}},
+			map[string]bool{"intersects": true, "within": false, "contains": false, "touches": true}},
+		{"overlapping cross", orb.Polygon{{{-1, 0.5}, {3, 0.5}, {3, 1.5}, {-1, 1.5}, {-1, 0.5}}},
+			map[string]bool{"intersects": true, "within": false, "contains": false, "touches": false}},
+		{"polygon with hole around", donut,
+			map[string]bool{"intersects": false, "within": false, "contains": false, "touches": false}},
+	}
+
+	for _, c := range cases {
+		for name, expected := range c.expected {
+			predicate, err := parsePredicate(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := predicate(c.geometry, decompose(area)); got != expected {
+				t.Errorf("%s: %s returned %v, expected %v", c.name, name, got, expected)
+			}
+		}
+	}
+}
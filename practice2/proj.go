@@ -0,0 +1,354 @@
+package practice2
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/project"
+)
+
+// Система координат, в которой Engine хранит и индексирует данные (RFC 7946)
+const nativeProjection = "EPSG:4326"
+
+// Поддерживаемые системы координат:
+//   - EPSG:4326 и совпадающие с ней CRS:84, OGC:CRS84; географические ETRS89 (EPSG:4258) и NAD83 (EPSG:4269)
+//     отличаются от WGS 84 меньше чем на 2 м и тоже принимаются без пересчёта;
+//   - Web Mercator под его распространёнными кодами и World Mercator (EPSG:3395) на эллипсоиде WGS 84;
+//   - зоны UTM на WGS 84: EPSG:32601–32660 (северное полушарие) и EPSG:32701–32760 (южное).
+//
+// Остальные коды EPSG, например национальные сетки на других датумах (EPSG:27700), отклоняются
+// с ошибкой: пересчёт в них требует параметров датума, которых у хранилища нет.
+
+// Projection описывает систему координат запроса относительно системы координат хранилища.
+// Для самого хранилища обе функции равны nil и преобразование не выполняется.
+type Projection struct {
+	Code       string
+	toNative   orb.Projection
+	fromNative orb.Projection
+	// Линии координатной сетки проекции не параллельны меридианам и параллелям (UTM):
+	// прямоугольник переводится по точкам его сторон, а не только по углам
+	curved bool
+}
+
+// Коды, под которыми клиенты (OpenLayers, Leaflet, ArcGIS) передают Web Mercator
+var mercatorCodes = []string{"EPSG:3857", "EPSG:900913", "EPSG:3785", "EPSG:102100", "EPSG:102113"}
+
+// Коды, совпадающие с системой координат хранилища
+var nativeCodes = []string{"EPSG:4326", "CRS:84", "OGC:CRS84", "EPSG:4258", "EPSG:4269"}
+
+// Функция для разбора параметра proj, пустое значение означает систему координат хранилища
+func parseProjection(code string) (*Projection, error) {
+	if code == "" {
+		return &Projection{Code: nativeProjection}, nil
+	}
+	normalized := strings.ToUpper(strings.TrimSpace(code))
+	normalized = strings.TrimPrefix(normalized, "URN:OGC:DEF:CRS:")
+	normalized = strings.Replace(normalized, "EPSG::", "EPSG:", 1)
+	normalized = strings.Replace(normalized, "OGC:1.3:", "OGC:", 1)
+
+	for _, c := range nativeCodes {
+		if normalized == c {
+			return &Projection{Code: normalized}, nil
+		}
+	}
+	for _, c := range mercatorCodes {
+		if normalized == c {
+			return &Projection{
+				Code:       normalized,
+				toNative:   project.Mercator.ToWGS84,
+				fromNative: project.WGS84.ToMercator,
+			}, nil
+		}
+	}
+	if normalized == "EPSG:3395" {
+		return &Projection{Code: normalized, toNative: worldMercatorToWGS84, fromNative: wgs84ToWorldMercator}, nil
+	}
+	if epsg, err := strconv.Atoi(strings.TrimPrefix(normalized, "EPSG:")); err == nil && strings.HasPrefix(normalized, "EPSG:") {
+		if zone := epsg % 100; (epsg/100 == 326 || epsg/100 == 327) && zone >= 1 && zone <= 60 {
+			tm := newUTM(zone, epsg/100 == 327)
+			return &Projection{Code: normalized, toNative: tm.toWGS84, fromNative: tm.fromWGS84, curved: true}, nil
+		}
+	}
+	return nil, errors.New("неподдерживаемая система координат: " + code)
+}
+
+// Функция для разбора прямоугольника запроса: rect=minx,miny,maxx,maxy либо minX/minY/maxX/maxY
+func parseRect(query url.Values) (min, max [2]float64, err error) {
+	if rect := query.Get("rect"); rect != "" {
+		parts := strings.Split(rect, ",")
+		if len(parts) != 4 {
+			return min, max, errors.New("Invalid rect parameter")
+		}
+		var values [4]float64
+		for i, part := range parts {
+			values[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return min, max, errors.New("Invalid rect parameter")
+			}
+		}
+		min = [2]float64{math.Min(values[0], values[2]), math.Min(values[1], values[3])}
+		max = [2]float64{math.Max(values[0], values[2]), math.Max(values[1], values[3])}
+		return min, max, nil
+	}
+
+	names := [4]string{"minX", "minY", "maxX", "maxY"}
+	var values [4]float64
+	for i, name := range names {
+		values[i], err = strconv.ParseFloat(query.Get(name), 64)
+		if err != nil {
+			return min, max, errors.New("Invalid " + name + " parameter")
+		}
+	}
+	return [2]float64{values[0], values[1]}, [2]float64{values[2], values[3]}, nil
+}
+
+// Количество отрезков, на которые делится сторона прямоугольника при переводе в проекцию с кривой сеткой
+const rectEdgeSteps = 16
+
+// rectToNative переводит прямоугольник запроса в систему координат хранилища.
+// Меркатор монотонен по каждой оси, поэтому достаточно перевести углы; для UTM берётся
+// прямоугольник, описанный вокруг точек сторон.
+//
+// Экстент карты может выходить за пределы одного оборота вокруг Земли. Прямоугольник, целиком
+// лежащий за линией перемены дат, сдвигается на 360° в основной диапазон. У прямоугольника,
+// пересекающего ±180°, восточная граница остаётся больше 180°: поиск выполняется по двум частям
+// из splitAntimeridian.
+func (p *Projection) rectToNative(min, max [2]float64) orb.Bound {
+	if p.toNative == nil {
+		return normalizeRect(min, max)
+	}
+	var bound orb.Bound
+	if p.curved {
+		bound = orb.Bound{Min: orb.Point{math.Inf(1), math.Inf(1)}, Max: orb.Point{math.Inf(-1), math.Inf(-1)}}
+		for i := 0; i <= rectEdgeSteps; i++ {
+			t := float64(i) / rectEdgeSteps
+			x := min[0] + (max[0]-min[0])*t
+			y := min[1] + (max[1]-min[1])*t
+			for _, point := range []orb.Point{{x, min[1]}, {x, max[1]}, {min[0], y}, {max[0], y}} {
+				bound = bound.Extend(p.toNative(point))
+			}
+		}
+	} else {
+		bound = orb.Bound{Min: p.toNative(orb.Point{min[0], min[1]}), Max: p.toNative(orb.Point{max[0], max[1]})}
+	}
+	return normalizeRect(bound.Min, bound.Max)
+}
+
+// Функция для приведения прямоугольника в градусах к одному обороту вокруг Земли: западная граница
+// попадает в [-180, 180], восточная больше 180°, если прямоугольник пересекает линию перемены дат.
+// Прямоугольник шире оборота заменяется всем диапазоном долгот.
+func normalizeRect(lo, hi [2]float64) orb.Bound {
+	if hi[0]-lo[0] >= 360 {
+		lo[0], hi[0] = -180, 180
+	}
+	for lo[0] > 180 {
+		lo[0], hi[0] = lo[0]-360, hi[0]-360
+	}
+	for lo[0] < -180 {
+		lo[0], hi[0] = lo[0]+360, hi[0]+360
+	}
+	lo[1], hi[1] = math.Max(lo[1], -90), math.Min(hi[1], 90)
+	return orb.Bound{Min: lo, Max: hi}
+}
+
+// splitAntimeridian делит прямоугольник из rectToNative, заходящий за 180°, на части по обе стороны
+// линии перемены дат. Остальные прямоугольники возвращаются без изменений.
+func splitAntimeridian(b orb.Bound) []orb.Bound {
+	if b.Max[0] <= 180 {
+		return []orb.Bound{b}
+	}
+	return []orb.Bound{
+		{Min: b.Min, Max: orb.Point{180, b.Max[1]}},
+		{Min: orb.Point{-180, b.Min[1]}, Max: orb.Point{b.Max[0] - 360, b.Max[1]}},
+	}
+}
+
+// Предельная широта Web Mercator: на полюсах проекция уходит в бесконечность
+const mercatorMaxLat = 85.05112877980659
+
+// boundFromNative переводит прямоугольник в систему координат запроса
+func (p *Projection) boundFromNative(b orb.Bound) orb.Bound {
+	if p.fromNative == nil {
+		return b
+	}
+	lo := orb.Point{b.Min[0], math.Max(b.Min[1], -mercatorMaxLat)}
+	hi := orb.Point{b.Max[0], math.Min(b.Max[1], mercatorMaxLat)}
+	if !p.curved {
+		return orb.Bound{Min: p.fromNative(lo), Max: p.fromNative(hi)}
+	}
+	bound := orb.Bound{Min: orb.Point{math.Inf(1), math.Inf(1)}, Max: orb.Point{math.Inf(-1), math.Inf(-1)}}
+	for i := 0; i <= rectEdgeSteps; i++ {
+		t := float64(i) / rectEdgeSteps
+		x := lo[0] + (hi[0]-lo[0])*t
+		y := lo[1] + (hi[1]-lo[1])*t
+		for _, point := range []orb.Point{{x, lo[1]}, {x, hi[1]}, {lo[0], y}, {hi[0], y}} {
+			bound = bound.Extend(p.fromNative(point))
+		}
+	}
+	return bound
+}
+
+// geometryToNative переводит геометрию области запроса в систему координат хранилища
+func (p *Projection) geometryToNative(g orb.Geometry) orb.Geometry {
+	if p.toNative == nil {
+		return g
+	}
+	return project.Geometry(orb.Clone(g), p.toNative)
+}
+
+// Функция для перевода объекта записи в систему координат хранилища. Карта отправляет нарисованные
+// объекты в своей системе координат, которую передаёт параметром proj, как и в select.
+// Координаты в градусах вне ±180/±90 отклоняются: так выглядят метры Web Mercator от клиента,
+// не передавшего proj, и сохранение их как градусов испортило бы данные.
+func featureToNative(r *http.Request, feature *geojson.Feature) error {
+	proj, err := parseProjection(r.URL.Query().Get("proj"))
+	if err != nil {
+		return err
+	}
+	if feature.Geometry == nil {
+		return nil
+	}
+	if proj.toNative == nil {
+		if b := feature.Geometry.Bound(); b.Min[0] < -180 || b.Max[0] > 180 || b.Min[1] < -90 || b.Max[1] > 90 {
+			return fmt.Errorf("координаты объекта выходят за пределы %s; для другой системы координат укажите параметр proj", proj.Code)
+		}
+		return nil
+	}
+	feature.Geometry = proj.geometryToNative(feature.Geometry)
+	return nil
+}
+
+// featuresFromNative возвращает копии объектов в системе координат запроса.
+// Объекты из Engine не изменяются, так как на них ссылаются индексы.
+func (p *Projection) featuresFromNative(features []*geojson.Feature) []*geojson.Feature {
+	if p.fromNative == nil {
+		return features
+	}
+	projected := make([]*geojson.Feature, 0, len(features))
+	for _, feature := range features {
+		projected = append(projected, &geojson.Feature{
+			ID:         feature.ID,
+			Type:       feature.Type,
+			Geometry:   project.Geometry(orb.Clone(feature.Geometry), p.fromNative),
+			Properties: feature.Properties,
+		})
+	}
+	return projected
+}
+
+// Эллипсоид WGS 84
+const (
+	wgs84A = 6378137.0
+	wgs84F = 1 / 298.257223563
+)
+
+var wgs84E = math.Sqrt(wgs84F * (2 - wgs84F))
+
+// World Mercator (EPSG:3395): Меркатор на эллипсоиде, в отличие от сферического Web Mercator
+func wgs84ToWorldMercator(p orb.Point) orb.Point {
+	lat := math.Max(-mercatorMaxLat, math.Min(mercatorMaxLat, p[1])) * math.Pi / 180
+	es := wgs84E * math.Sin(lat)
+	y := math.Log(math.Tan(math.Pi/4+lat/2) * math.Pow((1-es)/(1+es), wgs84E/2))
+	return orb.Point{wgs84A * p[0] * math.Pi / 180, wgs84A * y}
+}
+
+func worldMercatorToWGS84(p orb.Point) orb.Point {
+	t := math.Exp(-p[1] / wgs84A)
+	lat := math.Pi/2 - 2*math.Atan(t)
+	// Широта на эллипсоиде находится итерациями; сходимость до 1e-12 за несколько шагов
+	for i := 0; i < 15; i++ {
+		es := wgs84E * math.Sin(lat)
+		next := math.Pi/2 - 2*math.Atan(t*math.Pow((1-es)/(1+es), wgs84E/2))
+		if math.Abs(next-lat) < 1e-12 {
+			lat = next
+			break
+		}
+		lat = next
+	}
+	return orb.Point{p[0] / wgs84A * 180 / math.Pi, lat * 180 / math.Pi}
+}
+
+// utm — поперечная проекция Меркатора зоны UTM по рядам Крюгера до n⁴ (погрешность меньше миллиметра в пределах зоны)
+type utm struct {
+	lon0     float64
+	northing float64
+	a        float64
+	alpha    [4]float64
+	beta     [4]float64
+	delta    [4]float64
+}
+
+const (
+	utmScale   = 0.9996
+	utmEasting = 500000.0
+)
+
+func newUTM(zone int, south bool) *utm {
+	n := wgs84F / (2 - wgs84F)
+	n2, n3, n4 := n*n, n*n*n, n*n*n*n
+	tm := &utm{
+		lon0: float64(zone*6-183) * math.Pi / 180,
+		a:    wgs84A / (1 + n) * (1 + n2/4 + n4/64),
+		alpha: [4]float64{
+			n/2 - 2*n2/3 + 5*n3/16 + 41*n4/180,
+			13*n2/48 - 3*n3/5 + 557*n4/1440,
+			61*n3/240 - 103*n4/140,
+			49561 * n4 / 161280,
+		},
+		beta: [4]float64{
+			n/2 - 2*n2/3 + 37*n3/96 - n4/360,
+			n2/48 + n3/15 - 437*n4/1440,
+			17*n3/480 - 37*n4/840,
+			4397 * n4 / 161280,
+		},
+		delta: [4]float64{
+			2*n - 2*n2/3 - 2*n3 + 116*n4/45,
+			7*n2/3 - 8*n3/5 - 227*n4/45,
+			56*n3/15 - 136*n4/35,
+			4279 * n4 / 630,
+		},
+	}
+	if south {
+		tm.northing = 10000000
+	}
+	return tm
+}
+
+func (tm *utm) fromWGS84(p orb.Point) orb.Point {
+	lat, lon := p[1]*math.Pi/180, p[0]*math.Pi/180-tm.lon0
+	t := math.Sinh(math.Atanh(math.Sin(lat)) - wgs84E*math.Atanh(wgs84E*math.Sin(lat)))
+	xi0 := math.Atan2(t, math.Cos(lon))
+	eta0 := math.Atanh(math.Sin(lon) / math.Sqrt(1+t*t))
+	xi, eta := xi0, eta0
+	for j, alpha := range tm.alpha {
+		k := float64(2 * (j + 1))
+		xi += alpha * math.Sin(k*xi0) * math.Cosh(k*eta0)
+		eta += alpha * math.Cos(k*xi0) * math.Sinh(k*eta0)
+	}
+	return orb.Point{utmEasting + utmScale*tm.a*eta, tm.northing + utmScale*tm.a*xi}
+}
+
+func (tm *utm) toWGS84(p orb.Point) orb.Point {
+	xi := (p[1] - tm.northing) / (utmScale * tm.a)
+	eta := (p[0] - utmEasting) / (utmScale * tm.a)
+	xi0, eta0 := xi, eta
+	for j, beta := range tm.beta {
+		k := float64(2 * (j + 1))
+		xi0 -= beta * math.Sin(k*xi) * math.Cosh(k*eta)
+		eta0 -= beta * math.Cos(k*xi) * math.Sinh(k*eta)
+	}
+	chi := math.Asin(math.Sin(xi0) / math.Cosh(eta0))
+	lat := chi
+	for j, delta := range tm.delta {
+		lat += delta * math.Sin(float64(2*(j+1))*chi)
+	}
+	lon := tm.lon0 + math.Atan2(math.Sinh(eta0), math.Cos(xi0))
+	return orb.Point{lon * 180 / math.Pi, lat * 180 / math.Pi}
+}
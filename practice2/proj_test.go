@@ -0,0 +1,105 @@
+package practice2
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paulmach/orb"
+)
+
+func TestParseProjectionCodes(t *testing.T) {
+	for _, code := range []string{"EPSG:4326", "urn:ogc:def:crs:EPSG::4258", "EPSG:4269", "EPSG:3857", "EPSG:3395", "EPSG:32636", "EPSG:32760"} {
+		if _, err := parseProjection(code); err != nil {
+			t.Errorf("Expected %s to be supported, got %v", code, err)
+		}
+	}
+	for _, code := range []string{"EPSG:27700", "EPSG:32661", "EPSG:32700", "EPSG:abc"} {
+		if _, err := parseProjection(code); err == nil {
+			t.Errorf("Expected %s to be rejected", code)
+		}
+	}
+}
+
+func TestProjectionRoundTrip(t *testing.T) {
+	cases := []struct {
+		code  string
+		point orb.Point
+		// Ожидаемые координаты в проекции; nil — проверяется только обратный пересчёт
+		want *orb.Point
+	}{
+		// На осевом меридиане зоны 31 восточное смещение — 500 км, северное — длина дуги меридиана, умноженная на 0.9996
+		{"EPSG:32631", orb.Point{3, 40}, &orb.Point{500000, 4427757.22}},
+		{"EPSG:32631", orb.Point{3, 0}, &orb.Point{500000, 0}},
+		{"EPSG:32636", orb.Point{30.3, 59.9}, nil},
+		{"EPSG:32721", orb.Point{-60.5, -34.6}, nil},
+		{"EPSG:3395", orb.Point{30.3, 59.9}, nil},
+		{"EPSG:3395", orb.Point{-120, -45}, nil},
+	}
+	for _, c := range cases {
+		proj, err := parseProjection(c.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		projected := proj.fromNative(c.point)
+		if c.want != nil && (math.Abs(projected[0]-c.want[0]) > 1 || math.Abs(projected[1]-c.want[1]) > 1) {
+			t.Errorf("%s: %v projected to %v, want %v", c.code, c.point, projected, *c.want)
+		}
+		back := proj.toNative(projected)
+		if math.Abs(back[0]-c.point[0]) > 1e-8 || math.Abs(back[1]-c.point[1]) > 1e-8 {
+			t.Errorf("%s: round trip of %v returned %v", c.code, c.point, back)
+		}
+	}
+	// Эллипсоидальный Меркатор отличается от сферического Web Mercator на десятки километров по широте
+	worldMercator, _ := parseProjection("EPSG:3395")
+	webMercator, _ := parseProjection("EPSG:3857")
+	if dy := webMercator.fromNative(orb.Point{0, 60})[1] - worldMercator.fromNative(orb.Point{0, 60})[1]; dy < 10000 {
+		t.Errorf("Expected EPSG:3395 to differ from EPSG:3857 at 60°, got %.0f m", dy)
+	}
+}
+
+func TestRectToNativeUTM(t *testing.T) {
+	proj, _ := parseProjection("EPSG:32636")
+	// Прямоугольник UTM не совпадает с прямоугольником в градусах: описанный прямоугольник
+	// должен содержать все точки сторон, в том числе середину северной стороны
+	bound := proj.rectToNative([2]float64{300000, 6600000}, [2]float64{700000, 6700000})
+	for _, point := range []orb.Point{{300000, 6600000}, {700000, 6700000}, {500000, 6700000}, {300000, 6700000}} {
+		if native := proj.toNative(point); !bound.Contains(native) {
+			t.Errorf("Rect %v does not contain %v (%v)", bound, point, native)
+		}
+	}
+}
+
+func TestRectToNativeAntimeridian(t *testing.T) {
+	mercator, _ := parseProjection("EPSG:3857")
+	world := 20037508.342789244
+	// Экстент соседней копии мира сдвигается в основной диапазон
+	bound := mercator.rectToNative([2]float64{world + 1000000, 0}, [2]float64{world + 2000000, 1000000})
+	if bound.Min[0] > -170 || bound.Min[0] < -172 || bound.Max[0] > -161 || bound.Max[0] < -163 {
+		t.Errorf("Expected rect beyond the antimeridian to wrap to western longitudes, got %v", bound)
+	}
+	if boxes := splitAntimeridian(bound); len(boxes) != 1 || boxes[0] != bound {
+		t.Errorf("Expected rect beyond the antimeridian to stay whole, got %v", boxes)
+	}
+	// Экстент, пересекающий линию перемены дат, делится на части по обе стороны от неё
+	bound = mercator.rectToNative([2]float64{world - 1000000, 0}, [2]float64{world + 1000000, 1000000})
+	if bound.Min[0] < 170 || bound.Max[0] < 188 || bound.Max[0] > 190 {
+		t.Errorf("Expected rect across the antimeridian to extend past 180, got %v", bound)
+	}
+	boxes := splitAntimeridian(bound)
+	if len(boxes) != 2 || boxes[0].Max[0] != 180 || boxes[1].Min[0] != -180 || boxes[1].Max[0] > -170 {
+		t.Errorf("Expected rect across the antimeridian to split at 180, got %v", boxes)
+	}
+	native, _ := parseProjection("")
+	bound = native.rectToNative([2]float64{190, 10}, [2]float64{200, 20})
+	if bound.Min != (orb.Point{-170, 10}) || bound.Max != (orb.Point{-160, 20}) {
+		t.Errorf("Expected degrees beyond 180 to wrap, got %v", bound)
+	}
+	bound = native.rectToNative([2]float64{-200, 10}, [2]float64{-170, 20})
+	if bound.Min != (orb.Point{160, 10}) || bound.Max != (orb.Point{190, 20}) {
+		t.Errorf("Expected degrees west of -180 to wrap across the antimeridian, got %v", bound)
+	}
+	bound = native.rectToNative([2]float64{-500, -100}, [2]float64{500, 100})
+	if bound != (orb.Bound{Min: orb.Point{-180, -90}, Max: orb.Point{180, 90}}) {
+		t.Errorf("Expected rect wider than the world to cover all longitudes, got %v", bound)
+	}
+}
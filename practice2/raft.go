@@ -0,0 +1,1142 @@
+package practice2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Репликация через Raft — альтернатива рассылке транзакций лидера по websocket и выборам из election.go.
+// Транзакция записи становится записью журнала Raft; Engine применяет её и пишет в свой журнал
+// только после того, как запись сохранена на большинстве узлов (закоммичена), поэтому истории
+// узлов не расходятся: незакоммиченные записи отстранённого лидера заменяются записями нового.
+// Индекс записи Raft совпадает с LSN транзакции в Engine, а её term сохраняется в транзакции.
+// Чекпоинт Engine служит снапшотом Raft и хранит term последней покрытой записи:
+// после чекпоинта записи до его LSN удаляются из журнала Raft, а отставшая реплика получает
+// файл чекпоинта частями по SnapshotChunk байт и устанавливает его, собрав файл на диске.
+//
+// Узел Raft работает в своей горутине и обменивается с остальными узлами сообщениями через
+// RaftTransport; доставка не гарантируется, потерянные сообщения повторяются heartbeat лидера.
+// Между процессами сообщения передаёт HTTPRaftTransport, журнал Raft хранит FileRaftStorage.
+
+// RaftOptions включает Raft; выборы лидера из ElectionOptions при этом не используются
+type RaftOptions struct {
+	// ID узла; по нему остальные узлы отправляют сообщения, а клиенты перенаправляются к лидеру
+	ID string
+	// ID остальных узлов репликасета
+	Peers     []string
+	Transport RaftTransport
+	// Хранилище журнала Raft; nil — FileRaftStorage в <wrkdir>/raft
+	Storage RaftStorage
+	// Период тика; таймауты задаются в тиках
+	TickInterval time.Duration
+	// Минимальное число тиков без сообщений лидера до начала выборов; фактический таймаут случайный, до удвоенного
+	ElectionTicks int
+	// Период heartbeat лидера в тиках
+	HeartbeatTicks int
+	// Размер части чекпоинта в одном сообщении snapshot; 0 — raftSnapshotChunk
+	SnapshotChunk int
+}
+
+var DefaultRaftOptions = RaftOptions{
+	TickInterval:   50 * time.Millisecond,
+	ElectionTicks:  10,
+	HeartbeatTicks: 2,
+}
+
+// WithRaft включает репликацию через Raft; opts.ID и opts.Transport обязательны.
+// Записи подтверждаются после коммита на большинстве узлов, параметр writeConcern не учитывается.
+func WithRaft(opts RaftOptions) Option {
+	return func(e *Engine) {
+		e.raftOpts = opts
+	}
+}
+
+const (
+	raftFollower  = "follower"
+	raftCandidate = "candidate"
+	raftLeader    = "leader"
+)
+
+// Типы сообщений Raft
+const (
+	raftVote         = "vote"
+	raftVoteResp     = "voteResp"
+	raftAppend       = "append"
+	raftAppendResp   = "appendResp"
+	raftSnapshot     = "snapshot"
+	raftSnapshotResp = "snapshotResp"
+)
+
+const (
+	// Максимальное количество записей в одном сообщении append
+	raftMaxAppend = 256
+	// Размер очередей входящих сообщений и предложенных транзакций
+	raftInboxSize     = 1024
+	raftProposalQueue = 1024
+	// Размер части чекпоинта по умолчанию: сообщение с ней укладывается в таймаут HTTPRaftTransport
+	raftSnapshotChunk = 1 << 20
+)
+
+// RaftEntry — запись журнала Raft. Txn == nil у пустой записи, которую лидер добавляет в начале term,
+// чтобы закоммитить записи прежних term.
+type RaftEntry struct {
+	Index uint64       `json:"index"`
+	Term  uint64       `json:"term"`
+	Txn   *Transaction `json:"txn,omitempty"`
+}
+
+// validate проверяет транзакцию записи: записи приходят по сети и из файла журнала, и некорректная
+// запись не должна останавливать горутину Engine при применении
+func (e RaftEntry) validate() error {
+	if e.Txn == nil {
+		return nil
+	}
+	switch e.Txn.Action {
+	case "insert", "replace", "delete":
+	default:
+		return fmt.Errorf("неизвестное действие транзакции %q", e.Txn.Action)
+	}
+	if e.Txn.Feature == nil {
+		return errors.New("транзакция без объекта")
+	}
+	if _, ok := e.Txn.Feature.ID.(string); !ok {
+		return errors.New("ID объекта должен быть строкой")
+	}
+	return nil
+}
+
+// RaftSnapshot — часть чекпоинта лидера в формате файла чекпоинта, начиная с байта Offset,
+// и индекс последней покрытой им записи. Done отмечает последнюю часть файла.
+// В ответе snapshotResp Offset — число байт, уже полученных узлом; с него лидер продолжает передачу.
+type RaftSnapshot struct {
+	Index  uint64 `json:"index"`
+	Term   uint64 `json:"term"`
+	Offset int64  `json:"offset"`
+	Data   []byte `json:"data,omitempty"`
+	Done   bool   `json:"done,omitempty"`
+}
+
+// RaftMessage — сообщение между узлами Raft. Поля заполняются в зависимости от Type.
+type RaftMessage struct {
+	Type string `json:"type"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	Term uint64 `json:"term"`
+	// vote: последняя запись журнала кандидата
+	LastLogIndex uint64 `json:"lastLogIndex,omitempty"`
+	LastLogTerm  uint64 `json:"lastLogTerm,omitempty"`
+	// voteResp
+	Granted bool `json:"granted,omitempty"`
+	// append: записи после PrevLogIndex и индекс коммита лидера
+	PrevLogIndex uint64      `json:"prevLogIndex,omitempty"`
+	PrevLogTerm  uint64      `json:"prevLogTerm,omitempty"`
+	Entries      []RaftEntry `json:"entries,omitempty"`
+	Commit       uint64      `json:"commit,omitempty"`
+	// appendResp: при успехе — последний совпавший индекс, при отказе — индекс, с которого лидеру стоит повторить
+	Success    bool   `json:"success,omitempty"`
+	MatchIndex uint64 `json:"matchIndex,omitempty"`
+	// snapshot, snapshotResp: часть чекпоинта и позиция, с которой узел ждёт следующую
+	Snapshot *RaftSnapshot `json:"snapshot,omitempty"`
+}
+
+// RaftTransport доставляет сообщения между узлами Raft
+type RaftTransport interface {
+	// Send отправляет сообщение узлу msg.To без ожидания ответа; сообщение может потеряться
+	Send(msg RaftMessage)
+	// Register подключает узел id: входящие сообщения передаются в deliver. Повторная регистрация
+	// заменяет прежний узел, например после перезапуска
+	Register(id string, deliver func(msg RaftMessage))
+}
+
+// RaftState — сохранённое состояние узла Raft
+type RaftState struct {
+	Term     uint64
+	VotedFor string
+	// Последняя запись, покрытая снапшотом, и записи после неё
+	SnapshotIndex uint64
+	SnapshotTerm  uint64
+	Entries       []RaftEntry
+}
+
+// RaftStorage сохраняет term, голос и журнал Raft. Методы должны возвращаться после того,
+// как данные сохранены: узел подтверждает записи лидеру сразу после Append.
+type RaftStorage interface {
+	Load() (RaftState, error)
+	SaveHardState(term uint64, votedFor string) error
+	// Append сохраняет записи, заменяя сохранённые записи с теми же и большими индексами
+	Append(entries []RaftEntry) error
+	// Compact удаляет записи до index включительно. Если записи index с таким term нет, удаляются все записи.
+	Compact(index, term uint64) error
+}
+
+// MemoryRaftStorage хранит журнал Raft в памяти. Переживает перезапуск Storage в том же процессе,
+// но не перезапуск процесса: после него узел восстанавливается с LSN своего журнала транзакций.
+type MemoryRaftStorage struct {
+	mu    sync.Mutex
+	state RaftState
+}
+
+func NewMemoryRaftStorage() *MemoryRaftStorage {
+	return &MemoryRaftStorage{}
+}
+
+func (s *MemoryRaftStorage) Load() (RaftState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.state
+	state.Entries = slices.Clone(s.state.Entries)
+	return state, nil
+}
+
+func (s *MemoryRaftStorage) SaveHardState(term uint64, votedFor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Term, s.state.VotedFor = term, votedFor
+	return nil
+}
+
+func (s *MemoryRaftStorage) Append(entries []RaftEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keep := int(entries[0].Index - s.state.SnapshotIndex - 1)
+	s.state.Entries = append(s.state.Entries[:min(keep, len(s.state.Entries))], entries...)
+	return nil
+}
+
+func (s *MemoryRaftStorage) Compact(index, term uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pos := int(index) - int(s.state.SnapshotIndex)
+	if pos > 0 && pos <= len(s.state.Entries) && s.state.Entries[pos-1].Term == term {
+		s.state.Entries = slices.Clone(s.state.Entries[pos:])
+	} else {
+		s.state.Entries = nil
+	}
+	s.state.SnapshotIndex, s.state.SnapshotTerm = index, term
+	return nil
+}
+
+// MemoryTransport доставляет сообщения между узлами одного процесса. Сообщения копируются
+// через JSON, как при передаче по сети; изолированные узлы не получают и не отправляют сообщений.
+type MemoryTransport struct {
+	mu       sync.Mutex
+	nodes    map[string]func(msg RaftMessage)
+	isolated map[string]bool
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{nodes: make(map[string]func(msg RaftMessage)), isolated: make(map[string]bool)}
+}
+
+func (t *MemoryTransport) Register(id string, deliver func(msg RaftMessage)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nodes[id] = deliver
+}
+
+func (t *MemoryTransport) Send(msg RaftMessage) {
+	t.mu.Lock()
+	deliver := t.nodes[msg.To]
+	blocked := t.isolated[msg.From] || t.isolated[msg.To]
+	t.mu.Unlock()
+	if deliver == nil || blocked {
+		return
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Ошибка кодирования сообщения Raft: %v", err)
+		return
+	}
+	var copied RaftMessage
+	if err := json.Unmarshal(data, &copied); err != nil {
+		log.Printf("Ошибка декодирования сообщения Raft: %v", err)
+		return
+	}
+	deliver(copied)
+}
+
+// Isolate отключает узел от остальных, имитируя сетевой раздел
+func (t *MemoryTransport) Isolate(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.isolated[id] = true
+}
+
+// Heal возвращает изолированный узел в сеть
+func (t *MemoryTransport) Heal(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.isolated, id)
+}
+
+// RaftStatus — состояние узла Raft в ответе /<name>/replication/status
+type RaftStatus struct {
+	ID            string `json:"id"`
+	Role          string `json:"role"`
+	Term          uint64 `json:"term"`
+	Leader        string `json:"leader,omitempty"`
+	CommitIndex   uint64 `json:"commitIndex"`
+	AppliedIndex  uint64 `json:"appliedIndex"`
+	LastIndex     uint64 `json:"lastIndex"`
+	SnapshotIndex uint64 `json:"snapshotIndex"`
+}
+
+// raftProposal — транзакция, предложенная Engine; result получит ответ после применения записи
+type raftProposal struct {
+	txn    *Transaction
+	result chan error
+}
+
+// raftCommitted — закоммиченная запись для применения Engine; result != nil у записей,
+// предложенных на этом узле, пока он оставался лидером
+type raftCommitted struct {
+	entry  RaftEntry
+	result chan error
+}
+
+// raftNode — узел Raft. Состояние доступно только из его горутины, кроме status под мьютексом.
+type raftNode struct {
+	opts        RaftOptions
+	engine      *Engine
+	done        chan struct{}
+	inbox       chan RaftMessage
+	proposals   chan raftProposal
+	compactions chan uint64
+
+	mu     sync.Mutex
+	status RaftStatus
+
+	role     string
+	term     uint64
+	votedFor string
+	leader   string
+	// Записи после снапшота: entries[i].Index == snapIndex+i+1
+	entries     []RaftEntry
+	snapIndex   uint64
+	snapTerm    uint64
+	commitIndex uint64
+	applied     uint64
+	// Тики с последнего сообщения лидера, случайный таймаут выборов и тики с последнего heartbeat
+	elapsed          int
+	timeout          int
+	heartbeatElapsed int
+	votes            map[string]bool
+	// Лидер: следующий отправляемый и последний совпавший индекс каждого узла
+	next  map[string]uint64
+	match map[string]uint64
+	// Лидер: ответы на предложенные транзакции по индексу записи
+	pending map[uint64]chan error
+	// Лидер: передачи чекпоинта отставшим узлам
+	transfers map[string]*raftSnapshotTransfer
+	// Реплика: принимаемый чекпоинт лидера
+	incoming *raftIncomingSnapshot
+	// Реплика: собранный чекпоинт, который Engine устанавливает в отдельной горутине, и результат установки
+	installing *raftIncomingSnapshot
+	installed  chan error
+}
+
+// raftSnapshotTransfer — передача файла чекпоинта узлу: следующая часть начинается с offset
+type raftSnapshotTransfer struct {
+	index  uint64
+	term   uint64
+	path   string
+	offset int64
+}
+
+// raftIncomingSnapshot — чекпоинт, который реплика собирает во временном файле из частей лидера
+type raftIncomingSnapshot struct {
+	from  string
+	index uint64
+	term  uint64
+	file  *os.File
+	size  int64
+}
+
+// newRaftNode восстанавливает узел из хранилища журнала. Вызывается после recover:
+// записи до LSN Engine уже применены и закоммичены.
+func newRaftNode(e *Engine) (*raftNode, error) {
+	opts := e.raftOpts
+	if opts.Transport == nil {
+		return nil, errors.New("для Raft не задан транспорт")
+	}
+	if opts.TickInterval <= 0 || opts.ElectionTicks <= 0 || opts.HeartbeatTicks <= 0 {
+		return nil, errors.New("не заданы таймауты Raft")
+	}
+	if opts.SnapshotChunk <= 0 {
+		opts.SnapshotChunk = raftSnapshotChunk
+	}
+	if opts.Storage == nil {
+		storage, err := NewFileRaftStorage(e.dir.raftDir())
+		if err != nil {
+			return nil, err
+		}
+		opts.Storage = storage
+	}
+	state, err := opts.Storage.Load()
+	if err != nil {
+		return nil, err
+	}
+	n := &raftNode{
+		opts:        opts,
+		engine:      e,
+		done:        make(chan struct{}),
+		inbox:       make(chan RaftMessage, raftInboxSize),
+		proposals:   make(chan raftProposal, raftProposalQueue),
+		compactions: make(chan uint64, 16),
+		installed:   make(chan error, 1),
+		role:        raftFollower,
+		term:        state.Term,
+		votedFor:    state.VotedFor,
+		entries:     state.Entries,
+		snapIndex:   state.SnapshotIndex,
+		snapTerm:    state.SnapshotTerm,
+		pending:     make(map[uint64]chan error),
+	}
+	switch {
+	case e.lsn > n.lastIndex():
+		// Журнал Raft потерян: состояние Engine считается снапшотом с term его последней транзакции
+		n.entries, n.snapIndex, n.snapTerm = nil, e.lsn, e.lastTerm
+		if err := opts.Storage.Compact(e.lsn, e.lastTerm); err != nil {
+			return nil, err
+		}
+	case e.lsn < n.snapIndex:
+		return nil, errors.New("состояние хранилища отстаёт от снапшота Raft")
+	}
+	n.commitIndex, n.applied = e.lsn, e.lsn
+	n.publish()
+	return n, nil
+}
+
+func (n *raftNode) lastIndex() uint64 {
+	return n.snapIndex + uint64(len(n.entries))
+}
+
+// termAt возвращает term записи index; false — записи нет в журнале или она удалена снапшотом
+func (n *raftNode) termAt(index uint64) (uint64, bool) {
+	if index == n.snapIndex {
+		return n.snapTerm, true
+	}
+	if index < n.snapIndex || index > n.lastIndex() {
+		return 0, false
+	}
+	return n.entries[index-n.snapIndex-1].Term, true
+}
+
+func (n *raftNode) quorum() int {
+	return (len(n.opts.Peers)+1)/2 + 1
+}
+
+func (n *raftNode) run() {
+	n.opts.Transport.Register(n.opts.ID, func(msg RaftMessage) {
+		select {
+		case n.inbox <- msg:
+		default:
+			// Очередь переполнена: сообщение будет повторено
+		}
+	})
+	ticker := time.NewTicker(n.opts.TickInterval)
+	defer ticker.Stop()
+	// Engine освобождает рабочую директорию только после остановки узла
+	defer close(n.done)
+	n.resetTimeout()
+	for {
+		select {
+		case <-n.engine.ctx.Done():
+			n.failPending(errors.New("хранилище остановлено до коммита транзакции"))
+			n.discardSnapshot()
+			if n.installing != nil {
+				// Установка прерывается вместе с Engine; файл удаляется после её завершения
+				n.finishInstall(<-n.installed)
+			}
+			if closer, ok := n.opts.Storage.(io.Closer); ok {
+				if err := closer.Close(); err != nil {
+					log.Printf("Ошибка закрытия журнала Raft: %v", err)
+				}
+			}
+			return
+		case msg := <-n.inbox:
+			n.step(msg)
+		case p := <-n.proposals:
+			n.propose(p)
+		case index := <-n.compactions:
+			n.compact(index)
+		case err := <-n.installed:
+			n.finishInstall(err)
+		case <-ticker.C:
+			n.tick()
+		}
+		n.publish()
+	}
+}
+
+func (n *raftNode) publish() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.status = RaftStatus{
+		ID:            n.opts.ID,
+		Role:          n.role,
+		Term:          n.term,
+		Leader:        n.leader,
+		CommitIndex:   n.commitIndex,
+		AppliedIndex:  n.applied,
+		LastIndex:     n.lastIndex(),
+		SnapshotIndex: n.snapIndex,
+	}
+}
+
+// Status возвращает состояние узла; безопасен для вызова из любой горутины
+func (n *raftNode) Status() RaftStatus {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.status
+}
+
+func (n *raftNode) send(msg RaftMessage) {
+	msg.From = n.opts.ID
+	msg.Term = n.term
+	n.opts.Transport.Send(msg)
+}
+
+func (n *raftNode) saveHardState() error {
+	err := n.opts.Storage.SaveHardState(n.term, n.votedFor)
+	if err != nil {
+		log.Printf("Ошибка сохранения состояния Raft: %v", err)
+	}
+	return err
+}
+
+func (n *raftNode) resetTimeout() {
+	n.elapsed = 0
+	n.timeout = n.opts.ElectionTicks + rand.IntN(n.opts.ElectionTicks)
+}
+
+func (n *raftNode) tick() {
+	if n.role == raftLeader {
+		n.heartbeatElapsed++
+		if n.heartbeatElapsed >= n.opts.HeartbeatTicks {
+			n.heartbeatElapsed = 0
+			n.broadcastAppend()
+		}
+		return
+	}
+	n.elapsed++
+	// Узел, устанавливающий снапшот, заведомо отстаёт и не выдвигается, пока установка не закончится
+	if n.elapsed >= n.timeout && n.installing == nil {
+		n.campaign()
+	}
+}
+
+// campaign начинает выборы: узел увеличивает term, голосует за себя и запрашивает голоса остальных
+func (n *raftNode) campaign() {
+	n.role = raftCandidate
+	n.term++
+	n.votedFor = n.opts.ID
+	n.leader = ""
+	n.resetTimeout()
+	if n.saveHardState() != nil {
+		// Голос за себя не сохранён: после перезапуска узел мог бы проголосовать в этом term ещё раз
+		n.role = raftFollower
+		return
+	}
+	n.votes = map[string]bool{n.opts.ID: true}
+	if len(n.votes) >= n.quorum() {
+		n.becomeLeader()
+		return
+	}
+	lastTerm, _ := n.termAt(n.lastIndex())
+	for _, peer := range n.opts.Peers {
+		n.send(RaftMessage{Type: raftVote, To: peer, LastLogIndex: n.lastIndex(), LastLogTerm: lastTerm})
+	}
+}
+
+func (n *raftNode) becomeLeader() {
+	log.Printf("Узел Raft %s стал лидером, term %d", n.opts.ID, n.term)
+	n.role = raftLeader
+	n.leader = n.opts.ID
+	n.heartbeatElapsed = 0
+	n.next = make(map[string]uint64, len(n.opts.Peers))
+	n.match = make(map[string]uint64, len(n.opts.Peers))
+	n.transfers = make(map[string]*raftSnapshotTransfer)
+	n.discardSnapshot()
+	for _, peer := range n.opts.Peers {
+		n.next[peer] = n.lastIndex() + 1
+	}
+	// Записи прежних term коммитятся только вместе с записью текущего term
+	if err := n.appendEntry(nil); err != nil {
+		log.Printf("Ошибка записи в журнал Raft: %v", err)
+	}
+	n.broadcastAppend()
+	n.maybeCommit()
+}
+
+// becomeFollower переводит узел в реплики term; leader — узел, от которого пришло сообщение лидера.
+// Если новый term не удалось сохранить, узел остаётся в прежнем term и роли и возвращает false:
+// после перезапуска он мог бы проголосовать в новом term повторно.
+func (n *raftNode) becomeFollower(term uint64, leader string) bool {
+	if term > n.term {
+		prevTerm, prevVote := n.term, n.votedFor
+		n.term, n.votedFor = term, ""
+		if n.saveHardState() != nil {
+			n.term, n.votedFor = prevTerm, prevVote
+			return false
+		}
+	}
+	if n.role == raftLeader {
+		n.failPending(&NotLeaderError{Leader: leader})
+	}
+	n.role = raftFollower
+	n.leader = leader
+	if leader != "" {
+		n.elapsed = 0
+	}
+	return true
+}
+
+// failPending отвечает ошибкой на предложенные транзакции: их записи могут быть заменены записями нового лидера
+func (n *raftNode) failPending(err error) {
+	for _, result := range n.pending {
+		result <- err
+	}
+	clear(n.pending)
+}
+
+func (n *raftNode) appendEntry(txn *Transaction) error {
+	entry := RaftEntry{Index: n.lastIndex() + 1, Term: n.term, Txn: txn}
+	if err := n.opts.Storage.Append([]RaftEntry{entry}); err != nil {
+		return err
+	}
+	n.entries = append(n.entries, entry)
+	return nil
+}
+
+func (n *raftNode) propose(p raftProposal) {
+	if n.role != raftLeader {
+		p.result <- &NotLeaderError{Leader: n.leader}
+		return
+	}
+	if err := n.appendEntry(p.txn); err != nil {
+		p.result <- err
+		return
+	}
+	n.pending[n.lastIndex()] = p.result
+	n.broadcastAppend()
+	n.maybeCommit()
+}
+
+func (n *raftNode) step(msg RaftMessage) {
+	switch {
+	case msg.Term > n.term:
+		leader := ""
+		if msg.Type == raftAppend || msg.Type == raftSnapshot {
+			leader = msg.From
+		}
+		if !n.becomeFollower(msg.Term, leader) {
+			// Сообщение отбрасывается; отправитель повторит его
+			return
+		}
+	case msg.Term < n.term:
+		// Устаревший лидер или кандидат узнаёт текущий term из ответа
+		switch msg.Type {
+		case raftAppend, raftSnapshot:
+			n.send(RaftMessage{Type: raftAppendResp, To: msg.From})
+		case raftVote:
+			n.send(RaftMessage{Type: raftVoteResp, To: msg.From})
+		}
+		return
+	}
+
+	switch msg.Type {
+	case raftVote:
+		n.handleVote(msg)
+	case raftVoteResp:
+		if n.role == raftCandidate && msg.Granted {
+			n.votes[msg.From] = true
+			if len(n.votes) >= n.quorum() {
+				n.becomeLeader()
+			}
+		}
+	case raftAppend, raftSnapshot:
+		if n.role != raftFollower || n.leader != msg.From {
+			n.becomeFollower(msg.Term, msg.From)
+		}
+		n.elapsed = 0
+		if n.installing != nil {
+			// Записи после снапшота и его повторные части лидер пришлёт снова после установки
+			return
+		}
+		if msg.Type == raftAppend {
+			n.handleAppend(msg)
+		} else {
+			n.handleSnapshot(msg)
+		}
+	case raftAppendResp:
+		if n.role == raftLeader {
+			n.handleAppendResp(msg)
+		}
+	case raftSnapshotResp:
+		if n.role == raftLeader {
+			n.handleSnapshotResp(msg)
+		}
+	}
+}
+
+// handleVote голосует за кандидата, если узел ещё не голосовал в этом term,
+// а журнал кандидата не отстаёт от журнала узла
+func (n *raftNode) handleVote(msg RaftMessage) {
+	lastTerm, _ := n.termAt(n.lastIndex())
+	upToDate := msg.LastLogTerm > lastTerm || (msg.LastLogTerm == lastTerm && msg.LastLogIndex >= n.lastIndex())
+	granted := upToDate && (n.votedFor == "" || n.votedFor == msg.From)
+	if granted {
+		prev := n.votedFor
+		n.votedFor = msg.From
+		if n.saveHardState() != nil {
+			// Голос отдаётся только после сохранения
+			n.votedFor = prev
+			granted = false
+		} else {
+			n.elapsed = 0
+		}
+	}
+	n.send(RaftMessage{Type: raftVoteResp, To: msg.From, Granted: granted})
+}
+
+// handleAppend дописывает записи лидера после PrevLogIndex, если журнал узла совпадает с журналом
+// лидера на этом индексе. Расходящиеся незакоммиченные записи узла заменяются записями лидера.
+func (n *raftNode) handleAppend(msg RaftMessage) {
+	resp := RaftMessage{Type: raftAppendResp, To: msg.From}
+	prev, entries := msg.PrevLogIndex, msg.Entries
+	if prev < n.snapIndex {
+		// Записи до снапшота закоммичены и совпадают с журналом лидера
+		skip := n.snapIndex - prev
+		if skip >= uint64(len(entries)) {
+			entries = nil
+		} else {
+			entries = entries[skip:]
+		}
+		prev = n.snapIndex
+	} else if term, ok := n.termAt(prev); !ok || term != msg.PrevLogTerm {
+		// Лидер повторит с начала расходящегося term или с конца журнала узла
+		hint := min(prev-1, n.lastIndex())
+		if ok {
+			for hint > n.snapIndex {
+				if t, _ := n.termAt(hint); t != term {
+					break
+				}
+				hint--
+			}
+		}
+		resp.MatchIndex = hint
+		n.send(resp)
+		return
+	}
+
+	for i, entry := range entries {
+		if entry.Index <= n.lastIndex() {
+			if term, _ := n.termAt(entry.Index); term == entry.Term {
+				continue
+			}
+		}
+		// Журнал в памяти обрезается только после сохранения: при ошибке он совпадает с сохранённым
+		if err := n.opts.Storage.Append(entries[i:]); err != nil {
+			log.Printf("Ошибка записи в журнал Raft: %v", err)
+			return
+		}
+		n.entries = append(n.entries[:entry.Index-n.snapIndex-1], entries[i:]...)
+		break
+	}
+	last := prev + uint64(len(entries))
+	if commit := min(msg.Commit, last); commit > n.commitIndex {
+		n.commitIndex = commit
+		n.apply()
+	}
+	resp.Success = true
+	resp.MatchIndex = last
+	n.send(resp)
+}
+
+func (n *raftNode) handleAppendResp(msg RaftMessage) {
+	peer := msg.From
+	if msg.Success {
+		if msg.MatchIndex > n.match[peer] {
+			n.match[peer] = msg.MatchIndex
+		}
+		if transfer := n.transfers[peer]; transfer != nil && n.match[peer] >= transfer.index {
+			delete(n.transfers, peer)
+		}
+		n.next[peer] = max(n.next[peer], n.match[peer]+1)
+		n.maybeCommit()
+		if n.next[peer] <= n.lastIndex() {
+			n.sendAppend(peer)
+		}
+		return
+	}
+	n.next[peer] = max(min(n.next[peer]-1, msg.MatchIndex+1), n.match[peer]+1, 1)
+	n.sendAppend(peer)
+}
+
+func (n *raftNode) broadcastAppend() {
+	for _, peer := range n.opts.Peers {
+		n.sendAppend(peer)
+	}
+}
+
+// sendAppend отправляет узлу записи начиная с next; удалённые снапшотом записи заменяет чекпоинт
+func (n *raftNode) sendAppend(peer string) {
+	next := n.next[peer]
+	if next <= n.snapIndex {
+		n.sendSnapshot(peer)
+		return
+	}
+	prev := next - 1
+	prevTerm, _ := n.termAt(prev)
+	from := int(prev - n.snapIndex)
+	to := min(len(n.entries), from+raftMaxAppend)
+	n.send(RaftMessage{
+		Type:         raftAppend,
+		To:           peer,
+		PrevLogIndex: prev,
+		PrevLogTerm:  prevTerm,
+		Entries:      slices.Clone(n.entries[from:to]),
+		Commit:       n.commitIndex,
+	})
+}
+
+// sendSnapshot отправляет узлу очередную часть чекпоинта Engine. Передача начинается с последнего чекпоинта;
+// пока она идёт, heartbeat повторяет неподтверждённую часть. Файл чекпоинта неизменен после записи,
+// поэтому читается из горутины Raft; следующий чекпоинт не старше снапшота Raft.
+func (n *raftNode) sendSnapshot(peer string) {
+	transfer := n.transfers[peer]
+	if transfer == nil || transfer.index < n.snapIndex {
+		snapshots, err := listSnapshots(n.engine.dir.snapshotDir())
+		if err != nil || len(snapshots) == 0 || snapshots[0].lsn < n.snapIndex {
+			log.Printf("Нет чекпоинта для отправки узлу Raft %s: %v", peer, err)
+			return
+		}
+		term, ok := n.termAt(snapshots[0].lsn)
+		if !ok {
+			return
+		}
+		transfer = &raftSnapshotTransfer{index: snapshots[0].lsn, term: term, path: snapshots[0].path}
+		n.transfers[peer] = transfer
+	}
+	data, done, err := readSnapshotChunk(transfer.path, transfer.offset, n.opts.SnapshotChunk)
+	if err != nil {
+		// Чекпоинт удалён после записи следующего: передача начнётся заново с последнего
+		log.Printf("Ошибка чтения чекпоинта для узла Raft %s: %v", peer, err)
+		delete(n.transfers, peer)
+		return
+	}
+	n.send(RaftMessage{Type: raftSnapshot, To: peer, Snapshot: &RaftSnapshot{
+		Index:  transfer.index,
+		Term:   transfer.term,
+		Offset: transfer.offset,
+		Data:   data,
+		Done:   done,
+	}})
+}
+
+// readSnapshotChunk читает до size байт файла чекпоинта с позиции offset; done — часть последняя
+func readSnapshotChunk(path string, offset int64, size int) ([]byte, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	if offset > info.Size() {
+		return nil, false, errors.New("позиция за концом чекпоинта")
+	}
+	data := make([]byte, min(int64(size), info.Size()-offset))
+	if _, err := file.ReadAt(data, offset); err != nil {
+		return nil, false, err
+	}
+	return data, offset+int64(len(data)) == info.Size(), nil
+}
+
+// handleSnapshotResp продолжает передачу чекпоинта с позиции, которую подтвердил узел
+func (n *raftNode) handleSnapshotResp(msg RaftMessage) {
+	transfer := n.transfers[msg.From]
+	if transfer == nil || msg.Snapshot == nil || msg.Snapshot.Index != transfer.index {
+		return
+	}
+	transfer.offset = msg.Snapshot.Offset
+	n.sendSnapshot(msg.From)
+}
+
+// handleSnapshot дописывает часть чекпоинта лидера во временный файл и после последней части
+// заменяет им состояние Engine. Часть не с той позиции, которую ждёт узел, отбрасывается,
+// а лидер узнаёт из ответа, с какой позиции продолжить.
+func (n *raftNode) handleSnapshot(msg RaftMessage) {
+	snapshot := msg.Snapshot
+	if snapshot.Index <= n.commitIndex {
+		n.send(RaftMessage{Type: raftAppendResp, To: msg.From, Success: true, MatchIndex: snapshot.Index})
+		return
+	}
+	in := n.incoming
+	if in == nil || in.from != msg.From || in.index != snapshot.Index || in.term != snapshot.Term {
+		n.discardSnapshot()
+		if snapshot.Offset != 0 {
+			n.sendSnapshotResp(msg.From, snapshot.Index, 0)
+			return
+		}
+		// Временный файл удаляется при загрузке чекпоинтов, если узел остановится посреди передачи
+		file, err := os.CreateTemp(n.engine.dir.snapshotDir(), snapshotPrefix+"raft-*"+snapshotTmpExt)
+		if err != nil {
+			log.Printf("Ошибка создания файла снапшота Raft: %v", err)
+			return
+		}
+		in = &raftIncomingSnapshot{from: msg.From, index: snapshot.Index, term: snapshot.Term, file: file}
+		n.incoming = in
+	}
+	if snapshot.Offset != in.size {
+		n.sendSnapshotResp(msg.From, snapshot.Index, in.size)
+		return
+	}
+	if _, err := in.file.Write(snapshot.Data); err != nil {
+		log.Printf("Ошибка записи снапшота Raft от %s: %v", msg.From, err)
+		n.discardSnapshot()
+		return
+	}
+	in.size += int64(len(snapshot.Data))
+	if !snapshot.Done {
+		n.sendSnapshotResp(msg.From, snapshot.Index, in.size)
+		return
+	}
+	n.startInstall()
+}
+
+func (n *raftNode) sendSnapshotResp(to string, index uint64, offset int64) {
+	n.send(RaftMessage{Type: raftSnapshotResp, To: to, Snapshot: &RaftSnapshot{Index: index, Offset: offset}})
+}
+
+// discardSnapshot удаляет недособранный чекпоинт
+func (n *raftNode) discardSnapshot() {
+	if n.incoming == nil {
+		return
+	}
+	n.incoming.file.Close()
+	os.Remove(n.incoming.file.Name())
+	n.incoming = nil
+}
+
+// Вызывается в горутине установки снапшота Raft перед установкой; используется тестами,
+// чтобы удержать установку и проверить, что узел Raft продолжает обрабатывать сообщения
+var raftInstallHook func()
+
+// startInstall передаёт собранный чекпоинт Engine. Установка большого чекпоинта долгая, поэтому идёт
+// в отдельной горутине: узел Raft тем временем отвечает на голосования и heartbeat лидера.
+func (n *raftNode) startInstall() {
+	in := n.incoming
+	n.incoming, n.installing = nil, in
+	go func() {
+		if raftInstallHook != nil {
+			raftInstallHook()
+		}
+		n.installed <- n.engine.installRaftSnapshot(in.file)
+	}()
+}
+
+// finishInstall удаляет файл установленного чекпоинта и сжимает журнал Raft до его индекса
+func (n *raftNode) finishInstall(err error) {
+	in := n.installing
+	n.installing = nil
+	in.file.Close()
+	os.Remove(in.file.Name())
+	if err != nil {
+		log.Printf("Ошибка установки снапшота Raft от %s: %v", in.from, err)
+		return
+	}
+	index, term := in.index, in.term
+	// Записи после снапшота сохраняются, если журнал совпадает с журналом лидера на индексе снапшота
+	if t, ok := n.termAt(index); ok && t == term && index > n.snapIndex {
+		n.entries = slices.Clone(n.entries[index-n.snapIndex:])
+	} else {
+		n.entries = nil
+	}
+	n.snapIndex, n.snapTerm = index, term
+	n.commitIndex, n.applied = index, index
+	if err := n.opts.Storage.Compact(index, term); err != nil {
+		log.Printf("Ошибка сжатия журнала Raft: %v", err)
+	}
+	log.Printf("Узел Raft %s установил снапшот %d от %s", n.opts.ID, index, in.from)
+	n.send(RaftMessage{Type: raftAppendResp, To: in.from, Success: true, MatchIndex: index})
+}
+
+// maybeCommit продвигает индекс коммита до записи текущего term, сохранённой на большинстве узлов
+func (n *raftNode) maybeCommit() {
+	matches := []uint64{n.lastIndex()}
+	for _, peer := range n.opts.Peers {
+		matches = append(matches, n.match[peer])
+	}
+	slices.Sort(matches)
+	slices.Reverse(matches)
+	index := matches[n.quorum()-1]
+	if term, _ := n.termAt(index); index > n.commitIndex && term == n.term {
+		n.commitIndex = index
+		n.apply()
+	}
+}
+
+// apply передаёт Engine закоммиченные записи. Engine не ждёт горутину Raft,
+// поэтому отправка команды не приводит к взаимной блокировке.
+func (n *raftNode) apply() {
+	if n.commitIndex <= n.applied {
+		return
+	}
+	committed := make([]raftCommitted, 0, n.commitIndex-n.applied)
+	for index := n.applied + 1; index <= n.commitIndex; index++ {
+		committed = append(committed, raftCommitted{entry: n.entries[index-n.snapIndex-1], result: n.pending[index]})
+	}
+	select {
+	case n.engine.commands <- Command{action: "raftApply", committed: committed}:
+		for index := n.applied + 1; index <= n.commitIndex; index++ {
+			delete(n.pending, index)
+		}
+		n.applied = n.commitIndex
+	case <-n.engine.ctx.Done():
+	}
+}
+
+// compactTo передаёт узлу LSN сохранённого чекпоинта. Вызывается из горутины Engine и не блокирует её:
+// пропущенное сжатие выполнится после следующего чекпоинта.
+func (n *raftNode) compactTo(index uint64) {
+	select {
+	case n.compactions <- index:
+	default:
+	}
+}
+
+// compact удаляет из журнала записи, покрытые чекпоинтом Engine с LSN index
+func (n *raftNode) compact(index uint64) {
+	if index <= n.snapIndex || index > n.applied {
+		return
+	}
+	term, _ := n.termAt(index)
+	n.entries = slices.Clone(n.entries[index-n.snapIndex:])
+	n.snapIndex, n.snapTerm = index, term
+	if err := n.opts.Storage.Compact(index, term); err != nil {
+		log.Printf("Ошибка сжатия журнала Raft: %v", err)
+	}
+}
+
+// propose предлагает транзакцию записи журналу Raft. Ответ клиенту придёт после её коммита
+// и применения, либо ошибкой, если узел не лидер.
+func (e *Engine) propose(cmd Command, action string) {
+	if e.walErr != nil {
+		cmd.result <- e.walErr
+		return
+	}
+	txn := &Transaction{Action: action, Name: e.name, Feature: cmd.feature}
+	if err := (RaftEntry{Txn: txn}).validate(); err != nil {
+		cmd.result <- err
+		return
+	}
+	if _, exists := e.data[cmd.feature.ID.(string)]; action == "delete" && !exists {
+		cmd.result <- errors.New("объект не найден")
+		return
+	}
+	select {
+	case e.raft.proposals <- raftProposal{txn: txn, result: cmd.result}:
+	default:
+		cmd.result <- errors.New("очередь транзакций Raft переполнена")
+	}
+}
+
+// handleRaftApply пишет закоммиченные записи Raft в журнал транзакций и применяет их после того,
+// как журнал сохранён. LSN транзакции — индекс записи; записи, уже применённые до перезапуска, пропускаются.
+// После ошибки журнала узел перестаёт применять записи, как и принимать транзакции: состояние в памяти
+// не должно опережать журнал. Закоммиченные записи остаются в журнале Raft и применяются после перезапуска.
+func (e *Engine) handleRaftApply(cmd Command) {
+	for _, c := range cmd.committed {
+		if e.walErr != nil {
+			if c.result != nil {
+				c.result <- e.walErr
+			}
+			continue
+		}
+		index, term := c.entry.Index, c.entry.Term
+		if index <= e.lsn {
+			if c.result != nil {
+				c.result <- nil
+			}
+			continue
+		}
+		var txn *Transaction
+		rejected := c.entry.validate()
+		if rejected != nil {
+			// Запись закоммичена на всех узлах, поэтому все пропускают её одинаково: как пустая запись,
+			// она занимает LSN, но не применяется
+			log.Printf("Некорректная запись Raft %d пропущена: %v", index, rejected)
+		} else if c.entry.Txn != nil {
+			txn = &Transaction{Action: c.entry.Txn.Action, Name: e.name, LSN: index, Term: term, Feature: c.entry.Txn.Feature}
+			if err := e.logTransaction(txn); err != nil {
+				e.failWAL(err)
+				if c.result != nil {
+					c.result <- err
+				}
+				continue
+			}
+		}
+		e.lsn = index
+		result := c.result
+		// Пустая запись лидера не пишется в журнал транзакций, но занимает LSN и применяется
+		// в порядке остальных записей
+		e.wal.commit(func(err error) {
+			if err != nil {
+				e.failWAL(err)
+				// LSN остаётся на последней применённой записи
+				e.lsn = vclockLSN(e.vclock)
+			} else if txn != nil {
+				e.applyTransaction(txn)
+			} else {
+				e.vclock[e.name] = index
+				e.lastTerm = term
+			}
+			if result != nil {
+				if err == nil {
+					err = rejected
+				}
+				result <- err
+			}
+		})
+	}
+}
+
+// installRaftSnapshot проверяет собранный чекпоинт лидера и заменяет им состояние Engine,
+// применяя его из файла по одному объекту. Вызывается из горутины установки, а не из горутины Raft.
+func (e *Engine) installRaftSnapshot(file *os.File) error {
+	// Чекпоинт проверяется до установки: установка сначала удаляет прежнее состояние Engine
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := verifyCheckpoint(file); err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return e.execute(Command{action: "raftSnapshot", snapshot: file, result: make(chan error, 1)})
+}
+
+// handleRaftSnapshot заменяет состояние узла снапшотом лидера Raft
+func (e *Engine) handleRaftSnapshot(cmd Command) {
+	if err := e.installCheckpoint(cmd.snapshot); err != nil {
+		cmd.result <- err
+		return
+	}
+	cmd.result <- e.checkpoint()
+}
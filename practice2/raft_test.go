@@ -0,0 +1,594 @@
+package practice2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type raftTestNode struct {
+	id      string
+	dir     string
+	log     *MemoryRaftStorage
+	storage *Storage
+}
+
+// Функция для запуска репликасета Raft из size узлов, связанных транспортом в памяти
+func startRaftCluster(t *testing.T, size int, opts ...Option) ([]*raftTestNode, *MemoryTransport) {
+	t.Helper()
+	transport := NewMemoryTransport()
+	nodes := make([]*raftTestNode, size)
+	for i := range nodes {
+		nodes[i] = &raftTestNode{id: fmt.Sprintf("node%d", i+1), dir: t.TempDir(), log: NewMemoryRaftStorage()}
+	}
+	for _, node := range nodes {
+		node.start(t, nodes, transport, opts...)
+	}
+	t.Cleanup(func() {
+		for _, node := range nodes {
+			node.stop()
+		}
+	})
+	return nodes, transport
+}
+
+func (n *raftTestNode) start(t *testing.T, nodes []*raftTestNode, transport *MemoryTransport, opts ...Option) {
+	t.Helper()
+	raftOpts := RaftOptions{ID: n.id, Transport: transport, Storage: n.log, TickInterval: 5 * time.Millisecond, ElectionTicks: 10, HeartbeatTicks: 2, SnapshotChunk: 512}
+	for _, node := range nodes {
+		if node != n {
+			raftOpts.Peers = append(raftOpts.Peers, node.id)
+		}
+	}
+	s, err := NewStorage(http.NewServeMux(), n.dir, "storage", nil, false, append(opts, WithRaft(raftOpts))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.storage = s
+}
+
+func (n *raftTestNode) stop() {
+	if n.storage != nil {
+		n.storage.Stop()
+		n.storage = nil
+	}
+}
+
+// Функция для ожидания единственного лидера среди запущенных и не изолированных узлов
+func waitRaftLeader(t *testing.T, nodes []*raftTestNode, minTerm uint64) *raftTestNode {
+	t.Helper()
+	var leader *raftTestNode
+	waitFor(t, "raft leader", func() bool {
+		for _, node := range nodes {
+			if node.storage == nil {
+				continue
+			}
+			if status := node.storage.engine.raft.Status(); status.Role == raftLeader && status.Term > minTerm {
+				leader = node
+				return true
+			}
+		}
+		return false
+	})
+	return leader
+}
+
+func raftWrite(s *Storage, action, id string) error {
+	cmd := Command{action: action, feature: newTestFeature(id, 1, 1), result: make(chan error, 1)}
+	s.engine.commands <- cmd
+	return <-cmd.result
+}
+
+// Функция для записи через текущего лидера; повторяет запись, если лидер сменился до коммита
+func raftExec(t *testing.T, nodes []*raftTestNode, action, id string) {
+	t.Helper()
+	var err error
+	waitFor(t, action+" "+id, func() bool {
+		var notLeader *NotLeaderError
+		err = raftWrite(waitRaftLeader(t, nodes, 0).storage, action, id)
+		return !errors.As(err, &notLeader)
+	})
+	if err != nil {
+		t.Fatalf("%s failed: %v", action, err)
+	}
+}
+
+func TestRaftReplication(t *testing.T) {
+	nodes, _ := startRaftCluster(t, 3)
+	leader := waitRaftLeader(t, nodes, 0)
+
+	execCommand(t, leader.storage, "insert", newTestFeature("a", 1, 1))
+	execCommand(t, leader.storage, "insert", newTestFeature("b", 2, 2))
+	execCommand(t, leader.storage, "delete", newTestFeature("a", 0, 0))
+	// Лидер отвечает после коммита: запись уже есть на большинстве узлов
+	for _, node := range nodes {
+		waitFor(t, "apply on "+node.id, func() bool { return sameIDs(searchIDs(t, node.storage), "b") })
+	}
+
+	// Реплика не принимает записи и сообщает ID лидера
+	for _, node := range nodes {
+		if node == leader {
+			continue
+		}
+		var notLeader *NotLeaderError
+		if err := raftWrite(node.storage, "insert", "c"); !errors.As(err, &notLeader) || notLeader.Leader != leader.id {
+			t.Errorf("Expected NotLeaderError with leader %s from %s, got %v", leader.id, node.id, err)
+		}
+	}
+	status := replicationStatus(leader.storage)
+	if !status.Leader || status.Raft == nil || status.Raft.CommitIndex != status.VClock["storage"] {
+		t.Errorf("Unexpected leader replication status: %+v", status)
+	}
+}
+
+func TestRaftDiscardsUncommittedEntries(t *testing.T) {
+	nodes, transport := startRaftCluster(t, 3)
+	oldLeader := waitRaftLeader(t, nodes, 0)
+	execCommand(t, oldLeader.storage, "insert", newTestFeature("a", 1, 1))
+
+	// Изолированный лидер принимает транзакцию, но не может её закоммитить
+	transport.Isolate(oldLeader.id)
+	cmd := Command{action: "insert", feature: newTestFeature("lost", 1, 1), result: make(chan error, 1)}
+	oldLeader.storage.engine.commands <- cmd
+
+	var rest []*raftTestNode
+	for _, node := range nodes {
+		if node != oldLeader {
+			rest = append(rest, node)
+		}
+	}
+	newLeader := waitRaftLeader(t, rest, oldLeader.storage.engine.raft.Status().Term)
+	execCommand(t, newLeader.storage, "insert", newTestFeature("b", 2, 2))
+
+	// После восстановления связи незакоммиченная запись заменяется записями нового лидера
+	transport.Heal(oldLeader.id)
+	select {
+	case err := <-cmd.result:
+		var notLeader *NotLeaderError
+		if !errors.As(err, &notLeader) {
+			t.Errorf("Expected NotLeaderError for uncommitted insert, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for uncommitted insert to fail")
+	}
+	for _, node := range nodes {
+		waitFor(t, "converged history on "+node.id, func() bool { return sameIDs(searchIDs(t, node.storage), "a", "b") })
+	}
+}
+
+// Функция для отделения реплики от репликасета, пока остальные узлы записывают объекты f0..f19,
+// удаляют f0 и сжимают журнал Raft чекпоинтом. Возвращает лидера и отставшую реплику
+func isolateAndCompact(t *testing.T, nodes []*raftTestNode, transport *MemoryTransport) (leader, lagging *raftTestNode) {
+	t.Helper()
+	leader = waitRaftLeader(t, nodes, 0)
+	for _, node := range nodes {
+		if node != leader {
+			lagging = node
+			break
+		}
+	}
+
+	transport.Isolate(lagging.id)
+	for i := 0; i < 20; i++ {
+		execCommand(t, leader.storage, "insert", newTestFeature(fmt.Sprintf("f%d", i), float64(i), 0))
+	}
+	execCommand(t, leader.storage, "delete", newTestFeature("f0", 0, 0))
+	// Чекпоинт удаляет из журнала Raft записи, которых нет у изолированной реплики. Он создаётся на всех
+	// остальных узлах: кто бы ни стал лидером после возвращения реплики, догнать её можно только снапшотом
+	lsn := replicationStatus(leader.storage).VClock["storage"]
+	for _, node := range nodes {
+		if node == lagging {
+			continue
+		}
+		waitFor(t, "apply on "+node.id, func() bool { return replicationStatus(node.storage).VClock["storage"] >= lsn })
+		execCommand(t, node.storage, "checkpoint", nil)
+		waitFor(t, "log compaction on "+node.id, func() bool {
+			return node.storage.engine.raft.Status().SnapshotIndex == replicationStatus(node.storage).VClock["storage"]
+		})
+	}
+	return leader, lagging
+}
+
+func TestRaftSnapshotCatchUp(t *testing.T) {
+	nodes, transport := startRaftCluster(t, 3, WithSnapshotRetention(1))
+	leader, lagging := isolateAndCompact(t, nodes, transport)
+	// Чекпоинт передаётся несколькими частями
+	snapshots, err := listSnapshots(leader.storage.engine.dir.snapshotDir())
+	if err != nil || len(snapshots) == 0 {
+		t.Fatalf("Leader has no checkpoint: %v", err)
+	}
+	if info, err := os.Stat(snapshots[0].path); err != nil || info.Size() <= 2*512 {
+		t.Fatalf("Checkpoint should span several snapshot chunks: %v %v", info, err)
+	}
+
+	// Изолированный узел увеличивал term, поэтому после возвращения в сеть лидер может смениться,
+	// но журнал любого нового лидера начинается после последней записи реплики
+	transport.Heal(lagging.id)
+	raftExec(t, nodes, "insert", "tail")
+	waitFor(t, "snapshot install", func() bool {
+		ids := searchIDs(t, lagging.storage)
+		return len(ids) == 20 && ids["tail"] && !ids["f0"]
+	})
+	if status := lagging.storage.engine.raft.Status(); status.SnapshotIndex == 0 {
+		t.Errorf("Expected lagging node to install snapshot, got %+v", status)
+	}
+
+	// После перезапуска узел продолжает с применённого LSN, не применяя записи повторно
+	lagging.stop()
+	lagging.start(t, nodes, transport, WithSnapshotRetention(1))
+	raftExec(t, nodes, "insert", "after")
+	waitFor(t, "catch-up after restart", func() bool {
+		ids := searchIDs(t, lagging.storage)
+		return len(ids) == 21 && ids["after"]
+	})
+}
+
+func TestRaftServesWhileInstallingSnapshot(t *testing.T) {
+	nodes, transport := startRaftCluster(t, 3, WithSnapshotRetention(1))
+	_, lagging := isolateAndCompact(t, nodes, transport)
+
+	// Удерживаем установку снапшота, пока проверяем, что узел Raft отвечает на сообщения
+	started := make(chan struct{})
+	release := make(chan struct{})
+	raftInstallHook = func() {
+		close(started)
+		<-release
+	}
+	releaseInstall := sync.OnceFunc(func() { close(release) })
+	defer func() {
+		releaseInstall()
+		raftInstallHook = nil
+	}()
+	transport.Heal(lagging.id)
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for snapshot install")
+	}
+
+	replies := make(chan RaftMessage, 16)
+	transport.Register("probe", func(msg RaftMessage) {
+		select {
+		case replies <- msg:
+		default:
+		}
+	})
+	waitFor(t, "vote reply during snapshot install", func() bool {
+		term := lagging.storage.engine.raft.Status().Term
+		transport.Send(RaftMessage{Type: raftVote, From: "probe", To: lagging.id, Term: term})
+		select {
+		case <-replies:
+			return true
+		default:
+			return false
+		}
+	})
+	releaseInstall()
+	waitFor(t, "snapshot install", func() bool {
+		ids := searchIDs(t, lagging.storage)
+		return len(ids) == 19 && !ids["f0"]
+	})
+}
+
+func TestFileRaftStorage(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileRaftStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := func(index, term uint64) RaftEntry {
+		return RaftEntry{Index: index, Term: term, Txn: &Transaction{Action: "insert", Feature: newTestFeature(fmt.Sprint(index), 1, 1)}}
+	}
+	if err := s.SaveHardState(2, "node2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append([]RaftEntry{entry(1, 1), entry(2, 1), entry(3, 1)}); err != nil {
+		t.Fatal(err)
+	}
+	// Записи лидера нового term заменяют расходящийся хвост
+	if err := s.Append([]RaftEntry{entry(3, 2), entry(4, 2)}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	reopen := func() RaftState {
+		t.Helper()
+		s, err = NewFileRaftStorage(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state, err := s.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return state
+	}
+	terms := func(state RaftState) []uint64 {
+		var terms []uint64
+		for i, e := range state.Entries {
+			if e.Index != state.SnapshotIndex+uint64(i)+1 {
+				t.Fatalf("Unexpected index %d at position %d after snapshot %d", e.Index, i, state.SnapshotIndex)
+			}
+			terms = append(terms, e.Term)
+		}
+		return terms
+	}
+	state := reopen()
+	if state.Term != 2 || state.VotedFor != "node2" || fmt.Sprint(terms(state)) != "[1 1 2 2]" {
+		t.Errorf("Unexpected state after restart: term %d, vote %q, terms %v", state.Term, state.VotedFor, terms(state))
+	}
+
+	if err := s.Compact(2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append([]RaftEntry{entry(5, 3)}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	// Падение посреди Append оставляет оборванную запись в конце файла
+	path := filepath.Join(dir, raftLogName)
+	record, err := encodeFrame(6, []byte(`{"index":6,"term":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(record[:len(record)-3])
+	file.Close()
+	state = reopen()
+	if state.SnapshotIndex != 2 || state.SnapshotTerm != 1 || fmt.Sprint(terms(state)) != "[2 2 3]" {
+		t.Errorf("Unexpected state after compaction: snapshot %d/%d, terms %v", state.SnapshotIndex, state.SnapshotTerm, terms(state))
+	}
+	s.Close()
+
+	// Повреждение подтверждённой записи не отрезается молча
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-walHeaderSize-5] ^= 0xff
+	if err := os.WriteFile(path, append(data, record...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileRaftStorage(dir); err == nil {
+		t.Error("Expected corrupted Raft log to be rejected")
+	}
+}
+
+func TestRaftHTTPTransport(t *testing.T) {
+	nodes := make([]*testNode, 3)
+	for i := range nodes {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes[i] = &testNode{name: fmt.Sprintf("storage%d", i+1), addr: listener.Addr().String(), dir: t.TempDir()}
+		listener.Close()
+	}
+	start := func(node *testNode, peers []string) {
+		t.Helper()
+		node.mux = http.NewServeMux()
+		// Журнал Raft по умолчанию хранится в рабочей директории узла
+		opts := RaftOptions{ID: node.peer(), Peers: peers, Transport: NewHTTPRaftTransport(node.mux), TickInterval: 5 * time.Millisecond, ElectionTicks: 10, HeartbeatTicks: 2}
+		s, err := NewStorage(node.mux, node.dir, node.name, peers, false, WithRaft(opts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.storage = s
+		listener, err := net.Listen("tcp", node.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.server = &httptest.Server{Listener: listener, Config: &http.Server{Handler: node.mux}}
+		node.server.Start()
+	}
+	for i, node := range nodes {
+		start(node, clusterPeers(nodes, i))
+		defer node.stop()
+	}
+	leaderOf := func() *testNode {
+		var leader *testNode
+		waitFor(t, "raft leader", func() bool {
+			for _, node := range nodes {
+				if node.storage != nil && node.storage.engine.raft.Status().Role == raftLeader {
+					leader = node
+					return true
+				}
+			}
+			return false
+		})
+		return leader
+	}
+
+	leader := leaderOf()
+	// Реплика узнаёт адрес лидера из его первого heartbeat; до этого она отвечает 503
+	waitFor(t, "followers learn the leader", func() bool {
+		leader = leaderOf()
+		for _, node := range nodes {
+			if node.storage.engine.raft.Status().Leader != leader.peer() {
+				return false
+			}
+		}
+		return true
+	})
+	// Реплика перенаправляет запись к лидеру по его адресу
+	for i, node := range nodes {
+		if node == leader {
+			continue
+		}
+		body, _ := json.Marshal(newTestFeature("a", 1, 1))
+		w := httptest.NewRecorder()
+		node.mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/"+node.name+"/insert", bytes.NewReader(body)))
+		if w.Code != http.StatusTemporaryRedirect || w.Header().Get("X-Leader") != leader.peer() {
+			t.Errorf("Expected redirect from node %d to leader %s, got %d %v", i+1, leader.peer(), w.Code, w.Header())
+		}
+	}
+	execCommand(t, leader.storage, "insert", newTestFeature("a", 1, 1))
+	for _, node := range nodes {
+		waitFor(t, "apply on "+node.name, func() bool { return sameIDs(searchIDs(t, node.storage), "a") })
+	}
+
+	// Перезапущенный узел восстанавливает term и журнал Raft из рабочей директории
+	var follower *testNode
+	for i, node := range nodes {
+		if node != leader {
+			follower = node
+			before := node.storage.engine.raft.Status()
+			node.stop()
+			start(node, clusterPeers(nodes, i))
+			if after := node.storage.engine.raft.Status(); after.Term < before.Term || after.LastIndex < before.LastIndex {
+				t.Errorf("Raft state lost on restart: before %+v, after %+v", before, after)
+			}
+			break
+		}
+	}
+	leader = leaderOf()
+	execCommand(t, leader.storage, "insert", newTestFeature("b", 2, 2))
+	waitFor(t, "catch-up after restart", func() bool { return sameIDs(searchIDs(t, follower.storage), "a", "b") })
+}
+
+func TestRaftApplyStopsOnWALError(t *testing.T) {
+	dir := t.TempDir()
+	transport := NewMemoryTransport()
+	opts := RaftOptions{ID: "node1", Transport: transport, TickInterval: 5 * time.Millisecond, ElectionTicks: 2, HeartbeatTicks: 1}
+	s, err := NewStorage(http.NewServeMux(), dir, "storage", nil, false, WithRaft(opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "raft leader", func() bool { return s.engine.raft.Status().Role == raftLeader })
+	execCommand(t, s, "insert", newTestFeature("a", 1, 1))
+	lsn := replicationStatus(s).VClock["storage"]
+
+	// Запись закоммичена в Raft, но журнал транзакций не сохранил её: узел не применяет её и следующие записи
+	walSyncHook = func() error { return errors.New("disk failure") }
+	err = raftWrite(s, "insert", "b")
+	walSyncHook = nil
+	if err == nil {
+		t.Error("Expected insert to fail after fsync error")
+	}
+	if err := raftWrite(s, "insert", "c"); err == nil {
+		t.Error("Expected writes to be rejected after WAL failure")
+	}
+	if status := replicationStatus(s); !sameIDs(searchIDs(t, s), "a") || status.VClock["storage"] != lsn {
+		t.Errorf("Entry applied despite WAL failure: ids %v, vclock %v", searchIDs(t, s), status.VClock)
+	}
+	s.Stop()
+
+	// После перезапуска закоммиченная запись восстанавливается из журнала Raft
+	s, err = NewStorage(http.NewServeMux(), dir, "storage", nil, false, WithRaft(opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	waitFor(t, "committed entry after restart", func() bool { return sameIDs(searchIDs(t, s), "a", "b") })
+}
+
+// failingRaftStorage — журнал Raft в памяти, запись в который можно сделать неудачной
+type failingRaftStorage struct {
+	*MemoryRaftStorage
+	fail bool
+}
+
+func (s *failingRaftStorage) Append(entries []RaftEntry) error {
+	if s.fail {
+		return errors.New("disk failure")
+	}
+	return s.MemoryRaftStorage.Append(entries)
+}
+
+func (s *failingRaftStorage) SaveHardState(term uint64, votedFor string) error {
+	if s.fail {
+		return errors.New("disk failure")
+	}
+	return s.MemoryRaftStorage.SaveHardState(term, votedFor)
+}
+
+func TestRaftAppendKeepsLogOnStorageError(t *testing.T) {
+	storage := &failingRaftStorage{MemoryRaftStorage: NewMemoryRaftStorage()}
+	n := &raftNode{opts: RaftOptions{ID: "node1", Transport: NewMemoryTransport(), Storage: storage}, role: raftFollower, term: 2}
+	entries := []RaftEntry{{Index: 1, Term: 1}, {Index: 2, Term: 1}, {Index: 3, Term: 1}}
+	n.handleAppend(RaftMessage{Type: raftAppend, From: "node2", Term: 2, Entries: entries})
+	if n.lastIndex() != 3 {
+		t.Fatalf("Append stored %d entries, expected 3", n.lastIndex())
+	}
+
+	// Лидер нового term заменяет хвост, но сохранить записи не удаётся: журнал в памяти не меняется
+	storage.fail = true
+	n.handleAppend(RaftMessage{Type: raftAppend, From: "node2", Term: 2, PrevLogIndex: 1, PrevLogTerm: 1, Entries: []RaftEntry{{Index: 2, Term: 2}}})
+	if term, _ := n.termAt(3); n.lastIndex() != 3 || term != 1 {
+		t.Errorf("Log changed in memory after a failed append: last index %d, term of 3 is %d", n.lastIndex(), term)
+	}
+	state, err := storage.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Entries) != int(n.lastIndex()) {
+		t.Errorf("Log in memory has %d entries, storage has %d", n.lastIndex(), len(state.Entries))
+	}
+}
+
+func TestRaftKeepsTermOnStorageError(t *testing.T) {
+	storage := &failingRaftStorage{MemoryRaftStorage: NewMemoryRaftStorage(), fail: true}
+	transport := NewMemoryTransport()
+	var replies []RaftMessage
+	transport.Register("node2", func(msg RaftMessage) { replies = append(replies, msg) })
+	n := &raftNode{opts: RaftOptions{ID: "node1", Transport: transport, Storage: storage}, role: raftLeader, term: 2, pending: make(map[uint64]chan error)}
+
+	// Новый term не сохранён: узел не переходит в него и не голосует
+	n.step(RaftMessage{Type: raftVote, From: "node2", To: "node1", Term: 3})
+	if n.term != 2 || n.role != raftLeader || len(replies) != 0 {
+		t.Errorf("Node moved to an unsaved term: term %d, role %s, replies %v", n.term, n.role, replies)
+	}
+
+	storage.fail = false
+	n.step(RaftMessage{Type: raftVote, From: "node2", To: "node1", Term: 3})
+	if n.term != 3 || n.role != raftFollower || len(replies) != 1 || !replies[0].Granted {
+		t.Errorf("Node did not vote in the saved term: term %d, role %s, replies %v", n.term, n.role, replies)
+	}
+}
+
+func TestRaftRejectsMalformedEntries(t *testing.T) {
+	mux := http.NewServeMux()
+	opts := RaftOptions{ID: "127.0.0.1:0/storage", Transport: NewHTTPRaftTransport(mux), TickInterval: 5 * time.Millisecond, ElectionTicks: 2, HeartbeatTicks: 1}
+	s, err := NewStorage(mux, t.TempDir(), "storage", nil, false, WithRaft(opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	waitFor(t, "raft leader", func() bool { return s.engine.raft.Status().Role == raftLeader })
+	execCommand(t, s, "insert", newTestFeature("a", 1, 1))
+
+	// Транспорт не передаёт узлу записи без объекта
+	body, err := json.Marshal(RaftMessage{Type: raftAppend, From: "other", Term: 1, Entries: []RaftEntry{{Index: 1, Term: 1, Txn: &Transaction{Action: "insert"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/storage/replication/raft", bytes.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected %d for an entry without feature, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Закоммиченная некорректная запись отклоняется при применении, Engine продолжает работать
+	lsn := replicationStatus(s).VClock["storage"]
+	result := make(chan error, 1)
+	entry := RaftEntry{Index: lsn + 1, Term: s.engine.raft.Status().Term, Txn: &Transaction{Action: "insert"}}
+	s.engine.commands <- Command{action: "raftApply", committed: []raftCommitted{{entry: entry, result: result}}}
+	if err := <-result; err == nil {
+		t.Error("Expected malformed entry to be rejected")
+	}
+	if !sameIDs(searchIDs(t, s), "a") {
+		t.Errorf("Malformed entry changed data: %v", searchIDs(t, s))
+	}
+}
@@ -0,0 +1,256 @@
+package practice2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// Раскладка журнала Raft в <wrkdir>/raft:
+//
+//	state.json — term и голос узла
+//	log        — записи в формате записей WAL (см. walrecord.go); первая запись — raftLogHeader
+//
+// Append дописывает записи в конец файла. Запись с индексом, который уже встречался в файле,
+// заменяет прежнюю запись и все последующие, поэтому при загрузке журнал восстанавливается
+// так же, как его изменяли вызовы Append. Compact переписывает файл целиком.
+const (
+	raftStateName = "state.json"
+	raftLogName   = "log"
+)
+
+type raftHardState struct {
+	Term     uint64 `json:"term"`
+	VotedFor string `json:"votedFor,omitempty"`
+}
+
+// raftLogHeader — первая запись файла журнала: последняя запись, покрытая снапшотом
+type raftLogHeader struct {
+	SnapshotIndex uint64 `json:"snapshotIndex"`
+	SnapshotTerm  uint64 `json:"snapshotTerm"`
+}
+
+// FileRaftStorage хранит журнал Raft в файлах и возвращается из методов после fsync.
+// Копия журнала держится в памяти: узел читает её при Load, а Compact переписывает из неё файл.
+type FileRaftStorage struct {
+	mu    sync.Mutex
+	dir   string
+	file  *os.File
+	state RaftState
+}
+
+// NewFileRaftStorage открывает журнал Raft в директории dir, создавая её при необходимости.
+// Оборванная последняя запись отрезается; повреждение в середине журнала — ошибка.
+func NewFileRaftStorage(dir string) (*FileRaftStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &FileRaftStorage{dir: dir}
+	data, err := os.ReadFile(filepath.Join(dir, raftStateName))
+	if err == nil {
+		var hard raftHardState
+		if err := json.Unmarshal(data, &hard); err != nil {
+			return nil, fmt.Errorf("ошибка чтения состояния Raft: %w", err)
+		}
+		s.state.Term, s.state.VotedFor = hard.Term, hard.VotedFor
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, raftLogName)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := s.rewrite(s.state); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if s.file, err = os.OpenFile(path, os.O_RDWR, 0644); err != nil {
+		return nil, err
+	}
+	if err := s.readLog(); err != nil {
+		s.file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// readLog загружает журнал из файла и оставляет позицию файла после последней целой записи
+func (s *FileRaftStorage) readLog() error {
+	r := bufio.NewReader(s.file)
+	payload, _, err := readFrame(r)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения заголовка журнала Raft: %w", err)
+	}
+	var header raftLogHeader
+	if err := json.Unmarshal(payload, &header); err != nil {
+		return err
+	}
+	s.state.SnapshotIndex, s.state.SnapshotTerm = header.SnapshotIndex, header.SnapshotTerm
+	offset := int64(walHeaderSize + len(payload))
+	for {
+		payload, _, err := readFrame(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// Недописанная запись в конце файла — падение посреди Append, после которого узел не ответил лидеру
+			if err := s.checkTail(offset, err); err != nil {
+				return err
+			}
+			break
+		}
+		var entry RaftEntry
+		if err := json.Unmarshal(payload, &entry); err != nil {
+			return err
+		}
+		if err := entry.validate(); err != nil {
+			return fmt.Errorf("запись Raft %d: %w", entry.Index, err)
+		}
+		offset += int64(walHeaderSize + len(payload))
+		if entry.Index <= s.state.SnapshotIndex {
+			continue
+		}
+		pos := int(entry.Index - s.state.SnapshotIndex - 1)
+		if pos > len(s.state.Entries) {
+			return fmt.Errorf("в журнале Raft нет записей с индексом %d по %d", s.lastIndex()+1, entry.Index-1)
+		}
+		s.state.Entries = append(s.state.Entries[:pos], entry)
+	}
+	if err := s.file.Truncate(offset); err != nil {
+		return err
+	}
+	_, err = s.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// checkTail проверяет, что нечитаемый хвост журнала с позиции offset — оборванная последняя запись
+func (s *FileRaftStorage) checkTail(offset int64, corruption error) error {
+	if _, err := s.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	tail, err := io.ReadAll(s.file)
+	if err != nil {
+		return err
+	}
+	if err := tornOrCorrupt(tail, corruption); !errors.Is(err, errTornRecord) {
+		return fmt.Errorf("повреждён журнал Raft по смещению %d: %w", offset, err)
+	}
+	return nil
+}
+
+func (s *FileRaftStorage) lastIndex() uint64 {
+	return s.state.SnapshotIndex + uint64(len(s.state.Entries))
+}
+
+func (s *FileRaftStorage) Load() (RaftState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.state
+	state.Entries = slices.Clone(s.state.Entries)
+	return state, nil
+}
+
+func (s *FileRaftStorage) SaveHardState(term uint64, votedFor string) error {
+	data, err := json.Marshal(raftHardState{Term: term, VotedFor: votedFor})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeFileAtomic(filepath.Join(s.dir, raftStateName), data); err != nil {
+		return err
+	}
+	s.state.Term, s.state.VotedFor = term, votedFor
+	return nil
+}
+
+func (s *FileRaftStorage) Append(entries []RaftEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for i := range entries {
+		if err := writeRaftFrame(&buf, entries[i].Index, &entries[i]); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	keep := int(entries[0].Index - s.state.SnapshotIndex - 1)
+	s.state.Entries = append(s.state.Entries[:min(keep, len(s.state.Entries))], entries...)
+	return nil
+}
+
+func (s *FileRaftStorage) Compact(index, term uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.state
+	pos := int(index) - int(s.state.SnapshotIndex)
+	if pos > 0 && pos <= len(s.state.Entries) && s.state.Entries[pos-1].Term == term {
+		state.Entries = slices.Clone(s.state.Entries[pos:])
+	} else {
+		state.Entries = nil
+	}
+	state.SnapshotIndex, state.SnapshotTerm = index, term
+	if err := s.rewrite(state); err != nil {
+		return err
+	}
+	// Прежний файл заменён переименованием: дальнейшие записи дописываются в новый
+	file, err := os.OpenFile(filepath.Join(s.dir, raftLogName), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.file.Close()
+	s.file = file
+	s.state = state
+	return nil
+}
+
+// rewrite атомарно заменяет файл журнала снапшотом и записями state
+func (s *FileRaftStorage) rewrite(state RaftState) error {
+	var buf bytes.Buffer
+	header := raftLogHeader{SnapshotIndex: state.SnapshotIndex, SnapshotTerm: state.SnapshotTerm}
+	if err := writeRaftFrame(&buf, header.SnapshotIndex, &header); err != nil {
+		return err
+	}
+	for i := range state.Entries {
+		if err := writeRaftFrame(&buf, state.Entries[i].Index, &state.Entries[i]); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(filepath.Join(s.dir, raftLogName), buf.Bytes())
+}
+
+// Close закрывает файл журнала; узел Raft вызывает его при остановке
+func (s *FileRaftStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+func writeRaftFrame(buf *bytes.Buffer, index uint64, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	record, err := encodeFrame(index, payload)
+	if err != nil {
+		return err
+	}
+	buf.Write(record)
+	return nil
+}
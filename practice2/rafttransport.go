@@ -0,0 +1,106 @@
+package practice2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	// Максимальное количество неотвеченных запросов к одному узлу; сверх него сообщения отбрасываются
+	// и повторяются heartbeat лидера, поэтому недоступный узел не накапливает горутины отправки
+	raftHTTPInflight = 64
+	raftHTTPTimeout  = 5 * time.Second
+)
+
+// HTTPRaftTransport доставляет сообщения Raft между процессами. ID узлов — их адреса host:port/<name>,
+// как в списке peers: Send отправляет сообщение POST запросом на http://<msg.To>/replication/raft,
+// а Register подключает к mux узла обработчик /<name>/replication/raft для входящих сообщений.
+type HTTPRaftTransport struct {
+	mux    *http.ServeMux
+	client *http.Client
+
+	mu       sync.Mutex
+	nodes    map[string]func(msg RaftMessage)
+	inflight map[string]chan struct{}
+}
+
+func NewHTTPRaftTransport(mux *http.ServeMux) *HTTPRaftTransport {
+	return &HTTPRaftTransport{
+		mux:      mux,
+		client:   &http.Client{Timeout: raftHTTPTimeout},
+		nodes:    make(map[string]func(msg RaftMessage)),
+		inflight: make(map[string]chan struct{}),
+	}
+}
+
+func (t *HTTPRaftTransport) Register(id string, deliver func(msg RaftMessage)) {
+	pattern := "/" + path.Base(id) + "/replication/raft"
+	t.mu.Lock()
+	_, registered := t.nodes[pattern]
+	t.nodes[pattern] = deliver
+	t.mu.Unlock()
+	if !registered {
+		t.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			t.serve(w, r, pattern)
+		})
+	}
+}
+
+func (t *HTTPRaftTransport) serve(w http.ResponseWriter, r *http.Request, pattern string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var msg RaftMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, entry := range msg.Entries {
+		if err := entry.validate(); err != nil {
+			http.Error(w, fmt.Sprintf("запись Raft %d: %v", entry.Index, err), http.StatusBadRequest)
+			return
+		}
+	}
+	t.mu.Lock()
+	deliver := t.nodes[pattern]
+	t.mu.Unlock()
+	deliver(msg)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Send не ждёт ответа узла: запрос выполняется в отдельной горутине, ошибки означают потерю сообщения
+func (t *HTTPRaftTransport) Send(msg RaftMessage) {
+	t.mu.Lock()
+	slots, ok := t.inflight[msg.To]
+	if !ok {
+		slots = make(chan struct{}, raftHTTPInflight)
+		t.inflight[msg.To] = slots
+	}
+	t.mu.Unlock()
+	select {
+	case slots <- struct{}{}:
+	default:
+		return
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		<-slots
+		log.Printf("Ошибка кодирования сообщения Raft: %v", err)
+		return
+	}
+	go func() {
+		defer func() { <-slots }()
+		resp, err := t.client.Post("http://"+msg.To+"/replication/raft", "application/json", bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		resp.Body.Close()
+	}()
+}
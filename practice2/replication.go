@@ -0,0 +1,534 @@
+package practice2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Протокол репликации. Узлы репликасета знают друг друга по адресам host:port/<name>. Реплика подключается
+// к /<name>/replication лидера и первым сообщением отправляет ReplicationHello со своими векторными часами:
+// для каждого лидера, транзакции которого она применила, — последний LSN этого лидера. LSN сквозные
+// для репликасета, поэтому позиция реплики в журнале лидера — наибольший LSN её часов.
+// Лидер досылает пропущенные транзакции из журнала и переходит к отправке новых транзакций. Если журнал уже обрезан чекпоинтом, лидер отвечает сообщением
+// snapshot и закрывает соединение: реплика скачивает чекпоинт с /<name>/replication/snapshot
+// (см. bootstrap.go), устанавливает его и подключается снова за оставшимся хвостом журнала.
+// При включённых выборах реплика также сообщает term своей последней транзакции. Если у лидера транзакция
+// с тем же LSN имеет другой term, реплика применила неподтверждённый хвост отстранённого лидера:
+// лидер отправляет ей snapshot, и реплика заменяет свою историю чекпоинтом лидера до получения новых транзакций.
+//
+// Сообщения лидера — ReplicationMessage в JSON. Реплика подтверждает каждую применённую транзакцию
+// сообщением ReplicationAck, по которым лидер выполняет write concern (см. writeconcern.go).
+
+// ReplicationHello — первое сообщение реплики
+type ReplicationHello struct {
+	Name   string            `json:"name"`
+	VClock map[string]uint64 `json:"vclock"`
+	// Term реплики при включённых выборах; лидер с меньшим term отстраняется
+	Term uint64 `json:"term,omitempty"`
+	// Реплика была лидером и просит чекпоинт вместо хвоста журнала
+	Resync bool `json:"resync,omitempty"`
+	// Term последней применённой репликой транзакции
+	LastTerm uint64 `json:"lastTerm,omitempty"`
+}
+
+type ReplicationMessage struct {
+	// txn — транзакция журнала, snapshot — реплике нужно скачать чекпоинт, heartbeat — лидер на связи
+	Type string       `json:"type"`
+	Txn  *Transaction `json:"txn,omitempty"`
+	// Term и адрес лидера при включённых выборах
+	Term   uint64 `json:"term,omitempty"`
+	Leader string `json:"leader,omitempty"`
+}
+
+const (
+	// Количество транзакций, которые лидер держит в очереди медленной реплики. При переполнении
+	// соединение закрывается, и реплика догоняет лидера из журнала после переподключения
+	replicaQueueSize = 4096
+	// Задержка переподключения реплики: удваивается после каждой неудачи до максимума
+	replicationRetryMin = 100 * time.Millisecond
+	replicationRetryMax = 5 * time.Second
+	// Время ожидания первого сообщения реплики
+	replicationHelloTimeout = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{}
+
+// replicaSession — подключённая к лидеру реплика. Очередь заполняет горутина Engine,
+// отправкой по сети занимается обработчик соединения.
+type replicaSession struct {
+	name  string
+	queue chan *Transaction
+	// Закрывается обработчиком при разрыве соединения
+	done chan struct{}
+}
+
+// replicaPlan — ответ Engine на подключение реплики: что отправить до перехода к новым транзакциям
+type replicaPlan struct {
+	session *replicaSession
+	// Журнал не содержит всех пропущенных транзакций: реплика должна скачать чекпоинт
+	bootstrap bool
+	// Диапазон LSN (from, to], который нужно прочитать из журнала
+	from, to uint64
+	// Term и адрес лидера для сообщений реплике; heartbeat — период heartbeat, 0 без выборов
+	term      uint64
+	leader    string
+	heartbeat time.Duration
+	err       error
+}
+
+// handleAttachReplica регистрирует реплику и определяет, как её догнать. Очередь реплики
+// подключается в том же шаге Engine, в котором фиксируется to, поэтому транзакции не теряются и не повторяются.
+func (e *Engine) handleAttachReplica(cmd Command) {
+	if e.electionEnabled() && cmd.hello.Term > e.term {
+		// Реплика знает о более новых выборах
+		e.stepDown(cmd.hello.Term, "")
+	}
+	if !e.leader {
+		cmd.replicaResult <- replicaPlan{err: e.notLeader()}
+		return
+	}
+	if e.walErr != nil {
+		cmd.replicaResult <- replicaPlan{err: e.walErr}
+		return
+	}
+	// Транзакции, ожидающие fsync, придут реплике через очередь после применения
+	plan := replicaPlan{from: vclockLSN(cmd.hello.VClock), to: vclockLSN(e.vclock)}
+	if e.electionEnabled() {
+		plan.term, plan.leader, plan.heartbeat = e.term, e.election.Addr, e.election.HeartbeatInterval
+	}
+	if err := e.wal.flush(); err != nil {
+		cmd.replicaResult <- replicaPlan{err: err}
+		return
+	}
+	if cmd.hello.Resync || plan.from > plan.to || diverged(cmd.hello.VClock, e.vclock) ||
+		(plan.from < plan.to && !e.walCovers(plan.from+1)) ||
+		(e.electionEnabled() && !e.matchesTerm(plan.from, cmd.hello.LastTerm)) {
+		// Реплика применила транзакции, которых нет у лидера (разошедшаяся история), либо журнал обрезан: нужен чекпоинт.
+		// Журнал хранится начиная с самого старого чекпоинта, поэтому хвост после него всегда доступен
+		plan.bootstrap = true
+		cmd.replicaResult <- plan
+		return
+	}
+	plan.session = &replicaSession{
+		name:  cmd.hello.Name,
+		queue: make(chan *Transaction, replicaQueueSize),
+		done:  make(chan struct{}),
+	}
+	e.followers[plan.session] = struct{}{}
+	e.recordAck(plan.session.name, plan.from)
+	cmd.replicaResult <- plan
+}
+
+// Функция для проверки, что реплика применила транзакцию какого-либо лидера, которой нет у этого узла
+func diverged(replica, leader map[string]uint64) bool {
+	for name, lsn := range replica {
+		if lsn > leader[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesTerm проверяет, что транзакция лидера с данным LSN имеет тот же term, что и последняя транзакция реплики.
+// Term ищется в памяти для последней транзакции, в журнале или в заголовке чекпоинта, с которого начинается журнал
+func (e *Engine) matchesTerm(lsn, term uint64) bool {
+	if lsn == 0 {
+		return true
+	}
+	if lsn == vclockLSN(e.vclock) {
+		return term == e.lastTerm
+	}
+	if e.walCovers(lsn) {
+		found := false
+		err := readWALRange(e.wal.dir, lsn-1, lsn, func(txn *Transaction) error {
+			found = txn.Term == term
+			return nil
+		})
+		return err == nil && found
+	}
+	snapshotTerm, ok := readSnapshotTerm(e.dir.snapshotDir(), lsn)
+	return ok && snapshotTerm == term
+}
+
+// Функция для проверки, что журнал содержит транзакции начиная с lsn
+func (e *Engine) walCovers(lsn uint64) bool {
+	segments, err := e.wal.segments()
+	if err != nil || len(segments) == 0 {
+		return false
+	}
+	return segments[0].firstLSN <= lsn
+}
+
+// broadcastTransaction ставит транзакцию в очереди подключённых реплик
+func (e *Engine) broadcastTransaction(txn *Transaction) {
+	for session := range e.followers {
+		select {
+		case <-session.done:
+			close(session.queue)
+			delete(e.followers, session)
+			continue
+		default:
+		}
+		select {
+		case session.queue <- txn:
+		default:
+			log.Printf("Очередь реплики %s переполнена, соединение будет закрыто", session.name)
+			close(session.queue)
+			delete(e.followers, session)
+		}
+	}
+}
+
+// closeFollowers закрывает очереди реплик при остановке Engine или потере лидерства.
+// Подтверждения реплик относятся к транзакциям этого лидерства и сбрасываются вместе с ними.
+func (e *Engine) closeFollowers() {
+	for session := range e.followers {
+		close(session.queue)
+		delete(e.followers, session)
+	}
+	clear(e.replicaAcks)
+}
+
+// handleReplicate применяет транзакцию, полученную репликой от лидера, и записывает её в свой журнал,
+// чтобы после перезапуска векторные часы реплики соответствовали её данным
+func (e *Engine) handleReplicate(cmd Command) {
+	txn := cmd.txn
+	if err := e.observeLeader(cmd.term, cmd.leaderAddr); err != nil {
+		cmd.result <- err
+		return
+	}
+	if e.leader {
+		cmd.result <- errors.New("лидер не принимает транзакции репликации")
+		return
+	}
+	if txn.LSN <= vclockLSN(e.vclock) {
+		cmd.result <- nil
+		return
+	}
+	if e.walErr != nil {
+		cmd.result <- e.walErr
+		return
+	}
+	if err := e.logTransaction(txn); err != nil {
+		e.failWAL(err)
+		cmd.result <- err
+		return
+	}
+	// Транзакция применяется после fsync, как и на лидере
+	e.wal.commit(func(err error) {
+		if err != nil {
+			e.failWAL(err)
+			cmd.result <- err
+			return
+		}
+		e.applyTransaction(txn)
+		// Реплика продолжит нумерацию с этого LSN, если станет лидером
+		e.lsn = max(e.lsn, txn.LSN)
+		cmd.result <- nil
+	})
+}
+
+// handleInstallSnapshot заменяет состояние реплики снапшотом лидера и сразу сохраняет его чекпоинтом.
+// Прежние журнал и чекпоинты удаляются: история реплики могла разойтись с историей лидера.
+func (e *Engine) handleInstallSnapshot(cmd Command) {
+	if e.leader {
+		cmd.result <- errors.New("лидер не принимает снапшот")
+		return
+	}
+	if err := e.installCheckpoint(cmd.snapshot); err != nil {
+		cmd.result <- err
+		return
+	}
+	if e.leaderTerm != 0 {
+		// Состояние отстранённого лидера заменено чекпоинтом нового
+		e.leaderTerm = 0
+		if err := e.saveElection(); err != nil {
+			cmd.result <- err
+			return
+		}
+	}
+	cmd.result <- e.checkpoint()
+}
+
+// installCheckpoint заменяет состояние узла чекпоинтом из потока r, удаляя прежние журнал и чекпоинты.
+// Объекты применяются по одному, не загружая чекпоинт в память целиком. Если поток оборвался
+// или повреждён, узел остаётся пустым: прежнее состояние уже удалено, и реплика загрузит чекпоинт заново.
+func (e *Engine) installCheckpoint(r io.Reader) error {
+	// Фоновый чекпоинт прежнего состояния не должен появиться после снапшота
+	for e.checkpointRunning {
+		e.handleCheckpointDone(<-e.checkpointDone)
+	}
+	if err := e.wal.reset(); err != nil {
+		return err
+	}
+	if err := removeSnapshots(e.dir.snapshotDir()); err != nil {
+		return err
+	}
+	e.resetState()
+	header, err := e.applyCheckpoint(r)
+	if err != nil {
+		e.resetState()
+		return fmt.Errorf("ошибка чтения чекпоинта: %w", err)
+	}
+	e.lsn = header.LSN
+	return nil
+}
+
+func (e *Engine) handleReplicationState(cmd Command) {
+	status := ReplicationStatus{
+		Leader:     e.leader,
+		VClock:     maps.Clone(e.vclock),
+		Term:       e.term,
+		LeaderAddr: e.leaderAddr,
+		Resync:     !e.leader && e.leaderTerm != 0,
+		Followers:  len(e.followers),
+		LastTerm:   e.lastTerm,
+	}
+	if e.raft != nil {
+		raft := e.raft.Status()
+		status.Leader = raft.Role == raftLeader
+		status.Term = raft.Term
+		status.LeaderAddr = raft.Leader
+		status.Raft = &raft
+	}
+	cmd.replicationResult <- status
+}
+
+// execute отправляет команду Engine из фоновой горутины и ждёт результата.
+// Канал результата должен быть буферизован: после остановки Engine ответ никто не прочитает.
+func (e *Engine) execute(cmd Command) error {
+	select {
+	case e.commands <- cmd:
+	case <-e.ctx.Done():
+		return e.ctx.Err()
+	}
+	select {
+	case err := <-cmd.result:
+		return err
+	case <-e.ctx.Done():
+		return e.ctx.Err()
+	}
+}
+
+// errNotUpstream — узел addr сейчас не нужно слушать: лидер этот узел или другой известный узел
+var errNotUpstream = errors.New("узел не является лидером")
+
+// follow поддерживает подключение реплики к узлу addr, переподключаясь после разрыва
+func (e *Engine) follow(addr string) {
+	delay := replicationRetryMin
+	for {
+		changed := e.progress.wait()
+		connected, err := e.followOnce(addr)
+		if e.ctx.Err() != nil {
+			return
+		}
+		if connected {
+			delay = replicationRetryMin
+		}
+		if err == nil {
+			// Чекпоинт установлен, подключаемся за хвостом журнала сразу
+			continue
+		}
+		var wait <-chan time.Time
+		if errors.Is(err, errNotUpstream) {
+			// Ждём смены лидера; пауза — на случай, если лидер сменится до подключения
+			wait = time.After(replicationRetryMax)
+		} else {
+			e.progress.setUpstream(addr, "disconnected")
+			log.Printf("Репликация с %s прервана: %v", addr, err)
+			wait = time.After(delay)
+			delay = min(2*delay, replicationRetryMax)
+		}
+		select {
+		case <-wait:
+		case <-changed:
+			delay = replicationRetryMin
+		case <-e.ctx.Done():
+			return
+		}
+	}
+}
+
+// followOnce подключается к лидеру, догоняет его и применяет новые транзакции до разрыва соединения.
+// connected сообщает, что лидер принял подключение. Возвращает nil после установки чекпоинта лидера.
+func (e *Engine) followOnce(addr string) (connected bool, err error) {
+	state := Command{action: "replicationState", replicationResult: make(chan ReplicationStatus, 1)}
+	select {
+	case e.commands <- state:
+	case <-e.ctx.Done():
+		return false, e.ctx.Err()
+	}
+	var status ReplicationStatus
+	select {
+	case status = <-state.replicationResult:
+	case <-e.ctx.Done():
+		return false, e.ctx.Err()
+	}
+	if status.Leader || (status.LeaderAddr != "" && status.LeaderAddr != addr) {
+		return false, errNotUpstream
+	}
+
+	conn, _, err := websocket.DefaultDialer.DialContext(e.ctx, "ws://"+addr+"/replication", nil)
+	if err != nil {
+		return false, err
+	}
+	// Закрытие соединения прерывает чтение при остановке Engine
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-e.ctx.Done():
+		case <-stop:
+		}
+		conn.Close()
+	}()
+
+	hello := ReplicationHello{Name: e.name, VClock: status.VClock, Term: status.Term, Resync: status.Resync, LastTerm: status.LastTerm}
+	if err := conn.WriteJSON(hello); err != nil {
+		return false, err
+	}
+	e.progress.setUpstream(addr, "live")
+	for {
+		var msg ReplicationMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return connected, err
+		}
+		connected = true
+		cmd := Command{result: make(chan error, 1), term: msg.Term, leaderAddr: msg.Leader}
+		switch msg.Type {
+		case "txn":
+			if msg.Txn == nil || msg.Txn.Feature == nil {
+				return connected, errors.New("лидер прислал пустую транзакцию")
+			}
+			cmd.action, cmd.txn = "replicate", msg.Txn
+		case "heartbeat":
+			cmd.action = "heartbeat"
+		case "snapshot":
+			// Чекпоинт принимается только от действующего лидера
+			cmd.action = "heartbeat"
+			if err := e.execute(cmd); err != nil {
+				return connected, err
+			}
+			conn.Close()
+			e.progress.setUpstream(addr, "bootstrap")
+			return connected, e.bootstrap(addr)
+		default:
+			return connected, errors.New("неизвестное сообщение репликации: " + msg.Type)
+		}
+		if err := e.execute(cmd); err != nil {
+			return connected, err
+		}
+		if msg.Txn == nil {
+			continue
+		}
+		if err := conn.WriteJSON(ReplicationAck{LSN: msg.Txn.LSN}); err != nil {
+			return connected, err
+		}
+	}
+}
+
+func (s *Storage) setupReplicationHandler() {
+	s.mux.HandleFunc("/"+s.name+"/replication", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Printf("Ошибка апгрейда соединения: %v", err)
+			return
+		}
+		defer conn.Close()
+		if err := s.serveReplica(conn); err != nil {
+			log.Printf("Репликация на %s прервана: %v", conn.RemoteAddr(), err)
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseInternalServerErr, err.Error()), time.Now().Add(time.Second))
+		}
+	})
+	s.mux.HandleFunc("/"+s.name+"/replication/snapshot", s.serveSnapshot)
+	s.mux.HandleFunc("/"+s.name+"/replication/status", s.serveReplicationStatus)
+	s.mux.HandleFunc("/"+s.name+"/replication/vote", s.serveVote)
+}
+
+// serveReplica догоняет подключившуюся реплику и передаёт ей новые транзакции до разрыва соединения
+func (s *Storage) serveReplica(conn *websocket.Conn) error {
+	var hello ReplicationHello
+	conn.SetReadDeadline(time.Now().Add(replicationHelloTimeout))
+	if err := conn.ReadJSON(&hello); err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	cmd := Command{action: "attachReplica", hello: &hello, replicaResult: make(chan replicaPlan, 1)}
+	select {
+	case s.engine.commands <- cmd:
+	case <-s.engine.ctx.Done():
+		return s.engine.ctx.Err()
+	}
+	var plan replicaPlan
+	select {
+	case plan = <-cmd.replicaResult:
+	case <-s.engine.ctx.Done():
+		return s.engine.ctx.Err()
+	}
+	if plan.err != nil {
+		return plan.err
+	}
+	if plan.bootstrap {
+		return conn.WriteJSON(ReplicationMessage{Type: "snapshot", Term: plan.term, Leader: plan.leader})
+	}
+	session := plan.session
+	defer close(session.done)
+
+	// Реплика присылает подтверждения применённых транзакций для write concern; ошибка чтения означает разрыв
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			var ack ReplicationAck
+			if err := conn.ReadJSON(&ack); err != nil {
+				return
+			}
+			select {
+			case s.engine.commands <- Command{action: "replicaAck", replica: session, ackLSN: ack.LSN}:
+			case <-s.engine.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if plan.from < plan.to {
+		err := readWALRange(s.engine.wal.dir, plan.from, plan.to, func(txn *Transaction) error {
+			return conn.WriteJSON(ReplicationMessage{Type: "txn", Txn: txn, Term: plan.term, Leader: plan.leader})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	var heartbeat <-chan time.Time
+	if plan.heartbeat > 0 {
+		ticker := time.NewTicker(plan.heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+	for {
+		msg := ReplicationMessage{Type: "heartbeat", Term: plan.term, Leader: plan.leader}
+		select {
+		case txn, ok := <-session.queue:
+			if !ok {
+				return errors.New("очередь реплики закрыта")
+			}
+			msg.Type, msg.Txn = "txn", txn
+		case <-heartbeat:
+		case <-closed:
+			return nil
+		}
+		if err := conn.WriteJSON(msg); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package practice2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// Функция для ожидания условия, которое выполняется асинхронно, например применения транзакций репликой
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Функция для запуска лидера storage за HTTP сервером; возвращает адрес для подключения реплик
+func startLeader(t *testing.T, opts ...Option) (*Storage, string) {
+	t.Helper()
+	mux := http.NewServeMux()
+	leader, err := NewStorage(mux, t.TempDir(), "storage", nil, true, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leader.Run()
+	server := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		leader.Stop()
+		server.Close()
+	})
+	return leader, server.Listener.Addr().String() + "/storage"
+}
+
+func sameIDs(got map[string]bool, want ...string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for _, id := range want {
+		if !got[id] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReplicationCatchUpFromWAL(t *testing.T) {
+	leader, addr := startLeader(t)
+	execCommand(t, leader, "insert", newTestFeature("a", 1, 1))
+	execCommand(t, leader, "insert", newTestFeature("b", 2, 2))
+
+	dir := t.TempDir()
+	follower, err := NewStorage(http.NewServeMux(), dir, "replica", []string{addr}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	follower.Run()
+	waitFor(t, "initial catch-up", func() bool { return sameIDs(searchIDs(t, follower), "a", "b") })
+	execCommand(t, leader, "insert", newTestFeature("c", 3, 3))
+	waitFor(t, "live transaction", func() bool { return sameIDs(searchIDs(t, follower), "a", "b", "c") })
+	follower.Stop()
+
+	// Пока реплика остановлена, лидер продолжает принимать транзакции
+	execCommand(t, leader, "delete", newTestFeature("a", 0, 0))
+	execCommand(t, leader, "replace", newTestFeature("b", 5, 5))
+	execCommand(t, leader, "insert", newTestFeature("d", 4, 4))
+
+	follower, err = NewStorage(http.NewServeMux(), dir, "replica", []string{addr}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	follower.Run()
+	defer follower.Stop()
+	waitFor(t, "catch-up after restart", func() bool { return sameIDs(searchIDs(t, follower), "b", "c", "d") })
+	waitFor(t, "follower LSN", func() bool {
+		cmd := Command{action: "replicationState", replicationResult: make(chan ReplicationStatus)}
+		follower.engine.commands <- cmd
+		// Прогресс репликации хранится под именем лидера
+		return (<-cmd.replicationResult).VClock["storage"] == 6
+	})
+}
+
+func TestReplicationSnapshotFallback(t *testing.T) {
+	leader, addr := startLeader(t, WithSnapshotRetention(1))
+	for i, id := range []string{"a", "b", "c"} {
+		execCommand(t, leader, "insert", newTestFeature(id, float64(i), 0))
+	}
+	execCommand(t, leader, "delete", newTestFeature("b", 0, 0))
+	execCommand(t, leader, "checkpoint", nil)
+	// Журнал до чекпоинта удалён: реплику можно догнать только снапшотом
+	if leader.engine.walCovers(1) {
+		t.Fatal("Expected WAL to be truncated by checkpoint")
+	}
+
+	follower, err := NewStorage(http.NewServeMux(), t.TempDir(), "replica", []string{addr}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	follower.Run()
+	defer follower.Stop()
+	waitFor(t, "snapshot install", func() bool { return sameIDs(searchIDs(t, follower), "a", "c") })
+
+	// После снапшота реплика получает новые транзакции
+	execCommand(t, leader, "insert", newTestFeature("d", 4, 4))
+	waitFor(t, "transaction after snapshot", func() bool { return sameIDs(searchIDs(t, follower), "a", "c", "d") })
+}
+
+func TestReplicationBootstrapResume(t *testing.T) {
+	// Загрузка продолжается только с того узла, с которого начиналась
+	for _, source := range []string{"storage", "old-leader"} {
+		t.Run(source, func(t *testing.T) { testBootstrapResume(t, source) })
+	}
+}
+
+func testBootstrapResume(t *testing.T, source string) {
+	mux := http.NewServeMux()
+	leader, err := NewStorage(mux, t.TempDir(), "storage", nil, true, WithSnapshotRetention(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leader.Run()
+	// Запоминаем заголовки запросов чекпоинта, чтобы проверить продолжение загрузки
+	var ranges []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/replication/snapshot") {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			mu.Unlock()
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer func() {
+		leader.Stop()
+		server.Close()
+	}()
+	addr := server.Listener.Addr().String() + "/storage"
+
+	for i := 0; i < 50; i++ {
+		execCommand(t, leader, "insert", newTestFeature(fmt.Sprintf("f%d", i), float64(i), 0))
+	}
+	execCommand(t, leader, "checkpoint", nil)
+	execCommand(t, leader, "insert", newTestFeature("tail", 1, 1))
+
+	// Имитируем загрузку, прерванную на середине чекпоинта
+	snapshots, err := listSnapshots(leader.engine.dir.snapshotDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(snapshots[0].path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, snapshotDirName), 0755); err != nil {
+		t.Fatal(err)
+	}
+	half := int64(len(data) / 2)
+	if err := os.WriteFile(bootstrapPartPath(filepath.Join(dir, snapshotDirName), source, snapshots[0].lsn), data[:half], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	followerMux := http.NewServeMux()
+	follower, err := NewStorage(followerMux, dir, "replica", []string{addr}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	follower.Run()
+	defer follower.Stop()
+	waitFor(t, "bootstrap and WAL tail", func() bool { return len(searchIDs(t, follower)) == 51 && searchIDs(t, follower)["tail"] })
+
+	resumed, expectedRange := half, fmt.Sprintf("bytes=%d-", half)
+	if source != "storage" {
+		resumed, expectedRange = 0, ""
+	}
+	mu.Lock()
+	if len(ranges) != 1 || ranges[0] != expectedRange {
+		t.Errorf("Expected one snapshot request with range %q, got %q", expectedRange, ranges)
+	}
+	mu.Unlock()
+
+	req := httptest.NewRequest(http.MethodGet, "/replica/replication/status", nil)
+	w := httptest.NewRecorder()
+	followerMux.ServeHTTP(w, req)
+	var status ReplicationStatus
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	progress := status.Bootstrap
+	if progress == nil || !progress.Installed || progress.Resumed != resumed || progress.Received != int64(len(data)) || progress.Total != int64(len(data)) {
+		t.Errorf("Unexpected bootstrap progress: %+v", progress)
+	}
+	if status.Upstreams[addr] != "live" || status.VClock["storage"] != 51 {
+		t.Errorf("Unexpected replication status: %+v", status)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, snapshotDirName, bootstrapPrefix+"*")); len(matches) != 0 {
+		t.Errorf("Bootstrap part file should be removed after install: %v", matches)
+	}
+}
+
+func TestReplicationBootstrapCorrupt(t *testing.T) {
+	mux := http.NewServeMux()
+	leader, err := NewStorage(mux, t.TempDir(), "storage", nil, true, WithSnapshotRetention(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leader.Run()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/replication/snapshot") {
+			requests.Add(1)
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer func() {
+		leader.Stop()
+		server.Close()
+	}()
+
+	for i := 0; i < 50; i++ {
+		execCommand(t, leader, "insert", newTestFeature(fmt.Sprintf("f%d", i), float64(i), 0))
+	}
+	execCommand(t, leader, "checkpoint", nil)
+
+	// Загруженный целиком файл повреждён в середине: реплика обнаруживает это, применяя объекты
+	snapshots, err := listSnapshots(leader.engine.dir.snapshotDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(snapshots[0].path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, snapshotDirName), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bootstrapPartPath(filepath.Join(dir, snapshotDirName), "storage", snapshots[0].lsn), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	follower, err := NewStorage(http.NewServeMux(), dir, "replica", []string{server.Listener.Addr().String() + "/storage"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	follower.Run()
+	defer follower.Stop()
+	waitFor(t, "bootstrap after corrupt download", func() bool { return len(searchIDs(t, follower)) == 50 })
+	if n := requests.Load(); n != 2 {
+		t.Errorf("Expected the corrupt checkpoint to be downloaded again, got %d snapshot requests", n)
+	}
+	if status := replicationStatus(follower); status.VClock["storage"] != 50 {
+		t.Errorf("Unexpected vclock after bootstrap: %v", status.VClock)
+	}
+}
+
+// Функция для отправки объекта в обработчик записи; возвращает код ответа
+func postFeature(t *testing.T, mux *http.ServeMux, url string, feature *geojson.Feature) int {
+	t.Helper()
+	body, err := json.Marshal(feature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, url, bytes.NewReader(body)))
+	return w.Code
+}
+
+func TestWriteConcern(t *testing.T) {
+	// Репликасет из трёх узлов: для majority нужно подтверждение одной реплики
+	mux := http.NewServeMux()
+	leader, err := NewStorage(mux, t.TempDir(), "storage", []string{"replica1", "replica2"}, true,
+		WithWriteConcern(WriteConcernMajority, 200*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leader.Run()
+	server := httptest.NewServer(mux)
+	defer func() {
+		leader.Stop()
+		server.Close()
+	}()
+
+	// Без подключённых реплик подтверждения ждать не от кого: запись отклоняется сразу и не выполняется
+	start := time.Now()
+	if code := postFeature(t, mux, "/storage/insert", newTestFeature("a", 1, 1)); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d without connected replicas, got %d", http.StatusServiceUnavailable, code)
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Errorf("Write without connected replicas waited for the timeout: %v", elapsed)
+	}
+	if searchIDs(t, leader)["a"] {
+		t.Error("Rejected feature should not be stored on leader")
+	}
+	// Запрос может ослабить уровень хранилища
+	if code := postFeature(t, mux, "/storage/insert?writeConcern=async", newTestFeature("b", 2, 2)); code != http.StatusOK {
+		t.Errorf("Expected async insert to succeed, got %d", code)
+	}
+	if code := postFeature(t, mux, "/storage/insert?writeConcern=all", newTestFeature("c", 3, 3)); code != http.StatusBadRequest {
+		t.Errorf("Expected %d for unknown write concern, got %d", http.StatusBadRequest, code)
+	}
+
+	follower, err := NewStorage(http.NewServeMux(), t.TempDir(), "replica", []string{server.Listener.Addr().String() + "/storage"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	follower.Run()
+	defer follower.Stop()
+	waitFor(t, "follower attach", func() bool { return sameIDs(searchIDs(t, follower), "b") })
+
+	// Подтверждённая запись уже применена репликой к моменту ответа
+	if code := postFeature(t, mux, "/storage/insert?writeConcern=one", newTestFeature("d", 4, 4)); code != http.StatusOK {
+		t.Fatalf("Expected insert with writeConcern=one to succeed, got %d", code)
+	}
+	if !searchIDs(t, follower)["d"] {
+		t.Error("Feature acknowledged with writeConcern=one is missing on follower")
+	}
+	if code := postFeature(t, mux, "/storage/delete", newTestFeature("d", 0, 0)); code != http.StatusOK {
+		t.Fatalf("Expected delete with majority to succeed, got %d", code)
+	}
+	if searchIDs(t, follower)["d"] {
+		t.Error("Feature deleted with majority write concern is still present on follower")
+	}
+}
+
+func TestWriteConcernWithoutReplicas(t *testing.T) {
+	// У одиночного лидера запись на нём — запись на весь репликасет: ответ не ждёт таймаута
+	mux := http.NewServeMux()
+	leader, err := NewStorage(mux, t.TempDir(), "storage", nil, true, WithWriteConcern(WriteConcernOne, 5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leader.Run()
+	defer leader.Stop()
+
+	for i, concern := range []string{"", "?writeConcern=one", "?writeConcern=majority"} {
+		start := time.Now()
+		id := fmt.Sprintf("f%d", i)
+		if code := postFeature(t, mux, "/storage/insert"+concern, newTestFeature(id, 1, 1)); code != http.StatusOK {
+			t.Errorf("Insert%s on leader without replicas returned %d", concern, code)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Insert%s on leader without replicas took %v", concern, elapsed)
+		}
+		if !searchIDs(t, leader)[id] {
+			t.Errorf("Feature %s is missing on leader", id)
+		}
+	}
+}
+
+func TestWriteConcernAckAfterDisconnect(t *testing.T) {
+	e := &Engine{
+		replicas:     []string{"replica1", "replica2"},
+		leader:       true,
+		followers:    make(map[*replicaSession]struct{}),
+		replicaAcks:  make(map[string]uint64),
+		writeConcern: WriteConcernMajority,
+		writeTimeout: time.Minute,
+	}
+	defer e.failWriteConcern(errors.New("test finished"))
+	session := &replicaSession{name: "replica1", queue: make(chan *Transaction, 1), done: make(chan struct{})}
+	e.followers[session] = struct{}{}
+
+	first, second := make(chan error, 1), make(chan error, 1)
+	e.commit(Command{result: first}, 1)
+	e.commit(Command{result: second}, 2)
+	e.checkWriteConcern()
+	timer := e.concernTimer
+
+	// Подтверждение, не закрывающее ни одной транзакции, не переустанавливает таймер
+	e.handleReplicaAck(Command{replica: session, ackLSN: 0})
+	e.checkWriteConcern()
+	if e.concernTimer != timer {
+		t.Error("Write concern timer was recreated by an ack that resolved nothing")
+	}
+
+	// Реплика подтвердила транзакцию и отключилась раньше, чем Engine проверил ожидающих
+	close(session.done)
+	delete(e.followers, session)
+	e.handleReplicaAck(Command{replica: session, ackLSN: 1})
+	e.checkWriteConcern()
+	select {
+	case err := <-first:
+		if err != nil {
+			t.Errorf("Write acknowledged before disconnect failed: %v", err)
+		}
+	default:
+		t.Error("Write acknowledged by a disconnected replica is still waiting")
+	}
+	select {
+	case err := <-second:
+		t.Errorf("Unacknowledged write finished with %v", err)
+	default:
+	}
+}
@@ -0,0 +1,684 @@
+package practice2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Ответ шарда на запрос Router. Хранилища зарегистрированы на том же ServeMux,
+// поэтому запрос к шарду выполняется без сети.
+type shardResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (sr *shardResponse) Header() http.Header {
+	return sr.header
+}
+
+func (sr *shardResponse) Write(p []byte) (int, error) {
+	if sr.code == 0 {
+		sr.code = http.StatusOK
+	}
+	return sr.body.Write(p)
+}
+
+func (sr *shardResponse) WriteHeader(code int) {
+	if sr.code == 0 {
+		sr.code = code
+	}
+}
+
+// Функция для отправки запроса в один шард: реплики перебираются по порядку до первого успешного ответа
+func (r *Router) queryShard(req *http.Request, replicas []string, path string, body []byte) ([]byte, error) {
+	var errs []string
+	notFound := 0
+	for _, name := range replicas {
+		shardReq, err := newShardRequest(req.Context(), req, name, path, body)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := &shardResponse{header: make(http.Header)}
+		r.mux.ServeHTTP(resp, shardReq)
+		if resp.code == http.StatusOK {
+			return resp.body.Bytes(), nil
+		}
+		// Ошибки запроса одинаковы для всех реплик, повторять его нет смысла
+		if resp.code == http.StatusBadRequest {
+			return nil, &shardError{code: resp.code, msg: strings.TrimSpace(resp.body.String())}
+		}
+		if resp.code == http.StatusNotFound {
+			notFound++
+		}
+		errs = append(errs, fmt.Sprintf("%s: %d %s", name, resp.code, strings.TrimSpace(resp.body.String())))
+	}
+	return nil, &shardError{
+		code:     http.StatusBadGateway,
+		msg:      "шард недоступен: " + strings.Join(errs, "; "),
+		notFound: notFound == len(replicas),
+	}
+}
+
+// Функция для построения запроса к реплике шарда с параметрами и заголовками исходного запроса
+func newShardRequest(ctx context.Context, req *http.Request, name, path string, body []byte) (*http.Request, error) {
+	target := "/" + name + path
+	if req.URL.RawQuery != "" {
+		target += "?" + req.URL.RawQuery
+	}
+	shardReq, err := http.NewRequestWithContext(ctx, req.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	shardReq.Header = req.Header.Clone()
+	return shardReq, nil
+}
+
+type shardError struct {
+	code int
+	msg  string
+	// Все реплики шарда ответили 404
+	notFound bool
+}
+
+func (e *shardError) Error() string {
+	return e.msg
+}
+
+// RouterOption задаёт параметры Router
+type RouterOption func(r *Router)
+
+// WithShardBounds задаёт области данных шардов в порядке nodes, в EPSG:4326: шард хранит только объекты,
+// bounding box которых лежит в его области. Тайлы и select по прямоугольнику отправляются только шардам,
+// области которых пересекают запрос.
+func WithShardBounds(bounds ...orb.Bound) RouterOption {
+	return func(r *Router) {
+		r.bounds = bounds
+	}
+}
+
+// Функция для выбора шардов, области которых пересекают хотя бы один из boxes; возвращает индексы в r.nodes
+func (r *Router) shardsFor(boxes ...orb.Bound) []int {
+	var shards []int
+	for i := range r.nodes {
+		if i >= len(r.bounds) || intersectsAny(r.bounds[i], boxes) {
+			shards = append(shards, i)
+		}
+	}
+	return shards
+}
+
+func intersectsAny(bound orb.Bound, boxes []orb.Bound) bool {
+	for _, box := range boxes {
+		if bound.Intersects(box) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Router) allShards() []int {
+	shards := make([]int, len(r.nodes))
+	for i := range shards {
+		shards[i] = i
+	}
+	return shards
+}
+
+// Функция для выбора шардов select и aggregate: прямоугольник GET запроса переводится в EPSG:4326, как это делает
+// хранилище. Область из тела POST запроса и некорректные параметры обрабатывают все шарды.
+func (r *Router) selectShards(req *http.Request) []int {
+	if req.Method != http.MethodGet {
+		return r.allShards()
+	}
+	query := req.URL.Query()
+	proj, err := parseProjection(query.Get("proj"))
+	if err != nil {
+		return r.allShards()
+	}
+	min, max, err := parseRect(query)
+	if err != nil {
+		return r.allShards()
+	}
+	return r.shardsFor(splitAntimeridian(proj.rectToNative(min, max))...)
+}
+
+// Функция для рассылки запроса по шардам shards. Возвращает ответы в порядке shards.
+func (r *Router) scatter(req *http.Request, path string, shards []int) ([][]byte, error) {
+	responses, errs, err := r.gather(req, path, shards)
+	if err != nil {
+		return nil, err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return responses, nil
+}
+
+// Функция для рассылки запроса по шардам shards; в отличие от scatter возвращает ответ или ошибку каждого шарда
+func (r *Router) gather(req *http.Request, path string, shards []int) ([][]byte, []error, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	responses := make([][]byte, len(shards))
+	errs := make([]error, len(shards))
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i int, replicas []string) {
+			defer wg.Done()
+			responses[i], errs[i] = r.queryShard(req, replicas, path, body)
+		}(i, r.nodes[shard])
+	}
+	wg.Wait()
+	return responses, errs, nil
+}
+
+// Функция для проверки, что все реплики шарда ответили 404: объекта в шарде нет
+func isNotFound(err error) bool {
+	se, ok := err.(*shardError)
+	return ok && se.notFound
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	return io.ReadAll(req.Body)
+}
+
+// Функция для записи ошибки scatter с кодом, полученным от шарда
+func writeScatterError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if se, ok := err.(*shardError); ok {
+		code = se.code
+	}
+	http.Error(w, err.Error(), code)
+}
+
+// handleFeature ищет объект по ID во всех шардах: ответ — объект из первого шарда, в котором он нашёлся,
+// 404 — только если объекта нет ни в одном шарде
+func (r *Router) handleFeature(w http.ResponseWriter, req *http.Request) {
+	responses, errs, err := r.gather(req, req.URL.Path, r.allShards())
+	if err != nil {
+		writeScatterError(w, err)
+		return
+	}
+	var failed error
+	for i, data := range responses {
+		switch {
+		case errs[i] == nil:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(data)
+			return
+		case !isNotFound(errs[i]) && failed == nil:
+			failed = errs[i]
+		}
+	}
+	if failed != nil {
+		// Объект мог быть в недоступном шарде
+		writeScatterError(w, failed)
+		return
+	}
+	http.Error(w, "объект не найден", http.StatusNotFound)
+}
+
+// handleFeatures собирает пакетный запрос по ID со всех шардов. Отсутствующим считается ID,
+// которого нет ни в одном шарде, то есть он есть в поле missing ответа каждого шарда.
+func (r *Router) handleFeatures(w http.ResponseWriter, req *http.Request) {
+	responses, err := r.scatter(req, "/features", r.allShards())
+	if err != nil {
+		writeScatterError(w, err)
+		return
+	}
+
+	fc := geojson.NewFeatureCollection()
+	seen := make(map[interface{}]bool)
+	var missing []string
+	missingIn := make(map[string]int)
+	for _, data := range responses {
+		shardFC, err := geojson.UnmarshalFeatureCollection(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		for _, feature := range shardFC.Features {
+			// Объект мог попасть в несколько шардов во время переноса данных
+			if feature.ID != nil && seen[feature.ID] {
+				continue
+			}
+			seen[feature.ID] = true
+			fc.Append(feature)
+		}
+		ids, _ := shardFC.ExtraMembers["missing"].([]interface{})
+		counted := make(map[string]bool, len(ids))
+		for _, raw := range ids {
+			if id, ok := raw.(string); ok && !counted[id] {
+				counted[id] = true
+				if missingIn[id] == 0 {
+					missing = append(missing, id)
+				}
+				missingIn[id]++
+			}
+		}
+	}
+	notFound := []string{}
+	for _, id := range missing {
+		if missingIn[id] == len(responses) {
+			notFound = append(notFound, id)
+		}
+	}
+	fc.ExtraMembers = geojson.Properties{"missing": notFound}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(fc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleSelect собирает результаты select с шардов, области которых пересекают прямоугольник запроса. Параметры и тело запроса
+// (прямоугольник, proj, predicate, filter, GeoJSON область поиска) передаются шардам без изменений.
+func (r *Router) handleSelect(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	page, err := parsePage(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	clustering, err := parseSelectClustering(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	shards := r.selectShards(req)
+	if page.Stream {
+		r.streamScatter(w, req, "/select", page.Limit, shards)
+		return
+	}
+	responses, err := r.scatter(req, "/select", shards)
+	if err != nil {
+		writeScatterError(w, err)
+		return
+	}
+
+	fc := geojson.NewFeatureCollection()
+	seen := make(map[interface{}]bool)
+	more := false
+	for _, data := range responses {
+		shardFC, err := geojson.UnmarshalFeatureCollection(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if next, _ := shardFC.ExtraMembers["next"].(string); next != "" {
+			more = true
+		}
+		for _, feature := range shardFC.Features {
+			// Объект мог попасть в несколько шардов во время переноса данных
+			if feature.ID != nil && seen[feature.ID] {
+				continue
+			}
+			seen[feature.ID] = true
+			fc.Append(feature)
+		}
+	}
+	if clustering != nil {
+		fc.Features = mergeClusters(clustering, fc.Features)
+	}
+
+	if page.Limit > 0 {
+		// Каждый шард вернул свои первые limit объектов после курсора, поэтому общая страница —
+		// первые limit объектов объединения в порядке ID
+		sort.SliceStable(fc.Features, func(i, j int) bool {
+			return fmt.Sprint(fc.Features[i].ID) < fmt.Sprint(fc.Features[j].ID)
+		})
+		if len(fc.Features) > page.Limit {
+			fc.Features = fc.Features[:page.Limit]
+			more = true
+		}
+		var next interface{}
+		if more && len(fc.Features) > 0 {
+			next = encodeCursor(fmt.Sprint(fc.Features[len(fc.Features)-1].ID))
+		}
+		fc.ExtraMembers = geojson.Properties{"next": next}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(fc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Функция для разбора параметров кластеризации select на стороне Router
+func parseSelectClustering(query url.Values) (*Clustering, error) {
+	proj, err := parseProjection(query.Get("proj"))
+	if err != nil {
+		return nil, err
+	}
+	gen, err := parseGeneralization(query, proj)
+	if err != nil {
+		return nil, err
+	}
+	return parseClustering(query, gen, proj)
+}
+
+// mergeClusters объединяет кластеры шардов: кластер шарда добавляется как точка в центре масс
+// с весом count. В режиме grid центр кластера лежит в его ячейке, поэтому объединение точное;
+// в режиме distance кластеры шардов объединяются по тому же радиусу.
+func mergeClusters(c *Clustering, features []*geojson.Feature) []*geojson.Feature {
+	cl := newClusterer(c)
+	var rest []*geojson.Feature
+	for _, feature := range features {
+		p, count, bound, ok := clusterOf(feature)
+		if !ok {
+			// Объекты, которые не являются точками, выдаются без кластеризации
+			rest = append(rest, feature)
+			continue
+		}
+		var single *geojson.Feature
+		if isCluster, _ := feature.Properties["cluster"].(bool); !isCluster {
+			single = feature
+		}
+		cl.add(p, count, bound, single)
+	}
+	return append(rest, cl.features(false)...)
+}
+
+// handleAggregate складывает частичные агрегаты шардов. Объект, попавший в несколько шардов
+// во время переноса данных, учитывается в каждом из них: без самих объектов дубликаты не отличить.
+func (r *Router) handleAggregate(w http.ResponseWriter, req *http.Request) {
+	aggregation, err := parseAggregation(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	shards := r.selectShards(req)
+	responses, err := r.scatter(req, "/aggregate", shards)
+	if err != nil {
+		writeScatterError(w, err)
+		return
+	}
+	total := &Aggregate{}
+	if len(shards) == 0 {
+		// Область не задевает ни один шард: пустой агрегат той же формы, что и ответ шарда
+		if total, err = emptyAggregate(req.URL.Query(), aggregation); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	for _, data := range responses {
+		var partial Aggregate
+		if err := json.Unmarshal(data, &partial); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if err := total.merge(&partial); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(total); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Функция для построения агрегата без объектов по прямоугольнику GET запроса: пустые группы
+// и нулевая гистограмма, как у шарда, в области которого ничего не нашлось
+func emptyAggregate(query url.Values, aggregation *Aggregation) (*Aggregate, error) {
+	proj, err := parseProjection(query.Get("proj"))
+	if err != nil {
+		return nil, err
+	}
+	min, max, err := parseRect(query)
+	if err != nil {
+		return nil, err
+	}
+	aggregation.setGrid(proj, proj.rectToNative(min, max))
+	return newAggregator(aggregation).result(), nil
+}
+
+// shardStream — ResponseWriter потокового ответа шарда. Строки NDJSON успешного ответа передаются
+// в lines по мере того, как шард их пишет; ответ с ошибкой собирается целиком для сообщения.
+type shardStream struct {
+	ctx    context.Context
+	header http.Header
+	code   int
+	// Недописанная строка успешного ответа или тело ответа с ошибкой
+	buf   bytes.Buffer
+	lines chan<- []byte
+	// Вызывается один раз, когда шард начинает успешный ответ
+	ok func()
+}
+
+func (ss *shardStream) Header() http.Header {
+	return ss.header
+}
+
+func (ss *shardStream) WriteHeader(code int) {
+	if ss.code != 0 {
+		return
+	}
+	ss.code = code
+	if code == http.StatusOK {
+		ss.ok()
+	}
+}
+
+func (ss *shardStream) Write(p []byte) (int, error) {
+	ss.WriteHeader(http.StatusOK)
+	ss.buf.Write(p)
+	if ss.code != http.StatusOK {
+		return len(p), nil
+	}
+	for {
+		i := bytes.IndexByte(ss.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if err := ss.send(ss.buf.Next(i + 1)); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// send передаёт строку Router; ошибка означает, что Router больше не ждёт строк, и шард прекращает обход
+func (ss *shardStream) send(line []byte) error {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil
+	}
+	select {
+	case ss.lines <- append([]byte(nil), line...):
+		return nil
+	case <-ss.ctx.Done():
+		return ss.ctx.Err()
+	}
+}
+
+// Функция для потокового запроса к одному шарду: реплики перебираются по порядку, пока одна не начнёт
+// успешный ответ. Результат выбора реплики отправляется в status до первой строки.
+func (r *Router) streamShard(ctx context.Context, req *http.Request, replicas []string, path string, body []byte, lines chan<- []byte, status chan<- error) {
+	var errs []string
+	for _, name := range replicas {
+		shardReq, err := newShardRequest(ctx, req, name, path, body)
+		if err != nil {
+			status <- err
+			return
+		}
+		ss := &shardStream{ctx: ctx, header: make(http.Header), lines: lines, ok: func() { status <- nil }}
+		r.mux.ServeHTTP(ss, shardReq)
+		// Шард без подходящих объектов может ничего не записать
+		ss.WriteHeader(http.StatusOK)
+		if ss.code == http.StatusOK {
+			// Последняя строка могла прийти без перевода строки
+			ss.send(append(ss.buf.Bytes(), '\n'))
+			return
+		}
+		if ss.code == http.StatusBadRequest {
+			status <- &shardError{code: ss.code, msg: strings.TrimSpace(ss.buf.String())}
+			return
+		}
+		errs = append(errs, fmt.Sprintf("%s: %d %s", name, ss.code, strings.TrimSpace(ss.buf.String())))
+	}
+	status <- &shardError{code: http.StatusBadGateway, msg: "шард недоступен: " + strings.Join(errs, "; ")}
+}
+
+// streamScatter рассылает потоковый запрос по шардам shards и пересылает клиенту строки NDJSON по мере
+// их поступления, не дожидаясь полных ответов. Порядок строк в потоковой выдаче не определён,
+// поэтому строки шардов перемежаются. Статус ответа выбирается, когда все шарды начали отвечать:
+// ошибка любого шарда возвращается клиенту, как и в scatter. После limit строк запросы к шардам отменяются.
+func (r *Router) streamScatter(w http.ResponseWriter, req *http.Request, path string, limit int, shards []int) {
+	body, err := readBody(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	lines := make(chan []byte)
+	status := make(chan error, len(shards))
+	var wg sync.WaitGroup
+	for _, shard := range shards {
+		wg.Add(1)
+		go func(replicas []string) {
+			defer wg.Done()
+			r.streamShard(ctx, req, replicas, path, body, lines, status)
+		}(r.nodes[shard])
+	}
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+	defer func() {
+		// Шарды прекращают обход на первой записи после отмены; дожидаемся их, чтобы не оставлять горутин
+		cancel()
+		for range lines {
+		}
+	}()
+
+	for range shards {
+		if err := <-status; err != nil {
+			writeScatterError(w, err)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	written := 0
+	for line := range lines {
+		if _, err := w.Write(line); err != nil {
+			return
+		}
+		written++
+		if limit > 0 && written == limit {
+			return
+		}
+		if flusher != nil && written%streamFlushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+}
+
+// handleNearest объединяет top-k ближайших объектов шардов. Каждый шард возвращает свои k ближайших,
+// поэтому общие k ближайших находятся среди них: сортируем все ответы по расстоянию и берём первые k.
+func (r *Router) handleNearest(w http.ResponseWriter, req *http.Request) {
+	k, err := parseK(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	responses, err := r.scatter(req, "/nearest", r.allShards())
+	if err != nil {
+		writeScatterError(w, err)
+		return
+	}
+
+	type neighbour struct {
+		feature  *geojson.Feature
+		distance float64
+	}
+	var neighbours []neighbour
+	for _, data := range responses {
+		shardFC, err := geojson.UnmarshalFeatureCollection(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		distances, _ := shardFC.ExtraMembers["distances"].([]interface{})
+		if len(distances) != len(shardFC.Features) {
+			http.Error(w, "шард вернул расстояния не для всех объектов", http.StatusBadGateway)
+			return
+		}
+		for i, feature := range shardFC.Features {
+			distance, ok := distances[i].(float64)
+			if !ok {
+				http.Error(w, "шард вернул некорректное расстояние", http.StatusBadGateway)
+				return
+			}
+			neighbours = append(neighbours, neighbour{feature: feature, distance: distance})
+		}
+	}
+	// При равных расстояниях сохраняется порядок шардов, чтобы ответ был детерминированным
+	sort.SliceStable(neighbours, func(i, j int) bool { return neighbours[i].distance < neighbours[j].distance })
+
+	fc := geojson.NewFeatureCollection()
+	distances := []float64{}
+	seen := make(map[interface{}]bool)
+	for _, n := range neighbours {
+		if len(fc.Features) == k {
+			break
+		}
+		if n.feature.ID != nil && seen[n.feature.ID] {
+			continue
+		}
+		seen[n.feature.ID] = true
+		fc.Append(n.feature)
+		distances = append(distances, n.distance)
+	}
+	fc.ExtraMembers = geojson.Properties{"distances": distances}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(fc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleTile собирает тайл из тайлов шардов, области которых пересекают тайл вместе с буфером.
+// Без WithShardBounds запрос получают все шарды: шард без объектов в тайле отвечает пустым тайлом.
+func (r *Router) handleTile(w http.ResponseWriter, req *http.Request) {
+	tile, err := parseTile(req.PathValue("z"), req.PathValue("x"), req.PathValue("y"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Шарды отбираются по прямоугольнику, которым хранилище ищет объекты тайла
+	responses, err := r.scatter(req, req.URL.Path, r.shardsFor(tileSearchBound(tile)))
+	if err != nil {
+		writeScatterError(w, err)
+		return
+	}
+	data, err := mergeTiles(responses)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", mvtContentType)
+	w.Write(data)
+}
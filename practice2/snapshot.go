@@ -0,0 +1,277 @@
+package practice2
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+// Чекпоинты хранятся как snapshots/checkpoint-<lsn>.ckpt, где lsn — последний LSN Engine, вошедший в снапшот
+const (
+	snapshotPrefix = "checkpoint-"
+	snapshotExt    = ".ckpt"
+	snapshotTmpExt = ".tmp"
+)
+
+// Количество хранимых чекпоинтов по умолчанию
+const DefaultSnapshotRetention = 3
+
+type snapshotFile struct {
+	lsn  uint64
+	path string
+}
+
+// Функция для получения списка чекпоинтов в порядке убывания LSN
+func listSnapshots(dir string) ([]snapshotFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []snapshotFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotExt) {
+			continue
+		}
+		lsn, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, snapshotFile{lsn: lsn, path: filepath.Join(dir, name)})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].lsn > snapshots[j].lsn })
+	return snapshots, nil
+}
+
+// Функция для чтения term последней транзакции из заголовка чекпоинта с данным LSN
+func readSnapshotTerm(dir string, lsn uint64) (uint64, bool) {
+	snapshots, err := listSnapshots(dir)
+	if err != nil {
+		return 0, false
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.lsn != lsn {
+			continue
+		}
+		file, err := os.Open(snapshot.path)
+		if err != nil {
+			return 0, false
+		}
+		defer file.Close()
+		cr, err := NewCheckpointReader(file)
+		if err != nil {
+			return 0, false
+		}
+		return cr.Header.Term, true
+	}
+	return 0, false
+}
+
+// Функция для атомарной записи чекпоинта: данные пишутся во временный файл, который после fsync
+// переименовывается в итоговое имя. При падении на любом шаге предыдущие чекпоинты остаются целыми.
+func writeSnapshot(dir string, lsn uint64, write func(w io.Writer) error) (string, error) {
+	file, err := os.CreateTemp(dir, snapshotPrefix+"*"+snapshotTmpExt)
+	if err != nil {
+		return "", err
+	}
+	tmpPath := file.Name()
+	defer os.Remove(tmpPath) // после успешного rename файла с этим именем уже нет
+
+	if err := write(file); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%s%020d%s", snapshotPrefix, lsn, snapshotExt))
+	if err := os.Rename(tmpPath, path); err != nil {
+		return "", err
+	}
+	return path, syncDir(dir)
+}
+
+// Функция для удаления временных файлов, оставшихся от прерванных чекпоинтов
+func removeTempSnapshots(dir string) error {
+	matches, err := filepath.Glob(filepath.Join(dir, snapshotPrefix+"*"+snapshotTmpExt))
+	if err != nil {
+		return err
+	}
+	for _, path := range matches {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Функция для удаления всех чекпоинтов; реплика, устанавливающая снапшот лидера, отказывается от своей истории
+func removeSnapshots(dir string) error {
+	snapshots, err := listSnapshots(dir)
+	if err != nil {
+		return err
+	}
+	for _, snapshot := range snapshots {
+		if err := os.Remove(snapshot.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return syncDir(dir)
+}
+
+// Функция для удаления чекпоинтов сверх retention. Возвращает LSN самого старого оставшегося чекпоинта:
+// журнал нужен начиная с него, чтобы к любому из оставшихся чекпоинтов можно было откатиться.
+func pruneSnapshots(dir string, retention int) (uint64, error) {
+	snapshots, err := listSnapshots(dir)
+	if err != nil {
+		return 0, err
+	}
+	if len(snapshots) == 0 {
+		return 0, nil
+	}
+	if retention < 1 {
+		retention = 1
+	}
+	for len(snapshots) > retention {
+		last := snapshots[len(snapshots)-1]
+		if err := os.Remove(last.path); err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		snapshots = snapshots[:len(snapshots)-1]
+	}
+	return snapshots[len(snapshots)-1].lsn, syncDir(dir)
+}
+
+// Формат чекпоинта — журнал insert транзакций в записях того же вида, что и WAL:
+// первая запись — CheckpointHeader, затем по одной Transaction на каждый объект.
+// Формат потоковый: чекпоинт можно записывать и применять по одному объекту и передавать по сети.
+const checkpointFormat = "geojson-checkpoint/1"
+
+type CheckpointHeader struct {
+	Format string            `json:"format"`
+	Name   string            `json:"name"`
+	VClock map[string]uint64 `json:"vclock"`
+	// Последний LSN Engine, вошедший в чекпоинт, и term транзакции с этим LSN
+	LSN  uint64 `json:"lsn"`
+	Term uint64 `json:"term,omitempty"`
+	// Количество объектов; позволяет отличить полный чекпоинт от оборванного потока
+	Count int `json:"count"`
+}
+
+type CheckpointWriter struct {
+	w       *bufio.Writer
+	header  CheckpointHeader
+	written int
+}
+
+func NewCheckpointWriter(w io.Writer, header CheckpointHeader) (*CheckpointWriter, error) {
+	header.Format = checkpointFormat
+	cw := &CheckpointWriter{w: bufio.NewWriter(w), header: header}
+	payload, err := json.Marshal(&header)
+	if err != nil {
+		return nil, err
+	}
+	if err := cw.writeFrame(payload); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (cw *CheckpointWriter) writeFrame(payload []byte) error {
+	record, err := encodeFrame(cw.header.LSN, payload)
+	if err != nil {
+		return err
+	}
+	_, err = cw.w.Write(record)
+	return err
+}
+
+// Write записывает объект как insert транзакцию
+func (cw *CheckpointWriter) Write(feature *geojson.Feature) error {
+	if cw.written >= cw.header.Count {
+		return errors.New("количество объектов превышает указанное в заголовке чекпоинта")
+	}
+	payload, err := json.Marshal(&Transaction{
+		Action:  "insert",
+		Name:    cw.header.Name,
+		LSN:     cw.header.LSN,
+		Feature: feature,
+	})
+	if err != nil {
+		return err
+	}
+	if err := cw.writeFrame(payload); err != nil {
+		return err
+	}
+	cw.written++
+	return nil
+}
+
+// Close дописывает буфер; чекпоинт должен содержать ровно Count объектов
+func (cw *CheckpointWriter) Close() error {
+	if cw.written != cw.header.Count {
+		return fmt.Errorf("записано %d объектов из %d", cw.written, cw.header.Count)
+	}
+	return cw.w.Flush()
+}
+
+type CheckpointReader struct {
+	r      *bufio.Reader
+	Header CheckpointHeader
+	read   int
+}
+
+func NewCheckpointReader(r io.Reader) (*CheckpointReader, error) {
+	cr := &CheckpointReader{r: bufio.NewReader(r)}
+	payload, _, err := readFrame(cr.r)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения заголовка чекпоинта: %w", err)
+	}
+	if err := json.Unmarshal(payload, &cr.Header); err != nil {
+		return nil, err
+	}
+	if cr.Header.Format != checkpointFormat {
+		return nil, errors.New("неизвестный формат чекпоинта: " + cr.Header.Format)
+	}
+	if cr.Header.VClock == nil {
+		cr.Header.VClock = make(map[string]uint64)
+	}
+	return cr, nil
+}
+
+// Next возвращает следующую insert транзакцию чекпоинта или io.EOF после последней
+func (cr *CheckpointReader) Next() (*Transaction, error) {
+	if cr.read == cr.Header.Count {
+		return nil, io.EOF
+	}
+	payload, _, err := readFrame(cr.r)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("ошибка чтения объекта %d из %d: %w", cr.read+1, cr.Header.Count, err)
+	}
+	var txn Transaction
+	if err := json.Unmarshal(payload, &txn); err != nil {
+		return nil, err
+	}
+	if txn.Action != "insert" || txn.Feature == nil {
+		return nil, errors.New("чекпоинт должен содержать только insert транзакции")
+	}
+	cr.read++
+	return &txn, nil
+}
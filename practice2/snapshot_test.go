@@ -0,0 +1,214 @@
+package practice2
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// Функция для выполнения команды Engine с ожиданием результата
+func execCommand(t *testing.T, s *Storage, action string, feature *geojson.Feature) {
+	t.Helper()
+	cmd := Command{action: action, feature: feature, result: make(chan error)}
+	s.engine.commands <- cmd
+	if err := <-cmd.result; err != nil {
+		t.Fatalf("%s failed: %v", action, err)
+	}
+}
+
+func newTestFeature(id string, x, y float64) *geojson.Feature {
+	feature := geojson.NewFeature(orb.Point{x, y})
+	feature.ID = id
+	return feature
+}
+
+func searchIDs(t *testing.T, s *Storage) map[string]bool {
+	t.Helper()
+	cmd := Command{
+		action:       "search",
+		boxes:        []orb.Bound{{Min: orb.Point{-180, -90}, Max: orb.Point{180, 90}}},
+		searchResult: make(chan SearchResult),
+	}
+	s.engine.commands <- cmd
+	result := <-cmd.searchResult
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+	ids := make(map[string]bool)
+	for _, feature := range result.Features {
+		ids[feature.ID.(string)] = true
+	}
+	return ids
+}
+
+func TestCheckpointRetention(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStorage(http.NewServeMux(), dir, "storage1", nil, true, WithSnapshotRetention(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	for i, id := range []string{"a", "b", "c"} {
+		execCommand(t, s, "insert", newTestFeature(id, float64(i), 0))
+		execCommand(t, s, "checkpoint", nil)
+	}
+
+	snapshots, err := listSnapshots(filepath.Join(dir, snapshotDirName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 || snapshots[0].lsn != 3 || snapshots[1].lsn != 2 {
+		t.Fatalf("Expected snapshots for LSN 3 and 2, got %v", snapshots)
+	}
+
+	// Журнал хранится только начиная с самого старого оставшегося чекпоинта
+	segments, err := s.engine.wal.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, segment := range segments {
+		if segment.firstLSN < 2 {
+			t.Errorf("WAL segment %s is covered by all snapshots and should be removed", segment.path)
+		}
+	}
+}
+
+func TestCheckpointRollback(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStorage(http.NewServeMux(), dir, "storage1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	execCommand(t, s, "insert", newTestFeature("a", 1, 1))
+	execCommand(t, s, "checkpoint", nil)
+	execCommand(t, s, "insert", newTestFeature("b", 2, 2))
+	execCommand(t, s, "checkpoint", nil)
+	execCommand(t, s, "insert", newTestFeature("c", 3, 3))
+	s.Stop()
+
+	// Портим последний чекпоинт: хранилище должно откатиться к предыдущему и дочитать журнал
+	snapshots, err := listSnapshots(filepath.Join(dir, snapshotDirName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(snapshots[0].path, []byte(`{"data":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewStorage(http.NewServeMux(), dir, "storage1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	ids := searchIDs(t, s)
+	for _, id := range []string{"a", "b", "c"} {
+		if !ids[id] {
+			t.Errorf("Feature %s lost after rollback to previous checkpoint", id)
+		}
+	}
+}
+
+func TestInterruptedCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStorage(http.NewServeMux(), dir, "storage1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	execCommand(t, s, "insert", newTestFeature("a", 1, 1))
+	s.Stop()
+
+	// Недописанный временный файл от упавшего чекпоинта не должен мешать запуску
+	tmp := filepath.Join(dir, snapshotDirName, snapshotPrefix+"12345"+snapshotTmpExt)
+	if err := os.WriteFile(tmp, []byte(`{"da`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewStorage(http.NewServeMux(), dir, "storage1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+	defer s.Stop()
+
+	if !searchIDs(t, s)["a"] {
+		t.Error("Feature lost after interrupted checkpoint")
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Error("Temporary checkpoint file was not removed")
+	}
+}
+
+func TestCheckpointStream(t *testing.T) {
+	var buf bytes.Buffer
+	cw, err := NewCheckpointWriter(&buf, CheckpointHeader{
+		Name:   "storage1",
+		VClock: map[string]uint64{"storage1": 2},
+		LSN:    2,
+		Count:  2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if err := cw.Write(newTestFeature(id, 1, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	cr, err := NewCheckpointReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cr.Header.LSN != 2 || cr.Header.VClock["storage1"] != 2 || cr.Header.Count != 2 {
+		t.Errorf("Unexpected checkpoint header: %+v", cr.Header)
+	}
+	count := 0
+	for {
+		txn, err := cr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if txn.Action != "insert" || txn.Name != "storage1" {
+			t.Errorf("Unexpected checkpoint transaction: %+v", txn)
+		}
+		count++
+	}
+	if count != 2 {
+		t.Errorf("Read %d transactions, expected 2", count)
+	}
+
+	// Оборванный поток не должен приниматься за полный чекпоинт
+	cr, err = NewCheckpointReader(bytes.NewReader(data[:len(data)-3]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		_, err = cr.Next()
+		if err != nil {
+			break
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		t.Error("Truncated checkpoint stream was read without error")
+	}
+}
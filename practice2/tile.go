@@ -0,0 +1,102 @@
+package practice2
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/simplify"
+)
+
+const (
+	mvtContentType = "application/vnd.mapbox-vector-tile"
+	// Имя слоя MVT, в котором отдаются объекты хранилища
+	tileLayer = "features"
+	// Максимальный уровень масштаба тайлов
+	maxTileZoom = 24
+	// Буфер вокруг тайла в единицах extent: геометрии обрезаются с запасом, чтобы на стыках тайлов не было швов
+	tileBuffer = 64
+	// Допуск упрощения геометрий в единицах extent — меньше одного пикселя при отрисовке
+	tileSimplifyTolerance = 1.0
+)
+
+// Функция для разбора координат тайла из пути /tiles/{z}/{x}/{y}.mvt
+func parseTile(z, x, y string) (maptile.Tile, error) {
+	zoom, err := strconv.ParseUint(z, 10, 32)
+	if err != nil || zoom > maxTileZoom {
+		return maptile.Tile{}, errors.New("некорректный уровень масштаба тайла: " + z)
+	}
+	tx, errX := strconv.ParseUint(x, 10, 32)
+	ty, errY := strconv.ParseUint(strings.TrimSuffix(y, ".mvt"), 10, 32)
+	if errX != nil || errY != nil {
+		return maptile.Tile{}, errors.New("некорректные координаты тайла")
+	}
+	tile := maptile.New(uint32(tx), uint32(ty), maptile.Zoom(zoom))
+	if !tile.Valid() {
+		return maptile.Tile{}, errors.New("координаты тайла вне сетки для этого уровня масштаба")
+	}
+	return tile, nil
+}
+
+// Функция для получения прямоугольника запроса к rtree: тайл вместе с буфером, в долготе/широте
+func tileSearchBound(tile maptile.Tile) orb.Bound {
+	return tile.Bound(float64(tileBuffer) / mvt.DefaultExtent)
+}
+
+// encodeTile переводит объекты в координаты тайла, обрезает и упрощает их и кодирует в MVT.
+// Объекты Engine не изменяются: геометрии копируются перед проецированием.
+// MVT поддерживает только целочисленные ID, поэтому строковый ID объекта передаётся в свойстве id.
+func encodeTile(tile maptile.Tile, features []*geojson.Feature) ([]byte, error) {
+	fc := geojson.NewFeatureCollection()
+	for _, feature := range features {
+		props := make(geojson.Properties, len(feature.Properties)+1)
+		for k, v := range feature.Properties {
+			props[k] = v
+		}
+		props["id"] = feature.ID
+		fc.Append(&geojson.Feature{
+			Type:       feature.Type,
+			Geometry:   orb.Clone(feature.Geometry),
+			Properties: props,
+		})
+	}
+
+	layer := mvt.NewLayer(tileLayer, fc)
+	layer.ProjectToTile(tile)
+	layer.Clip(orb.Bound{
+		Min: orb.Point{-tileBuffer, -tileBuffer},
+		Max: orb.Point{mvt.DefaultExtent + tileBuffer, mvt.DefaultExtent + tileBuffer},
+	})
+	layer.Simplify(simplify.DouglasPeucker(tileSimplifyTolerance))
+	layer.RemoveEmpty(tileSimplifyTolerance, tileSimplifyTolerance)
+	return mvt.Marshal(mvt.Layers{layer})
+}
+
+// mergeTiles объединяет тайлы шардов: объекты слоёв с одинаковым именем собираются в один слой.
+// Геометрии уже в координатах тайла, поэтому повторное проецирование не нужно.
+func mergeTiles(tiles [][]byte) ([]byte, error) {
+	var merged mvt.Layers
+	byName := make(map[string]*mvt.Layer)
+	for _, data := range tiles {
+		if len(data) == 0 {
+			continue
+		}
+		layers, err := mvt.Unmarshal(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, layer := range layers {
+			if existing, ok := byName[layer.Name]; ok {
+				existing.Features = append(existing.Features, layer.Features...)
+				continue
+			}
+			byName[layer.Name] = layer
+			merged = append(merged, layer)
+		}
+	}
+	return mvt.Marshal(merged)
+}
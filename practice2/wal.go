@@ -0,0 +1,344 @@
+package practice2
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Durability определяет, когда Engine подтверждает транзакцию клиенту
+type Durability int
+
+const (
+	// DurabilitySync — fsync журнала после каждой транзакции
+	DurabilitySync Durability = iota
+	// DurabilityGroup — один fsync на группу транзакций, накопленных за окно GroupWindow или до GroupBatch штук
+	DurabilityGroup
+	// DurabilityNone — запись в page cache без fsync, транзакция может потеряться при падении ОС
+	DurabilityNone
+)
+
+const walSegmentExt = ".wal"
+
+type WALOptions struct {
+	Durability Durability
+	// Размер сегмента, после которого журнал переключается на новый файл
+	SegmentSize int64
+	// Максимальное время ожидания fsync для группового коммита
+	GroupWindow time.Duration
+	// Количество транзакций, после которого групповой коммит выполняется не дожидаясь окна
+	GroupBatch int
+}
+
+var DefaultWALOptions = WALOptions{
+	Durability:  DurabilitySync,
+	SegmentSize: 64 << 20,
+	GroupWindow: 2 * time.Millisecond,
+	GroupBatch:  128,
+}
+
+// wal — журнал транзакций из последовательности сегментов <firstLSN>.wal.
+// Принадлежит горутине Engine и не защищён от конкурентного доступа.
+type wal struct {
+	dir  string
+	opts WALOptions
+
+	file *os.File
+	buf  *bufio.Writer
+	size int64
+	// LSN последней записи в журнале
+	lastLSN uint64
+	// Количество байт, записанных с момента открытия журнала
+	written int64
+
+	// Обработчики транзакций, ожидающих fsync группового коммита
+	pending []func(err error)
+	timer   *time.Timer
+}
+
+// Функция для открытия журнала. Запись после перезапуска всегда начинается с нового сегмента,
+// поэтому уже существующие сегменты только читаются при воспроизведении.
+func openWAL(dir string, opts WALOptions) (*wal, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	return &wal{dir: dir, opts: opts}, nil
+}
+
+type walSegment struct {
+	firstLSN uint64
+	path     string
+}
+
+// segments возвращает сегменты журнала в порядке возрастания первого LSN
+func (w *wal) segments() ([]walSegment, error) {
+	return listWALSegments(w.dir)
+}
+
+// Функция для получения списка сегментов журнала; не обращается к состоянию wal,
+// поэтому может вызываться вне горутины Engine
+func listWALSegments(dir string) ([]walSegment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []walSegment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, walSegmentExt) {
+			continue
+		}
+		lsn, err := strconv.ParseUint(strings.TrimSuffix(name, walSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, walSegment{firstLSN: lsn, path: filepath.Join(dir, name)})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].firstLSN < segments[j].firstLSN })
+	return segments, nil
+}
+
+func (w *wal) segmentPath(firstLSN uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d%s", firstLSN, walSegmentExt))
+}
+
+func (w *wal) openSegment(path string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.buf = bufio.NewWriter(file)
+	w.size = 0
+	return nil
+}
+
+// append дописывает транзакцию в буфер текущего сегмента, при необходимости создавая новый
+func (w *wal) append(txn *Transaction) error {
+	if w.file == nil {
+		if err := w.openSegment(w.segmentPath(txn.LSN)); err != nil {
+			return err
+		}
+		// Новый файл должен пережить падение вместе со своей записью в директории
+		if err := syncDir(w.dir); err != nil {
+			return err
+		}
+	}
+	record, err := encodeRecord(txn)
+	if err != nil {
+		return err
+	}
+	n, err := w.buf.Write(record)
+	w.size += int64(n)
+	w.written += int64(n)
+	if err == nil {
+		w.lastLSN = txn.LSN
+	}
+	return err
+}
+
+// commit вызывает done, когда транзакции, записанные через append, сохранены в соответствии
+// с уровнем Durability. В режиме группового коммита done вызывается позже, из syncPending,
+// но всегда в горутине Engine и в порядке вызовов commit.
+func (w *wal) commit(done func(err error)) {
+	switch w.opts.Durability {
+	case DurabilityGroup:
+		w.pending = append(w.pending, done)
+		if len(w.pending) >= w.opts.GroupBatch {
+			w.syncPending()
+			return
+		}
+		if w.timer == nil {
+			w.timer = time.NewTimer(w.opts.GroupWindow)
+		}
+	case DurabilityNone:
+		err := w.flush()
+		if err == nil {
+			err = w.rotateIfFull()
+		}
+		done(err)
+	default:
+		err := w.sync()
+		if err == nil {
+			err = w.rotateIfFull()
+		}
+		done(err)
+	}
+}
+
+// groupCommit возвращает канал таймера группового коммита, nil если ожидающих транзакций нет
+func (w *wal) groupCommit() <-chan time.Time {
+	if w.timer == nil {
+		return nil
+	}
+	return w.timer.C
+}
+
+// syncPending выполняет fsync и подтверждает все транзакции, ожидающие группового коммита
+func (w *wal) syncPending() {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	err := w.sync()
+	if err == nil {
+		err = w.rotateIfFull()
+	}
+	// Обработчики могут дописать в журнал новые транзакции, поэтому список забирается заранее
+	pending := w.pending
+	w.pending = nil
+	for _, done := range pending {
+		done(err)
+	}
+}
+
+func (w *wal) flush() error {
+	if w.file == nil {
+		return nil
+	}
+	return w.buf.Flush()
+}
+
+// Вызывается перед fsync журнала; используется тестами, чтобы имитировать ошибку диска
+var walSyncHook func() error
+
+func (w *wal) sync() error {
+	if w.file == nil {
+		return nil
+	}
+	if walSyncHook != nil {
+		if err := walSyncHook(); err != nil {
+			return err
+		}
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// rotateIfFull закрывает заполненный сегмент; следующий append откроет новый
+func (w *wal) rotateIfFull() error {
+	if w.file == nil || w.size < w.opts.SegmentSize {
+		return nil
+	}
+	return w.closeSegment()
+}
+
+func (w *wal) closeSegment() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.sync()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	w.buf = nil
+	w.size = 0
+	return err
+}
+
+// truncate удаляет сегменты, все записи которых не старше lsn, то есть уже сохранены в чекпоинте
+func (w *wal) truncate(lsn uint64) error {
+	if w.file != nil && w.lastLSN <= lsn {
+		w.syncPending()
+		if err := w.closeSegment(); err != nil {
+			return err
+		}
+	}
+	segments, err := w.segments()
+	if err != nil {
+		return err
+	}
+	for i, segment := range segments {
+		// Последний LSN сегмента — это LSN перед началом следующего сегмента
+		covered := w.file == nil && w.lastLSN <= lsn
+		if i+1 < len(segments) {
+			covered = segments[i+1].firstLSN <= lsn+1
+		}
+		if !covered {
+			break
+		}
+		if err := os.Remove(segment.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return syncDir(w.dir)
+}
+
+// replay читает транзакции всех сегментов по порядку.
+// Оборванная запись в конце последнего сегмента отрезается, любое другое повреждение возвращается как *WALCorruptionError.
+func (w *wal) replay(apply func(txn *Transaction)) error {
+	segments, err := w.segments()
+	if err != nil {
+		return err
+	}
+	for i, segment := range segments {
+		w.lastLSN, err = replaySegment(segment.path, i == len(segments)-1, w.lastLSN, apply)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reset удаляет все сегменты журнала. Используется, когда реплика устанавливает снапшот лидера:
+// прежняя история реплики им заменена и не должна воспроизводиться после перезапуска.
+func (w *wal) reset() error {
+	w.syncPending()
+	if err := w.closeSegment(); err != nil {
+		return err
+	}
+	segments, err := w.segments()
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if err := os.Remove(segment.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	w.lastLSN = 0
+	return syncDir(w.dir)
+}
+
+// abandon закрывает текущий сегмент без сброса буфера после ошибки журнала: транзакции,
+// о неудаче которых узнали клиенты, не должны попасть на диск позже. Ожидающие fsync получают err.
+func (w *wal) abandon(err error) {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+		w.buf = nil
+		w.size = 0
+	}
+	pending := w.pending
+	w.pending = nil
+	for _, done := range pending {
+		done(err)
+	}
+}
+
+func (w *wal) close() error {
+	w.syncPending()
+	return w.closeSegment()
+}
+
+// Функция для fsync директории, чтобы создание и удаление файлов пережили падение
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,185 @@
+package practice2
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+func testTransaction(lsn uint64) *Transaction {
+	feature := geojson.NewFeature(orb.Point{float64(lsn), float64(lsn)})
+	feature.ID = "feature"
+	return &Transaction{Action: "insert", Name: "storage1", LSN: lsn, Feature: feature}
+}
+
+func TestWALSegmentRotation(t *testing.T) {
+	dir := t.TempDir()
+	opts := DefaultWALOptions
+	opts.SegmentSize = 256
+	w, err := openWAL(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan error, 1)
+	for lsn := uint64(1); lsn <= 20; lsn++ {
+		if err := w.append(testTransaction(lsn)); err != nil {
+			t.Fatal(err)
+		}
+		w.commit(func(err error) { result <- err })
+		if err := <-result; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := w.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) < 2 {
+		t.Errorf("Expected WAL to rotate into several segments, got %d", len(segments))
+	}
+
+	// Транзакции должны читаться из всех сегментов по порядку
+	w, err = openWAL(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var next uint64 = 1
+	err = w.replay(func(txn *Transaction) {
+		if txn.LSN != next {
+			t.Errorf("Replay returned LSN %d, expected %d", txn.LSN, next)
+		}
+		next++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 21 {
+		t.Errorf("Replay returned %d transactions, expected 20", next-1)
+	}
+}
+
+func TestWALGroupCommit(t *testing.T) {
+	opts := DefaultWALOptions
+	opts.Durability = DurabilityGroup
+	opts.GroupWindow = time.Hour
+	opts.GroupBatch = 3
+	w, err := openWAL(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+
+	results := make([]chan error, 3)
+	for i := range results {
+		results[i] = make(chan error, 1)
+		if err := w.append(testTransaction(uint64(i + 1))); err != nil {
+			t.Fatal(err)
+		}
+		result := results[i]
+		w.commit(func(err error) { result <- err })
+		if i < 2 {
+			// До заполнения группы подтверждений быть не должно
+			select {
+			case <-results[i]:
+				t.Fatalf("Transaction %d acknowledged before group commit", i+1)
+			default:
+			}
+			if w.groupCommit() == nil {
+				t.Fatal("Expected group commit timer to be armed")
+			}
+		}
+	}
+
+	// Третья транзакция заполняет группу и подтверждает все три
+	for i, result := range results {
+		select {
+		case err := <-result:
+			if err != nil {
+				t.Errorf("Transaction %d failed: %v", i+1, err)
+			}
+		default:
+			t.Errorf("Transaction %d was not acknowledged after group commit", i+1)
+		}
+	}
+	if w.groupCommit() != nil {
+		t.Error("Expected group commit timer to be stopped")
+	}
+}
+
+func TestGroupCommitStorage(t *testing.T) {
+	dir := t.TempDir()
+	opts := DefaultWALOptions
+	opts.Durability = DurabilityGroup
+	s, err := NewStorage(http.NewServeMux(), dir, "storage1", nil, true, WithWAL(opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run()
+
+	// Подтверждение должно прийти по таймеру окна группового коммита
+	cmd := Command{action: "insert", feature: testTransaction(1).Feature, result: make(chan error)}
+	s.engine.commands <- cmd
+	select {
+	case err := <-cmd.result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Insert was not acknowledged by group commit")
+	}
+	s.Stop()
+}
+
+func TestWALSyncFailure(t *testing.T) {
+	for _, durability := range []Durability{DurabilitySync, DurabilityGroup} {
+		opts := DefaultWALOptions
+		opts.Durability = durability
+		dir := t.TempDir()
+		s, err := NewStorage(http.NewServeMux(), dir, "storage1", nil, true, WithWAL(opts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Run()
+		execCommand(t, s, "insert", newTestFeature("a", 1, 1))
+
+		// Неудачный fsync: клиент получает ошибку, а объект не появляется в памяти
+		walSyncHook = func() error { return errors.New("disk failure") }
+		cmd := Command{action: "insert", feature: newTestFeature("b", 2, 2), result: make(chan error)}
+		s.engine.commands <- cmd
+		if err := <-cmd.result; err == nil {
+			t.Errorf("Expected insert to fail after fsync error (durability %d)", durability)
+		}
+		walSyncHook = nil
+		if !sameIDs(searchIDs(t, s), "a") {
+			t.Errorf("Feature from failed transaction is visible (durability %d): %v", durability, searchIDs(t, s))
+		}
+
+		// Узел больше не принимает записи, даже когда диск снова работает
+		cmd = Command{action: "delete", feature: newTestFeature("a", 0, 0), result: make(chan error)}
+		s.engine.commands <- cmd
+		if err := <-cmd.result; err == nil {
+			t.Errorf("Expected writes to be rejected after WAL failure (durability %d)", durability)
+		}
+		s.Stop()
+
+		// Транзакция, о неудаче которой узнал клиент, не восстанавливается после перезапуска
+		s, err = NewStorage(http.NewServeMux(), dir, "storage1", nil, true, WithWAL(opts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Run()
+		if !sameIDs(searchIDs(t, s), "a") {
+			t.Errorf("Unexpected features after restart (durability %d): %v", durability, searchIDs(t, s))
+		}
+		s.Stop()
+	}
+}
@@ -0,0 +1,288 @@
+package practice2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+)
+
+// Формат записи журнала (little endian):
+//
+//	length  uint32 — длина payload
+//	crc     uint32 — CRC-32C от lsn и payload
+//	lsn     uint64 — LSN транзакции, нужен для диагностики повреждений
+//	payload []byte — Transaction в JSON
+const (
+	walHeaderSize    = 16
+	walMaxRecordSize = 64 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Признак оборванной записи: процесс упал посреди записи, и хвост сегмента не дописан
+var errTornRecord = errors.New("оборванная запись")
+
+// WALCorruptionError описывает повреждение журнала, которое нельзя объяснить оборванной последней записью
+type WALCorruptionError struct {
+	Segment string
+	Offset  int64
+	// LSN из заголовка повреждённой записи
+	LSN uint64
+	// LSN последней целой записи перед повреждением
+	PrevLSN uint64
+	Err     error
+}
+
+func (e *WALCorruptionError) Error() string {
+	return fmt.Sprintf("повреждена запись журнала LSN %d (после LSN %d) в %s по смещению %d: %v",
+		e.LSN, e.PrevLSN, e.Segment, e.Offset, e.Err)
+}
+
+func (e *WALCorruptionError) Unwrap() error {
+	return e.Err
+}
+
+// Функция для кодирования транзакции в запись журнала
+func encodeRecord(txn *Transaction) ([]byte, error) {
+	payload, err := json.Marshal(txn)
+	if err != nil {
+		return nil, err
+	}
+	return encodeFrame(txn.LSN, payload)
+}
+
+// Функция для упаковки payload в запись с длиной и CRC; тот же формат используется в чекпоинтах
+func encodeFrame(lsn uint64, payload []byte) ([]byte, error) {
+	if len(payload) > walMaxRecordSize {
+		return nil, errors.New("запись превышает максимальный размер")
+	}
+	record := make([]byte, walHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint64(record[8:16], lsn)
+	copy(record[walHeaderSize:], payload)
+	binary.LittleEndian.PutUint32(record[4:8], crc32.Checksum(record[8:], crcTable))
+	return record, nil
+}
+
+// Функция для чтения записи из потока, длина которого заранее неизвестна (чекпоинт, сеть).
+// Возвращает io.EOF, только если поток закончился ровно на границе записи.
+func readFrame(r io.Reader) ([]byte, uint64, error) {
+	var header [walHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, err
+	}
+	length := int64(binary.LittleEndian.Uint32(header[0:4]))
+	crc := binary.LittleEndian.Uint32(header[4:8])
+	lsn := binary.LittleEndian.Uint64(header[8:16])
+	if length == 0 || length > walMaxRecordSize {
+		return nil, lsn, fmt.Errorf("недопустимая длина записи %d", length)
+	}
+
+	record := make([]byte, 8+length)
+	copy(record[:8], header[8:16])
+	if _, err := io.ReadFull(r, record[8:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, lsn, err
+	}
+	if crc32.Checksum(record, crcTable) != crc {
+		return nil, lsn, errors.New("несовпадение CRC")
+	}
+	return record[8:], lsn, nil
+}
+
+// Функция для чтения одной записи; remaining — сколько байт осталось в сегменте от начала записи.
+// Возвращает LSN из заголовка даже при ошибке, если заголовок прочитан.
+func readRecord(r *bufio.Reader, remaining int64) (*Transaction, uint64, int64, error) {
+	if remaining < walHeaderSize {
+		return nil, 0, 0, errTornRecord
+	}
+	var header [walHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, 0, err
+	}
+	length := int64(binary.LittleEndian.Uint32(header[0:4]))
+	crc := binary.LittleEndian.Uint32(header[4:8])
+	lsn := binary.LittleEndian.Uint64(header[8:16])
+
+	if length == 0 {
+		// Файловая система могла выделить блок, но не успеть записать данные — хвост из нулей
+		if crc == 0 && lsn == 0 && zeroTail(r) {
+			return nil, lsn, 0, errTornRecord
+		}
+		return nil, lsn, 0, errors.New("запись нулевой длины")
+	}
+	if length > walMaxRecordSize {
+		return nil, lsn, 0, fmt.Errorf("недопустимая длина записи %d", length)
+	}
+	if walHeaderSize+length > remaining {
+		// Запись не помещается в сегмент: либо она не дописана, либо повреждено поле длины
+		rest, err := io.ReadAll(io.LimitReader(r, remaining-walHeaderSize))
+		if err != nil {
+			return nil, lsn, 0, err
+		}
+		return nil, lsn, 0, tornOrCorrupt(append(header[:], rest...), errors.New("длина записи выходит за конец сегмента"))
+	}
+
+	record := make([]byte, 8+length)
+	copy(record[:8], header[8:16])
+	if _, err := io.ReadFull(r, record[8:]); err != nil {
+		return nil, lsn, 0, err
+	}
+	if crc32.Checksum(record, crcTable) != crc {
+		// Несовпадение CRC в последней записи сегмента — это недописанный сектор, если только
+		// повреждённая длина не захватила следующие целые записи
+		if walHeaderSize+length == remaining {
+			return nil, lsn, 0, tornOrCorrupt(append(header[:8], record...), errors.New("несовпадение CRC"))
+		}
+		return nil, lsn, 0, errors.New("несовпадение CRC")
+	}
+
+	var txn Transaction
+	if err := json.Unmarshal(record[8:], &txn); err != nil {
+		return nil, lsn, 0, err
+	}
+	if txn.LSN != lsn {
+		return nil, lsn, 0, fmt.Errorf("LSN заголовка %d не совпадает с LSN транзакции %d", lsn, txn.LSN)
+	}
+	return &txn, lsn, walHeaderSize + length, nil
+}
+
+// Функция для классификации последней записи сегмента, которую не удалось прочитать. tail — байты
+// от начала записи до конца сегмента. Запись считается оборванной, только если после её начала
+// нет ни одной целой записи: иначе повреждено поле длины в середине журнала, и отрезание хвоста
+// потеряло бы подтверждённые транзакции.
+func tornOrCorrupt(tail []byte, corruption error) error {
+	for i := 1; i+walHeaderSize <= len(tail); i++ {
+		length := int(binary.LittleEndian.Uint32(tail[i : i+4]))
+		if length == 0 || length > len(tail)-i-walHeaderSize {
+			continue
+		}
+		crc := binary.LittleEndian.Uint32(tail[i+4 : i+8])
+		if crc32.Checksum(tail[i+8:i+walHeaderSize+length], crcTable) == crc {
+			return fmt.Errorf("%w; по смещению +%d есть целая запись", corruption, i)
+		}
+	}
+	return errTornRecord
+}
+
+// Функция для проверки, что до конца сегмента остались только нули
+func zeroTail(r *bufio.Reader) bool {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if !bytes.Equal(buf[:n], make([]byte, n)) {
+			return false
+		}
+		if err != nil {
+			return errors.Is(err, io.EOF)
+		}
+	}
+}
+
+// Функция для воспроизведения сегмента. В последнем сегменте оборванная запись и всё после неё отрезаются.
+// Возвращает LSN последней применённой записи.
+func replaySegment(path string, last bool, prevLSN uint64, apply func(txn *Transaction)) (uint64, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return prevLSN, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return prevLSN, err
+	}
+	size := info.Size()
+
+	r := bufio.NewReader(file)
+	var offset int64
+	for offset < size {
+		txn, lsn, n, err := readRecord(r, size-offset)
+		if err == nil {
+			apply(txn)
+			prevLSN = txn.LSN
+			offset += n
+			continue
+		}
+		if errors.Is(err, errTornRecord) && last {
+			log.Printf("Обрезаем оборванную запись журнала в %s по смещению %d (после LSN %d)", path, offset, prevLSN)
+			if err := file.Truncate(offset); err != nil {
+				return prevLSN, err
+			}
+			return prevLSN, file.Sync()
+		}
+		return prevLSN, &WALCorruptionError{Segment: path, Offset: offset, LSN: lsn, PrevLSN: prevLSN, Err: err}
+	}
+	return prevLSN, nil
+}
+
+// readWALRange читает из сегментов журнала транзакции с LSN в диапазоне (from, to] и передаёт их в send.
+// Выполняется вне горутины Engine: журнал открывается только на чтение, а записи до to к моменту
+// вызова уже сброшены на диск. Сегмент, удалённый чекпоинтом во время чтения, возвращается как ошибка.
+func readWALRange(dir string, from, to uint64, send func(txn *Transaction) error) error {
+	segments, err := listWALSegments(dir)
+	if err != nil {
+		return err
+	}
+	next := from + 1
+	for i, segment := range segments {
+		// Сегмент целиком до from: следующий начинается не позже from+1
+		if i+1 < len(segments) && segments[i+1].firstLSN <= next {
+			continue
+		}
+		if segment.firstLSN > next {
+			return fmt.Errorf("в журнале нет транзакций с LSN %d по %d", next, segment.firstLSN-1)
+		}
+		if next, err = readSegmentRange(segment.path, next, to, send); err != nil {
+			return err
+		}
+		if next > to {
+			return nil
+		}
+	}
+	if next <= to {
+		return fmt.Errorf("в журнале нет транзакций с LSN %d по %d", next, to)
+	}
+	return nil
+}
+
+// Функция для чтения транзакций сегмента с LSN от next до to; возвращает следующий ожидаемый LSN
+func readSegmentRange(path string, next, to uint64, send func(txn *Transaction) error) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return next, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return next, err
+	}
+	size := info.Size()
+
+	r := bufio.NewReader(file)
+	var offset int64
+	for offset < size && next <= to {
+		txn, lsn, n, err := readRecord(r, size-offset)
+		if err != nil {
+			return next, &WALCorruptionError{Segment: path, Offset: offset, LSN: lsn, PrevLSN: next - 1, Err: err}
+		}
+		offset += n
+		if txn.LSN < next {
+			continue
+		}
+		if err := send(txn); err != nil {
+			return next, err
+		}
+		next = txn.LSN + 1
+	}
+	return next, nil
+}
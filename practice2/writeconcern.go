@@ -0,0 +1,221 @@
+package practice2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WriteConcern определяет, подтверждения скольких реплик лидер ждёт перед ответом клиенту.
+// Локальная запись в журнал всегда выполняется с уровнем durability журнала.
+type WriteConcern int
+
+const (
+	// WriteConcernAsync — ответ после записи в журнал лидера, реплики получают транзакцию позже
+	WriteConcernAsync WriteConcern = iota
+	// WriteConcernOne — ответ после подтверждения хотя бы одной реплики
+	WriteConcernOne
+	// WriteConcernMajority — ответ после записи на большинство узлов репликасета, включая лидера
+	WriteConcernMajority
+)
+
+// Время ожидания подтверждений реплик по умолчанию
+const DefaultWriteConcernTimeout = 5 * time.Second
+
+// ErrWriteConcernTimeout возвращается, если реплики не подтвердили транзакцию за отведённое время.
+// Транзакция при этом уже записана на лидере и будет доставлена репликам позже.
+var ErrWriteConcernTimeout = errors.New("транзакция записана на лидере, но не подтверждена репликами за отведённое время")
+
+// ErrNotEnoughReplicas возвращается до записи транзакции, если подключённых реплик меньше,
+// чем подтверждений требует writeConcern: такая транзакция заведомо не дождалась бы подтверждения.
+var ErrNotEnoughReplicas = errors.New("подключено недостаточно реплик для writeConcern, транзакция не записана")
+
+// Функция для разбора параметра writeConcern=async|one|majority
+func parseWriteConcern(raw string) (WriteConcern, error) {
+	switch raw {
+	case "async":
+		return WriteConcernAsync, nil
+	case "one":
+		return WriteConcernOne, nil
+	case "majority":
+		return WriteConcernMajority, nil
+	}
+	return 0, errors.New("неизвестный writeConcern: " + raw)
+}
+
+// Функция для получения уровня подтверждения из параметра запроса; nil — уровень хранилища
+func requestWriteConcern(r *http.Request) (*WriteConcern, error) {
+	raw := r.URL.Query().Get("writeConcern")
+	if raw == "" {
+		return nil, nil
+	}
+	concern, err := parseWriteConcern(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &concern, nil
+}
+
+// WithWriteConcern задаёт уровень подтверждения записи по умолчанию и время ожидания реплик.
+// Запрос может переопределить уровень параметром writeConcern.
+func WithWriteConcern(concern WriteConcern, timeout time.Duration) Option {
+	return func(e *Engine) {
+		e.writeConcern = concern
+		e.writeTimeout = timeout
+	}
+}
+
+// ReplicationAck — сообщение реплики лидеру: транзакции до LSN включительно применены и записаны в журнал
+type ReplicationAck struct {
+	LSN uint64 `json:"lsn"`
+}
+
+// concernWaiter — транзакция, ответ на которую ждёт подтверждений реплик
+type concernWaiter struct {
+	lsn      uint64
+	acks     int
+	result   chan error
+	deadline time.Time
+}
+
+// Функция для получения количества реплик, подтверждение которых требуется для команды.
+// Размер репликасета — лидер и узлы из списка replicas; majority считается по нему, а не по
+// подключённым репликам. Требование не превышает числа реплик: лидеру без реплик writeConcern=one
+// не у кого ждать подтверждения, и запись на нём — запись на весь репликасет.
+func (e *Engine) requiredAcks(cmd Command) int {
+	concern := e.writeConcern
+	if cmd.writeConcern != nil {
+		concern = *cmd.writeConcern
+	}
+	switch concern {
+	case WriteConcernOne:
+		return min(1, len(e.replicas))
+	case WriteConcernMajority:
+		return (len(e.replicas) + 1) / 2
+	}
+	return 0
+}
+
+// checkReplicas отклоняет команду до записи, если подключённых реплик не хватает для её writeConcern
+func (e *Engine) checkReplicas(cmd Command) error {
+	required, live := e.requiredAcks(cmd), e.liveFollowers()
+	if required > live {
+		return fmt.Errorf("%w: нужно подтверждений %d, подключено реплик %d", ErrNotEnoughReplicas, required, live)
+	}
+	return nil
+}
+
+// Функция для подсчёта подключённых реплик; разорванные соединения удаляются из followers при следующей рассылке
+func (e *Engine) liveFollowers() int {
+	n := 0
+	for session := range e.followers {
+		select {
+		case <-session.done:
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// commit отвечает на транзакцию лидера с LSN lsn, уже сохранённую в журнале: сразу
+// либо после подтверждения нужного количества реплик
+func (e *Engine) commit(cmd Command, lsn uint64) {
+	acks := e.requiredAcks(cmd)
+	if acks == 0 {
+		cmd.result <- nil
+		return
+	}
+	e.concernWaiters = append(e.concernWaiters, &concernWaiter{
+		lsn:      lsn,
+		acks:     acks,
+		result:   cmd.result,
+		deadline: time.Now().Add(e.writeTimeout),
+	})
+}
+
+// handleReplicaAck запоминает подтверждение по имени реплики, а не по соединению: сессия могла
+// быть закрыта за переполнение очереди или разрыв, но подтверждённые транзакции реплика уже записала
+func (e *Engine) handleReplicaAck(cmd Command) {
+	if !e.leader {
+		return
+	}
+	e.recordAck(cmd.replica.name, cmd.ackLSN)
+}
+
+func (e *Engine) recordAck(name string, lsn uint64) {
+	if lsn > e.replicaAcks[name] {
+		e.replicaAcks[name] = lsn
+	}
+}
+
+// checkWriteConcern отвечает на транзакции, получившие нужные подтверждения или не дождавшиеся их.
+// Вызывается в горутине Engine после каждой команды, группового коммита и срабатывания таймера.
+func (e *Engine) checkWriteConcern() {
+	if len(e.concernWaiters) == 0 {
+		return
+	}
+	now := time.Now()
+	var next time.Time
+	waiting := e.concernWaiters[:0]
+	for _, waiter := range e.concernWaiters {
+		if e.ackedBy(waiter.lsn) >= waiter.acks {
+			waiter.result <- nil
+			continue
+		}
+		if !now.Before(waiter.deadline) {
+			waiter.result <- ErrWriteConcernTimeout
+			continue
+		}
+		if next.IsZero() || waiter.deadline.Before(next) {
+			next = waiter.deadline
+		}
+		waiting = append(waiting, waiter)
+	}
+	clear(e.concernWaiters[len(waiting):])
+	e.concernWaiters = waiting
+
+	// Таймер переустанавливается, только когда меняется ближайший срок, а не на каждое подтверждение
+	if e.concernTimer != nil && next.Equal(e.concernDeadline) {
+		return
+	}
+	if e.concernTimer != nil {
+		e.concernTimer.Stop()
+		e.concernTimer = nil
+	}
+	e.concernDeadline = next
+	if !next.IsZero() {
+		e.concernTimer = time.NewTimer(time.Until(next))
+	}
+}
+
+// Функция для подсчёта реплик, подтвердивших транзакцию с LSN lsn, включая отключившиеся после подтверждения
+func (e *Engine) ackedBy(lsn uint64) int {
+	n := 0
+	for _, acked := range e.replicaAcks {
+		if acked >= lsn {
+			n++
+		}
+	}
+	return n
+}
+
+func (e *Engine) concernTimeout() <-chan time.Time {
+	if e.concernTimer == nil {
+		return nil
+	}
+	return e.concernTimer.C
+}
+
+// failWriteConcern отвечает ошибкой всем ожидающим транзакциям при остановке Engine
+func (e *Engine) failWriteConcern(err error) {
+	for _, waiter := range e.concernWaiters {
+		waiter.result <- err
+	}
+	e.concernWaiters = nil
+	if e.concernTimer != nil {
+		e.concernTimer.Stop()
+		e.concernTimer = nil
+	}
+}